@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+	"github.com/lessucettes/adresu-plugin/internal/strfry"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+)
+
+// banSource is recorded as the source of bans issued from the command line.
+const banSource = "cli"
+
+// The ban commands open the configured database directly, so with the badger
+// driver the plugin must be stopped before adding or removing bans; listing
+// them reads a snapshot while it runs. SQLite and Redis stores can be shared
+// with a running plugin.
+
+// runBans implements "adresu-plugin bans add|remove|list". The former
+// "ban", "unban" and "list-bans" commands remain as aliases.
+func runBans(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: adresu-plugin bans add|remove|list [flags]")
+	}
+	switch args[0] {
+	case "add":
+		return runBan(args[1:])
+	case "remove":
+		return runUnban(args[1:])
+	case "list":
+		return runListBans(args[1:])
+	default:
+		return fmt.Errorf("unknown bans command %q", args[0])
+	}
+}
+
+// banAddOptions are the flags of "adresu-plugin bans add".
+type banAddOptions struct {
+	configPath   string
+	duration     time.Duration
+	reason       string
+	deleteEvents bool
+}
+
+func (o *banAddOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("bans add")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Path to the configuration file.")
+	fs.DurationVar(&o.duration, "duration", 0, "How long the ban lasts (default policy.ban_duration).")
+	fs.StringVar(&o.reason, "reason", "manual", "Reason recorded with the ban.")
+	fs.BoolVar(&o.deleteEvents, "delete-events", true, "Delete the pubkey's events from strfry.")
+	return fs
+}
+
+// runBan implements "adresu-plugin bans add <pubkey>": banning a pubkey
+// and, like a moderator ban, deleting its events from strfry.
+func runBan(args []string) error {
+	var opts banAddOptions
+	pubkey, err := pubkeyArg(opts.flagSet(), args, "usage: adresu-plugin bans add <pubkey> [-duration 720h] [-reason text] [-delete-events=false]")
+	if err != nil {
+		return err
+	}
+
+	cfg, db, err := openConfiguredStore(opts.configPath, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if opts.duration <= 0 {
+		opts.duration = cfg.Policy.BanDuration
+	}
+
+	ctx := context.Background()
+	if err := db.BanAuthor(ctx, pubkey, opts.duration, store.BanInfo{Reason: opts.reason, Source: banSource}); err != nil {
+		return err
+	}
+	fmt.Printf("%s banned until %s\n", pubkey, time.Now().Add(opts.duration).Format(time.RFC3339))
+
+	if opts.deleteEvents {
+		// Journaled, so a failed deletion is retried when the plugin starts.
+		action, err := db.JournalAction(ctx, store.Action{Type: store.ActionDeleteEvents, PubKey: pubkey})
+		if err != nil {
+			return fmt.Errorf("failed to journal event deletion: %w", err)
+		}
+		sf := strfry.NewClient(cfg.Strfry.ExecutablePath, cfg.Strfry.ConfigPath)
+		if err := sf.DeleteEventsByAuthor(pubkey); err != nil {
+			return fmt.Errorf("failed to delete events (the plugin retries on its next start): %w", err)
+		}
+		if err := db.CompleteAction(ctx, action.ID); err != nil {
+			return err
+		}
+		fmt.Println("Deleted its events from strfry.")
+	}
+	return nil
+}
+
+// runUnban implements "adresu-plugin bans remove <pubkey>". Like a moderator
+// unban, it also lifts the pubkey's kind restrictions.
+func runUnban(args []string) error {
+	var opts configOptions
+	pubkey, err := pubkeyArg(opts.flagSet("bans remove"), args, "usage: adresu-plugin bans remove <pubkey>")
+	if err != nil {
+		return err
+	}
+
+	_, db, err := openConfiguredStore(opts.configPath, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := db.UnbanAuthor(ctx, pubkey); err != nil {
+		return err
+	}
+	if err := db.LiftRestrictions(ctx, pubkey, nil); err != nil {
+		return err
+	}
+	fmt.Printf("%s unbanned\n", pubkey)
+	return nil
+}
+
+// runListBans implements "adresu-plugin bans list".
+func runListBans(args []string) error {
+	var opts configOptions
+	opts.flagSet("bans list").Parse(args)
+
+	_, db, err := openConfiguredStore(opts.configPath, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	records, err := db.Authors(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	banned := 0
+	for _, r := range records {
+		if !r.BannedUntil.After(now) {
+			continue
+		}
+		info, err := db.GetBanInfo(ctx, r.PubKey)
+		if err != nil {
+			return err
+		}
+		if info == nil {
+			continue // Expired meanwhile.
+		}
+		banned++
+		fmt.Printf("%s until %s", r.PubKey, info.ExpiresAt.Format(time.RFC3339))
+		if !info.CreatedAt.IsZero() {
+			fmt.Printf(" since %s", info.CreatedAt.Format(time.RFC3339))
+		}
+		if info.Source != "" {
+			fmt.Printf(" by %s", info.Source)
+		}
+		if info.Reason != "" {
+			fmt.Printf(": %s", info.Reason)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%d banned pubkeys\n", banned)
+	return nil
+}
+
+// pubkeyArg parses args, with flags before or after the single pubkey
+// argument, and returns the pubkey in hex.
+func pubkeyArg(fs *flag.FlagSet, args []string, usage string) (string, error) {
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return "", errors.New(usage)
+	}
+	arg := fs.Arg(0)
+	fs.Parse(fs.Args()[1:])
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("unexpected argument %q; %s", fs.Arg(0), usage)
+	}
+	pubkey, err := nip.NormalizePubKey(arg)
+	if err != nil {
+		return "", fmt.Errorf("invalid pubkey %q: %w", arg, err)
+	}
+	return pubkey, nil
+}
+
+// openConfiguredStore loads the configuration and opens its store, with
+// readOnly as store.OpenReadOnly does.
+func openConfiguredStore(configPath string, readOnly bool) (*config.Config, store.Store, error) {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	cfg, _, err := config.Load(configPath, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	open := store.Open
+	if readOnly {
+		open = store.OpenReadOnly
+	}
+	db, err := open(&cfg.DB)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, db, nil
+}
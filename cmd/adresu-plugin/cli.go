@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// command is one "adresu-plugin <name>" subcommand.
+type command struct {
+	name    string
+	summary string
+	// args describes the arguments after the name in usage lines.
+	args string
+	// subcommands are offered by shell completion after the name.
+	subcommands []string
+	run         func(args []string) error
+	// flags builds the flag set of the command, keyed by subcommand or by ""
+	// for a command without subcommands, for help and shell completion.
+	flags map[string]func() *flag.FlagSet
+	// hidden commands are kept for compatibility but not listed.
+	hidden bool
+}
+
+// commands is the command tree. Without a command, the binary runs as the
+// plugin, as strfry invokes it with flags only.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "run", summary: "Serve strfry write policy requests on stdin/stdout (the default)", run: runPlugin,
+			flags: map[string]func() *flag.FlagSet{"": new(runOptions).flagSet}},
+		{name: "validate", summary: "Validate the configuration file", run: runValidate,
+			flags: map[string]func() *flag.FlagSet{"": configFlags("validate")}},
+		{name: "bans", summary: "Ban, unban and list pubkeys in the database", args: "add|remove|list", subcommands: []string{"add", "remove", "list"}, run: runBans,
+			flags: map[string]func() *flag.FlagSet{"add": new(banAddOptions).flagSet, "remove": configFlags("bans remove"), "list": configFlags("bans list")}},
+		{name: "db", summary: "Check the database", args: "check", subcommands: []string{"check"}, run: runDB,
+			flags: map[string]func() *flag.FlagSet{"check": new(dbCheckOptions).flagSet}},
+		{name: "simulate", summary: "Replay policy inputs through a scratch pipeline and print the decisions", run: runSimulate,
+			flags: map[string]func() *flag.FlagSet{"": new(simulateOptions).flagSet}},
+		{name: "explain", summary: "Show how every filter judges one event", run: runExplain,
+			flags: map[string]func() *flag.FlagSet{"": new(explainOptions).flagSet}},
+		{name: "gen-events", summary: "Write synthetic policy inputs for simulate, golden or load tests", run: runGenEvents,
+			flags: map[string]func() *flag.FlagSet{"": new(genEventsOptions).flagSet}},
+		{name: "stats", summary: "Summarize recent decisions of the running plugin", run: runStats,
+			flags: map[string]func() *flag.FlagSet{"": new(statsOptions).flagSet}},
+		{name: "golden", summary: "Capture or verify golden decisions for a corpus", args: "capture|verify", subcommands: []string{"capture", "verify"}, run: runGolden,
+			flags: map[string]func() *flag.FlagSet{
+				"capture": func() *flag.FlagSet { return new(goldenOptions).flagSet("capture") },
+				"verify":  func() *flag.FlagSet { return new(goldenOptions).flagSet("verify") },
+			}},
+		{name: "loadtest", summary: "Measure decision latency and memory under synthetic load", run: runLoadTest,
+			flags: map[string]func() *flag.FlagSet{"": new(loadTestOptions).flagSet}},
+		{name: "tune", summary: "Suggest configuration changes from the plugin's log", run: runTune,
+			flags: map[string]func() *flag.FlagSet{"": new(tuneOptions).flagSet}},
+		{name: "prime", summary: "Seed behavioral filters from the relay's recent events", run: runPrime,
+			flags: map[string]func() *flag.FlagSet{"": new(primeOptions).flagSet}},
+		{name: "restrict", summary: "Manage kind restrictions through the admin API", args: "list|add|lift", subcommands: []string{"list", "add", "lift"}, run: runRestrict,
+			flags: map[string]func() *flag.FlagSet{
+				"list": func() *flag.FlagSet { return new(restrictOptions).flagSet("list") },
+				"add":  func() *flag.FlagSet { return new(restrictOptions).flagSet("add") },
+				"lift": func() *flag.FlagSet { return new(restrictOptions).flagSet("lift") },
+			}},
+		{name: "reputation", summary: "Export or import signed ban summaries", args: "export|import", subcommands: []string{"export", "import"}, run: runReputation,
+			flags: map[string]func() *flag.FlagSet{"export": new(reputationExportOptions).flagSet, "import": new(reputationImportOptions).flagSet}},
+		{name: "pack", summary: "Sign or verify rule packs", args: "sign|verify", subcommands: []string{"sign", "verify"}, run: runPack,
+			flags: map[string]func() *flag.FlagSet{"sign": new(packSignOptions).flagSet, "verify": new(packVerifyOptions).flagSet}},
+		{name: "completion", summary: "Print a shell completion script", args: "bash|zsh|fish", subcommands: []string{"bash", "zsh", "fish"}, run: runCompletion},
+		{name: "version", summary: "Print the plugin version", run: func([]string) error { fmt.Println(version); return nil }},
+		{name: "help", summary: "Show help for a command", args: "[command]", run: runHelp},
+		{name: "ban", run: runBan, hidden: true,
+			flags: map[string]func() *flag.FlagSet{"": new(banAddOptions).flagSet}},
+		{name: "unban", run: runUnban, hidden: true,
+			flags: map[string]func() *flag.FlagSet{"": configFlags("bans remove")}},
+		{name: "list-bans", run: runListBans, hidden: true,
+			flags: map[string]func() *flag.FlagSet{"": configFlags("bans list")}},
+		{name: "__complete", run: runComplete, hidden: true},
+	}
+}
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func main() {
+	args := os.Args[1:]
+	name := "run"
+	if len(args) > 0 {
+		switch {
+		case isHelpFlag(args[0]):
+			printHelp(os.Stdout)
+			return
+		case !strings.HasPrefix(args[0], "-"):
+			name, args = args[0], args[1:]
+		}
+	}
+
+	cmd := lookupCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q for \"adresu-plugin\"\nRun 'adresu-plugin --help' for usage.\n", name)
+		os.Exit(2)
+	}
+	if len(cmd.subcommands) > 0 && len(args) > 0 && isHelpFlag(args[0]) {
+		printCommandUsage(os.Stdout, cmd.name, nil)
+		return
+	}
+	if err := cmd.run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// printHelp lists the commands.
+func printHelp(w io.Writer) {
+	fmt.Fprint(w, "Adresu Plugin is a write policy plugin for the strfry Nostr relay and a toolbox for its operators.\n\n")
+	fmt.Fprint(w, "Usage:\n  adresu-plugin [flags]\n  adresu-plugin [command]\n\nAvailable Commands:\n")
+	for _, c := range commands {
+		if !c.hidden {
+			fmt.Fprintf(w, "  %-12s %s\n", c.name, c.summary)
+		}
+	}
+	fmt.Fprint(w, "\nFlags:\n  -h, --help   help for adresu-plugin\n\n")
+	fmt.Fprint(w, "Without a command, the flags of \"run\" apply.\n")
+	fmt.Fprint(w, "Use \"adresu-plugin [command] --help\" for more information about a command.\n")
+}
+
+// runHelp implements "adresu-plugin help [command]".
+func runHelp(args []string) error {
+	if len(args) == 0 {
+		printHelp(os.Stdout)
+		return nil
+	}
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	var fs *flag.FlagSet
+	if build := cmd.flags[""]; build != nil {
+		fs = build()
+	}
+	printCommandUsage(os.Stdout, cmd.name, fs)
+	return nil
+}
+
+// printCommandUsage prints the help of the command at path, with the flags
+// of fs if it has any.
+func printCommandUsage(w io.Writer, path string, fs *flag.FlagSet) {
+	name, _, nested := strings.Cut(path, " ")
+	cmd := lookupCommand(name)
+	if cmd != nil && cmd.summary != "" && !nested {
+		fmt.Fprintf(w, "%s\n\n", cmd.summary)
+	}
+	fmt.Fprintf(w, "Usage:\n  adresu-plugin %s", path)
+	if cmd != nil && cmd.args != "" && !nested {
+		fmt.Fprintf(w, " %s", cmd.args)
+	}
+	hasFlags := false
+	if fs != nil {
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	}
+	if hasFlags {
+		fmt.Fprint(w, " [flags]\n\nFlags:\n")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	} else {
+		fmt.Fprintln(w)
+	}
+}
+
+// newFlagSet creates the flag set of the command at path, e.g. "bans add",
+// with cobra-style help on -h and --help.
+func newFlagSet(path string) *flag.FlagSet {
+	fs := flag.NewFlagSet(path, flag.ExitOnError)
+	fs.Usage = func() {
+		printCommandUsage(fs.Output(), path, fs)
+	}
+	return fs
+}
+
+// configOptions are the flags of commands that only take the configuration.
+type configOptions struct {
+	configPath string
+}
+
+func (o *configOptions) flagSet(path string) *flag.FlagSet {
+	fs := newFlagSet(path)
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Path to the configuration file.")
+	return fs
+}
+
+// configFlags returns a builder of the configOptions flag set at path.
+func configFlags(path string) func() *flag.FlagSet {
+	return func() *flag.FlagSet { return new(configOptions).flagSet(path) }
+}
+
+// runComplete implements the hidden "adresu-plugin __complete <words...>",
+// which the completion scripts call with the words before the cursor and the
+// word being completed, printing one candidate per line.
+func runComplete(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	words, current := args[:len(args)-1], args[len(args)-1]
+	var candidates []string
+	switch {
+	case len(words) == 0 && !strings.HasPrefix(current, "-"):
+		for _, c := range commands {
+			if !c.hidden {
+				candidates = append(candidates, c.name)
+			}
+		}
+	case strings.HasPrefix(current, "-"):
+		path := []string{"run"}
+		if len(words) > 0 {
+			path = words[:1]
+			if cmd := lookupCommand(words[0]); cmd != nil && len(words) > 1 && slices.Contains(cmd.subcommands, words[1]) {
+				path = words[:2]
+			}
+		}
+		candidates = commandFlags(path)
+	case len(words) == 1:
+		if cmd := lookupCommand(words[0]); cmd != nil {
+			candidates = cmd.subcommands
+		}
+	}
+	for _, c := range candidates {
+		if strings.HasPrefix(c, current) {
+			fmt.Println(c)
+		}
+	}
+	return nil
+}
+
+// commandFlags returns the flags of the command at path.
+func commandFlags(path []string) []string {
+	cmd := lookupCommand(path[0])
+	if cmd == nil {
+		return nil
+	}
+	var sub string
+	if len(path) > 1 {
+		sub = path[1]
+	}
+	build := cmd.flags[sub]
+	if build == nil {
+		return nil
+	}
+	var flags []string
+	build().VisitAll(func(f *flag.Flag) { flags = append(flags, "-"+f.Name) })
+	return flags
+}
+
+const bashCompletion = `# bash completion for adresu-plugin
+_adresu_plugin() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	local IFS=$'\n'
+	COMPREPLY=($(compgen -W "$("${COMP_WORDS[0]}" __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)" -- "$cur"))
+}
+complete -o default -F _adresu_plugin adresu-plugin
+`
+
+const zshCompletion = `#compdef adresu-plugin
+# zsh completion for adresu-plugin
+_adresu_plugin() {
+	local -a candidates
+	candidates=("${(@f)$(${words[1]} __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -n "${candidates[1]}" ]]; then
+		compadd -- "${candidates[@]}"
+	else
+		_files
+	fi
+}
+compdef _adresu_plugin adresu-plugin
+`
+
+const fishCompletion = `# fish completion for adresu-plugin
+complete -c adresu-plugin -a '(adresu-plugin __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`
+
+// runCompletion implements "adresu-plugin completion bash|zsh|fish".
+func runCompletion(args []string) error {
+	usage := `usage: adresu-plugin completion bash|zsh|fish
+
+To load completions in the current shell:
+  bash: source <(adresu-plugin completion bash)
+  zsh:  source <(adresu-plugin completion zsh)
+  fish: adresu-plugin completion fish | source`
+	if len(args) != 1 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		return fmt.Errorf("unsupported shell %q; %s", args[0], usage)
+	}
+	return nil
+}
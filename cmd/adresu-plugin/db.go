@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+// runDB implements "adresu-plugin db <command>".
+func runDB(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: adresu-plugin db check [-config path] [-checksums]")
+	}
+	switch args[0] {
+	case "check":
+		return runDBCheck(args[1:])
+	default:
+		return fmt.Errorf("unknown db command %q", args[0])
+	}
+}
+
+// dbCheckOptions are the flags of "adresu-plugin db check".
+type dbCheckOptions struct {
+	configPath string
+	checksums  bool
+}
+
+func (o *dbCheckOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("db check")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Path to the configuration file.")
+	fs.BoolVar(&o.checksums, "checksums", false, "Also verify checksums of all tables (reads the whole database).")
+	return fs
+}
+
+func runDBCheck(args []string) error {
+	var opts dbCheckOptions
+	opts.flagSet().Parse(args)
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	cfg, _, err := config.Load(opts.configPath, false)
+	if err != nil {
+		return err
+	}
+
+	if cfg.DB.Driver != config.DBBadger {
+		return fmt.Errorf("db check only supports the badger driver, not %q", cfg.DB.Driver)
+	}
+	// Read-only, so that the database can be checked while the plugin runs.
+	db, err := store.NewBadgerReadOnlyStore(&cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	fmt.Printf("Checking database: %s\n", cfg.DB.Path)
+	report, err := db.Check(context.Background(), opts.checksums)
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range slices.Sorted(maps.Keys(report.KeysByPrefix)) {
+		fmt.Printf("  %-10s %d keys\n", prefix, report.KeysByPrefix[prefix])
+	}
+	fmt.Printf("  unknown    %d keys\n", report.UnknownKeys)
+	for _, key := range report.InvalidKeys {
+		fmt.Printf("  invalid key: %q\n", key)
+	}
+	if len(report.InvalidKeys) > 0 {
+		return fmt.Errorf("found %d invalid keys", len(report.InvalidKeys))
+	}
+	fmt.Println("Database is OK.")
+	return nil
+}
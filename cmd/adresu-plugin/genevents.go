@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// genEventsOptions are the flags of "adresu-plugin gen-events".
+type genEventsOptions struct {
+	count   int
+	authors int
+	kinds   string
+	out     string
+}
+
+func (o *genEventsOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("gen-events")
+	fs.IntVar(&o.count, "count", 1000, "Number of events to write.")
+	fs.IntVar(&o.authors, "authors", 100, "Number of distinct synthetic pubkeys.")
+	fs.StringVar(&o.kinds, "kinds", "1,1,1,7,6", "Comma-separated kinds to draw from; repeat a kind to weight it.")
+	fs.StringVar(&o.out, "out", "", "Write to this file instead of stdout.")
+	return fs
+}
+
+// runGenEvents implements "adresu-plugin gen-events": writing synthetic
+// strfry policy inputs, the same traffic loadtest generates, as a corpus for
+// simulate, golden or other tools.
+func runGenEvents(args []string) error {
+	var opts genEventsOptions
+	opts.flagSet().Parse(args)
+
+	if opts.count <= 0 || opts.authors <= 0 {
+		return errors.New("count and authors must be positive")
+	}
+	var kinds []int
+	for field := range strings.SplitSeq(opts.kinds, ",") {
+		kind, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return fmt.Errorf("invalid kind %q in -kinds", field)
+		}
+		kinds = append(kinds, kind)
+	}
+
+	pubkeys := make([]string, opts.authors)
+	for i := range pubkeys {
+		pk, err := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+		if err != nil {
+			return fmt.Errorf("failed to generate synthetic author: %w", err)
+		}
+		pubkeys[i] = pk
+	}
+
+	var w io.Writer = os.Stdout
+	if opts.out != "" {
+		f, err := os.Create(opts.out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	for range opts.count {
+		ev := syntheticEvent(pubkeys[rand.IntN(len(pubkeys))], kinds[rand.IntN(len(kinds))])
+		if err := encoder.Encode(PolicyInput{Type: "new", Event: ev, SourceType: "IP4", SourceInfo: syntheticIP()}); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if opts.out != "" {
+		fmt.Fprintf(os.Stderr, "Wrote %d events from %d authors to %s\n", opts.count, opts.authors, opts.out)
+	}
+	return nil
+}
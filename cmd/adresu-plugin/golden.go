@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/pipeline"
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+// goldenDecision is one line of a golden file.
+type goldenDecision struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	Msg    string `json:"msg,omitempty"`
+}
+
+// goldenOptions are the flags of "adresu-plugin golden capture|verify".
+type goldenOptions struct {
+	configPath string
+	eventsPath string
+	goldenPath string
+	rebaseTime bool
+}
+
+func (o *goldenOptions) flagSet(command string) *flag.FlagSet {
+	fs := newFlagSet("golden " + command)
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Configuration file to replay the corpus with.")
+	fs.StringVar(&o.eventsPath, "events", "", "Corpus of strfry policy inputs, one JSON object per line.")
+	fs.StringVar(&o.goldenPath, "golden", "", "Golden file to write (capture) or compare against (verify).")
+	fs.BoolVar(&o.rebaseTime, "rebase-time", true, "Shift created_at so the newest corpus event is 'now', keeping time-based filters stable across runs.")
+	return fs
+}
+
+// runGolden implements "adresu-plugin golden <capture|verify>".
+func runGolden(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: adresu-plugin golden capture|verify -config path -events corpus.jsonl -golden golden.jsonl")
+	}
+	switch args[0] {
+	case "capture", "verify":
+	default:
+		return fmt.Errorf("unknown golden command %q", args[0])
+	}
+	command := args[0]
+
+	var opts goldenOptions
+	opts.flagSet(command).Parse(args[1:])
+
+	if opts.eventsPath == "" || opts.goldenPath == "" {
+		return errors.New("-events and -golden are required")
+	}
+
+	decisions, err := replayCorpus(opts.configPath, opts.eventsPath, opts.rebaseTime)
+	if err != nil {
+		return err
+	}
+
+	if command == "capture" {
+		if err := writeGolden(opts.goldenPath, decisions); err != nil {
+			return err
+		}
+		fmt.Printf("Captured %d decisions to %s\n", len(decisions), opts.goldenPath)
+		return nil
+	}
+
+	expected, err := readGolden(opts.goldenPath)
+	if err != nil {
+		return err
+	}
+	return compareGolden(os.Stdout, expected, decisions)
+}
+
+// replayCorpus runs every corpus event through a scratch pipeline.
+func replayCorpus(configPath, eventsPath string, rebaseTime bool) ([]goldenDecision, error) {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	cfg, _, err := config.Load(configPath, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	inputs, err := readCorpus(eventsPath)
+	if err != nil {
+		return nil, err
+	}
+	if rebaseTime {
+		rebaseCreatedAt(inputs)
+	}
+
+	p, cleanup, err := scratchPipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	ctx := context.Background()
+	decisions := make([]goldenDecision, 0, len(inputs))
+	for i := range inputs {
+		in := &inputs[i]
+		resp, err := p.ProcessEvent(in.Context(ctx), &in.Event, in.RemoteIP(), false)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %w", in.Event.ID, err)
+		}
+		decisions = append(decisions, goldenDecision{ID: resp.ID, Action: resp.Action, Msg: resp.Msg})
+	}
+	return decisions, nil
+}
+
+// isolate points cfg at the throwaway database in dbDir and turns off what
+// reaches beyond it, so that a replay or load test never touches production
+// state and decides the same way on every run.
+func isolate(cfg *config.Config, dbDir string) {
+	cfg.DB.Driver = config.DBBadger
+	cfg.DB.Path = dbDir
+	cfg.DB.CheckOnStartup = false
+	cfg.DB.Tiering.Enabled = false
+	// No side effects outside the temporary database, and no dependency on
+	// the local strfry installation.
+	cfg.Mirror.Enabled = false
+	cfg.Canary.Enabled = false
+	cfg.Strfry.ExecutablePath = ""
+	cfg.Strfry.CheckConfig = config.StrfryCheckOff
+	// Filters that query other services see their current state, if they
+	// are reachable at all, so their results would change between runs:
+	// they are disabled, or limited to files and static lists. Sources are
+	// copied so the caller's config keeps its URLs.
+	cfg.Filters.DNSBL.Enabled = false
+	cfg.Filters.Origin.Enabled = false
+	cfg.Filters.WoT.Enabled = false
+	cfg.Policy.MuteList.Enabled = false
+	cfg.Filters.Whitelist.List = ""
+	cfg.Filters.CompromisedKeys.Sources = fileSources(cfg.Filters.CompromisedKeys.Sources)
+	lists := make([]config.IPReputationList, len(cfg.Filters.IPReputation.Lists))
+	for i, list := range cfg.Filters.IPReputation.Lists {
+		list.Sources = fileSources(list.Sources)
+		lists[i] = list
+	}
+	cfg.Filters.IPReputation.Lists = lists
+	// Nothing is served or published either.
+	cfg.Admin.Enabled = false
+	cfg.Metrics.Enabled = false
+	cfg.Flags.URL = ""
+	cfg.Digest.Enabled = false
+	cfg.BanReview.Enabled = false
+	cfg.Summary.Enabled = false
+	cfg.Changelog.Enabled = false
+}
+
+// scratchPipeline builds a pipeline for cfg backed by a throwaway database,
+// so replays never touch production state. cleanup closes and removes it.
+func scratchPipeline(cfg *config.Config) (p *policy.Pipeline, cleanup func(), err error) {
+	dbDir, err := os.MkdirTemp("", "adresu-scratch-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	isolate(cfg, dbDir)
+
+	db, err := store.NewBadgerStore(&cfg.DB)
+	if err != nil {
+		os.RemoveAll(dbDir)
+		return nil, nil, fmt.Errorf("failed to open temporary database: %w", err)
+	}
+	p, err = pipeline.Build(cfg, pipeline.Deps{DB: db})
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dbDir)
+		return nil, nil, err
+	}
+	return p, func() {
+		p.Close()
+		db.Close()
+		os.RemoveAll(dbDir)
+	}, nil
+}
+
+// fileSources returns a copy of sources without the http(s) URLs.
+func fileSources(sources []string) []string {
+	return slices.DeleteFunc(slices.Clone(sources), func(src string) bool {
+		return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+	})
+}
+
+func readCorpus(path string) ([]PolicyInput, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var inputs []PolicyInput
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var in PolicyInput
+		if err := json.Unmarshal(scanner.Bytes(), &in); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs, scanner.Err()
+}
+
+// rebaseCreatedAt shifts all events by the same offset so that the newest one
+// was created now. Event IDs are kept, as the plugin does not verify them.
+func rebaseCreatedAt(inputs []PolicyInput) {
+	var newest nostr.Timestamp
+	for _, in := range inputs {
+		newest = max(newest, in.Event.CreatedAt)
+	}
+	offset := nostr.Now() - newest
+	for i := range inputs {
+		inputs[i].Event.CreatedAt += offset
+	}
+}
+
+func writeGolden(path string, decisions []goldenDecision) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	for _, d := range decisions {
+		if err := encoder.Encode(d); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+func readGolden(path string) ([]goldenDecision, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var decisions []goldenDecision
+	decoder := json.NewDecoder(f)
+	for {
+		var d goldenDecision
+		if err := decoder.Decode(&d); err != nil {
+			if errors.Is(err, io.EOF) {
+				return decisions, nil
+			}
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		decisions = append(decisions, d)
+	}
+}
+
+// compareGolden prints every changed decision and fails if there is any.
+func compareGolden(w io.Writer, expected, actual []goldenDecision) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("golden file has %d decisions, corpus produced %d; recapture after changing the corpus", len(expected), len(actual))
+	}
+	changed := 0
+	for i := range expected {
+		want, got := expected[i], actual[i]
+		if want == got {
+			continue
+		}
+		changed++
+		fmt.Fprintf(w, "event %s (#%d):\n  - %s %q\n  + %s %q\n", want.ID, i+1, want.Action, want.Msg, got.Action, got.Msg)
+	}
+	if changed > 0 {
+		return fmt.Errorf("%d of %d decisions changed", changed, len(expected))
+	}
+	fmt.Fprintf(w, "All %d decisions match the golden file.\n", len(expected))
+	return nil
+}
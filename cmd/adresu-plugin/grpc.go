@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"google.golang.org/grpc"
+
+	"github.com/lessucettes/adresu-plugin/internal/nauthz"
+)
+
+// serveGRPC answers nostr-rs-relay's event admission requests on listen
+// until ctx is done.
+func serveGRPC(ctx context.Context, listen string, dryRun bool) error {
+	lis, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC: %w", err)
+	}
+	server := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			pendingLines.Add(1)
+			defer pendingLines.Add(-1)
+			return handler(ctx, req)
+		},
+	))
+	nauthz.RegisterAuthorizationServer(server, nauthz.NewServer(loadPipeline, dryRun))
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	slog.Info("gRPC event admission server listening", "addr", lis.Addr().String())
+	return server.Serve(lis)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+)
+
+// oversizePrefix is how much of a line over the input limit is kept: enough
+// to find the event ID, which strfry writes first.
+const oversizePrefix = 4096
+
+// inputLine is one line of policy input, without its newline. A line over
+// the input limit is not kept whole: data holds its beginning only, and size
+// its full length.
+type inputLine struct {
+	data []byte
+	size int
+}
+
+func (l inputLine) truncated() bool {
+	return l.size > len(l.data)
+}
+
+// readLines sends the lines of r to lines, cutting those longer than limit
+// bytes, so a huge line costs neither memory nor parsing time. It returns the
+// read error, or nil at the end of r.
+func readLines(r io.Reader, limit int, lines chan<- inputLine) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var data []byte
+	size := 0
+	for {
+		chunk, err := br.ReadSlice('\n')
+		complete := err == nil
+		if complete {
+			chunk = chunk[:len(chunk)-1]
+		}
+		size += len(chunk)
+		switch {
+		case size <= limit:
+			data = append(data, chunk...)
+		case len(data) < oversizePrefix:
+			data = append(data, chunk[:min(len(chunk), oversizePrefix-len(data))]...)
+		case len(data) > oversizePrefix:
+			data = data[:oversizePrefix]
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if complete || size > 0 {
+			lines <- inputLine{data: data, size: size}
+		}
+		data, size = nil, 0
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var eventIDRe = regexp.MustCompile(`"id"\s*:\s*"([0-9a-f]{64})"`)
+
+// scanEventID finds the event ID in policy input that cannot be decoded, so
+// it can still be answered. Only the event has an "id" key.
+func scanEventID(data []byte) string {
+	if m := eventIDRe.FindSubmatch(data); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+)
+
+// RuntimeStats is the snapshot written by -stats-file and read back by the load test.
+type RuntimeStats struct {
+	HeapAllocBytes  uint64  `json:"heap_alloc_bytes"`
+	TotalAllocBytes uint64  `json:"total_alloc_bytes"`
+	SysBytes        uint64  `json:"sys_bytes"`
+	NumGC           uint32  `json:"num_gc"`
+	PauseTotalNs    uint64  `json:"pause_total_ns"`
+	GCCPUFraction   float64 `json:"gc_cpu_fraction"`
+}
+
+func writeRuntimeStats(path string) error {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	data, err := json.Marshal(RuntimeStats{
+		HeapAllocBytes:  ms.HeapAlloc,
+		TotalAllocBytes: ms.TotalAlloc,
+		SysBytes:        ms.Sys,
+		NumGC:           ms.NumGC,
+		PauseTotalNs:    ms.PauseTotalNs,
+		GCCPUFraction:   ms.GCCPUFraction,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// loadTestOptions are the flags of "adresu-plugin loadtest".
+type loadTestOptions struct {
+	binary      string
+	configPath  string
+	useDefaults bool
+	rate        int
+	duration    time.Duration
+	warmup      time.Duration
+	authors     int
+	maxP99      time.Duration
+	maxRSSMB    int
+	maxLossPct  float64
+}
+
+func (o *loadTestOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("loadtest")
+	fs.StringVar(&o.binary, "binary", "", "Plugin binary to test (defaults to this executable).")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Configuration file passed to the plugin under test.")
+	fs.BoolVar(&o.useDefaults, "use-defaults", false, "Run the plugin with internal defaults if the config file is missing.")
+	fs.IntVar(&o.rate, "rate", 1000, "Events per second to send.")
+	fs.DurationVar(&o.duration, "duration", 30*time.Second, "How long to generate traffic.")
+	fs.DurationVar(&o.warmup, "warmup", 0, "Wait this long after starting the plugin before sending traffic.")
+	fs.IntVar(&o.authors, "authors", 1000, "Number of distinct synthetic pubkeys.")
+	fs.DurationVar(&o.maxP99, "max-p99", 0, "Fail if p99 decision latency exceeds this (0 disables the check).")
+	fs.IntVar(&o.maxRSSMB, "max-rss-mb", 0, "Fail if the plugin's peak RSS exceeds this many MiB (0 disables the check).")
+	fs.Float64Var(&o.maxLossPct, "max-loss-pct", 0, "Fail if more than this percentage of events got no response.")
+	return fs
+}
+
+// runLoadTest feeds synthetic events through a child plugin process over
+// stdin/stdout and checks the observed decision latency against the SLOs.
+func runLoadTest(args []string) error {
+	var opts loadTestOptions
+	opts.flagSet().Parse(args)
+
+	if opts.rate <= 0 || opts.duration <= 0 || opts.authors <= 0 {
+		return errors.New("rate, duration and authors must be positive")
+	}
+	if opts.binary == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate own executable: %w", err)
+		}
+		opts.binary = exe
+	}
+
+	tmpDir, err := os.MkdirTemp("", "adresu-loadtest-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	statsPath := filepath.Join(tmpDir, "runtime-stats.json")
+
+	// The child must not write to the production database or act on strfry,
+	// other services or the network; sandboxed, it also does not contend
+	// for the database of a plugin running from the same config.
+	childArgs := []string{"-config", opts.configPath, "-sandbox", "-stats-file", statsPath}
+	if opts.useDefaults {
+		childArgs = append(childArgs, "-use-defaults")
+	}
+	cmd := exec.Command(opts.binary, childArgs...)
+	logPath := filepath.Join(tmpDir, "plugin.log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	cmd.Stderr = logFile
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start plugin: %w", err)
+	}
+
+	authors := make([]string, opts.authors)
+	for i := range authors {
+		pk, err := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+		if err != nil {
+			return fmt.Errorf("failed to generate synthetic author: %w", err)
+		}
+		authors[i] = pk
+	}
+
+	var (
+		mu       sync.Mutex
+		inFlight = make(map[string]time.Time)
+	)
+	latencies := make([]time.Duration, 0, opts.rate*int(opts.duration/time.Second+1))
+	actions := make(map[string]int)
+
+	readDone := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			var resp policy.PolicyResponse
+			if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+				continue
+			}
+			now := time.Now()
+			mu.Lock()
+			if sent, ok := inFlight[resp.ID]; ok {
+				latencies = append(latencies, now.Sub(sent))
+				delete(inFlight, resp.ID)
+			}
+			actions[resp.Action]++
+			mu.Unlock()
+		}
+		readDone <- scanner.Err()
+	}()
+
+	if opts.warmup > 0 {
+		time.Sleep(opts.warmup)
+	}
+
+	fmt.Printf("Sending %d events/s for %s to %s\n", opts.rate, opts.duration, opts.binary)
+	sent, err := generateLoad(stdin, authors, opts.rate, opts.duration, func(id string, at time.Time) {
+		mu.Lock()
+		inFlight[id] = at
+		mu.Unlock()
+	})
+	stdin.Close()
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("failed to write to plugin: %w; plugin log tail:\n%s", err, fileTail(logPath, 2048))
+	}
+
+	if err := <-readDone; err != nil {
+		return fmt.Errorf("failed to read plugin responses: %w", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("plugin exited with error: %w; plugin log tail:\n%s", err, fileTail(logPath, 2048))
+	}
+
+	var peakRSS int64
+	if ru, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+		peakRSS = ru.Maxrss * 1024 // Linux reports KiB.
+	}
+	var rtStats RuntimeStats
+	if data, err := os.ReadFile(statsPath); err == nil {
+		_ = json.Unmarshal(data, &rtStats)
+	}
+
+	slices.Sort(latencies)
+	received := len(latencies)
+	lossPct := 0.0
+	if sent > 0 {
+		lossPct = float64(sent-received) / float64(sent) * 100
+	}
+	p99 := percentile(latencies, 0.99)
+
+	fmt.Printf("Events sent:      %d\n", sent)
+	fmt.Printf("Responses:        %d (loss %.2f%%)\n", received, lossPct)
+	fmt.Printf("Actions:          %v\n", actions)
+	fmt.Printf("Latency p50:      %s\n", percentile(latencies, 0.50))
+	fmt.Printf("Latency p90:      %s\n", percentile(latencies, 0.90))
+	fmt.Printf("Latency p99:      %s\n", p99)
+	fmt.Printf("Latency max:      %s\n", percentile(latencies, 1.0))
+	fmt.Printf("Peak RSS:         %.1f MiB\n", float64(peakRSS)/(1<<20))
+	fmt.Printf("Heap at exit:     %.1f MiB\n", float64(rtStats.HeapAllocBytes)/(1<<20))
+	fmt.Printf("Total allocated:  %.1f MiB\n", float64(rtStats.TotalAllocBytes)/(1<<20))
+	fmt.Printf("GC cycles:        %d (pause total %s, cpu fraction %.4f)\n",
+		rtStats.NumGC, time.Duration(rtStats.PauseTotalNs), rtStats.GCCPUFraction)
+
+	var violations []error
+	if opts.maxP99 > 0 && p99 > opts.maxP99 {
+		violations = append(violations, fmt.Errorf("p99 latency %s exceeds SLO %s", p99, opts.maxP99))
+	}
+	if opts.maxRSSMB > 0 && peakRSS > int64(opts.maxRSSMB)<<20 {
+		violations = append(violations, fmt.Errorf("peak RSS %.1f MiB exceeds SLO %d MiB", float64(peakRSS)/(1<<20), opts.maxRSSMB))
+	}
+	if lossPct > opts.maxLossPct {
+		violations = append(violations, fmt.Errorf("response loss %.2f%% exceeds SLO %.2f%%", lossPct, opts.maxLossPct))
+	}
+	if len(violations) > 0 {
+		return errors.Join(violations...)
+	}
+	fmt.Println("All SLOs met.")
+	return nil
+}
+
+// generateLoad writes paced synthetic PolicyInput lines to w. Events are not
+// signed, since the plugin leaves signature verification to the relay.
+func generateLoad(w io.Writer, authors []string, rate int, duration time.Duration, onSend func(id string, at time.Time)) (int, error) {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+
+	const tick = 10 * time.Millisecond
+	perTick := float64(rate) * tick.Seconds()
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	kinds := []int{nostr.KindTextNote, nostr.KindTextNote, nostr.KindTextNote, nostr.KindReaction, nostr.KindRepost}
+	sent := 0
+	budget := 0.0
+	for {
+		select {
+		case <-ctx.Done():
+			return sent, bw.Flush()
+		case <-ticker.C:
+			budget += perTick
+			for ; budget >= 1; budget-- {
+				ev := syntheticEvent(authors[rand.IntN(len(authors))], kinds[rand.IntN(len(kinds))])
+				onSend(ev.ID, time.Now())
+				if err := encoder.Encode(PolicyInput{Type: "new", Event: ev, SourceType: "IP4", SourceInfo: syntheticIP()}); err != nil {
+					return sent, err
+				}
+				sent++
+			}
+			if err := bw.Flush(); err != nil {
+				return sent, err
+			}
+		}
+	}
+}
+
+func syntheticEvent(pubkey string, kind int) nostr.Event {
+	var nonce [8]byte
+	for i := range nonce {
+		nonce[i] = byte(rand.IntN(256))
+	}
+	ev := nostr.Event{
+		PubKey:    pubkey,
+		CreatedAt: nostr.Now(),
+		Kind:      kind,
+		Tags:      nostr.Tags{},
+		Content:   "load test event " + hex.EncodeToString(nonce[:]),
+	}
+	ev.ID = ev.GetID()
+	return ev
+}
+
+func syntheticIP() string {
+	return fmt.Sprintf("10.%d.%d.%d", rand.IntN(256), rand.IntN(256), rand.IntN(256))
+}
+
+func fileTail(path string, n int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Size() > n {
+		f.Seek(-n, io.SeekEnd)
+	}
+	data, _ := io.ReadAll(f)
+	return string(data)
+}
+
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * q)
+	return sorted[idx]
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -12,15 +11,26 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
 	"github.com/nbd-wtf/go-nostr"
 
+	"github.com/lessucettes/adresu-plugin/internal/admin"
+	"github.com/lessucettes/adresu-plugin/internal/changelog"
 	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/digest"
+	"github.com/lessucettes/adresu-plugin/internal/metrics"
+	"github.com/lessucettes/adresu-plugin/internal/pipeline"
 	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/review"
+	"github.com/lessucettes/adresu-plugin/internal/schedule"
 	"github.com/lessucettes/adresu-plugin/internal/store"
 	"github.com/lessucettes/adresu-plugin/internal/strfry"
+	"github.com/lessucettes/adresu-plugin/internal/summary"
+	"github.com/lessucettes/adresu-plugin/internal/trace"
 )
 
 var version = "dev"
@@ -33,119 +43,290 @@ type PolicyInput struct {
 	IP         string      `json:"ip,omitempty"`
 }
 
+// RemoteIP returns the submitting client's address, if strfry provided one.
+func (in *PolicyInput) RemoteIP() string {
+	if in.SourceType == "IP4" || in.SourceType == "IP6" {
+		return in.SourceInfo
+	}
+	return in.IP
+}
+
+// Context derives the context for processing this input. Stored events that
+// strfry replays as "lookback" are judged, but never enforced on.
+func (in *PolicyInput) Context(ctx context.Context) context.Context {
+	ctx = policy.WithSource(ctx, policy.Source{Type: in.SourceType, Info: in.SourceInfo})
+	if in.Type == "lookback" {
+		return policy.WithoutSideEffects(ctx)
+	}
+	return ctx
+}
+
 var (
 	currentPipeline *policy.Pipeline
 	pipelineMutex   sync.RWMutex
+	// pendingLines counts the input lines read but not yet answered (or, in
+	// gRPC mode, the requests being judged), the queue depth load shedding
+	// watches.
+	pendingLines atomic.Int64
 )
 
-func buildPipeline(cfg *config.Config, db store.Store) (*policy.Pipeline, error) {
-	strfryClient := strfry.NewClient(cfg.Strfry.ExecutablePath, cfg.Strfry.ConfigPath)
+// The modes of "run": the protocol the plugin answers.
+const (
+	modeStrfry = "strfry"
+	modeGRPC   = "grpc"
+)
 
-	var stages []policy.PipelineStage
+// badgerGCInterval is the default schedule of the badger_gc job.
+const badgerGCInterval = 10 * time.Minute
 
-	type kitFilterFactory struct {
-		name        string
-		constructor func() (kitpolicy.Filter, error)
-	}
+// loadPipeline returns the pipeline in use.
+func loadPipeline() *policy.Pipeline {
+	pipelineMutex.RLock()
+	defer pipelineMutex.RUnlock()
+	return currentPipeline
+}
 
-	langDetector := kitpolicy.GetGlobalDetector()
+// runOptions are the flags of "adresu-plugin run".
+type runOptions struct {
+	showVersion    bool
+	configPath     string
+	useDefaults    bool
+	validateConfig bool
+	dryRun         bool
+	mode           string
+	batchSize      int
+	batchInterval  time.Duration
+	statsFile      string
+	sandbox        bool
+}
 
-	kitFactories := []kitFilterFactory{
-		{"EmergencyFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewEmergencyFilter(&cfg.Filters.Emergency) }},
-		{"KindFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewKindFilter(&cfg.Filters.Kind) }},
-		{"RateLimiterFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewRateLimiterFilter(&cfg.Filters.RateLimiter) }},
-		{"FreshnessFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewFreshnessFilter(&cfg.Filters.Freshness) }},
-		{"SizeFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewSizeFilter(&cfg.Filters.Size) }},
-		{"TagsFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewTagsFilter(&cfg.Filters.Tags) }},
-		{"KeywordFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewKeywordFilter(&cfg.Filters.Keywords) }},
-		{"RepostAbuseFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewRepostAbuseFilter(&cfg.Filters.RepostAbuse) }},
-		{"EphemeralChatFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewEphemeralChatFilter(&cfg.Filters.EphemeralChat) }},
-		{"LanguageFilter", func() (kitpolicy.Filter, error) {
-			return kitpolicy.NewLanguageFilter(&cfg.Filters.Language, langDetector)
-		}},
-	}
+func (o *runOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("run")
+	fs.BoolVar(&o.showVersion, "version", false, "Show plugin version and exit")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Path to the configuration file.")
+	fs.BoolVar(&o.useDefaults, "use-defaults", false, "Run with internal defaults if the config file is missing.")
+	fs.BoolVar(&o.validateConfig, "validate", false, "Validate the configuration file and exit.")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Log what would be rejected without actually rejecting it.")
+	fs.StringVar(&o.mode, "mode", modeStrfry, "Serve strfry write policy requests on stdin/stdout (strfry) or nostr-rs-relay event admission requests over gRPC on grpc.listen (grpc).")
+	fs.IntVar(&o.batchSize, "batch-size", 1, "Write responses to stdout in batches of up to this many (1 = one write per event).")
+	fs.DurationVar(&o.batchInterval, "batch-interval", 5*time.Millisecond, "Longest a batched response waits before being written.")
+	fs.StringVar(&o.statsFile, "stats-file", "", "Write Go runtime statistics as JSON to this file on exit.")
+	fs.BoolVar(&o.sandbox, "sandbox", false, "Run in dry-run mode on a temporary database, without side effects, listeners or network lookups (used by loadtest).")
+	return fs
+}
 
-	for _, factory := range kitFactories {
-		filter, err := factory.constructor()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create kit filter '%s': %w", factory.name, err)
-		}
-		if filter != nil {
-			stages = append(stages, policy.PipelineStage{Filter: filter})
-		}
-	}
+// runPlugin implements "adresu-plugin run", the default command: serving
+// strfry's write policy requests on stdin/stdout.
+func runPlugin(args []string) error {
+	var opts runOptions
+	opts.flagSet().Parse(args)
 
-	bannedAuthorFilter, err := policy.NewBannedAuthorFilter(db, &cfg.Filters.BannedAuthor)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create BannedAuthorFilter: %w", err)
+	if opts.showVersion {
+		fmt.Println(version)
+		return nil
 	}
-	stages = append(stages, policy.PipelineStage{Filter: bannedAuthorFilter})
-
-	moderationFilter, err := policy.NewModerationFilter(
-		cfg.Policy.ModeratorPubKey, cfg.Policy.BanEmoji, cfg.Policy.UnbanEmoji, db, strfryClient, cfg.Policy.BanDuration,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ModerationFilter: %w", err)
+	if opts.validateConfig {
+		return runValidate([]string{"-config", opts.configPath})
 	}
-	stages = append(stages, policy.PipelineStage{Filter: moderationFilter})
-
-	autoBanFilter, err := policy.NewAutoBanFilter(db, &cfg.Filters.AutoBan)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create AutoBanFilter: %w", err)
+	if opts.mode != modeStrfry && opts.mode != modeGRPC {
+		return fmt.Errorf("-mode must be %s or %s", modeStrfry, modeGRPC)
 	}
-	rejectionHandlers := []policy.RejectionHandler{autoBanFilter}
-
-	var metricsCollector policy.MetricsCollector = nil
-	pipeline := policy.NewPipeline(cfg, stages, rejectionHandlers, metricsCollector)
-
-	return pipeline, nil
+	if opts.batchSize < 1 {
+		return errors.New("-batch-size must be at least 1")
+	}
+	batch := responseBatching{Size: opts.batchSize, Interval: opts.batchInterval}
+	return runApp(opts.configPath, opts.mode, opts.useDefaults, opts.dryRun, opts.sandbox, opts.statsFile, batch)
 }
 
-func main() {
-	showVersion := flag.Bool("version", false, "Show plugin version and exit")
-	configPath := flag.String("config", "./config.toml", "Path to the configuration file.")
-	useDefaults := flag.Bool("use-defaults", false, "Run with internal defaults if the config file is missing.")
-	validateConfig := flag.Bool("validate", false, "Validate the configuration file and exit.")
-	dryRun := flag.Bool("dry-run", false, "Log what would be rejected without actually rejecting it.")
-	flag.Parse()
+// runValidate implements "adresu-plugin validate".
+func runValidate(args []string) error {
+	var opts configOptions
+	opts.flagSet("validate").Parse(args)
 
-	if *showVersion {
-		fmt.Println(version)
-		return
-	}
-	if *validateConfig {
-		if err := validateConfiguration(*configPath); err != nil {
-			fmt.Fprintf(os.Stderr, "Configuration is INVALID: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Println("Configuration is VALID.")
-		return
-	}
-	if err := runApp(*configPath, *useDefaults, *dryRun); err != nil {
-		fmt.Fprintf(os.Stderr, "Application run failed: %v\n", err)
-		os.Exit(1)
+	if err := validateConfiguration(opts.configPath); err != nil {
+		return fmt.Errorf("configuration is INVALID: %w", err)
 	}
+	fmt.Println("Configuration is VALID.")
+	return nil
 }
 
-func runApp(configPath string, useDefaults bool, dryRun bool) error {
+func runApp(configPath, mode string, useDefaults, dryRun, sandbox bool, statsFile string, batch responseBatching) error {
 	cfg, defaultsUsed, err := config.Load(configPath, useDefaults)
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
-	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.Log.Level.ToSlogLevel()}))
+	// A sandboxed plugin keeps its state in a temporary database and its
+	// configuration isolated across reloads.
+	var sandboxDir string
+	if sandbox {
+		if sandboxDir, err = os.MkdirTemp("", "adresu-sandbox-*"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(sandboxDir)
+		isolate(cfg, sandboxDir)
+		dryRun = true
+	}
+	logger := slog.New(trace.NewHandler(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.Log.Level.ToSlogLevel()})))
 	slog.SetDefault(logger)
 	if dryRun {
 		slog.Warn("Plugin is running in DRY-RUN mode.")
 	}
-	slog.Info("Policy plugin starting up", "version", version, "config_path", configPath, "using_defaults", defaultsUsed)
+	slog.Info("Policy plugin starting up", "version", version, "mode", mode, "config_path", configPath, "using_defaults", defaultsUsed)
 
-	db, err := store.NewBadgerStore(&cfg.DB)
+	db, err := store.Open(&cfg.DB)
 	if err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 	defer db.Close()
 
-	p, err := buildPipeline(cfg, db)
+	if statsFile != "" {
+		defer func() {
+			if err := writeRuntimeStats(statsFile); err != nil {
+				slog.Error("Failed to write runtime statistics", "path", statsFile, "error", err)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The journal is read before anything can add to it, so that the replay
+	// below repeats the side effects of the last run only, never those of
+	// this one still in flight.
+	interrupted, err := db.PendingActions(ctx)
+	if err != nil {
+		slog.Error("Failed to read journaled side effects", "error", err)
+	}
+
+	// Remote flags override the config file, at startup and on every reload;
+	// baseCfg is the config file alone.
+	baseCfg := cfg
+	var flags *config.FlagPoller
+	if cfg.Flags.URL != "" {
+		flags = config.NewFlagPoller(&cfg.Flags)
+		if _, err := flags.Poll(ctx); err != nil {
+			slog.Warn("Failed to fetch remote flags, using the cached ones", "url", cfg.Flags.URL, "error", err)
+		}
+		if cfg, err = flags.Apply(baseCfg); err != nil {
+			slog.Error("Remote flags do not apply, ignoring them", "error", err)
+		}
+	}
+
+	// Periodic jobs run from one scheduler; the pipelines' list refreshes
+	// join it as they are built.
+	sched, err := schedule.New(cfg.Schedule.Jitter, cfg.Schedule.Jobs)
+	if err != nil {
+		return fmt.Errorf("failed to initialize scheduler: %w", err)
+	}
+	sched.Start(ctx)
+	if gc, ok := db.(store.GarbageCollector); ok {
+		sched.Add(schedule.Job{Name: config.JobBadgerGC, Schedule: schedule.Every(badgerGCInterval), Run: gc.CollectGarbage})
+	}
+
+	if cfg.DB.Tiering.Enabled {
+		tiered := store.NewTieredStore(db, &cfg.DB.Tiering)
+		tiered.Start(ctx)
+		sched.Add(schedule.Job{Name: config.JobTieringResync, Schedule: schedule.Every(cfg.DB.Tiering.ResyncInterval), Run: tiered.Resync})
+		db = tiered
+	}
+
+	// The admin API, observers and shared state are created once and survive
+	// pipeline reloads.
+	deps := pipeline.Deps{
+		DB:              db,
+		Maintenance:     policy.NewMaintenanceSwitch(&cfg.Maintenance),
+		Cooldowns:       kitpolicy.NewCooldowns(cfg.Filters.Cooldown.CacheSize),
+		SlowMode:        kitpolicy.NewSlowMode(cfg.Filters.EphemeralChat.CacheSize),
+		Ledger:          policy.NewFirstSeenLedger(0),
+		QueueDepth:      func() int { return int(pendingLines.Load()) },
+		CanaryStats:     policy.NewCanaryStats(),
+		ExperimentStats: policy.NewExperimentStats(),
+		Scheduler:       sched,
+	}
+	deps.Observers = append(deps.Observers, deps.Ledger)
+	var latency *metrics.LatencyRecorder
+	if cfg.Admin.Enabled || cfg.Metrics.Enabled {
+		latency = metrics.NewLatencyRecorder()
+		deps.Observers = append(deps.Observers, latency)
+	}
+	if cfg.Metrics.Enabled {
+		collector := metrics.NewCollector()
+		deps.Collector = collector
+		metrics.Serve(ctx, &cfg.Metrics, metrics.NewExporter(collector, latency, deps.CanaryStats, deps.ExperimentStats, sched))
+	}
+
+	// The summary is created before the admin API so that its ban listener
+	// also sees bans issued through it.
+	var sum *summary.Summary
+	if cfg.Summary.Enabled {
+		if sum, err = summary.New(&cfg.Summary, db, cfg.Policy.ModeratorPubKey); err != nil {
+			return fmt.Errorf("failed to initialize daily summary: %w", err)
+		}
+		sum.Start(ctx)
+		sched.Add(schedule.Job{Name: config.JobSummary, Schedule: schedule.Daily(cfg.Summary.At), Run: sum.Run})
+		deps.Observers = append(deps.Observers, sum)
+		deps.DB = store.WithBanListeners(deps.DB, sum.OnBan)
+	}
+
+	var server *admin.Server
+	if cfg.Admin.Enabled {
+		decisions := admin.NewDecisionStream()
+		stats := metrics.NewStats()
+		cardinality := metrics.NewCardinality()
+		deps.Observers = append(deps.Observers, decisions, stats, cardinality)
+		deps.DB = store.WithBanListeners(deps.DB, stats.OnBan)
+		server = admin.NewServer(&cfg.Admin)
+		server.Handle("GET /decisions", decisions)
+		server.Handle("GET /metrics/latency", latency)
+		server.Handle("GET /stats", stats)
+		server.Handle("GET /metrics/cardinality", cardinality)
+		server.Handle("GET /canary", deps.CanaryStats)
+		server.Handle("GET /experiment", deps.ExperimentStats)
+		server.Handle("GET /schedule", sched)
+		server.Handle("/maintenance", admin.NewMaintenanceHandler(deps.Maintenance))
+		server.Handle("/restrictions", admin.NewRestrictionsHandler(deps.DB))
+		server.Handle("GET /ban-evasion", admin.NewBanEvasionHandler(func() []policy.EvasionCandidate {
+			return policy.EvasionCandidates(loadPipeline())
+		}))
+		sf := strfry.NewClient(cfg.Strfry.ExecutablePath, cfg.Strfry.ConfigPath)
+		moderator := policy.NewModerator(deps.DB, sf, loadPipeline)
+		server.Handle("/bans", admin.NewBansHandler(moderator, deps.DB, cfg.Policy.BanDuration))
+		server.Handle("/blocklist", admin.NewBlocklistHandler(moderator, deps.DB, cfg.Filters.Blocklist.Duration))
+		if cfg.Admin.NIP86 {
+			server.Handle("POST /{$}", admin.NewNIP86Handler(moderator, deps.DB, cfg.Policy.BanDuration, cfg.Filters.Blocklist.Duration))
+		}
+	}
+
+	if cfg.Digest.Enabled {
+		d := digest.New(&cfg.Digest)
+		sched.Add(schedule.Job{Name: config.JobDigest, Schedule: schedule.Every(cfg.Digest.Interval), Run: d.Run})
+		deps.Observers = append(deps.Observers, d)
+		if server != nil {
+			server.Handle("GET /digest", d)
+		}
+	}
+	if cfg.BanReview.Enabled {
+		r, err := review.New(&cfg.BanReview, db, cfg.Policy.ModeratorPubKey)
+		if err != nil {
+			return fmt.Errorf("failed to initialize ban review: %w", err)
+		}
+		sched.Add(schedule.Job{Name: config.JobBanReview, Schedule: schedule.Daily(cfg.BanReview.At), Run: r.Run})
+		deps.Observers = append(deps.Observers, r)
+		deps.AutoBanListeners = append(deps.AutoBanListeners, r.OnAutoBan)
+		if server != nil {
+			server.Handle("GET /ban-review", r)
+		}
+	}
+	if sum != nil && server != nil {
+		server.Handle("GET /summary", sum)
+	}
+	var cl *changelog.Changelog
+	if cfg.Changelog.Enabled {
+		if cl, err = changelog.New(&cfg.Changelog, cfg.Policy.ModeratorPubKey); err != nil {
+			return fmt.Errorf("failed to initialize changelog: %w", err)
+		}
+	}
+	p, err := pipeline.Build(cfg, deps)
 	if err != nil {
 		return err
 	}
@@ -154,8 +335,14 @@ func runApp(configPath string, useDefaults bool, dryRun bool) error {
 	currentPipeline = p
 	pipelineMutex.Unlock()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Finish the side effects a crash or kill interrupted, in the background
+	// since strfry deletes can be slow.
+	go func() {
+		sf := strfry.NewClient(cfg.Strfry.ExecutablePath, cfg.Strfry.ConfigPath)
+		if n := policy.ReplayJournal(ctx, deps.DB, sf, interrupted); n > 0 {
+			slog.Info("Replayed journaled side effects", "completed", n)
+		}
+	}()
 
 	shutdownChan := make(chan os.Signal, 1)
 	signal.Notify(shutdownChan, os.Interrupt, syscall.SIGTERM)
@@ -165,13 +352,34 @@ func runApp(configPath string, useDefaults bool, dryRun bool) error {
 		cancel()
 	}()
 
-	onReload := func(newCfg *config.Config) {
+	// The rule pack checker follows the loaded packs, so it restarts with
+	// every reload.
+	packCtx, stopPackChecker := context.WithCancel(ctx)
+	go config.StartRulePackChecker(packCtx, &cfg.RulePacks)
+
+	maintenanceCfg := cfg.Maintenance
+	// appliedCfg is the configuration of the pipeline in use, for the
+	// changelog.
+	appliedCfg := cfg
+	var reloadMu sync.Mutex
+	onReload := func(newCfg *config.Config) error {
 		slog.Info("Reloading pipeline with new configuration...")
-		newPipeline, err := buildPipeline(newCfg, db)
+		newPipeline, err := pipeline.Build(newCfg, deps)
 		if err != nil {
 			slog.Error("Failed to build new pipeline on config reload, keeping old one", "error", err)
-			return
+			return err
+		}
+		// A mode switched through the admin API is kept unless the
+		// configured mode itself was edited.
+		if newCfg.Maintenance.Mode != maintenanceCfg.Mode || newCfg.Maintenance.Message != maintenanceCfg.Message {
+			deps.Maintenance.Set(newCfg.Maintenance.Mode, newCfg.Maintenance.Message)
+			slog.Warn("Maintenance mode changed by configuration", "mode", newCfg.Maintenance.Mode)
 		}
+		maintenanceCfg = newCfg.Maintenance
+
+		stopPackChecker()
+		packCtx, stopPackChecker = context.WithCancel(ctx)
+		go config.StartRulePackChecker(packCtx, &newCfg.RulePacks)
 
 		pipelineMutex.Lock()
 		oldPipeline := currentPipeline
@@ -181,79 +389,233 @@ func runApp(configPath string, useDefaults bool, dryRun bool) error {
 		if oldPipeline != nil {
 			go oldPipeline.Close() // Gracefully shutdown the old pipeline.
 		}
+		if cl != nil {
+			cl.Announce(ctx, appliedCfg, newCfg)
+		}
+		appliedCfg = newCfg
 
 		slog.Info("Pipeline reloaded successfully.", "path", configPath)
+		return nil
+	}
+	onConfigReload := func(newCfg *config.Config) error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		if sandbox {
+			isolate(newCfg, sandboxDir)
+		}
+		baseCfg = newCfg
+		if flags != nil {
+			var err error
+			if newCfg, err = flags.Apply(baseCfg); err != nil {
+				slog.Error("Remote flags do not apply to the new configuration, ignoring them", "error", err)
+			}
+		}
+		return onReload(newCfg)
+	}
+	go config.StartWatcher(ctx, configPath, func(newCfg *config.Config) { onConfigReload(newCfg) }, 0)
+	if flags != nil {
+		go flags.Run(ctx, func(changed config.Flags) {
+			reloadMu.Lock()
+			defer reloadMu.Unlock()
+			newCfg, err := flags.Apply(baseCfg)
+			if err != nil {
+				slog.Error("Remote flags do not apply, keeping the current pipeline", "error", err)
+				return
+			}
+			slog.Info("Remote flags changed, reloading pipeline", "flags", changed)
+			onReload(newCfg)
+		})
+	}
+
+	// Started last, so that a reload requested through it finds everything
+	// in place.
+	if server != nil {
+		server.Handle("POST /reload", admin.NewReloadHandler(func() error {
+			newCfg, _, err := config.Load(configPath, false)
+			if err != nil {
+				return err
+			}
+			return onConfigReload(newCfg)
+		}))
+		server.Start(ctx)
 	}
-	go config.StartWatcher(ctx, configPath, onReload, 0)
 
-	return processEvents(ctx, os.Stdin, os.Stdout, dryRun)
+	if mode == modeGRPC {
+		return serveGRPC(ctx, cfg.GRPC.Listen, dryRun)
+	}
+	return processEvents(ctx, os.Stdin, os.Stdout, dryRun, batch, cfg.Runtime.Workers, cfg.Runtime.MaxInputBytes)
 }
 
-func processEvents(ctx context.Context, r io.Reader, w io.Writer, dryRun bool) error {
-	linesChan := make(chan []byte)
+func processEvents(ctx context.Context, r io.Reader, w io.Writer, dryRun bool, batch responseBatching, workers, maxInput int) error {
+	linesChan := make(chan inputLine)
 	errChan := make(chan error, 1)
-	encoder := json.NewEncoder(w)
+	out := newResponseWriter(w, batch)
 
 	go func() {
 		defer close(errChan) // This ensures the error channel is always closed.
-		scanner := bufio.NewScanner(r)
-		for scanner.Scan() {
-			lineCopy := make([]byte, len(scanner.Bytes()))
-			copy(lineCopy, scanner.Bytes())
-			linesChan <- lineCopy
-		}
-		if err := scanner.Err(); err != nil {
+		if err := readLines(r, maxInput, linesChan); err != nil {
 			errChan <- err
 		}
 		close(linesChan)
 	}()
 
-	slog.Info("Ready to process events from stdin...")
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case line, ok := <-linesChan:
-			if !ok {
-				// linesChan is closed, check for a final error. This no longer blocks.
-				if err := <-errChan; err != nil {
-					return err
-				}
-				slog.Info("Input stream closed, shutting down.")
+	// process runs one input line through the pipeline. It returns nil when
+	// there is nothing to answer.
+	process := func(line inputLine) *policy.PolicyResponse {
+		if line.size == 0 {
+			return nil
+		}
+		// Every input line gets a trace ID, decodable or not.
+		eventCtx := trace.With(ctx, trace.NewID())
+		// Input that cannot be decoded is still rejected when its event ID
+		// can be found, so that strfry is not left waiting for an answer.
+		if line.truncated() {
+			id := scanEventID(line.data)
+			slog.WarnContext(eventCtx, "Policy input too large, not decoding it", "size", line.size, "max", maxInput, "event_id", id)
+			if id == "" {
 				return nil
 			}
-
-			if len(line) == 0 {
-				continue
-			}
-			var input PolicyInput
-			if err := json.Unmarshal(line, &input); err != nil {
-				slog.Warn("Failed to decode policy input JSON", "error", err, "raw_line_prefix", string(line))
-				continue
+			return &policy.PolicyResponse{ID: id, Action: "reject", Msg: "invalid: event too large"}
+		}
+		var input PolicyInput
+		if err := json.Unmarshal(line.data, &input); err != nil {
+			id := scanEventID(line.data)
+			slog.WarnContext(eventCtx, "Failed to decode policy input JSON", "error", err, "event_id", id, "raw_line_prefix", string(line.data[:min(len(line.data), 256)]))
+			if id == "" {
+				return nil
 			}
+			return &policy.PolicyResponse{ID: id, Action: "reject", Msg: "invalid: malformed policy input"}
+		}
 
-			remoteIP := ""
-			if input.SourceType == "IP4" || input.SourceType == "IP6" {
-				remoteIP = input.SourceInfo
-			} else if input.IP != "" {
-				remoteIP = input.IP
-			}
+		p := loadPipeline()
 
-			pipelineMutex.RLock()
-			p := currentPipeline
-			pipelineMutex.RUnlock()
+		result, err := p.ProcessEvent(input.Context(eventCtx), &input.Event, input.RemoteIP(), dryRun)
+		if err != nil {
+			// A failed filter comes with a rejection, which strfry still
+			// waits for.
+			slog.ErrorContext(eventCtx, "Error processing event", "event_id", input.Event.ID, "error", err)
+		}
+		return &result
+	}
 
-			result, err := p.ProcessEvent(ctx, &input.Event, remoteIP, dryRun)
-			if err != nil {
-				slog.Error("Error processing event", "event_id", input.Event.ID, "error", err)
-				continue
+	// Lines are processed by the workers but answered in input order: each
+	// line gets a slot, queued in order and filled by whichever worker takes
+	// the line. The bounded queues hold back the reader when workers lag.
+	type job struct {
+		line inputLine
+		slot chan *policy.PolicyResponse
+	}
+	jobs := make(chan job, workers)
+	slots := make(chan chan *policy.PolicyResponse, workers)
+	go func() {
+		defer close(slots)
+		defer close(jobs)
+		for line := range linesChan {
+			slot := make(chan *policy.PolicyResponse, 1)
+			pendingLines.Add(1)
+			jobs <- job{line: line, slot: slot}
+			slots <- slot
+		}
+	}()
+	for range workers {
+		go func() {
+			for j := range jobs {
+				j.slot <- process(j.line)
+			}
+		}()
+	}
+
+	flush := func() bool {
+		if err := out.Flush(); err != nil {
+			if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.EPIPE) {
+				return false
+			}
+			slog.ErrorContext(ctx, "Failed to write responses to stdout", "error", err)
+		}
+		return true
+	}
+	// handle writes the response of one line; it returns false once stdout
+	// is gone.
+	handle := func(slot chan *policy.PolicyResponse) bool {
+		var result *policy.PolicyResponse
+		select {
+		case result = <-slot:
+		default:
+			// The line is still being processed: the responses before it
+			// are flushed at the batch deadline meanwhile, or right away
+			// without one.
+			if out.Deadline() == nil && !flush() {
+				return false
 			}
+		wait:
+			for {
+				select {
+				case result = <-slot:
+					break wait
+				case <-out.Deadline():
+					if !flush() {
+						return false
+					}
+				}
+			}
+		}
+		pendingLines.Add(-1)
+		if result == nil {
+			return true
+		}
+		if err := out.Write(result); err != nil {
+			if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.EPIPE) {
+				return false
+			}
+			slog.ErrorContext(ctx, "Failed to write response to stdout", "error", err)
+		}
+		return true
+	}
+	// finish runs once all lines are answered.
+	finish := func() error {
+		flush()
+		// Check for a final error. This no longer blocks.
+		if err := <-errChan; err != nil {
+			return err
+		}
+		slog.Info("Input stream closed, shutting down.")
+		return nil
+	}
 
-			if err := encoder.Encode(result); err != nil {
-				if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.EPIPE) {
+	slog.Info("Ready to process events from stdin...", "workers", workers)
+	for {
+		if out.Pending() {
+			// Flush as soon as the input goes idle.
+			select {
+			case slot, ok := <-slots:
+				if !ok {
+					return finish()
+				}
+				if !handle(slot) {
 					return nil
 				}
-				slog.Error("Failed to write response to stdout", "error", err)
+				continue
+			default:
+			}
+			if !flush() {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			flush()
+			return ctx.Err()
+		case <-out.Deadline():
+			if !flush() {
+				return nil
+			}
+		case slot, ok := <-slots:
+			if !ok {
+				return finish()
+			}
+			if !handle(slot) {
+				return nil
 			}
 		}
 	}
@@ -267,13 +629,13 @@ func validateConfiguration(configPath string) error {
 		return err
 	}
 
-	db, err := store.NewBadgerStore(&cfg.DB)
+	db, err := store.Open(&cfg.DB)
 	if err != nil {
 		return fmt.Errorf("failed to open database for validation: %w", err)
 	}
 	defer db.Close()
 
-	if _, err := buildPipeline(cfg, db); err != nil {
+	if _, err := pipeline.Build(cfg, pipeline.Deps{DB: db}); err != nil {
 		return err
 	}
 	return nil
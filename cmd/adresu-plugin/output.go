@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// responseBatching controls how responses are flushed to stdout. With Size
+// above 1, responses are buffered and written together once Size of them are
+// pending or the oldest has waited Interval, cutting per-line write syscalls
+// at high event rates. Pending responses are also flushed whenever no input
+// is waiting, so a client that waits for each response never stalls.
+type responseBatching struct {
+	Size     int
+	Interval time.Duration
+}
+
+// responseWriter encodes responses as JSON lines and flushes them in batches.
+type responseWriter struct {
+	buf     *bufio.Writer
+	enc     *json.Encoder
+	batch   responseBatching
+	pending int
+	timer   *time.Timer
+}
+
+func newResponseWriter(w io.Writer, batch responseBatching) *responseWriter {
+	buf := bufio.NewWriterSize(w, 64*1024)
+	rw := &responseWriter{buf: buf, enc: json.NewEncoder(buf), batch: batch}
+	if batch.Size > 1 && batch.Interval > 0 {
+		rw.timer = time.NewTimer(batch.Interval)
+		rw.timer.Stop()
+	}
+	return rw
+}
+
+// Write buffers a response, flushing if the batch is full.
+func (rw *responseWriter) Write(response any) error {
+	if err := rw.enc.Encode(response); err != nil {
+		return err
+	}
+	rw.pending++
+	if rw.pending >= rw.batch.Size {
+		return rw.Flush()
+	}
+	if rw.pending == 1 && rw.timer != nil {
+		rw.timer.Reset(rw.batch.Interval)
+	}
+	return nil
+}
+
+// Pending reports whether buffered responses await a flush.
+func (rw *responseWriter) Pending() bool {
+	return rw.pending > 0
+}
+
+// Deadline fires when the oldest pending response has waited the batch
+// interval. It is nil without an interval.
+func (rw *responseWriter) Deadline() <-chan time.Time {
+	if rw.timer == nil {
+		return nil
+	}
+	return rw.timer.C
+}
+
+func (rw *responseWriter) Flush() error {
+	if rw.pending == 0 {
+		return nil
+	}
+	rw.pending = 0
+	if rw.timer != nil {
+		rw.timer.Stop()
+	}
+	return rw.buf.Flush()
+}
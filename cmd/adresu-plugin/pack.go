@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// runPack implements "adresu-plugin pack <command>", tools for publishing
+// rule packs.
+func runPack(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: adresu-plugin pack sign|verify [flags] pack.toml")
+	}
+	switch args[0] {
+	case "sign":
+		return runPackSign(args[1:])
+	case "verify":
+		return runPackVerify(args[1:])
+	default:
+		return fmt.Errorf("unknown pack command %q", args[0])
+	}
+}
+
+// packSignOptions are the flags of "adresu-plugin pack sign".
+type packSignOptions struct {
+	keyEnv string
+}
+
+func (o *packSignOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("pack sign")
+	fs.StringVar(&o.keyEnv, "key-env", "ADRESU_PACK_KEY", "Environment variable holding the signing key (nsec or hex).")
+	return fs
+}
+
+func runPackSign(args []string) error {
+	var opts packSignOptions
+	fs := opts.flagSet()
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: adresu-plugin pack sign [-key-env VAR] pack.toml")
+	}
+	path := fs.Arg(0)
+
+	key, err := parseSecretKey(os.Getenv(opts.keyEnv))
+	if err != nil {
+		return fmt.Errorf("%s: %w", opts.keyEnv, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pack, err := config.ParseRulePack(data)
+	if err != nil {
+		return fmt.Errorf("invalid rule pack: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	sig, err := schnorr.Sign(key, sum[:])
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".sig", []byte(hex.EncodeToString(sig.Serialize())+"\n"), 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Signed %s %s, wrote %s.sig\n", pack.Pack.Name, pack.Pack.Version, path)
+	fmt.Printf("  pubkey = %q\n", hex.EncodeToString(schnorr.SerializePubKey(key.PubKey())))
+	fmt.Printf("  sha256 = %q\n", config.RulePackDigest(data))
+	return nil
+}
+
+// packVerifyOptions are the flags of "adresu-plugin pack verify".
+type packVerifyOptions struct {
+	pubkey string
+}
+
+func (o *packVerifyOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("pack verify")
+	fs.StringVar(&o.pubkey, "pubkey", "", "Expected signer (npub or hex); requires pack.toml.sig.")
+	return fs
+}
+
+func runPackVerify(args []string) error {
+	var opts packVerifyOptions
+	fs := opts.flagSet()
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: adresu-plugin pack verify [-pubkey key] pack.toml")
+	}
+	path := fs.Arg(0)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pack, err := config.ParseRulePack(data)
+	if err != nil {
+		return fmt.Errorf("invalid rule pack: %w", err)
+	}
+	if opts.pubkey != "" {
+		pk, err := nip.NormalizePubKey(opts.pubkey)
+		if err != nil {
+			return err
+		}
+		sig, err := os.ReadFile(path + ".sig")
+		if err != nil {
+			return err
+		}
+		if err := config.VerifyRulePackSignature(data, string(sig), pk); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%s %s: %d keyword rules, %d rate rules, %d denied kinds\n", pack.Pack.Name, pack.Pack.Version,
+		len(pack.Keywords.Rules), len(pack.RateLimiter.Rules), len(pack.Policy.DeniedKinds))
+	fmt.Printf("  sha256 = %q\n", config.RulePackDigest(data))
+	if opts.pubkey != "" {
+		fmt.Println("  signature OK")
+	}
+	return nil
+}
+
+// parseSecretKey accepts an nsec or a hex secret key.
+func parseSecretKey(s string) (*btcec.PrivateKey, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("no signing key set")
+	}
+	if strings.HasPrefix(s, "nsec1") {
+		prefix, v, err := nip19.Decode(s)
+		if err != nil || prefix != "nsec" {
+			return nil, errors.New("invalid nsec")
+		}
+		s = v.(string)
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return nil, errors.New("invalid secret key")
+	}
+	key, _ := btcec.PrivKeyFromBytes(b)
+	return key, nil
+}
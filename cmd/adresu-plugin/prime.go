@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/priming"
+	"github.com/lessucettes/adresu-plugin/internal/strfry"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+)
+
+// primeOptions are the flags of "adresu-plugin prime".
+type primeOptions struct {
+	configPath string
+	fromStrfry bool
+	days       int
+	out        string
+}
+
+func (o *primeOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("prime")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Path to the configuration file.")
+	fs.BoolVar(&o.fromStrfry, "from-strfry", false, "Scan the events stored by strfry.")
+	fs.IntVar(&o.days, "days", 7, "Number of past days to scan.")
+	fs.StringVar(&o.out, "out", "", "Write the snapshot to this file (default priming.path).")
+	return fs
+}
+
+// runPrime implements "adresu-plugin prime -from-strfry": scanning the
+// relay's recent events into the author history that the plugin seeds its
+// filters with on the next start or reload.
+func runPrime(args []string) error {
+	var opts primeOptions
+	opts.flagSet().Parse(args)
+
+	if !opts.fromStrfry {
+		return errors.New("usage: adresu-plugin prime -from-strfry [-days 7] [-out priming.json]")
+	}
+	if opts.days < 1 {
+		return errors.New("-days must be at least 1")
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	cfg, _, err := config.Load(opts.configPath, false)
+	if err != nil {
+		return err
+	}
+	if opts.out == "" {
+		opts.out = cfg.Priming.Path
+	}
+	if opts.out == "" {
+		return errors.New("set priming.path in the configuration or pass -out")
+	}
+
+	sf := strfry.NewClient(cfg.Strfry.ExecutablePath, cfg.Strfry.ConfigPath)
+	ctx := context.Background()
+	now := time.Now()
+	since := now.Add(-time.Duration(opts.days) * 24 * time.Hour)
+
+	// One scan per day bounds the events held in memory at once.
+	builder := kitpolicy.NewHistoryBuilder()
+	total := 0
+	for from := since; from.Before(now); from = from.Add(24 * time.Hour) {
+		until := from.Add(24 * time.Hour)
+		if until.After(now) {
+			until = now
+		}
+		s, u := nostr.Timestamp(from.Unix()), nostr.Timestamp(until.Unix()-1)
+		events, err := sf.ScanEvents(ctx, nostr.Filter{Since: &s, Until: &u})
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			builder.Add(ev)
+		}
+		total += len(events)
+	}
+
+	snapshot := &priming.Snapshot{
+		GeneratedAt: now.UTC(),
+		Since:       since.UTC(),
+		Events:      total,
+		Authors:     builder.History(),
+	}
+	if err := priming.Write(opts.out, snapshot); err != nil {
+		return err
+	}
+	fmt.Printf("Scanned %d events from %d authors since %s into %s\n",
+		total, len(snapshot.Authors), since.Format(time.RFC3339), opts.out)
+	if cfg.Priming.Path != opts.out {
+		fmt.Println("Set priming.path to this file for the plugin to load it.")
+	}
+	return nil
+}
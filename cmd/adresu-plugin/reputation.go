@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/reputation"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+)
+
+// runReputation implements "adresu-plugin reputation <command>": exchanging
+// signed ban and restriction summaries with cooperating relays. Export reads
+// a snapshot of the database, so it works while the plugin runs; with the
+// badger driver the plugin must be stopped before an import.
+func runReputation(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: adresu-plugin reputation export|import [flags]")
+	}
+	switch args[0] {
+	case "export":
+		return runReputationExport(args[1:])
+	case "import":
+		return runReputationImport(args[1:])
+	default:
+		return fmt.Errorf("unknown reputation command %q", args[0])
+	}
+}
+
+// reputationExportOptions are the flags of "adresu-plugin reputation export".
+type reputationExportOptions struct {
+	configPath string
+	keyEnv     string
+	relay      string
+	out        string
+}
+
+func (o *reputationExportOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("reputation export")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Path to the configuration file.")
+	fs.StringVar(&o.keyEnv, "key-env", "ADRESU_REPUTATION_KEY", "Environment variable holding the relay operator's signing key (nsec or hex).")
+	fs.StringVar(&o.relay, "relay", "", "URL of this relay, recorded in the summary.")
+	fs.StringVar(&o.out, "out", "", "Write the signed summary to this file instead of stdout.")
+	return fs
+}
+
+func runReputationExport(args []string) error {
+	var opts reputationExportOptions
+	opts.flagSet().Parse(args)
+
+	key, err := parseSecretKey(os.Getenv(opts.keyEnv))
+	if err != nil {
+		return fmt.Errorf("%s: %w", opts.keyEnv, err)
+	}
+	db, err := openStore(opts.configPath, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	records, err := db.Authors(context.Background())
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	summary := reputation.FromRecords(records, opts.relay, now)
+	ev, err := reputation.Sign(summary, hex.EncodeToString(key.Serialize()), now)
+	if err != nil {
+		return err
+	}
+
+	data, _ := json.MarshalIndent(ev, "", "  ")
+	data = append(data, '\n')
+	if opts.out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(opts.out, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d pubkeys to %s, signed by %s\n", len(summary.Entries), opts.out, ev.PubKey)
+	return nil
+}
+
+// reputationImportOptions are the flags of "adresu-plugin reputation import".
+type reputationImportOptions struct {
+	configPath   string
+	in           string
+	issuers      string
+	bans         bool
+	restrictions bool
+	maxDuration  time.Duration
+	dryRun       bool
+}
+
+func (o *reputationImportOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("reputation import")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Path to the configuration file.")
+	fs.StringVar(&o.in, "in", "", "Signed summary to import.")
+	fs.StringVar(&o.issuers, "issuer", "", "Comma-separated pubkeys (npub or hex) whose summaries are trusted.")
+	fs.BoolVar(&o.bans, "bans", true, "Import bans.")
+	fs.BoolVar(&o.restrictions, "restrictions", true, "Import kind restrictions.")
+	fs.DurationVar(&o.maxDuration, "max-duration", 30*24*time.Hour, "Cap on how long imported bans and restrictions last here.")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Report what would be imported without changing the database.")
+	return fs
+}
+
+func runReputationImport(args []string) error {
+	var opts reputationImportOptions
+	opts.flagSet().Parse(args)
+	if opts.in == "" || opts.issuers == "" {
+		return errors.New("usage: adresu-plugin reputation import -in summary.json -issuer npub1... [flags]")
+	}
+
+	var trusted []string
+	for v := range strings.SplitSeq(opts.issuers, ",") {
+		pk, err := nip.NormalizePubKey(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("-issuer: %w", err)
+		}
+		trusted = append(trusted, pk)
+	}
+
+	data, err := os.ReadFile(opts.in)
+	if err != nil {
+		return err
+	}
+	var ev nostr.Event
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return fmt.Errorf("invalid summary file: %w", err)
+	}
+	summary, err := reputation.Verify(&ev, trusted)
+	if err != nil {
+		return err
+	}
+
+	db, err := openStore(opts.configPath, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	res, err := reputation.Apply(context.Background(), db, summary, reputation.ImportOptions{
+		Bans:         opts.bans,
+		Restrictions: opts.restrictions,
+		MaxDuration:  opts.maxDuration,
+		DryRun:       opts.dryRun,
+		Issuer:       ev.PubKey,
+	}, time.Now())
+	if err != nil {
+		return err
+	}
+
+	verb := "Imported"
+	if opts.dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s from %s (%s, %s): %d bans, %d restrictions; %d pubkeys skipped\n",
+		verb, ev.PubKey, summary.Relay, ev.CreatedAt.Time().Format(time.RFC3339), res.Banned, res.Restricted, res.Skipped)
+	return nil
+}
+
+// openStore opens the configured database for an operator command, with
+// readOnly as store.OpenReadOnly does.
+func openStore(configPath string, readOnly bool) (store.Store, error) {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	cfg, _, err := config.Load(configPath, false)
+	if err != nil {
+		return nil, err
+	}
+	if readOnly {
+		return store.OpenReadOnly(&cfg.DB)
+	}
+	return store.Open(&cfg.DB)
+}
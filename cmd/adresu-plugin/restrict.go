@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+// restrictOptions are the flags of "adresu-plugin restrict list|add|lift".
+type restrictOptions struct {
+	configPath string
+	pubkey     string
+	kinds      string
+	duration   time.Duration
+}
+
+func (o *restrictOptions) flagSet(command string) *flag.FlagSet {
+	fs := newFlagSet("restrict " + command)
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Configuration of the running plugin, for the admin API address and credentials.")
+	fs.StringVar(&o.pubkey, "pubkey", "", "Pubkey (npub or hex) to manage.")
+	fs.StringVar(&o.kinds, "kinds", "", "Comma-separated kinds (add: required; lift: empty lifts all).")
+	fs.DurationVar(&o.duration, "duration", 7*24*time.Hour, "How long an added restriction lasts.")
+	return fs
+}
+
+// runRestrict implements "adresu-plugin restrict <command>": managing the
+// per-pubkey kind restrictions of the running plugin through its admin API.
+func runRestrict(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: adresu-plugin restrict list|add|lift -pubkey key [-kinds 1,6] [-duration 168h]")
+	}
+	command := args[0]
+	var opts restrictOptions
+	opts.flagSet(command).Parse(args[1:])
+	if opts.pubkey == "" {
+		return errors.New("-pubkey is required")
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	cfg, _, err := config.Load(opts.configPath, false)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if !cfg.Admin.Enabled {
+		return fmt.Errorf("the admin API is disabled in %s; enable [admin] to use restrict", opts.configPath)
+	}
+
+	q := url.Values{"pubkey": {opts.pubkey}}
+	var resp *http.Response
+	switch command {
+	case "list":
+		resp, err = callAdmin(&cfg.Admin, http.MethodGet, "/restrictions?"+q.Encode(), nil)
+	case "add":
+		var kindList []int
+		for v := range strings.SplitSeq(opts.kinds, ",") {
+			kind, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("invalid -kinds: %q", opts.kinds)
+			}
+			kindList = append(kindList, kind)
+		}
+		body, _ := json.Marshal(map[string]any{"pubkey": opts.pubkey, "kinds": kindList, "duration": opts.duration.String()})
+		resp, err = callAdmin(&cfg.Admin, http.MethodPut, "/restrictions", bytes.NewReader(body))
+	case "lift":
+		if opts.kinds != "" {
+			q.Set("kinds", opts.kinds)
+		}
+		resp, err = callAdmin(&cfg.Admin, http.MethodDelete, "/restrictions?"+q.Encode(), nil)
+	default:
+		return fmt.Errorf("unknown restrict command %q", command)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var state struct {
+		PubKey       string              `json:"pubkey"`
+		Restrictions []store.Restriction `json:"restrictions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if len(state.Restrictions) == 0 {
+		fmt.Printf("%s has no restrictions\n", state.PubKey)
+		return nil
+	}
+	fmt.Printf("%s may not post:\n", state.PubKey)
+	for _, r := range state.Restrictions {
+		fmt.Printf("  kind %d until %s\n", r.Kind, r.Until.Format(time.RFC3339))
+	}
+	return nil
+}
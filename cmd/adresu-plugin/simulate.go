@@ -0,0 +1,187 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// simulateOptions are the flags of "adresu-plugin simulate".
+type simulateOptions struct {
+	configPath string
+	eventsPath string
+	rebaseTime bool
+	top        int
+}
+
+func (o *simulateOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("simulate")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Configuration file to simulate.")
+	fs.StringVar(&o.eventsPath, "events", "", "Corpus of strfry policy inputs, one JSON object per line (see gen-events).")
+	fs.BoolVar(&o.rebaseTime, "rebase-time", true, "Shift created_at so the newest corpus event is 'now'.")
+	fs.IntVar(&o.top, "top", 10, "Number of most frequent rejection messages to summarize.")
+	return fs
+}
+
+// runSimulate implements "adresu-plugin simulate": replaying a corpus of
+// policy inputs through a scratch pipeline, printing every decision as a JSON
+// line and a summary on stderr.
+func runSimulate(args []string) error {
+	var opts simulateOptions
+	opts.flagSet().Parse(args)
+
+	if opts.eventsPath == "" {
+		return errors.New("-events is required")
+	}
+	decisions, err := replayCorpus(opts.configPath, opts.eventsPath, opts.rebaseTime)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	rejections := make(map[string]int)
+	rejected := 0
+	for _, d := range decisions {
+		if err := encoder.Encode(d); err != nil {
+			return err
+		}
+		if d.Action == "reject" {
+			rejected++
+			rejections[d.Msg]++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Simulated %d events: %d accepted, %d rejected\n", len(decisions), len(decisions)-rejected, rejected)
+	msgs := slices.SortedFunc(maps.Keys(rejections), func(a, b string) int {
+		return cmp.Or(rejections[b]-rejections[a], cmp.Compare(a, b))
+	})
+	tw := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, msg := range msgs[:min(opts.top, len(msgs))] {
+		fmt.Fprintf(tw, "  %d\t%s\n", rejections[msg], msg)
+	}
+	return tw.Flush()
+}
+
+// explainOptions are the flags of "adresu-plugin explain".
+type explainOptions struct {
+	configPath string
+	eventPath  string
+	remoteIP   string
+}
+
+func (o *explainOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("explain")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Configuration file to explain the decision with.")
+	fs.StringVar(&o.eventPath, "event", "-", "File holding the event or strfry policy input as JSON (- reads stdin).")
+	fs.StringVar(&o.remoteIP, "ip", "", "Client address to assume (default the policy input's).")
+	return fs
+}
+
+// runExplain implements "adresu-plugin explain": running one event through
+// every filter of a scratch pipeline, including those after the first
+// rejection, and printing each verdict.
+func runExplain(args []string) error {
+	var opts explainOptions
+	opts.flagSet().Parse(args)
+
+	in, err := readExplainInput(opts.eventPath)
+	if err != nil {
+		return err
+	}
+	if opts.remoteIP != "" {
+		in.SourceType, in.SourceInfo, in.IP = "", "", opts.remoteIP
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	cfg, _, err := config.Load(opts.configPath, false)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	p, cleanup, err := scratchPipeline(cfg)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	results, msg, err := p.Explain(in.Context(context.Background()), &in.Event, in.RemoteIP())
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILTER\tVERDICT\tTIME\tREASON")
+	for _, res := range results {
+		verdict := "accept"
+		switch {
+		case !res.Allowed:
+			verdict = "reject"
+		case res.ShadowBan:
+			verdict = "shadow"
+		case res.Strike:
+			verdict = "strike"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Filter, verdict, res.Duration, res.Reason)
+	}
+	tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	for _, res := range results {
+		if !res.Allowed {
+			fmt.Printf("\nDecision: reject by %s: %s\n", res.Filter, msg)
+			return nil
+		}
+	}
+	for _, res := range results {
+		if res.ShadowBan {
+			fmt.Printf("\nDecision: shadow-ban by %s (accepted, then deleted)\n", res.Filter)
+			return nil
+		}
+	}
+	fmt.Println("\nDecision: accept")
+	return nil
+}
+
+// readExplainInput reads a policy input, or a bare event, from path.
+func readExplainInput(path string) (*PolicyInput, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	in := &PolicyInput{Type: "new"}
+	if _, ok := probe["event"]; ok {
+		err = json.Unmarshal(data, in)
+	} else {
+		var event nostr.Event
+		err = json.Unmarshal(data, &event)
+		in.Event = event
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	return in, nil
+}
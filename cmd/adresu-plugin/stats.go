@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/metrics"
+)
+
+// adminKeyEnv names the environment variable holding an admin key for
+// NIP-98 signed admin API calls.
+const adminKeyEnv = "ADRESU_ADMIN_KEY"
+
+// statsOptions are the flags of "adresu-plugin stats".
+type statsOptions struct {
+	configPath string
+	since      time.Duration
+	top        int
+}
+
+func (o *statsOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("stats")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Configuration of the running plugin, for the admin API address and credentials.")
+	fs.DurationVar(&o.since, "since", time.Hour, "Report on this recent window (at most 24h).")
+	fs.IntVar(&o.top, "top", 10, "Number of top rejection reasons to show.")
+	return fs
+}
+
+// runStats implements "adresu-plugin stats": a terminal report of recent
+// decisions, fetched from the running plugin's admin API.
+func runStats(args []string) error {
+	var opts statsOptions
+	opts.flagSet().Parse(args)
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	cfg, _, err := config.Load(opts.configPath, false)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if !cfg.Admin.Enabled {
+		return fmt.Errorf("the admin API is disabled in %s; enable [admin] to use stats", opts.configPath)
+	}
+
+	q := url.Values{"since": {opts.since.String()}, "top": {fmt.Sprint(opts.top)}}
+	resp, err := callAdmin(&cfg.Admin, http.MethodGet, "/stats?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var report metrics.StatsReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return fmt.Errorf("invalid stats response: %w", err)
+	}
+	printStats(os.Stdout, report)
+	return nil
+}
+
+func printStats(w io.Writer, r metrics.StatsReport) {
+	total := r.Accepted + r.Rejected
+	fmt.Fprintf(w, "Last %s: %d events, %d accepted, %d rejected (accept ratio %.1f%%), %d bans issued\n",
+		r.Since, total, r.Accepted, r.Rejected, r.AcceptRatio*100, r.Bans)
+	if len(r.TopReasons) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\nTop rejection reasons:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  COUNT\tSHARE\tFILTER\tREASON")
+	for _, rc := range r.TopReasons {
+		fmt.Fprintf(tw, "  %d\t%.1f%%\t%s\t%s\n", rc.Count, float64(rc.Count)/float64(r.Rejected)*100, rc.Filter, rc.Reason)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nRejections by filter:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  COUNT\tSHARE\tFILTER")
+	for _, fc := range r.Filters {
+		fmt.Fprintf(tw, "  %d\t%.1f%%\t%s\n", fc.Count, float64(fc.Count)/float64(r.Rejected)*100, fc.Filter)
+	}
+	tw.Flush()
+}
+
+// callAdmin sends an authenticated request to the running plugin's admin
+// API. Requests are signed with NIP-98 when $ADRESU_ADMIN_KEY holds an admin
+// key, and carry the configured token otherwise. Responses other than 200 OK
+// are returned as errors.
+func callAdmin(cfg *config.AdminConfig, method, path string, body io.Reader) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = io.ReadAll(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, adminURL(cfg, path), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if key := os.Getenv(adminKeyEnv); key != "" {
+		auth, err := signAdminRequest(cfg, key, method, path, payload)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", adminKeyEnv, err)
+		}
+		req.Header.Set("Authorization", auth)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the plugin (is it running?): %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("admin API returned %s: %s", resp.Status, msg)
+	}
+	return resp, nil
+}
+
+// signAdminRequest returns a NIP-98 Authorization header for a request.
+func signAdminRequest(cfg *config.AdminConfig, secretKey, method, path string, payload []byte) (string, error) {
+	key, err := parseSecretKey(secretKey)
+	if err != nil {
+		return "", err
+	}
+	signedURL := adminURL(cfg, path)
+	if cfg.PublicURL != "" {
+		signedURL = strings.TrimSuffix(cfg.PublicURL, "/") + path
+	}
+	ev := nostr.Event{
+		Kind:      nostr.KindHTTPAuth,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"u", signedURL}, {"method", method}},
+	}
+	// The admin API wants the body hash, even of an empty body, for every
+	// method that may carry one.
+	if len(payload) > 0 || (method != http.MethodGet && method != http.MethodHead) {
+		sum := sha256.Sum256(payload)
+		ev.Tags = append(ev.Tags, nostr.Tag{"payload", hex.EncodeToString(sum[:])})
+	}
+	if err := ev.Sign(hex.EncodeToString(key.Serialize())); err != nil {
+		return "", err
+	}
+	data, _ := json.Marshal(ev)
+	return "Nostr " + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// adminURL returns the URL of an admin API endpoint on the local plugin.
+func adminURL(cfg *config.AdminConfig, path string) string {
+	host, port, err := net.SplitHostPort(cfg.Listen)
+	if err != nil {
+		return "http://" + cfg.Listen + path
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + path
+}
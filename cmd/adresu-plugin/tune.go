@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// logRecord holds the fields of the plugin's JSON log lines used for tuning.
+type logRecord struct {
+	Msg            string `json:"msg"`
+	Filter         string `json:"filter_name"`
+	Reason         string `json:"reason"`
+	PubKey         string `json:"pubkey"`
+	UnbannedPubKey string `json:"unbanned_pubkey"`
+	ByFilter       string `json:"by_filter"`
+}
+
+type tuneStats struct {
+	lines           int
+	rejections      map[string]int            // filter -> count
+	reasons         map[string]map[string]int // filter -> reason -> count
+	rejectedBy      map[string]map[string]struct{}
+	autoBans        map[string]int // triggering filter -> count
+	unbanned        map[string]int // filter -> rejected pubkeys later unbanned by a moderator
+	patternHits     map[string]int
+	rateRuleHits    map[string]int
+	unbannedPubKeys map[string]struct{}
+}
+
+// tuneOptions are the flags of "adresu-plugin tune".
+type tuneOptions struct {
+	configPath string
+	logPath    string
+	minFPRatio float64
+}
+
+func (o *tuneOptions) flagSet() *flag.FlagSet {
+	fs := newFlagSet("tune")
+	fs.StringVar(&o.configPath, "config", "./config.toml", "Configuration file to tune.")
+	fs.StringVar(&o.logPath, "log", "", "Plugin JSON log file to analyze ('-' for stdin).")
+	fs.Float64Var(&o.minFPRatio, "min-fp-ratio", 0.05, "Flag filters whose rejected authors were later unbanned at least this often.")
+	return fs
+}
+
+// runTune analyzes the plugin's JSON log (the audit trail of all decisions)
+// and suggests configuration changes: dead keyword patterns, rate rules that
+// never trigger, and filters whose rejections are often reversed by moderators.
+func runTune(args []string) error {
+	var opts tuneOptions
+	opts.flagSet().Parse(args)
+
+	if opts.logPath == "" {
+		return fmt.Errorf("-log is required")
+	}
+	cfg, _, err := config.Load(opts.configPath, false)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	var r io.Reader = os.Stdin
+	if opts.logPath != "-" {
+		f, err := os.Open(opts.logPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	stats, err := collectTuneStats(r)
+	if err != nil {
+		return err
+	}
+	printTuneReport(os.Stdout, cfg, stats, opts.minFPRatio)
+	return nil
+}
+
+func collectTuneStats(r io.Reader) (*tuneStats, error) {
+	s := &tuneStats{
+		rejections:      make(map[string]int),
+		reasons:         make(map[string]map[string]int),
+		rejectedBy:      make(map[string]map[string]struct{}),
+		autoBans:        make(map[string]int),
+		unbanned:        make(map[string]int),
+		patternHits:     make(map[string]int),
+		rateRuleHits:    make(map[string]int),
+		unbannedPubKeys: make(map[string]struct{}),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec logRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		s.lines++
+
+		switch rec.Msg {
+		case "Event rejected by filter":
+			s.rejections[rec.Filter]++
+			if s.reasons[rec.Filter] == nil {
+				s.reasons[rec.Filter] = make(map[string]int)
+			}
+			s.reasons[rec.Filter][rec.Reason]++
+			if s.rejectedBy[rec.PubKey] == nil {
+				s.rejectedBy[rec.PubKey] = make(map[string]struct{})
+			}
+			s.rejectedBy[rec.PubKey][rec.Filter] = struct{}{}
+
+			if src, ok := quotedSuffix(rec.Reason, "forbidden_pattern_found:"); ok {
+				s.patternHits[src]++
+			}
+			if desc, ok := quotedSuffix(rec.Reason, "rate_limit_exceeded:rule:"); ok {
+				s.rateRuleHits[strings.TrimSuffix(desc, " (thread reply)")]++
+			}
+
+		case "Auto-banning user for repeated violations":
+			s.autoBans[rec.ByFilter]++
+
+		case "Moderator action: unbanning pubkey":
+			if _, seen := s.unbannedPubKeys[rec.UnbannedPubKey]; seen {
+				continue
+			}
+			s.unbannedPubKeys[rec.UnbannedPubKey] = struct{}{}
+			for filter := range s.rejectedBy[rec.UnbannedPubKey] {
+				s.unbanned[filter]++
+			}
+		}
+	}
+	return s, scanner.Err()
+}
+
+func printTuneReport(w io.Writer, cfg *config.Config, s *tuneStats, minFPRatio float64) {
+	fmt.Fprintf(w, "Analyzed %d log records.\n\n", s.lines)
+
+	fmt.Fprintln(w, "Rejections by filter:")
+	for _, filter := range sortedByCount(s.rejections) {
+		fmt.Fprintf(w, "  %-24s %8d\n", filter, s.rejections[filter])
+		reasons := sortedByCount(s.reasons[filter])
+		for _, reason := range reasons[:min(3, len(reasons))] {
+			fmt.Fprintf(w, "      %8d  %s\n", s.reasons[filter][reason], reason)
+		}
+	}
+	if len(s.autoBans) > 0 {
+		fmt.Fprintln(w, "\nAuto-bans by triggering filter:")
+		for _, filter := range sortedByCount(s.autoBans) {
+			fmt.Fprintf(w, "  %-24s %8d\n", filter, s.autoBans[filter])
+		}
+	}
+
+	var suggestions []string
+
+	// Keyword patterns without a single hit only cost CPU.
+	for i, rule := range cfg.Filters.Keywords.Rules {
+		if !cfg.Filters.Keywords.Enabled {
+			break
+		}
+		keepWords := slices.DeleteFunc(slices.Clone(rule.Words), func(w string) bool { return s.patternHits[w] == 0 })
+		keepRegexps := slices.DeleteFunc(slices.Clone(rule.Regexps), func(rx string) bool { return s.patternHits[rx] == 0 })
+		if len(keepWords) == len(rule.Words) && len(keepRegexps) == len(rule.Regexps) {
+			continue
+		}
+		hunk := fmt.Sprintf("# [[filters.keywords.rule]] #%d (%q): patterns with zero hits\n", i, rule.Description)
+		if len(keepWords) != len(rule.Words) {
+			hunk += fmt.Sprintf("-words   = %s\n+words   = %s\n", tomlList(rule.Words), tomlList(keepWords))
+		}
+		if len(keepRegexps) != len(rule.Regexps) {
+			hunk += fmt.Sprintf("-regexps = %s\n+regexps = %s\n", tomlList(rule.Regexps), tomlList(keepRegexps))
+		}
+		suggestions = append(suggestions, hunk)
+	}
+
+	// Rate rules that never trigger may be too generous to matter.
+	if cfg.Filters.RateLimiter.Enabled {
+		for i, rule := range cfg.Filters.RateLimiter.Rules {
+			if rule.Rate <= 0 || s.rateRuleHits[rule.Description] > 0 {
+				continue
+			}
+			suggestions = append(suggestions, fmt.Sprintf(
+				"# [[filters.rate_limiter.rule]] #%d (%q) never triggered; consider tightening or removing it\n-rate  = %g\n+rate  = %g\n",
+				i, rule.Description, rule.Rate, rule.Rate/2))
+		}
+	}
+
+	// Filters whose rejected authors moderators later unbanned look like false positives.
+	var noisy []string
+	for filter, unbans := range s.unbanned {
+		authors := 0
+		for _, filters := range s.rejectedBy {
+			if _, ok := filters[filter]; ok {
+				authors++
+			}
+		}
+		if authors > 0 && float64(unbans)/float64(authors) >= minFPRatio {
+			noisy = append(noisy, filter)
+			suggestions = append(suggestions, fmt.Sprintf(
+				"# %s: %d of %d rejected authors were later unbanned by a moderator (possible false positives)\n",
+				filter, unbans, authors))
+		}
+	}
+	if len(noisy) > 0 && cfg.Filters.AutoBan.Enabled {
+		slices.Sort(noisy)
+		exclude := slices.Clone(cfg.Filters.AutoBan.ExcludeFilters)
+		for _, f := range noisy {
+			if !slices.Contains(exclude, f) {
+				exclude = append(exclude, f)
+			}
+		}
+		if len(exclude) != len(cfg.Filters.AutoBan.ExcludeFilters) {
+			suggestions = append(suggestions, fmt.Sprintf(
+				"# [filters.autoban]: stop striking on noisy filters\n-exclude_filters_from_strikes = %s\n+exclude_filters_from_strikes = %s\n",
+				tomlList(cfg.Filters.AutoBan.ExcludeFilters), tomlList(exclude)))
+		}
+	}
+
+	fmt.Fprintln(w, "\nSuggested config changes:")
+	if len(suggestions) == 0 {
+		fmt.Fprintln(w, "  none, the current configuration looks well tuned for this log.")
+		return
+	}
+	for _, hunk := range suggestions {
+		fmt.Fprintln(w)
+		fmt.Fprint(w, hunk)
+	}
+}
+
+// quotedSuffix extracts X from reasons formatted as prefix + "'X'".
+func quotedSuffix(reason, prefix string) (string, bool) {
+	rest, ok := strings.CutPrefix(reason, prefix)
+	if !ok || len(rest) < 2 || rest[0] != '\'' || rest[len(rest)-1] != '\'' {
+		return "", false
+	}
+	return rest[1 : len(rest)-1], true
+}
+
+func sortedByCount(m map[string]int) []string {
+	keys := slices.Collect(maps.Keys(m))
+	slices.SortFunc(keys, func(a, b string) int {
+		if c := cmp.Compare(m[b], m[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return keys
+}
+
+func tomlList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, it := range items {
+		b, _ := json.Marshal(it)
+		quoted[i] = string(b)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
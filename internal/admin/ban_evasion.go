@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+)
+
+// BanEvasionHandler lists (GET) the ban evasion candidates flagged by the
+// current pipeline, newest last, for moderators to review.
+type BanEvasionHandler struct {
+	candidates func() []policy.EvasionCandidate
+}
+
+// NewBanEvasionHandler creates a BanEvasionHandler; candidates returns those
+// of the pipeline in use, which changes on reloads.
+func NewBanEvasionHandler(candidates func() []policy.EvasionCandidate) *BanEvasionHandler {
+	return &BanEvasionHandler{candidates: candidates}
+}
+
+func (h *BanEvasionHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	candidates := h.candidates()
+	if candidates == nil {
+		candidates = []policy.EvasionCandidate{}
+	}
+	writeJSON(w, candidates)
+}
@@ -0,0 +1,225 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+// banSource is recorded as the source of bans issued through the admin API.
+const banSource = "admin"
+
+type banRequest struct {
+	PubKey string `json:"pubkey"`
+	IP     string `json:"ip"`
+	// Duration defaults to policy.ban_duration.
+	Duration string `json:"duration"`
+	Reason   string `json:"reason"`
+	// DeleteEvents deletes the pubkey's events from strfry, like a moderator
+	// ban; it defaults to true.
+	DeleteEvents *bool `json:"delete_events"`
+}
+
+type pubkeyBan struct {
+	PubKey string `json:"pubkey"`
+	store.BanInfo
+}
+
+type bansState struct {
+	PubKeys []pubkeyBan   `json:"pubkeys"`
+	IPs     []store.IPBan `json:"ips"`
+}
+
+// BansHandler lists (GET, or GET ?pubkey= for one ban), adds (PUT) and lifts
+// (DELETE ?pubkey= or ?ip=) pubkey and IP bans.
+type BansHandler struct {
+	moderator   *policy.Moderator
+	store       store.Store
+	banDuration time.Duration
+}
+
+// NewBansHandler creates a BansHandler; banDuration is the default duration
+// of bans.
+func NewBansHandler(m *policy.Moderator, s store.Store, banDuration time.Duration) *BansHandler {
+	return &BansHandler{moderator: m, store: s, banDuration: banDuration}
+}
+
+func (h *BansHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if v := r.URL.Query().Get("pubkey"); v != "" {
+			h.serveBan(w, r, v)
+			return
+		}
+		h.serveBans(w, r)
+
+	case http.MethodPut:
+		var req banRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+			return
+		}
+		duration := h.banDuration
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil || d <= 0 {
+				http.Error(w, "duration must be a positive duration such as \"72h\"", http.StatusBadRequest)
+				return
+			}
+			duration = d
+		}
+		if req.Reason == "" {
+			req.Reason = "manual"
+		}
+		info := store.BanInfo{Reason: req.Reason, Source: banSource}
+		switch {
+		case req.PubKey != "" && req.IP == "":
+			pubkey, err := nip.NormalizePubKey(req.PubKey)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid pubkey: %v", err), http.StatusBadRequest)
+				return
+			}
+			deleteEvents := req.DeleteEvents == nil || *req.DeleteEvents
+			if err := h.moderator.Ban(r.Context(), pubkey, duration, info, deleteEvents); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			slog.Warn("Pubkey banned via admin API", "pubkey", pubkey, "duration", duration,
+				"reason", req.Reason, "delete_events", deleteEvents, "remote_addr", r.RemoteAddr)
+			h.serveBan(w, r, pubkey)
+		case req.IP != "" && req.PubKey == "":
+			if !validIP(req.IP) {
+				http.Error(w, fmt.Sprintf("invalid ip: %q", req.IP), http.StatusBadRequest)
+				return
+			}
+			key, err := h.moderator.BanIP(r.Context(), req.IP, duration, info)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			slog.Warn("IP banned via admin API", "ip", key, "duration", duration, "reason", req.Reason, "remote_addr", r.RemoteAddr)
+			info.CreatedAt = time.Now().UTC().Truncate(time.Second)
+			info.ExpiresAt = info.CreatedAt.Add(duration)
+			writeJSON(w, store.IPBan{IP: key, BanInfo: info})
+		default:
+			http.Error(w, "exactly one of pubkey and ip is required", http.StatusBadRequest)
+		}
+
+	case http.MethodDelete:
+		q := r.URL.Query()
+		switch {
+		case q.Has("pubkey") && !q.Has("ip"):
+			pubkey, err := nip.NormalizePubKey(q.Get("pubkey"))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid pubkey: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := h.moderator.Unban(r.Context(), pubkey); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			slog.Warn("Pubkey unbanned via admin API", "pubkey", pubkey, "remote_addr", r.RemoteAddr)
+		case q.Has("ip") && !q.Has("pubkey"):
+			if !validIP(q.Get("ip")) {
+				http.Error(w, fmt.Sprintf("invalid ip: %q", q.Get("ip")), http.StatusBadRequest)
+				return
+			}
+			key, err := h.moderator.UnbanIP(r.Context(), q.Get("ip"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			slog.Warn("IP unbanned via admin API", "ip", key, "remote_addr", r.RemoteAddr)
+		default:
+			http.Error(w, "exactly one of pubkey and ip is required", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveBan writes the ban of pubkey, or 404 if it is not banned.
+func (h *BansHandler) serveBan(w http.ResponseWriter, r *http.Request, pubkey string) {
+	pk, err := nip.NormalizePubKey(pubkey)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid pubkey: %v", err), http.StatusBadRequest)
+		return
+	}
+	info, err := h.store.GetBanInfo(r.Context(), pk)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info == nil {
+		http.Error(w, "not banned", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, pubkeyBan{PubKey: pk, BanInfo: *info})
+}
+
+// serveBans writes every active pubkey and IP ban.
+func (h *BansHandler) serveBans(w http.ResponseWriter, r *http.Request) {
+	pubkeys, err := pubkeyBans(r.Context(), h.store)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ips, err := h.store.IPBans(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ips == nil {
+		ips = []store.IPBan{}
+	}
+	writeJSON(w, bansState{PubKeys: pubkeys, IPs: ips})
+}
+
+// pubkeyBans returns every active pubkey ban.
+func pubkeyBans(ctx context.Context, s store.Store) ([]pubkeyBan, error) {
+	records, err := s.Authors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bans := []pubkeyBan{}
+	for _, rec := range records {
+		if rec.BannedUntil.IsZero() {
+			continue
+		}
+		info, err := s.GetBanInfo(ctx, rec.PubKey)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil { // Nil if it expired since Authors ran.
+			bans = append(bans, pubkeyBan{PubKey: rec.PubKey, BanInfo: *info})
+		}
+	}
+	return bans, nil
+}
+
+// validIP reports whether s is an address or a network in CIDR notation.
+func validIP(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(s)
+	return err == nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
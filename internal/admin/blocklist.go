@@ -0,0 +1,148 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+type blockRequest struct {
+	// EventID blocks the event and, if strfry stores it, its content; the
+	// stored event is deleted.
+	EventID string `json:"event_id"`
+	// ContentHash is the hex SHA-256 of the content to block.
+	ContentHash string `json:"content_hash"`
+	// Content is the content to block, hashed by the plugin.
+	Content string `json:"content"`
+	// Duration defaults to filters.blocklist.duration.
+	Duration string `json:"duration"`
+	Reason   string `json:"reason"`
+}
+
+// BlocklistHandler lists (GET), adds (PUT) and removes (DELETE ?event_id= or
+// ?content_hash=) blocklist entries. Entries listed in the config file are
+// not in the database, so they are neither listed nor removable here.
+type BlocklistHandler struct {
+	moderator *policy.Moderator
+	store     store.Store
+	duration  time.Duration
+}
+
+// NewBlocklistHandler creates a BlocklistHandler; duration is the default
+// duration of entries.
+func NewBlocklistHandler(m *policy.Moderator, s store.Store, duration time.Duration) *BlocklistHandler {
+	return &BlocklistHandler{moderator: m, store: s, duration: duration}
+}
+
+func (h *BlocklistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := h.store.Blocklist(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if entries == nil {
+			entries = []store.BlockedEntry{}
+		}
+		writeJSON(w, entries)
+
+	case http.MethodPut:
+		var req blockRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024*1024)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+			return
+		}
+		duration := h.duration
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil || d <= 0 {
+				http.Error(w, "duration must be a positive duration such as \"72h\"", http.StatusBadRequest)
+				return
+			}
+			duration = d
+		}
+		if req.Reason == "" {
+			req.Reason = "manual"
+		}
+		info := store.BanInfo{Reason: req.Reason, Source: banSource}
+		req.EventID = strings.ToLower(req.EventID)
+		req.ContentHash = strings.ToLower(req.ContentHash)
+
+		var keys []string
+		switch {
+		case req.EventID != "" && req.ContentHash == "" && req.Content == "":
+			if !nostr.IsValid32ByteHex(req.EventID) {
+				http.Error(w, fmt.Sprintf("invalid event_id: %q", req.EventID), http.StatusBadRequest)
+				return
+			}
+			var err error
+			if keys, err = h.moderator.BlockEvent(r.Context(), req.EventID, duration, info); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		case req.ContentHash != "" && req.EventID == "" && req.Content == "":
+			key := store.BlockedContentPrefix + req.ContentHash
+			if !store.ValidBlockKey(key) {
+				http.Error(w, fmt.Sprintf("invalid content_hash: %q", req.ContentHash), http.StatusBadRequest)
+				return
+			}
+			keys = []string{key}
+		case req.Content != "" && req.EventID == "" && req.ContentHash == "":
+			keys = []string{policy.ContentBlockKey(req.Content)}
+		default:
+			http.Error(w, "exactly one of event_id, content_hash and content is required", http.StatusBadRequest)
+			return
+		}
+		if req.EventID == "" {
+			if err := h.moderator.Block(r.Context(), keys[0], duration, info); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		slog.Warn("Blocked via admin API", "keys", keys, "duration", duration, "reason", req.Reason, "remote_addr", r.RemoteAddr)
+
+		info.CreatedAt = time.Now().UTC().Truncate(time.Second)
+		info.ExpiresAt = info.CreatedAt.Add(duration)
+		entries := make([]store.BlockedEntry, 0, len(keys))
+		for _, key := range keys {
+			entries = append(entries, store.BlockedEntry{Key: key, BanInfo: info})
+		}
+		writeJSON(w, entries)
+
+	case http.MethodDelete:
+		q := r.URL.Query()
+		var key string
+		switch {
+		case q.Has("event_id") && !q.Has("content_hash"):
+			key = store.BlockedEventPrefix + strings.ToLower(q.Get("event_id"))
+		case q.Has("content_hash") && !q.Has("event_id"):
+			key = store.BlockedContentPrefix + strings.ToLower(q.Get("content_hash"))
+		default:
+			http.Error(w, "exactly one of event_id and content_hash is required", http.StatusBadRequest)
+			return
+		}
+		if !store.ValidBlockKey(key) {
+			http.Error(w, fmt.Sprintf("invalid blocklist key: %q", key), http.StatusBadRequest)
+			return
+		}
+		if err := h.moderator.Unblock(r.Context(), key); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.Warn("Unblocked via admin API", "key", key, "remote_addr", r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,134 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+)
+
+const subscriberBuffer = 256
+
+// DecisionStream fans pipeline decisions out to live subscribers. It outlives
+// pipeline reloads, so streams stay open when the configuration changes.
+type DecisionStream struct {
+	mu   sync.RWMutex
+	subs map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	ch      chan policy.Decision
+	action  string
+	filter  string
+	pubkey  string
+	reason  string
+	dropped atomic.Int64
+}
+
+func NewDecisionStream() *DecisionStream {
+	return &DecisionStream{subs: make(map[*subscriber]struct{})}
+}
+
+// ObserveDecision implements policy.DecisionObserver. Slow subscribers lose
+// decisions instead of delaying the pipeline.
+func (ds *DecisionStream) ObserveDecision(d policy.Decision) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	for sub := range ds.subs {
+		if !sub.matches(d) {
+			continue
+		}
+		select {
+		case sub.ch <- d:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+func (sub *subscriber) matches(d policy.Decision) bool {
+	return (sub.action == "" || sub.action == d.Action) &&
+		(sub.filter == "" || sub.filter == d.Filter) &&
+		(sub.pubkey == "" || sub.pubkey == d.PubKey) &&
+		(sub.reason == "" || sub.matchesReason(d))
+}
+
+// matchesReason reports whether the final reason or the verdict of any stage
+// starts with the requested reason, so non-rejecting outcomes such as trainee
+// moderator actions can be followed too.
+func (sub *subscriber) matchesReason(d policy.Decision) bool {
+	if strings.HasPrefix(d.Reason, sub.reason) {
+		return true
+	}
+	for _, st := range d.Stages {
+		if strings.HasPrefix(st.Reason, sub.reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP streams decisions as Server-Sent Events, optionally filtered by
+// the action, filter, pubkey and reason (a prefix) query parameters.
+func (ds *DecisionStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	sub := &subscriber{
+		ch:     make(chan policy.Decision, subscriberBuffer),
+		action: q.Get("action"),
+		filter: q.Get("filter"),
+		reason: q.Get("reason"),
+	}
+	if pk := q.Get("pubkey"); pk != "" {
+		hexKey, err := nip.NormalizePubKey(pk)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid pubkey: %v", err), http.StatusBadRequest)
+			return
+		}
+		sub.pubkey = hexKey
+	}
+
+	ds.mu.Lock()
+	ds.subs[sub] = struct{}{}
+	ds.mu.Unlock()
+	defer func() {
+		ds.mu.Lock()
+		delete(ds.subs, sub)
+		ds.mu.Unlock()
+		if n := sub.dropped.Load(); n > 0 {
+			slog.Warn("Decision stream subscriber was too slow", "dropped", n)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case d := <-sub.ch:
+			data, err := json.Marshal(d)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: decision\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
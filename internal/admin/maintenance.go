@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+)
+
+type maintenanceState struct {
+	Mode    config.MaintenanceMode `json:"mode"`
+	Message string                 `json:"message,omitempty"`
+}
+
+// MaintenanceHandler reports (GET) and switches (PUT) the maintenance mode.
+type MaintenanceHandler struct {
+	sw *policy.MaintenanceSwitch
+}
+
+func NewMaintenanceHandler(sw *policy.MaintenanceSwitch) *MaintenanceHandler {
+	return &MaintenanceHandler{sw: sw}
+}
+
+func (h *MaintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var state maintenanceState
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&state); err != nil {
+			http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if state.Mode == "" {
+			http.Error(w, "mode is required", http.StatusBadRequest)
+			return
+		}
+		h.sw.Set(state.Mode, state.Message)
+		slog.Warn("Maintenance mode switched via admin API", "mode", state.Mode, "remote_addr", r.RemoteAddr)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mode, message := h.sw.Get()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenanceState{Mode: mode, Message: message})
+}
@@ -0,0 +1,260 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+// nip86ContentType is the content type of NIP-86 requests and responses.
+const nip86ContentType = "application/nostr+json+rpc"
+
+type nip86Request struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type nip86Response struct {
+	Result any    `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// nip86Entry is an item of the listbannedpubkeys, listbannedevents and
+// listblockedips results.
+type nip86Entry struct {
+	PubKey string `json:"pubkey,omitempty"`
+	ID     string `json:"id,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// nip86Method executes a NIP-86 method with its params.
+type nip86Method func(h *NIP86Handler, r *http.Request, params []json.RawMessage) (any, error)
+
+// nip86Methods are the supported methods. Allowing a pubkey lifts its ban,
+// since access is open to everyone not banned.
+var nip86Methods = map[string]nip86Method{
+	"banpubkey":         (*NIP86Handler).banPubKey,
+	"allowpubkey":       (*NIP86Handler).allowPubKey,
+	"listbannedpubkeys": (*NIP86Handler).listBannedPubKeys,
+	"banevent":          (*NIP86Handler).banEvent,
+	"allowevent":        (*NIP86Handler).allowEvent,
+	"listbannedevents":  (*NIP86Handler).listBannedEvents,
+	"blockip":           (*NIP86Handler).blockIP,
+	"unblockip":         (*NIP86Handler).unblockIP,
+	"listblockedips":    (*NIP86Handler).listBlockedIPs,
+}
+
+// NIP86Handler serves the NIP-86 relay management API for the bans it can
+// express: pubkey and IP bans, with the same effects as the /bans endpoint,
+// and event bans, which block events like the /blocklist endpoint.
+type NIP86Handler struct {
+	moderator                  *policy.Moderator
+	store                      store.Store
+	banDuration, blockDuration time.Duration
+}
+
+// NewNIP86Handler creates a NIP86Handler; bans last banDuration and event
+// bans blockDuration.
+func NewNIP86Handler(m *policy.Moderator, s store.Store, banDuration, blockDuration time.Duration) *NIP86Handler {
+	return &NIP86Handler{moderator: m, store: s, banDuration: banDuration, blockDuration: blockDuration}
+}
+
+func (h *NIP86Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req nip86Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeNIP86(w, http.StatusBadRequest, nip86Response{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	if req.Method == "supportedmethods" {
+		methods := append([]string{"supportedmethods"}, slices.Sorted(maps.Keys(nip86Methods))...)
+		writeNIP86(w, http.StatusOK, nip86Response{Result: methods})
+		return
+	}
+	method, ok := nip86Methods[req.Method]
+	if !ok {
+		writeNIP86(w, http.StatusOK, nip86Response{Error: fmt.Sprintf("unsupported method %q", req.Method)})
+		return
+	}
+	result, err := method(h, r, req.Params)
+	if err != nil {
+		writeNIP86(w, http.StatusOK, nip86Response{Error: err.Error()})
+		return
+	}
+	writeNIP86(w, http.StatusOK, nip86Response{Result: result})
+}
+
+func (h *NIP86Handler) banPubKey(r *http.Request, params []json.RawMessage) (any, error) {
+	pubkey, reason, err := nip86Target(params, nip.NormalizePubKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.moderator.Ban(r.Context(), pubkey, h.banDuration, store.BanInfo{Reason: reason, Source: banSource}, true); err != nil {
+		return nil, err
+	}
+	slog.Warn("Pubkey banned via NIP-86", "pubkey", pubkey, "reason", reason, "remote_addr", r.RemoteAddr)
+	return true, nil
+}
+
+func (h *NIP86Handler) allowPubKey(r *http.Request, params []json.RawMessage) (any, error) {
+	pubkey, _, err := nip86Target(params, nip.NormalizePubKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.moderator.Unban(r.Context(), pubkey); err != nil {
+		return nil, err
+	}
+	slog.Warn("Pubkey unbanned via NIP-86", "pubkey", pubkey, "remote_addr", r.RemoteAddr)
+	return true, nil
+}
+
+func (h *NIP86Handler) listBannedPubKeys(r *http.Request, _ []json.RawMessage) (any, error) {
+	bans, err := pubkeyBans(r.Context(), h.store)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]nip86Entry, 0, len(bans))
+	for _, b := range bans {
+		entries = append(entries, nip86Entry{PubKey: b.PubKey, Reason: b.Reason})
+	}
+	return entries, nil
+}
+
+func (h *NIP86Handler) banEvent(r *http.Request, params []json.RawMessage) (any, error) {
+	id, reason, err := nip86Target(params, parseEventID)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := h.moderator.BlockEvent(r.Context(), id, h.blockDuration, store.BanInfo{Reason: reason, Source: banSource})
+	if err != nil {
+		return nil, err
+	}
+	slog.Warn("Event banned via NIP-86", "keys", keys, "reason", reason, "remote_addr", r.RemoteAddr)
+	return true, nil
+}
+
+// allowEvent lifts the block of the event ID; a block of its content stays.
+func (h *NIP86Handler) allowEvent(r *http.Request, params []json.RawMessage) (any, error) {
+	id, _, err := nip86Target(params, parseEventID)
+	if err != nil {
+		return nil, err
+	}
+	key := policy.EventBlockKey(id)
+	if err := h.moderator.Unblock(r.Context(), key); err != nil {
+		return nil, err
+	}
+	slog.Warn("Event allowed via NIP-86", "key", key, "remote_addr", r.RemoteAddr)
+	return true, nil
+}
+
+func (h *NIP86Handler) listBannedEvents(r *http.Request, _ []json.RawMessage) (any, error) {
+	blocked, err := h.store.Blocklist(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]nip86Entry, 0, len(blocked))
+	for _, b := range blocked {
+		if id, ok := strings.CutPrefix(b.Key, store.BlockedEventPrefix); ok {
+			entries = append(entries, nip86Entry{ID: id, Reason: b.Reason})
+		}
+	}
+	return entries, nil
+}
+
+func (h *NIP86Handler) blockIP(r *http.Request, params []json.RawMessage) (any, error) {
+	ip, reason, err := nip86Target(params, parseIP)
+	if err != nil {
+		return nil, err
+	}
+	key, err := h.moderator.BanIP(r.Context(), ip, h.banDuration, store.BanInfo{Reason: reason, Source: banSource})
+	if err != nil {
+		return nil, err
+	}
+	slog.Warn("IP banned via NIP-86", "ip", key, "reason", reason, "remote_addr", r.RemoteAddr)
+	return true, nil
+}
+
+func (h *NIP86Handler) unblockIP(r *http.Request, params []json.RawMessage) (any, error) {
+	ip, _, err := nip86Target(params, parseIP)
+	if err != nil {
+		return nil, err
+	}
+	key, err := h.moderator.UnbanIP(r.Context(), ip)
+	if err != nil {
+		return nil, err
+	}
+	slog.Warn("IP unbanned via NIP-86", "ip", key, "remote_addr", r.RemoteAddr)
+	return true, nil
+}
+
+func (h *NIP86Handler) listBlockedIPs(r *http.Request, _ []json.RawMessage) (any, error) {
+	bans, err := h.store.IPBans(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]nip86Entry, 0, len(bans))
+	for _, b := range bans {
+		entries = append(entries, nip86Entry{IP: b.IP, Reason: b.Reason})
+	}
+	return entries, nil
+}
+
+// nip86Target decodes the params of a ban method: the target, checked and
+// normalized by parse, and an optional reason ("manual" if absent).
+func nip86Target(params []json.RawMessage, parse func(string) (string, error)) (string, string, error) {
+	if len(params) == 0 {
+		return "", "", errors.New("missing params")
+	}
+	var target, reason string
+	if err := json.Unmarshal(params[0], &target); err != nil {
+		return "", "", errors.New("the first param must be a string")
+	}
+	if len(params) > 1 {
+		if err := json.Unmarshal(params[1], &reason); err != nil {
+			return "", "", errors.New("the reason must be a string")
+		}
+	}
+	if reason == "" {
+		reason = "manual"
+	}
+	target, err := parse(target)
+	if err != nil {
+		return "", "", err
+	}
+	return target, reason, nil
+}
+
+// parseIP checks that s is an address or a network in CIDR notation.
+func parseIP(s string) (string, error) {
+	if !validIP(s) {
+		return "", fmt.Errorf("invalid ip: %q", s)
+	}
+	return s, nil
+}
+
+// parseEventID returns s, trimmed and lowercased, if it is an event ID.
+func parseEventID(s string) (string, error) {
+	id := strings.ToLower(strings.TrimSpace(s))
+	if !nostr.IsValid32ByteHex(id) {
+		return "", fmt.Errorf("invalid event id: %q", s)
+	}
+	return id, nil
+}
+
+func writeNIP86(w http.ResponseWriter, status int, resp nip86Response) {
+	w.Header().Set("Content-Type", nip86ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// nip98Window is how far an auth event's created_at may be from the
+	// server clock.
+	nip98Window = 60 * time.Second
+	// maxAuthBody bounds the request body read to check a payload hash.
+	maxAuthBody = 1 << 20
+)
+
+// nip98Verifier checks NIP-98 HTTP auth events: a kind 27235 event, signed
+// by an admin pubkey, bound to the request URL, method and, for methods with
+// a body, body hash, and sent base64-encoded in "Authorization: Nostr
+// <event>". Each event is accepted once, so a captured header cannot be
+// replayed.
+type nip98Verifier struct {
+	pubkeys   []string
+	publicURL string
+
+	mu   sync.Mutex
+	seen *lru.LRU[string, struct{}]
+}
+
+func newNIP98Verifier(pubkeys []string, publicURL string) *nip98Verifier {
+	return &nip98Verifier{
+		pubkeys:   pubkeys,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		seen:      lru.NewLRU[string, struct{}](4096, nil, 2*nip98Window),
+	}
+}
+
+// verify authenticates r from the base64 event in header and returns the
+// signer's pubkey. The request body is buffered when a payload hash is
+// checked, so handlers can still read it.
+func (v *nip98Verifier) verify(r *http.Request, header string, now time.Time) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header))
+	if err != nil {
+		return "", errors.New("auth event is not valid base64")
+	}
+	var ev nostr.Event
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return "", errors.New("auth event is not valid JSON")
+	}
+
+	if ev.Kind != nostr.KindHTTPAuth {
+		return "", fmt.Errorf("auth event has kind %d, want %d", ev.Kind, nostr.KindHTTPAuth)
+	}
+	if !slices.Contains(v.pubkeys, ev.PubKey) {
+		return "", fmt.Errorf("pubkey %s is not an admin", ev.PubKey)
+	}
+	if d := now.Sub(ev.CreatedAt.Time()); d > nip98Window || d < -nip98Window {
+		return "", errors.New("auth event is too old or from the future")
+	}
+	if ev.GetID() != ev.ID {
+		return "", errors.New("auth event id does not match its content")
+	}
+	if ok, err := ev.CheckSignature(); err != nil || !ok {
+		return "", errors.New("invalid auth event signature")
+	}
+
+	// NIP-86 clients sign the relay URL, with or without a trailing slash.
+	if u := ev.Tags.Find("u"); u == nil || strings.TrimSuffix(u[1], "/") != strings.TrimSuffix(v.requestURL(r), "/") {
+		return "", errors.New("auth event u tag does not match the request URL")
+	}
+	if m := ev.Tags.Find("method"); m == nil || !strings.EqualFold(m[1], r.Method) {
+		return "", errors.New("auth event method tag does not match the request method")
+	}
+	p := ev.Tags.Find("payload")
+	if p == nil && hasBody(r.Method) {
+		// Without it, a captured event would authorize any body.
+		return "", errors.New("auth event has no payload tag")
+	}
+	if p != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxAuthBody))
+		if err != nil {
+			return "", fmt.Errorf("failed to read body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		if !strings.EqualFold(p[1], hex.EncodeToString(sum[:])) {
+			return "", errors.New("auth event payload tag does not match the request body")
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen.Contains(ev.ID) {
+		return "", errors.New("auth event was already used")
+	}
+	v.seen.Add(ev.ID, struct{}{})
+	return ev.PubKey, nil
+}
+
+// hasBody reports whether requests with method carry a body that the auth
+// event must hash.
+func hasBody(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// requestURL is the absolute URL the client is expected to have signed.
+func (v *nip98Verifier) requestURL(r *http.Request) string {
+	if v.publicURL != "" {
+		return v.publicURL + r.URL.RequestURI()
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+// ReloadHandler reloads the configuration file on POST, like a change
+// noticed by the watcher, and reports whether the new pipeline was built.
+type ReloadHandler struct {
+	reload func() error
+}
+
+func NewReloadHandler(reload func() error) *ReloadHandler {
+	return &ReloadHandler{reload: reload}
+}
+
+func (h *ReloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	slog.Warn("Configuration reload requested via admin API", "remote_addr", r.RemoteAddr)
+	if err := h.reload(); err != nil {
+		// A store that cannot be reached is worth retrying; a configuration
+		// that does not build is not.
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, store.ErrStoreUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, "reload failed, keeping the current configuration: "+err.Error(), status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
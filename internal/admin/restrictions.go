@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+type restrictionRequest struct {
+	PubKey   string `json:"pubkey"`
+	Kinds    []int  `json:"kinds"`
+	Duration string `json:"duration"`
+}
+
+type restrictionsState struct {
+	PubKey       string              `json:"pubkey"`
+	Restrictions []store.Restriction `json:"restrictions"`
+}
+
+// RestrictionsHandler lists (GET ?pubkey=), adds (PUT) and lifts
+// (DELETE ?pubkey=&kinds=) per-pubkey kind restrictions.
+type RestrictionsHandler struct {
+	store store.Store
+}
+
+func NewRestrictionsHandler(s store.Store) *RestrictionsHandler {
+	return &RestrictionsHandler{store: s}
+}
+
+func (h *RestrictionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var pubkey string
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+		pk, err := nip.NormalizePubKey(r.URL.Query().Get("pubkey"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid pubkey: %v", err), http.StatusBadRequest)
+			return
+		}
+		pubkey = pk
+		if r.Method == http.MethodDelete {
+			kinds, err := parseKinds(r.URL.Query().Get("kinds"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := h.store.LiftRestrictions(r.Context(), pubkey, kinds); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			slog.Warn("Restrictions lifted via admin API", "pubkey", pubkey, "kinds", kinds, "remote_addr", r.RemoteAddr)
+		}
+
+	case http.MethodPut:
+		var req restrictionRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+			return
+		}
+		pk, err := nip.NormalizePubKey(req.PubKey)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid pubkey: %v", err), http.StatusBadRequest)
+			return
+		}
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, "duration must be a positive duration such as \"72h\"", http.StatusBadRequest)
+			return
+		}
+		if len(req.Kinds) == 0 {
+			http.Error(w, "kinds is required", http.StatusBadRequest)
+			return
+		}
+		pubkey = pk
+		if err := h.store.RestrictKinds(r.Context(), pubkey, req.Kinds, duration); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.Warn("Restrictions added via admin API",
+			"pubkey", pubkey, "kinds", req.Kinds, "duration", duration, "remote_addr", r.RemoteAddr)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	restrictions, err := h.store.Restrictions(r.Context(), pubkey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(restrictionsState{PubKey: pubkey, Restrictions: restrictions})
+}
+
+// parseKinds parses a comma-separated list of kinds; "" means none.
+func parseKinds(s string) ([]int, error) {
+	var kinds []int
+	for v := range strings.SplitSeq(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		kind, err := strconv.Atoi(v)
+		if err != nil || kind < 0 {
+			return nil, fmt.Errorf("invalid kind %q", v)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
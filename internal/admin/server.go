@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Server is the authenticated HTTP API used by moderators and external tools.
+// Requests are signed with NIP-98 by an admin pubkey or, if configured, carry
+// the static bearer token.
+type Server struct {
+	cfg   *config.AdminConfig
+	nip98 *nip98Verifier
+	mux   *http.ServeMux
+	http  *http.Server
+}
+
+// NewServer creates an admin server. Endpoints are registered with Handle
+// before Start is called.
+func NewServer(cfg *config.AdminConfig) *Server {
+	s := &Server{
+		cfg:   cfg,
+		nip98: newNIP98Verifier(cfg.PubKeys, cfg.PublicURL),
+		mux:   http.NewServeMux(),
+	}
+	s.http = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           s.authenticate(s.mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Handle registers an endpoint; the pattern follows http.ServeMux syntax.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start serves in the background until ctx is cancelled.
+func (s *Server) Start(ctx context.Context) {
+	go func() {
+		slog.Info("Admin API listening", "addr", s.cfg.Listen)
+		if err := s.http.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Admin API stopped", "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		s.http.Shutdown(shutdownCtx)
+	}()
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if event, ok := strings.CutPrefix(auth, "Nostr "); ok && len(s.cfg.PubKeys) > 0 {
+			pubkey, err := s.nip98.verify(r, event, time.Now())
+			if err != nil {
+				slog.Warn("Admin API request rejected", "error", err, "remote_addr", r.RemoteAddr)
+				http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+			slog.Debug("Admin API request", "pubkey", pubkey, "method", r.Method, "path", r.URL.Path)
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || s.cfg.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
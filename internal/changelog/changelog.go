@@ -0,0 +1,75 @@
+// Package changelog announces the policy changes of config reloads, to the
+// moderator or publicly, building an auditable history of the relay's rules.
+package changelog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/notify"
+)
+
+// KeyEnv names the environment variable holding the key that signs
+// changelog notes.
+const KeyEnv = "ADRESU_CHANGELOG_KEY"
+
+type sender interface {
+	Send(ctx context.Context, text string) error
+}
+
+// Changelog publishes a note for every reload that changes the policy.
+type Changelog struct {
+	sender sender
+}
+
+// New creates a changelog sending direct messages to moderator or, if
+// cfg.Public, public notes tagged "changelog".
+func New(cfg *config.ChangelogConfig, moderator string) (*Changelog, error) {
+	var s sender
+	var err error
+	if cfg.Public {
+		s, err = notify.NewNote(KeyEnv, nostr.Tags{{"t", "changelog"}}, cfg.Relays)
+	} else {
+		s, err = notify.NewDM(KeyEnv, moderator, cfg.Relays)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Changelog{sender: s}, nil
+}
+
+// Announce publishes, in the background, the policy settings that differ
+// between old and new, if any.
+func (c *Changelog) Announce(ctx context.Context, old, new *config.Config) {
+	changes := config.PolicyChanges(old, new)
+	if len(changes) == 0 {
+		return
+	}
+	text := format(new.Policy.RelayName, changes, time.Now())
+	go func() {
+		if err := c.sender.Send(ctx, text); err != nil {
+			slog.Error("Failed to publish changelog", "changes", changes, "error", err)
+			return
+		}
+		slog.Info("Changelog published", "changes", changes)
+	}()
+}
+
+// format lists changes in a note.
+func format(relayName string, changes []string, at time.Time) string {
+	if relayName == "" {
+		relayName = "the relay"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "The policy of %s was updated on %s.\n\nChanged settings:\n", relayName, at.UTC().Format("2006-01-02 15:04 UTC"))
+	for _, key := range changes {
+		fmt.Fprintf(&b, "- %s\n", key)
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// policySections are the sections whose changes alter how events are judged,
+// as opposed to how the plugin runs.
+var policySections = []string{"policy", "filters", "pipeline", "experiment", "maintenance", "messages"}
+
+// PolicyChanges lists the settings of the policy sections that differ between
+// old and new, as sorted TOML keys no deeper than "section.setting" (e.g.
+// "filters.keywords", "policy.ban_duration", "messages.SizeFilter"). Values
+// are left out, so the list can be shown to anyone. Rule packs count as
+// changes to the filters they are merged into.
+func PolicyChanges(old, new *Config) []string {
+	oldV, newV := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	var changed []string
+	for _, section := range policySections {
+		field, _ := fieldByTOMLName(oldV.Type(), section)
+		a, b := oldV.FieldByIndex(field.Index), newV.FieldByIndex(field.Index)
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			continue
+		}
+		changed = append(changed, settingChanges(section, a, b)...)
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// settingChanges lists the settings of section that differ between a and b,
+// or section itself if its settings cannot be told apart.
+func settingChanges(section string, a, b reflect.Value) []string {
+	var changed []string
+	switch a.Kind() {
+	case reflect.Struct:
+		for i := range a.NumField() {
+			field := a.Type().Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+				changed = append(changed, section+"."+name)
+			}
+		}
+	case reflect.Map:
+		keys := make(map[string]reflect.Value)
+		for _, m := range []reflect.Value{a, b} {
+			for _, k := range m.MapKeys() {
+				keys[k.String()] = k
+			}
+		}
+		for name, k := range keys {
+			x, y := a.MapIndex(k), b.MapIndex(k)
+			if x.IsValid() != y.IsValid() || (x.IsValid() && !reflect.DeepEqual(x.Interface(), y.Interface())) {
+				changed = append(changed, section+"."+name)
+			}
+		}
+	}
+	if len(changed) == 0 {
+		changed = append(changed, section)
+	}
+	return changed
+}
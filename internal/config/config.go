@@ -5,19 +5,357 @@ import (
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"net"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	kitconfig "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+
+	"github.com/lessucettes/adresu-plugin/internal/schedule"
 )
 
+// ErrConfigInvalid is wrapped by the errors of configurations that do not
+// parse or validate, as opposed to files that cannot be read.
+var ErrConfigInvalid = errors.New("invalid configuration")
+
 type Config struct {
-	Log     LogConfig     `toml:"log"`
-	DB      DBConfig      `toml:"database"`
-	Strfry  StrfryConfig  `toml:"strfry"`
-	Policy  PolicyConfig  `toml:"policy"`
-	Filters FiltersConfig `toml:"filters"`
+	Log         LogConfig         `toml:"log"`
+	DB          DBConfig          `toml:"database"`
+	Strfry      StrfryConfig      `toml:"strfry"`
+	Policy      PolicyConfig      `toml:"policy"`
+	Filters     FiltersConfig     `toml:"filters"`
+	Mirror      MirrorConfig      `toml:"mirror"`
+	Pipeline    PipelineConfig    `toml:"pipeline"`
+	Canary      CanaryConfig      `toml:"canary"`
+	Experiment  ExperimentConfig  `toml:"experiment"`
+	Runtime     RuntimeConfig     `toml:"runtime"`
+	Priming     PrimingConfig     `toml:"priming"`
+	Admin       AdminConfig       `toml:"admin"`
+	GRPC        GRPCConfig        `toml:"grpc"`
+	Metrics     MetricsConfig     `toml:"metrics"`
+	Maintenance MaintenanceConfig `toml:"maintenance"`
+	GeoIP       GeoIPConfig       `toml:"geoip"`
+	Schedule    ScheduleConfig    `toml:"schedule"`
+	// Messages maps a filter name to a text/template that renders the message
+	// returned to clients when that filter rejects an event.
+	Messages map[string]string `toml:"messages"`
+	Digest   DigestConfig      `toml:"digest"`
+	// BanReview is the daily report of bans about to expire and recent
+	// auto-bans, for moderators to extend, shorten or convert.
+	BanReview BanReviewConfig `toml:"ban_review"`
+	// Summary is the daily report of the relay's activity for its operator.
+	Summary SummaryConfig `toml:"summary"`
+	// Changelog announces the policy changes of config reloads.
+	Changelog ChangelogConfig `toml:"changelog"`
+	// RulePacks are shared bundles of rules merged into Filters on load.
+	RulePacks RulePacksConfig `toml:"rule_packs"`
+	Flags     FlagsConfig     `toml:"flags"`
+}
+
+type DigestScope string
+
+const (
+	DigestRejected DigestScope = "rejected"
+	DigestAccepted DigestScope = "accepted"
+	DigestAll      DigestScope = "all"
+)
+
+func (s *DigestScope) UnmarshalText(text []byte) error {
+	v := string(text)
+	switch DigestScope(v) {
+	case DigestRejected, DigestAccepted, DigestAll:
+		*s = DigestScope(v)
+		return nil
+	default:
+		return fmt.Errorf("invalid digest scope: %q (must be rejected, accepted, all)", v)
+	}
+}
+
+// DigestConfig controls the periodic report of similar-content clusters.
+// Read once at startup, not on reload.
+type DigestConfig struct {
+	Enabled        bool          `toml:"enabled"`
+	Scope          DigestScope   `toml:"scope"`
+	Kinds          []int         `toml:"kinds"`
+	Window         time.Duration `toml:"window"`
+	Interval       time.Duration `toml:"interval"`
+	MaxItems       int           `toml:"max_items"`
+	MinChars       int           `toml:"min_chars"`
+	MaxDistance    int           `toml:"max_distance"`
+	MinClusterSize int           `toml:"min_cluster_size"`
+	Top            int           `toml:"top"`
+	Path           string        `toml:"path"`
+}
+
+type BanReviewConfig struct {
+	Enabled bool `toml:"enabled"`
+	// At is the UTC time of day ("HH:MM") the review is published.
+	At string `toml:"at"`
+	// Horizon selects bans expiring within it; Lookback selects auto-bans
+	// issued within it.
+	Horizon  time.Duration `toml:"horizon"`
+	Lookback time.Duration `toml:"lookback"`
+	// Evidence is the number of recent rejections kept per pubkey.
+	Evidence int    `toml:"evidence"`
+	Path     string `toml:"path"`
+	// DMRelays receive the review as NIP-17 direct messages to the
+	// moderator, signed with the key in $ADRESU_REVIEW_KEY.
+	DMRelays []string `toml:"dm_relays"`
+}
+
+// SummaryConfig is the daily activity summary: top offenders, bans issued
+// and expired, busiest hours and filter hits new since the previous day.
+type SummaryConfig struct {
+	Enabled bool `toml:"enabled"`
+	// At is the UTC time of day ("HH:MM") the day's summary is compiled.
+	At string `toml:"at"`
+	// Dir receives one summary-YYYY-MM-DD.txt file per day, of which the
+	// latest Keep are kept.
+	Dir  string `toml:"dir"`
+	Keep int    `toml:"keep"`
+	// Top bounds the offenders and pubkeys listed.
+	Top int `toml:"top"`
+	// DMRelays receive the summary as NIP-17 direct messages to the
+	// moderator, signed with the key in $ADRESU_SUMMARY_KEY.
+	DMRelays []string `toml:"dm_relays"`
+}
+
+// ChangelogConfig publishes a note listing the policy settings changed by
+// every successful reload (see PolicyChanges), signed with the key in
+// $ADRESU_CHANGELOG_KEY: a NIP-17 direct message to the moderator or, if
+// Public, a kind 1 note anyone can read. Read once at startup.
+type ChangelogConfig struct {
+	Enabled bool     `toml:"enabled"`
+	Public  bool     `toml:"public"`
+	Relays  []string `toml:"relays"`
+}
+
+// RuntimeConfig tunes event processing. Read once at startup, not on reload.
+type RuntimeConfig struct {
+	// Workers is the number of events processed concurrently. Responses are
+	// still written in input order.
+	Workers int `toml:"workers"`
+	// MaxInputBytes bounds an input line. Longer lines are rejected without
+	// being decoded.
+	MaxInputBytes int `toml:"max_input_bytes"`
+}
+
+// PrimingConfig points to the author history written by "adresu-plugin
+// prime", which seeds the behavioral state of filters whenever the pipeline
+// is built.
+type PrimingConfig struct {
+	Path string `toml:"path"` // Empty disables priming.
+}
+
+type MaintenanceMode string
+
+const (
+	MaintenanceOff       MaintenanceMode = "off"
+	MaintenanceReadOnly  MaintenanceMode = "readonly"  // Reject all writes.
+	MaintenanceAllowlist MaintenanceMode = "allowlist" // Accept only allowed_pubkeys.
+)
+
+func (m *MaintenanceMode) UnmarshalText(text []byte) error {
+	v := string(text)
+	switch MaintenanceMode(v) {
+	case MaintenanceOff, MaintenanceReadOnly, MaintenanceAllowlist, "":
+		*m = MaintenanceMode(v)
+		return nil
+	default:
+		return fmt.Errorf("invalid maintenance mode: %q (must be off, readonly, allowlist)", v)
+	}
+}
+
+// GeoIPConfig locates the source addresses of events, for filters with
+// policies by origin such as filters.language.region_languages.
+type GeoIPConfig struct {
+	// Path is a CSV country database with "start_ip,end_ip,country" lines,
+	// such as DB-IP's or IP2Location's free ones. Empty disables GeoIP.
+	Path string `toml:"path"`
+	// Regions group country codes under names usable instead of countries.
+	Regions map[string][]string `toml:"regions"`
+}
+
+// Names of the scheduled jobs, as used in schedule.jobs.
+const (
+	JobBadgerGC               = "badger_gc"
+	JobTieringResync          = "tiering_resync"
+	JobBanReview              = "ban_review"
+	JobSummary                = "summary"
+	JobDigest                 = "digest"
+	JobWoTRefresh             = "wot_refresh"
+	JobWhitelistRefresh       = "whitelist_refresh"
+	JobCompromisedKeysRefresh = "compromised_keys_refresh"
+	JobMuteListRefresh        = "mute_list_refresh"
+	JobIPReputationRefresh    = "ip_reputation_refresh"
+)
+
+var scheduledJobs = []string{
+	JobBadgerGC, JobTieringResync, JobBanReview, JobSummary, JobDigest,
+	JobWoTRefresh, JobWhitelistRefresh, JobCompromisedKeysRefresh, JobMuteListRefresh,
+	JobIPReputationRefresh,
+}
+
+// ScheduleConfig tunes the periodic maintenance jobs. Read once at startup,
+// not on reload.
+type ScheduleConfig struct {
+	// Jitter delays every run by a random duration up to it, so that relays
+	// sharing a database or a list source do not all hit it at once.
+	Jitter time.Duration `toml:"jitter"`
+	// Jobs maps a job name to a cron expression (UTC) or "@every <duration>"
+	// replacing the schedule derived from the job's own settings.
+	Jobs map[string]string `toml:"jobs"`
+}
+
+// ProtectedRole is a role whose holders automatic sanctions never apply to.
+type ProtectedRole string
+
+const (
+	RoleModerator   ProtectedRole = "moderator"   // policy.moderator_pubkey and trainee_moderators.
+	RoleBot         ProtectedRole = "bot"         // policy.bots.
+	RoleAllowlisted ProtectedRole = "allowlisted" // Pubkeys allowed by filters.whitelist.
+)
+
+func (r *ProtectedRole) UnmarshalText(text []byte) error {
+	v := string(text)
+	switch ProtectedRole(v) {
+	case RoleModerator, RoleBot, RoleAllowlisted:
+		*r = ProtectedRole(v)
+		return nil
+	default:
+		return fmt.Errorf("invalid protected role: %q (must be moderator, bot, allowlisted)", v)
+	}
+}
+
+// MaintenanceConfig sets the maintenance mode at startup. The admin API can
+// switch it at runtime; config reloads do not reset a mode switched that way.
+type MaintenanceConfig struct {
+	Mode           MaintenanceMode `toml:"mode"`
+	Message        string          `toml:"message"`
+	AllowedPubKeys []string        `toml:"allowed_pubkeys"`
+}
+
+// GRPCConfig is the event admission server of "run -mode=grpc", which
+// answers nostr-rs-relay instead of strfry.
+type GRPCConfig struct {
+	Listen string `toml:"listen"`
+}
+
+type AdminConfig struct {
+	Enabled bool   `toml:"enabled"`
+	Listen  string `toml:"listen"`
+	// PubKeys may call the API with NIP-98 HTTP auth: each request carries a
+	// kind 27235 event signed by one of them.
+	PubKeys []string `toml:"pubkeys"`
+	// PublicURL is the base URL clients use to reach the API, when it sits
+	// behind a reverse proxy; NIP-98 events are checked against it.
+	PublicURL string `toml:"public_url"`
+	// Token is a static bearer token, kept for tools that cannot sign
+	// requests. Leave empty to accept NIP-98 only.
+	Token string `toml:"token"`
+	// NIP86 serves the NIP-86 relay management API at "/", so standard
+	// relay management clients, signing with one of PubKeys, can ban and
+	// unban pubkeys and IPs. Requests to the relay URL with the content type
+	// "application/nostr+json+rpc" are to be proxied there.
+	NIP86 bool `toml:"nip86"`
+}
+
+// MetricsConfig enables an unauthenticated OpenMetrics endpoint for
+// Prometheus scrapers, separate from the admin API.
+type MetricsConfig struct {
+	Enabled bool   `toml:"enabled"`
+	Listen  string `toml:"listen"`
+	Path    string `toml:"path"`
+}
+
+type PipelineConfig struct {
+	// ParallelStages evaluates consecutive independent filters concurrently.
+	ParallelStages bool `toml:"parallel_stages"`
+	// LatencyBudget logs a per-filter breakdown for events taking longer.
+	LatencyBudget time.Duration      `toml:"latency_budget"`
+	PoWLane       PoWLaneConfig      `toml:"pow_lane"`
+	Degradation   DegradationConfig  `toml:"degradation"`
+	LoadShedding  LoadSheddingConfig `toml:"load_shedding"`
+}
+
+// DegradationConfig sheds filters under load. Every Interval the plugin
+// measures its CPU use and average decision latency and enters the highest
+// step whose threshold either reaches. It steps down one step at a time, once
+// the current step's thresholds have not been reached for RecoverAfter.
+type DegradationConfig struct {
+	Enabled      bool              `toml:"enabled"`
+	Interval     time.Duration     `toml:"interval"`
+	RecoverAfter time.Duration     `toml:"recover_after"`
+	Steps        []DegradationStep `toml:"step"`
+}
+
+// DegradationStep is one rung of the degradation ladder. Steps apply
+// cumulatively: a step also skips the filters of the steps below it.
+type DegradationStep struct {
+	Description string `toml:"description"`
+	// CPU is the process CPU use, as a fraction of GOMAXPROCS cores, that
+	// enters the step; 0 ignores CPU.
+	CPU float64 `toml:"cpu"`
+	// Latency is the average decision latency that enters the step; 0
+	// ignores latency.
+	Latency time.Duration `toml:"latency"`
+	// Skip lists filters not run at this step.
+	Skip []string `toml:"skip"`
+	// Only, if set, lists the only filters still run at this step.
+	Only []string `toml:"only"`
+}
+
+// LoadSheddingConfig rejects the events of low-priority kinds while the
+// plugin is overloaded. Every Interval, while the input queue reaches
+// QueueDepth or the average decision latency reaches Latency, one more tier
+// is shed, in order; once neither has been reached for RecoverAfter, the last
+// tier shed is let back in.
+type LoadSheddingConfig struct {
+	Enabled      bool          `toml:"enabled"`
+	Interval     time.Duration `toml:"interval"`
+	RecoverAfter time.Duration `toml:"recover_after"`
+	// QueueDepth is the number of input lines read but not yet answered
+	// that counts as overload; 0 ignores the queue.
+	QueueDepth int `toml:"queue_depth"`
+	// Latency is the average decision latency that counts as overload; 0
+	// ignores latency.
+	Latency time.Duration `toml:"latency"`
+	// Message is returned for shed events.
+	Message string             `toml:"message"`
+	Tiers   []LoadSheddingTier `toml:"tier"`
+}
+
+// LoadSheddingTier is a group of kinds shed together. Kinds in no tier are
+// never shed.
+type LoadSheddingTier struct {
+	Description string `toml:"description"`
+	Kinds       []int  `toml:"kinds"`
+	// Ephemeral adds the ephemeral kinds (20000-29999) not in an earlier
+	// tier.
+	Ephemeral bool `toml:"ephemeral"`
+}
+
+// PoWLaneConfig lets events with NIP-13 proof of work through the listed
+// filters while the relay is overloaded (emergency mode is enabled or the
+// fairness guard is saturated). The required difficulty starts at
+// MinDifficulty and rises by one bit each time the rate of events admitted
+// through the lane doubles past TargetRate, up to MaxDifficulty.
+type PoWLaneConfig struct {
+	Enabled       bool          `toml:"enabled"`
+	MinDifficulty int           `toml:"min_difficulty"`
+	MaxDifficulty int           `toml:"max_difficulty"`
+	TargetRate    float64       `toml:"target_rate"`
+	Window        time.Duration `toml:"window"`
+	Filters       []string      `toml:"filters"`
 }
 
 type LogLevel string
@@ -60,40 +398,523 @@ type LogConfig struct {
 	RejectionLevels map[string]LogLevel `toml:"rejection_levels"`
 }
 
+type DBDriver string
+
+const (
+	DBBadger DBDriver = "badger" // Local BadgerDB directory at Path.
+	DBRedis  DBDriver = "redis"  // Redis server at URL, shareable by relays.
+	DBSQLite DBDriver = "sqlite" // SQLite file at Path.
+)
+
 type DBConfig struct {
+	Driver DBDriver `toml:"driver"`
+	// Path is the BadgerDB directory or the SQLite file.
 	Path string `toml:"path"`
+	// URL and KeyPrefix locate the Redis database; several relays sharing one
+	// ban list use the same URL and prefix.
+	URL       string `toml:"url"`
+	KeyPrefix string `toml:"key_prefix"`
+	// CheckOnStartup walks the database and validates keys when opening it.
+	CheckOnStartup bool `toml:"check_on_startup"`
+	// InstanceID tells apart the relay instances sharing a SQLite or Redis
+	// database, so that each replays only the side effects it journaled,
+	// which act on its own strfry. It is required for those drivers and must
+	// stay the same across restarts.
+	InstanceID string        `toml:"instance_id"`
+	Tiering    TieringConfig `toml:"tiering"`
+}
+
+// TieringConfig puts an in-memory mirror of bans and restrictions in front
+// of the database. Read once at startup, not on reload.
+type TieringConfig struct {
+	Enabled bool `toml:"enabled"`
+	// ResyncInterval rebuilds the mirror from the database, picking up
+	// changes made by other processes sharing it.
+	ResyncInterval time.Duration `toml:"resync_interval"`
+	// ArchivePath, if set, receives a JSON line for every ban or restriction
+	// that leaves the mirror because it expired or was lifted.
+	ArchivePath string `toml:"archive_path"`
+}
+
+type StrfryCheckMode string
+
+const (
+	StrfryCheckOff   StrfryCheckMode = "off"
+	StrfryCheckWarn  StrfryCheckMode = "warn"
+	StrfryCheckAlign StrfryCheckMode = "align"
+)
+
+func (m *StrfryCheckMode) UnmarshalText(text []byte) error {
+	v := string(text)
+	switch StrfryCheckMode(v) {
+	case StrfryCheckOff, StrfryCheckWarn, StrfryCheckAlign:
+		*m = StrfryCheckMode(v)
+		return nil
+	default:
+		return fmt.Errorf("invalid strfry.check_config: %q (must be off, warn, align)", v)
+	}
 }
 
 type StrfryConfig struct {
-	ExecutablePath string `toml:"executable_path"`
-	ConfigPath     string `toml:"config_path"`
+	ExecutablePath string          `toml:"executable_path"`
+	ConfigPath     string          `toml:"config_path"`
+	CheckConfig    StrfryCheckMode `toml:"check_config"`
+}
+
+// CanaryConfig runs a candidate configuration in shadow: every event is also
+// judged by a pipeline built from the config file at Path, without side
+// effects, and its decision is compared with the live one.
+type CanaryConfig struct {
+	Enabled bool   `toml:"enabled"`
+	Path    string `toml:"path"`
+	// LogSampleRate is the fraction of divergent decisions logged.
+	LogSampleRate float64 `toml:"log_sample_rate"`
+	// MaxInFlight bounds the events the candidate judges at once; events
+	// arriving while it is saturated are skipped rather than queued.
+	MaxInFlight int `toml:"max_in_flight"`
+}
+
+// ExperimentConfig splits authors into cohorts judged with different
+// settings, and counts the acceptance and retention of each cohort, so the
+// effect of a setting can be measured before it applies to everyone.
+type ExperimentConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Name seeds the assignment of authors to cohorts: renaming the
+	// experiment reshuffles them and restarts the counts.
+	Name string `toml:"name"`
+	// RetentionWindow is how long after their first event an author must
+	// have an event accepted to count as retained.
+	RetentionWindow time.Duration  `toml:"retention_window"`
+	Cohorts         []CohortConfig `toml:"cohort"`
+}
+
+type CohortConfig struct {
+	Name string `toml:"name"`
+	// Weight is the cohort's share of authors, relative to the others.
+	Weight int `toml:"weight"`
+	// Settings override config keys for the cohort, as dotted paths such as
+	// "filters.pow.min_difficulty", with the restrictions of remote flags.
+	// A cohort without settings is judged by the live pipeline.
+	Settings Flags `toml:"settings"`
+}
+
+type MirrorConfig struct {
+	Enabled        bool          `toml:"enabled"`
+	Relays         []string      `toml:"relays"`
+	Kinds          []int         `toml:"kinds"`
+	QueueSize      int           `toml:"queue_size"`
+	MaxRetries     int           `toml:"max_retries"`
+	RetryDelay     time.Duration `toml:"retry_delay"`
+	PublishTimeout time.Duration `toml:"publish_timeout"`
 }
 
 type PolicyConfig struct {
-	ModeratorPubKey string        `toml:"moderator_pubkey"`
-	BanEmoji        string        `toml:"ban_emoji"`
-	UnbanEmoji      string        `toml:"unban_emoji"`
-	BanDuration     time.Duration `toml:"ban_duration"`
+	ModeratorPubKey string `toml:"moderator_pubkey"`
+	// BanEmoji reactions ban the author of the reacted-to event and delete
+	// that event (NIP-25 "e" tag) from strfry, or all of the author's events
+	// if the reaction names none. NukeEmoji reactions always delete them all.
+	BanEmoji    string        `toml:"ban_emoji"`
+	NukeEmoji   string        `toml:"nuke_emoji"`
+	UnbanEmoji  string        `toml:"unban_emoji"`
+	BanDuration time.Duration `toml:"ban_duration"`
+	// RestrictEmoji reactions forbid the author of the reacted-to event to
+	// post its kind (NIP-25 "k" tag) for RestrictDuration.
+	RestrictEmoji    string        `toml:"restrict_emoji"`
+	RestrictDuration time.Duration `toml:"restrict_duration"`
+	// DeleteEmoji reactions delete the reacted-to event (NIP-25 "e" tag)
+	// from strfry, without banning its author.
+	DeleteEmoji string `toml:"delete_emoji"`
+	// DeleteStrike also counts a delete reaction as an autoban strike
+	// against the author.
+	DeleteStrike bool `toml:"delete_strike"`
+	// BlockEmoji reactions add the reacted-to event and its content to the
+	// blocklist and delete the event from strfry, without banning its
+	// author.
+	BlockEmoji string `toml:"block_emoji"`
+	// ShadowBanDelay is how long after accepting an event that a filter with
+	// action "shadow" matched it is deleted from strfry, leaving strfry time
+	// to store it first.
+	ShadowBanDelay time.Duration `toml:"shadow_ban_delay"`
+	// SlowModeEmoji reactions to a chat message put its room in slow mode for
+	// SlowModeDuration, or lift it: filters.ephemeral_chat then makes everyone
+	// in the room wait SlowModeDelay between messages.
+	SlowModeEmoji    string        `toml:"slow_mode_emoji"`
+	SlowModeDelay    time.Duration `toml:"slow_mode_delay"`
+	SlowModeDuration time.Duration `toml:"slow_mode_duration"`
+	// TraineeModerators' ban and unban reactions are logged but not enforced.
+	TraineeModerators []string `toml:"trainee_moderators"`
+	// Bots registers the relay's own bots, such as announcement or
+	// bridge accounts.
+	Bots []string `toml:"bots"`
+	// ProtectedRoles are spared by autoban, report bans and ban or nuke
+	// reactions, so a misfiring filter cannot ban the relay's moderators or
+	// bots.
+	ProtectedRoles []ProtectedRole `toml:"protected_roles"`
+	// AcceptWarnings returns filter advisories as "msg" on accepted events.
+	AcceptWarnings bool `toml:"accept_warnings"`
+	// UnknownKindAction handles kinds no configured rule mentions.
+	UnknownKindAction UnknownKindAction `toml:"unknown_kind_action"`
+	UnknownKindRate   float64           `toml:"unknown_kind_rate"`
+	UnknownKindBurst  int               `toml:"unknown_kind_burst"`
+	// KnownKinds are treated as known in addition to those used by rules.
+	KnownKinds []int `toml:"known_kinds"`
+	// Reports bans authors reported (NIP-56) by enough trusted reporters.
+	Reports ReportsConfig `toml:"reports"`
+	// MuteList bans the pubkeys moderators mute from their clients.
+	MuteList MuteListConfig `toml:"mute_list"`
+	// RelayName, Contact and AppealURL brand rejection messages, telling
+	// users who rejected their event and how to appeal. AppealURL is a
+	// text/template executed like the [messages] templates.
+	RelayName string `toml:"relay_name"`
+	Contact   string `toml:"contact"`
+	AppealURL string `toml:"appeal_url"`
+}
+
+// ReportsConfig turns NIP-56 reports (kind 1984) by trusted reporters into
+// strikes against the reported pubkey. Reports by Threshold distinct trusted
+// reporters within Window of the first one ban it for BanDuration.
+type ReportsConfig struct {
+	Enabled bool `toml:"enabled"`
+	// TrustedReporters are counted in addition to the moderator.
+	TrustedReporters []string      `toml:"trusted_reporters"`
+	Threshold        int           `toml:"threshold"`
+	Window           time.Duration `toml:"window"`
+	// BanDuration defaults to policy.ban_duration.
+	BanDuration time.Duration `toml:"ban_duration"`
+	// Types limits the counted report types; empty counts all of them.
+	Types     []string `toml:"types"`
+	CacheSize int      `toml:"cache_size"`
+}
+
+// MuteListConfig mirrors the NIP-51 mute lists (kind 10000) of PubKeys into
+// bans, so moderators can moderate by muting from any client. Every pubkey in
+// the public "p" tags of a list is banned for BanDuration, renewed while it
+// stays listed, and unbanned once the owner unmutes it. Lists are refreshed
+// periodically and applied as soon as their owner publishes a new version
+// through the relay. Private (encrypted) mutes cannot be read.
+type MuteListConfig struct {
+	Enabled bool `toml:"enabled"`
+	// PubKeys own the mirrored lists; empty means policy.moderator_pubkey.
+	PubKeys []string `toml:"pubkeys"`
+	// Relays to fetch the lists from; empty runs "strfry scan" on the local
+	// database.
+	Relays          []string      `toml:"relays"`
+	RefreshInterval time.Duration `toml:"refresh_interval"`
+	Timeout         time.Duration `toml:"timeout"`
+	// BanDuration should outlast RefreshInterval, so that bans are renewed
+	// before they expire.
+	BanDuration time.Duration `toml:"ban_duration"`
+}
+
+// ReportTypes are the report types defined by NIP-56.
+var ReportTypes = []string{"nudity", "malware", "profanity", "illegal", "spam", "impersonation", "other"}
+
+type UnknownKindAction string
+
+const (
+	UnknownKindAccept    UnknownKindAction = "accept"
+	UnknownKindReject    UnknownKindAction = "reject"
+	UnknownKindRateLimit UnknownKindAction = "ratelimit"
+)
+
+func (a *UnknownKindAction) UnmarshalText(text []byte) error {
+	v := string(text)
+	switch UnknownKindAction(v) {
+	case UnknownKindAccept, UnknownKindReject, UnknownKindRateLimit, "":
+		*a = UnknownKindAction(v)
+		return nil
+	default:
+		return fmt.Errorf("invalid policy.unknown_kind_action: %q (must be accept, reject, ratelimit)", v)
+	}
 }
 
 type FiltersConfig struct {
+	Validation    kitconfig.ValidationFilterConfig    `toml:"validation"`
 	Kind          kitconfig.KindFilterConfig          `toml:"policy"`
 	Emergency     kitconfig.EmergencyFilterConfig     `toml:"emergency"`
 	RateLimiter   kitconfig.RateLimiterConfig         `toml:"rate_limiter"`
 	Freshness     kitconfig.FreshnessFilterConfig     `toml:"freshness"`
 	Size          kitconfig.SizeFilterConfig          `toml:"size"`
 	Tags          kitconfig.TagsFilterConfig          `toml:"tags"`
+	TagStuffing   kitconfig.TagStuffingFilterConfig   `toml:"tag_stuffing"`
 	Keywords      kitconfig.KeywordFilterConfig       `toml:"keywords"`
 	Language      kitconfig.LanguageFilterConfig      `toml:"language"`
 	EphemeralChat kitconfig.EphemeralChatFilterConfig `toml:"ephemeral_chat"`
 	RepostAbuse   kitconfig.RepostAbuseFilterConfig   `toml:"repost_abuse"`
+	ReplyFlood    kitconfig.ReplyFloodFilterConfig    `toml:"reply_flood"`
+	References    kitconfig.ReferenceFilterConfig     `toml:"references"`
+	Fairness      kitconfig.FairnessFilterConfig      `toml:"fairness"`
+	LiveActivity  kitconfig.LiveActivityFilterConfig  `toml:"live_activity"`
+	FileSharing   kitconfig.FileSharingFilterConfig   `toml:"file_sharing"`
+	Phishing      kitconfig.PhishingFilterConfig      `toml:"phishing"`
+	BotSignatures kitconfig.BotSignatureFilterConfig  `toml:"bot_signatures"`
+	Client        kitconfig.ClientFilterConfig        `toml:"client"`
+	InlineData    kitconfig.InlineDataFilterConfig    `toml:"inline_data"`
+	Metadata      kitconfig.MetadataFilterConfig      `toml:"metadata"`
+	PoW           kitconfig.PoWFilterConfig           `toml:"pow"`
+	KindDiversity kitconfig.KindDiversityFilterConfig `toml:"kind_diversity"`
+	// DuplicateContent rejects copy-paste spam.
+	DuplicateContent kitconfig.DuplicateContentFilterConfig `toml:"duplicate_content"`
+
+	Cooldown        CooldownFilterConfig        `toml:"cooldown"`
+	Origin          OriginFilterConfig          `toml:"origin"`
+	BannedAuthor    BannedAuthorFilterConfig    `toml:"banned_author"`
+	IP              IPFilterConfig              `toml:"ip"`
+	BannedIP        BannedIPFilterConfig        `toml:"banned_ip"`
+	IPReputation    IPReputationFilterConfig    `toml:"ip_reputation"`
+	DNSBL           DNSBLFilterConfig           `toml:"dnsbl"`
+	Blocklist       BlocklistFilterConfig       `toml:"blocklist"`
+	BannedReference BannedReferenceFilterConfig `toml:"banned_reference"`
+	BanEvasion      BanEvasionFilterConfig      `toml:"ban_evasion"`
+	AutoBan         AutoBanFilterConfig         `toml:"autoban"`
+	WoT             WoTFilterConfig             `toml:"wot"`
+	Whitelist       WhitelistFilterConfig       `toml:"whitelist"`
+	CompromisedKeys CompromisedKeysFilterConfig `toml:"compromised_keys"`
+	// Exec filters are operator-provided programs, run in order of
+	// appearance at their configured positions.
+	Exec []ExecFilterConfig `toml:"exec"`
+}
+
+// ExecFilterConfig runs an external program as a filter. The program speaks
+// strfry's write policy protocol: it reads one JSON request per line on
+// stdin and answers each with one {"id", "action", "msg"} line on stdout, so
+// existing strfry plugins can be used as they are.
+type ExecFilterConfig struct {
+	// Name identifies the filter in logs, metrics, messages and the
+	// degradation ladder.
+	Name    string `toml:"name"`
+	Command string `toml:"command"`
+	// Module is the path of a WASI module to run instead of Command, in a
+	// sandbox without access to files or the network.
+	Module string   `toml:"module"`
+	Args   []string `toml:"args"`
+	Kinds  []int    `toml:"kinds"` // Empty checks all kinds.
+	// After names the filter this one runs after; empty runs it after the
+	// others, just before moderator commands are handled.
+	After string `toml:"after"`
+	// Processes is how many copies of the program serve events
+	// concurrently (1 if not set).
+	Processes int `toml:"processes"`
+	// Timeout bounds the wait for a process and its answer (1s if not set).
+	Timeout time.Duration `toml:"timeout"`
+	// FailOpen accepts events the program could not judge, because it
+	// crashed, timed out or answered garbage; otherwise they are rejected.
+	FailOpen bool                   `toml:"fail_open"`
+	Action   kitconfig.FilterAction `toml:"action"`
+}
+
+// WoTFilterConfig limits posting to the operator's web of trust: the operator,
+// the pubkeys in their kind 3 contact list and, with depth 2, the pubkeys
+// those follow. Moderators are always trusted.
+type WoTFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// OperatorPubKey roots the graph; it defaults to policy.moderator_pubkey.
+	OperatorPubKey string `toml:"operator_pubkey"`
+	Depth          int    `toml:"depth"`
+	// Relays to fetch contact lists from; empty runs "strfry scan" on the
+	// local database.
+	Relays          []string               `toml:"relays"`
+	RefreshInterval time.Duration          `toml:"refresh_interval"`
+	Timeout         time.Duration          `toml:"timeout"`
+	Kinds           []int                  `toml:"kinds"` // Empty checks all kinds.
+	Action          kitconfig.FilterAction `toml:"action"`
+}
 
-	BannedAuthor BannedAuthorFilterConfig `toml:"banned_author"`
-	AutoBan      AutoBanFilterConfig      `toml:"autoban"`
+// Treatments of events from an IPReputationList.
+const (
+	IPReputationReject    = "reject"
+	IPReputationRateLimit = "rate_limit"
+	IPReputationPoW       = "pow"
+)
+
+// IPReputationFilterConfig treats events submitted from listed addresses,
+// such as Tor exit nodes or cloud and datacenter networks, with suspicion.
+type IPReputationFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Lists are checked in order; the first listing the address applies.
+	Lists []IPReputationList `toml:"lists"`
+	// Every source is reloaded each RefreshInterval.
+	RefreshInterval time.Duration `toml:"refresh_interval"`
+	// Timeout bounds the download of one URL.
+	Timeout time.Duration `toml:"timeout"`
+	// CacheSize bounds the rate limiters of rate_limit lists.
+	CacheSize int `toml:"cache_size"`
+}
+
+// IPReputationList is a set of addresses and networks and the treatment of
+// their events.
+type IPReputationList struct {
+	// Name labels the list in reasons and logs, e.g. "tor" or "datacenter".
+	Name string `toml:"name"`
+	// Sources are files and http(s) URLs listing one address or CIDR network
+	// per line. Tor's exit-addresses format ("ExitAddress <ip> ...") is
+	// understood too.
+	Sources []string `toml:"sources"`
+	// Action is IPReputationReject, IPReputationRateLimit (Rate events per
+	// second with Burst per address) or IPReputationPoW (PoWDifficulty bits
+	// of NIP-13 proof of work required).
+	Action        string  `toml:"action"`
+	Rate          float64 `toml:"rate"`
+	Burst         int     `toml:"burst"`
+	PoWDifficulty int     `toml:"pow_difficulty"`
+}
+
+// DNSBLFilterConfig checks the addresses events are submitted from against
+// DNS blocklists in the style of Spamhaus ZEN. Lookups that fail or time out
+// count as not listed.
+type DNSBLFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Zones are the blocklists queried, e.g. "zen.spamhaus.org".
+	Zones []string `toml:"zones"`
+	// Resolver is the "host:port" of the DNS server to query; empty uses the
+	// system's. Some blocklists refuse queries from public resolvers.
+	Resolver string `toml:"resolver"`
+	// Timeout bounds the lookups of one address in all zones.
+	Timeout   time.Duration `toml:"timeout"`
+	CacheSize int           `toml:"cache_size"`
+	CacheTTL  time.Duration `toml:"cache_ttl"`
+	// Action is "reject", or "strike" to only count listed addresses against
+	// their authors.
+	Action kitconfig.FilterAction `toml:"action"`
+}
+
+// CompromisedKeysFilterConfig rejects events signed with keys whose secret
+// key is known to have leaked, as listed by feeds of such keys.
+type CompromisedKeysFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Sources are files and http(s) URLs listing one pubkey per line. Every
+	// source is reloaded each RefreshInterval.
+	Sources         []string      `toml:"sources"`
+	RefreshInterval time.Duration `toml:"refresh_interval"`
+	// Timeout bounds the download of one URL.
+	Timeout time.Duration          `toml:"timeout"`
+	Action  kitconfig.FilterAction `toml:"action"`
+}
+
+// WhitelistFilterConfig makes the relay invite-only: only the listed pubkeys,
+// and moderators, may publish. The list is the union of PubKeys, the pubkeys
+// in File and the "p" tags of the List event.
+type WhitelistFilterConfig struct {
+	Enabled bool     `toml:"enabled"`
+	PubKeys []string `toml:"pubkeys"`
+	// File holds one pubkey per line; it is reloaded whenever it changes.
+	File string `toml:"file"`
+	// List is the address of a kind 30000 follow set, as an naddr or
+	// "30000:<pubkey>:<d>", normalized to the latter with a hex pubkey.
+	List string `toml:"list"`
+	// Relays to fetch the List event from; empty runs "strfry scan" on the
+	// local database.
+	Relays          []string      `toml:"relays"`
+	RefreshInterval time.Duration `toml:"refresh_interval"`
+	Timeout         time.Duration `toml:"timeout"`
+	// AllowDelegates accepts events carrying a valid NIP-26 delegation from
+	// a listed pubkey.
+	AllowDelegates bool                   `toml:"allow_delegates"`
+	Kinds          []int                  `toml:"kinds"` // Empty checks all kinds.
+	Action         kitconfig.FilterAction `toml:"action"`
+}
+
+type CooldownFilterConfig struct {
+	Enabled   bool                    `toml:"enabled"`
+	By        kitconfig.RateLimiterBy `toml:"by"`
+	CacheSize int                     `toml:"cache_size"`
+	// OnReject maps a filter name to the cooldown imposed when it rejects.
+	OnReject map[string]time.Duration `toml:"on_reject"`
+}
+
+// OriginFilterConfig verifies that events synced or streamed from other
+// relays are really served by them.
+type OriginFilterConfig struct {
+	Enabled      bool                   `toml:"enabled"`
+	SampleRate   float64                `toml:"sample_rate"`
+	Timeout      time.Duration          `toml:"timeout"`
+	QueueSize    int                    `toml:"queue_size"`
+	MaxFailures  int                    `toml:"max_failures"`
+	FailureTTL   time.Duration          `toml:"failure_window"`
+	FlagDuration time.Duration          `toml:"flag_duration"`
+	Action       kitconfig.FilterAction `toml:"action"`
 }
 
 type BannedAuthorFilterConfig struct {
 	CheckNIP26 bool `toml:"check_nip26"`
+	// Operator policy for NIP-26 delegations, applied when check_nip26 is on.
+	RequireTimeBounds      bool          `toml:"require_delegation_time_bounds"`
+	MaxDelegationWindow    time.Duration `toml:"max_delegation_window"`
+	RequireKindConditions  bool          `toml:"require_delegation_kinds"`
+	MaxDelegateesPerAuthor int           `toml:"max_delegatees_per_delegator"`
+	// DelegateeTTL is how long a delegatee counts as active when its
+	// delegation has no upper time bound.
+	DelegateeTTL time.Duration `toml:"delegatee_ttl"`
+}
+
+// IPFilterConfig rejects events submitted from the Deny networks and, if
+// Allow is not empty, from outside the Allow networks. Deny takes priority.
+type IPFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Allow and Deny list addresses and CIDR networks.
+	Allow []string `toml:"allow"`
+	Deny  []string `toml:"deny"`
+}
+
+// BannedIPFilterConfig rejects events submitted from banned addresses.
+// Addresses are reduced to the given prefixes both when banned and when
+// looked up, so a single ban can cover a whole network.
+type BannedIPFilterConfig struct {
+	Enabled    bool `toml:"enabled"`
+	IPv4Prefix int  `toml:"ipv4_prefix"`
+	IPv6Prefix int  `toml:"ipv6_prefix"`
+}
+
+// BlocklistFilterConfig rejects events by ID or by exact content: those
+// listed here, and those blocked at runtime through the admin API or
+// policy.block_emoji, which are kept in the database for Duration.
+type BlocklistFilterConfig struct {
+	Enabled  bool     `toml:"enabled"`
+	EventIDs []string `toml:"event_ids"`
+	// ContentHashes are hex SHA-256 hashes of event contents.
+	ContentHashes []string      `toml:"content_hashes"`
+	Duration      time.Duration `toml:"duration"`
+}
+
+type BannedReferenceAction string
+
+const (
+	BannedReferenceReject BannedReferenceAction = "reject"
+	BannedReferenceStrike BannedReferenceAction = "strike"
+)
+
+func (a *BannedReferenceAction) UnmarshalText(text []byte) error {
+	v := string(text)
+	switch BannedReferenceAction(v) {
+	case BannedReferenceReject, BannedReferenceStrike:
+		*a = BannedReferenceAction(v)
+		return nil
+	default:
+		return fmt.Errorf("invalid banned_reference.action: %q (must be reject, strike)", v)
+	}
+}
+
+type BannedReferenceFilterConfig struct {
+	Enabled         bool                  `toml:"enabled"`
+	Action          BannedReferenceAction `toml:"action"`
+	Kinds           []int                 `toml:"kinds"`
+	CheckMentions   bool                  `toml:"check_content_mentions"`
+	RequirePromo    bool                  `toml:"require_promo"`
+	PromoPatterns   []string              `toml:"promo_patterns"`
+	MaxPubKeyChecks int                   `toml:"max_pubkey_checks"`
+}
+
+type BanEvasionFilterConfig struct {
+	Enabled             bool          `toml:"enabled"`
+	Kinds               []int         `toml:"kinds"`
+	SimilarityThreshold float64       `toml:"similarity_threshold"`
+	MinChars            int           `toml:"min_chars"`
+	NewKeyWindow        time.Duration `toml:"new_key_window"`
+	EarlyPosts          int           `toml:"early_posts"`
+	ProfileCacheSize    int           `toml:"profile_cache_size"`
+	ProfileTTL          time.Duration `toml:"profile_ttl"`
+	BannedCacheSize     int           `toml:"banned_cache_size"`
+	BannedTTL           time.Duration `toml:"banned_ttl"`
 }
 
 type AutoBanFilterConfig struct {
@@ -106,58 +927,858 @@ type AutoBanFilterConfig struct {
 	CooldownDuration  time.Duration `toml:"cooldown_duration"`
 	BanTimeout        time.Duration `toml:"ban_timeout"`
 	ExcludeFilters    []string      `toml:"exclude_filters_from_strikes"`
+	// BanIP also bans the address the offending event came from, through
+	// filters.banned_ip.
+	BanIP bool `toml:"ban_ip"`
+	// PersistStrikes also counts strikes in the database, so that they
+	// survive restarts and reloads.
+	PersistStrikes bool `toml:"persist_strikes"`
+	// AgeTiers raise max_strikes for authors first seen long enough ago;
+	// max_strikes applies to authors too new for any tier.
+	AgeTiers []AutoBanAgeTier `toml:"age_tier"`
+}
+
+// AutoBanAgeTier is the strike limit of authors first seen at least MinAge ago.
+type AutoBanAgeTier struct {
+	MinAge     time.Duration `toml:"min_age"`
+	MaxStrikes int           `toml:"max_strikes"`
+}
+
+// validIPOrCIDR reports whether s is an address or a network in CIDR
+// notation.
+func validIPOrCIDR(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(s)
+	return err == nil
+}
+
+func findCommonElements(slice1, slice2 []int) []int {
+	set := make(map[int]struct{})
+	var common []int
+
+	for _, item := range slice1 {
+		set[item] = struct{}{}
+	}
+
+	for _, item := range slice2 {
+		if _, found := set[item]; found {
+			common = append(common, item)
+		}
+	}
+	return common
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		DB: DBConfig{
+			Driver:    DBBadger,
+			Path:      "./plugin-db",
+			KeyPrefix: "adresu:",
+			Tiering: TieringConfig{
+				ResyncInterval: time.Minute,
+			},
+		},
+		Strfry: StrfryConfig{
+			ExecutablePath: "/usr/local/bin/strfry",
+			ConfigPath:     "/etc/strfry.conf",
+			CheckConfig:    StrfryCheckWarn,
+		},
+		Policy: PolicyConfig{
+			BanEmoji:          "🔨",
+			NukeEmoji:         "💣",
+			UnbanEmoji:        "🔓",
+			ProtectedRoles:    []ProtectedRole{RoleModerator, RoleBot, RoleAllowlisted},
+			BanDuration:       30 * 24 * time.Hour,
+			RestrictDuration:  7 * 24 * time.Hour,
+			ShadowBanDelay:    10 * time.Second,
+			SlowModeDelay:     30 * time.Second,
+			SlowModeDuration:  time.Hour,
+			UnknownKindAction: UnknownKindAccept,
+			Reports: ReportsConfig{
+				Threshold: 3,
+				Window:    24 * time.Hour,
+				CacheSize: 10000,
+			},
+			MuteList: MuteListConfig{
+				RefreshInterval: 10 * time.Minute,
+				Timeout:         30 * time.Second,
+				BanDuration:     24 * time.Hour,
+			},
+		},
+		Filters: FiltersConfig{
+			Validation: kitconfig.ValidationFilterConfig{
+				EmptyTagNames: true,
+				HexReferences: true,
+				Timestamps:    true,
+				MaxTags:       2000,
+			},
+			RateLimiter: kitconfig.RateLimiterConfig{
+				ThreadReplies: kitconfig.ThreadReplyConfig{
+					RateMultiplier:  3.0,
+					BurstMultiplier: 2.0,
+					CacheSize:       65536,
+					ActiveWindow:    time.Hour,
+				},
+			},
+			DuplicateContent: kitconfig.DuplicateContentFilterConfig{
+				MinLength:           20,
+				MaxDuplicates:       3,
+				GlobalMaxDuplicates: 20,
+				Window:              time.Hour,
+				MaxDistance:         5,
+				CacheSize:           65536,
+				Action:              kitconfig.ActionReject,
+			},
+			BotSignatures: kitconfig.BotSignatureFilterConfig{
+				BenignAction:    kitconfig.ActionAllow,
+				MaliciousAction: kitconfig.ActionReject,
+			},
+			Client: kitconfig.ClientFilterConfig{
+				Action: kitconfig.ActionReject,
+			},
+			ReplyFlood: kitconfig.ReplyFloodFilterConfig{
+				Kinds:      []int{nostr.KindTextNote, nostr.KindComment},
+				Window:     time.Hour,
+				MaxThreads: 30,
+				MaxAuthors: 30,
+				CacheSize:  65536,
+				Action:     kitconfig.ActionReject,
+			},
+			TagStuffing: kitconfig.TagStuffingFilterConfig{
+				Action: kitconfig.ActionReject,
+			},
+			Metadata: kitconfig.MetadataFilterConfig{
+				MaxNameLength:  64,
+				MaxAboutLength: 2000,
+				MaxURLLength:   1024,
+				Action:         kitconfig.ActionReject,
+			},
+			Blocklist: BlocklistFilterConfig{
+				Duration: 30 * 24 * time.Hour,
+			},
+			BannedAuthor: BannedAuthorFilterConfig{
+				DelegateeTTL: 30 * 24 * time.Hour,
+			},
+			Cooldown: CooldownFilterConfig{
+				By:        kitconfig.RateByPubKey,
+				CacheSize: 65536,
+			},
+			Origin: OriginFilterConfig{
+				SampleRate:   0.05,
+				Timeout:      10 * time.Second,
+				QueueSize:    1000,
+				MaxFailures:  3,
+				FailureTTL:   time.Hour,
+				FlagDuration: 24 * time.Hour,
+				Action:       kitconfig.ActionReject,
+			},
+			WoT: WoTFilterConfig{
+				Depth:           1,
+				RefreshInterval: time.Hour,
+				Timeout:         30 * time.Second,
+				Action:          kitconfig.ActionReject,
+			},
+			Whitelist: WhitelistFilterConfig{
+				RefreshInterval: 10 * time.Minute,
+				Timeout:         30 * time.Second,
+				Action:          kitconfig.ActionReject,
+			},
+			IPReputation: IPReputationFilterConfig{
+				RefreshInterval: time.Hour,
+				Timeout:         30 * time.Second,
+				CacheSize:       65536,
+			},
+			DNSBL: DNSBLFilterConfig{
+				Timeout:   time.Second,
+				CacheSize: 65536,
+				CacheTTL:  time.Hour,
+				Action:    kitconfig.ActionReject,
+			},
+			CompromisedKeys: CompromisedKeysFilterConfig{
+				RefreshInterval: time.Hour,
+				Timeout:         30 * time.Second,
+				Action:          kitconfig.ActionReject,
+			},
+		},
+		Pipeline: PipelineConfig{
+			PoWLane: PoWLaneConfig{
+				MinDifficulty: 20,
+				MaxDifficulty: 28,
+				TargetRate:    5,
+				Window:        10 * time.Second,
+				Filters:       []string{"EmergencyFilter", "FairnessFilter", "RateLimiterFilter"},
+			},
+			Degradation: DegradationConfig{
+				Interval:     time.Second,
+				RecoverAfter: 30 * time.Second,
+			},
+			LoadShedding: LoadSheddingConfig{
+				Interval:     time.Second,
+				RecoverAfter: 30 * time.Second,
+				Message:      "rate-limited: relay is overloaded, please retry later",
+				Tiers: []LoadSheddingTier{
+					{Description: "ephemeral events", Ephemeral: true},
+					{Description: "reactions", Kinds: []int{7}},
+					{Description: "reposts", Kinds: []int{6, 16}},
+				},
+			},
+		},
+		Runtime: RuntimeConfig{
+			Workers:       1,
+			MaxInputBytes: 1 << 20,
+		},
+		GRPC: GRPCConfig{
+			Listen: "127.0.0.1:50051",
+		},
+		Admin: AdminConfig{
+			Listen: "127.0.0.1:8089",
+		},
+		Metrics: MetricsConfig{
+			Listen: "127.0.0.1:9091",
+			Path:   "/metrics",
+		},
+		Digest: DigestConfig{
+			Scope:          DigestRejected,
+			Kinds:          []int{nostr.KindTextNote},
+			Window:         24 * time.Hour,
+			Interval:       24 * time.Hour,
+			MaxItems:       50000,
+			MinChars:       40,
+			MaxDistance:    5,
+			MinClusterSize: 5,
+			Top:            10,
+		},
+		BanReview: BanReviewConfig{
+			At:       "03:00",
+			Horizon:  24 * time.Hour,
+			Lookback: 24 * time.Hour,
+			Evidence: 5,
+		},
+		Canary: CanaryConfig{
+			LogSampleRate: 0.1,
+			MaxInFlight:   64,
+		},
+		Experiment: ExperimentConfig{
+			RetentionWindow: 24 * time.Hour,
+		},
+		Summary: SummaryConfig{
+			At:   "00:00",
+			Keep: 14,
+			Top:  10,
+		},
+		Flags: FlagsConfig{
+			PollInterval: 10 * time.Second,
+			Timeout:      5 * time.Second,
+		},
+		RulePacks: RulePacksConfig{
+			CacheDir:      "./rule-packs",
+			CheckInterval: 24 * time.Hour,
+		},
+		Maintenance: MaintenanceConfig{
+			Mode:    MaintenanceOff,
+			Message: "blocked: relay is under maintenance, please try again later",
+		},
+	}
+}
+
+// KnownKinds returns every kind that some configured rule or policy list
+// mentions explicitly, plus policy.known_kinds. Kinds outside this set are
+// "unknown" to the plugin and handled per policy.unknown_kind_action.
+func (c *Config) KnownKinds() map[int]struct{} {
+	f := &c.Filters
+	lists := [][]int{
+		c.Policy.KnownKinds,
+		f.Kind.AllowedKinds, f.Kind.DeniedKinds,
+		f.Language.KindsToCheck, f.EphemeralChat.Kinds, f.References.Kinds,
+		f.Phishing.Kinds, f.InlineData.Kinds, f.ReplyFlood.Kinds, f.KindDiversity.Kinds, f.DuplicateContent.Kinds,
+		f.BannedReference.Kinds, f.BanEvasion.Kinds, f.Client.RequiredKinds, c.Mirror.Kinds,
+	}
+	for _, r := range f.RateLimiter.Rules {
+		lists = append(lists, r.Kinds)
+	}
+	for _, sig := range f.BotSignatures.Signatures {
+		lists = append(lists, sig.Kinds)
+	}
+	for _, r := range f.Freshness.Rules {
+		lists = append(lists, r.Kinds)
+	}
+	for _, r := range f.Size.Rules {
+		lists = append(lists, r.Kinds)
+	}
+	for _, r := range f.Tags.Rules {
+		lists = append(lists, r.Kinds)
+	}
+	for _, r := range f.TagStuffing.Rules {
+		lists = append(lists, r.Kinds)
+	}
+	for _, r := range f.Keywords.Rules {
+		lists = append(lists, r.Kinds)
+	}
+	for _, r := range f.PoW.Rules {
+		lists = append(lists, r.Kinds)
+	}
+	for _, r := range f.FileSharing.Rules {
+		lists = append(lists, r.Kinds)
+	}
+	if f.LiveActivity.Enabled {
+		lists = append(lists, []int{1311, 30311})
+	}
+	if c.Policy.ModeratorPubKey != "" || len(c.Policy.TraineeModerators) > 0 {
+		lists = append(lists, []int{nostr.KindReaction})
+	}
+	if c.Policy.Reports.Enabled {
+		lists = append(lists, []int{nostr.KindReporting})
+	}
+	if c.Policy.MuteList.Enabled {
+		lists = append(lists, []int{nostr.KindMuteList})
+	}
+
+	known := make(map[int]struct{})
+	for _, list := range lists {
+		for _, k := range list {
+			known[k] = struct{}{}
+		}
+	}
+	return known
 }
 
-func findCommonElements(slice1, slice2 []int) []int {
-	set := make(map[int]struct{})
-	var common []int
+// normalize converts operator-supplied keys to the canonical hex form, so that
+// pasted npub values do not silently fail to match.
+func (c *Config) normalize() error {
+	if c.Policy.ModeratorPubKey != "" {
+		pk, err := nip.NormalizePubKey(c.Policy.ModeratorPubKey)
+		if err != nil {
+			return fmt.Errorf("policy.moderator_pubkey: %w", err)
+		}
+		c.Policy.ModeratorPubKey = pk
+	}
+	for i, v := range c.Policy.TraineeModerators {
+		pk, err := nip.NormalizePubKey(v)
+		if err != nil {
+			return fmt.Errorf("policy.trainee_moderators: %w", err)
+		}
+		c.Policy.TraineeModerators[i] = pk
+	}
+	for i, v := range c.Policy.Bots {
+		pk, err := nip.NormalizePubKey(v)
+		if err != nil {
+			return fmt.Errorf("policy.bots: %w", err)
+		}
+		c.Policy.Bots[i] = pk
+	}
+	for i, v := range c.Policy.Reports.TrustedReporters {
+		pk, err := nip.NormalizePubKey(v)
+		if err != nil {
+			return fmt.Errorf("policy.reports.trusted_reporters: %w", err)
+		}
+		c.Policy.Reports.TrustedReporters[i] = pk
+	}
+	for i, v := range c.Policy.MuteList.PubKeys {
+		pk, err := nip.NormalizePubKey(v)
+		if err != nil {
+			return fmt.Errorf("policy.mute_list.pubkeys: %w", err)
+		}
+		c.Policy.MuteList.PubKeys[i] = pk
+	}
+	for i, v := range c.Filters.Blocklist.EventIDs {
+		c.Filters.Blocklist.EventIDs[i] = strings.ToLower(v)
+	}
+	for i, v := range c.Filters.Blocklist.ContentHashes {
+		c.Filters.Blocklist.ContentHashes[i] = strings.ToLower(v)
+	}
+	if len(c.Policy.MuteList.PubKeys) == 0 && c.Policy.ModeratorPubKey != "" {
+		c.Policy.MuteList.PubKeys = []string{c.Policy.ModeratorPubKey}
+	}
+	if c.Filters.WoT.OperatorPubKey != "" {
+		pk, err := nip.NormalizePubKey(c.Filters.WoT.OperatorPubKey)
+		if err != nil {
+			return fmt.Errorf("filters.wot.operator_pubkey: %w", err)
+		}
+		c.Filters.WoT.OperatorPubKey = pk
+	} else {
+		c.Filters.WoT.OperatorPubKey = c.Policy.ModeratorPubKey
+	}
+	for i, v := range c.Maintenance.AllowedPubKeys {
+		pk, err := nip.NormalizePubKey(v)
+		if err != nil {
+			return fmt.Errorf("maintenance.allowed_pubkeys: %w", err)
+		}
+		c.Maintenance.AllowedPubKeys[i] = pk
+	}
+	for i, v := range c.Admin.PubKeys {
+		pk, err := nip.NormalizePubKey(v)
+		if err != nil {
+			return fmt.Errorf("admin.pubkeys: %w", err)
+		}
+		c.Admin.PubKeys[i] = pk
+	}
+	for i, v := range c.Filters.Whitelist.PubKeys {
+		pk, err := nip.NormalizePubKey(v)
+		if err != nil {
+			return fmt.Errorf("filters.whitelist.pubkeys: %w", err)
+		}
+		c.Filters.Whitelist.PubKeys[i] = pk
+	}
+	for _, sig := range c.Filters.BotSignatures.Signatures {
+		for i, v := range sig.PubKeys {
+			pk, err := nip.NormalizePubKey(v)
+			if err != nil {
+				return fmt.Errorf("filters.bot_signatures.signature %q: %w", sig.Name, err)
+			}
+			sig.PubKeys[i] = pk
+		}
+	}
+	if c.Filters.Whitelist.List != "" {
+		addr, err := normalizeListAddress(c.Filters.Whitelist.List)
+		if err != nil {
+			return fmt.Errorf("filters.whitelist.list: %w", err)
+		}
+		c.Filters.Whitelist.List = addr
+	}
+	return nil
+}
+
+// normalizeListAddress turns an naddr or "30000:<pubkey>:<d>" address of a
+// follow set into the latter form with a hex pubkey.
+func normalizeListAddress(s string) (string, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "nostr:")
+	var kind, pubkey, d string
+	if strings.HasPrefix(s, "naddr1") {
+		_, value, err := nip19.Decode(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid naddr: %w", err)
+		}
+		ptr := value.(nostr.EntityPointer)
+		kind, pubkey, d = strconv.Itoa(ptr.Kind), ptr.PublicKey, ptr.Identifier
+	} else {
+		parts := strings.SplitN(s, ":", 3)
+		if len(parts) != 3 {
+			return "", fmt.Errorf("%q is neither an naddr nor a \"30000:<pubkey>:<d>\" address", s)
+		}
+		kind, pubkey, d = parts[0], parts[1], parts[2]
+	}
+	if kind != strconv.Itoa(nostr.KindCategorizedPeopleList) {
+		return "", fmt.Errorf("list must be a kind %d follow set, got kind %s", nostr.KindCategorizedPeopleList, kind)
+	}
+	pk, err := nip.NormalizePubKey(pubkey)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%s:%s", kind, pk, d), nil
+}
+
+func (c *Config) validate() error {
+	// --- [database] ---
+	switch c.DB.Driver {
+	case DBBadger, DBSQLite:
+		if c.DB.Path == "" {
+			return fmt.Errorf("database.path must be set for the %s driver", c.DB.Driver)
+		}
+	case DBRedis:
+		if c.DB.URL == "" {
+			return errors.New("database.url must be set for the redis driver")
+		}
+	default:
+		return fmt.Errorf("invalid database.driver %q (must be badger, redis or sqlite)", c.DB.Driver)
+	}
+	if c.DB.Driver != DBBadger && c.DB.InstanceID == "" {
+		return fmt.Errorf("database.instance_id must be set for the %s driver, unique among the instances sharing the database and stable across restarts", c.DB.Driver)
+	}
+	if c.DB.Tiering.Enabled && c.DB.Tiering.ResyncInterval <= 0 {
+		return errors.New("database.tiering.resync_interval must be a positive duration")
+	}
+
+	// --- [policy] ---
+	if c.Policy.BanDuration <= 0 {
+		return errors.New("policy.ban_duration must be a positive duration (e.g., '24h')")
+	}
+	if (c.Policy.BanEmoji != "" || c.Policy.UnbanEmoji != "") && c.Policy.ModeratorPubKey == "" {
+		return errors.New("policy.moderator_pubkey must be set")
+	}
+	if slices.Contains(c.Policy.TraineeModerators, c.Policy.ModeratorPubKey) {
+		return errors.New("policy.trainee_moderators must not include policy.moderator_pubkey")
+	}
+	if len(c.Policy.TraineeModerators) > 0 && (c.Policy.BanEmoji == "" || c.Policy.UnbanEmoji == "") {
+		return errors.New("policy.ban_emoji and policy.unban_emoji must be set when policy.trainee_moderators is used")
+	}
+	if (c.Policy.BanEmoji != "" || c.Policy.UnbanEmoji != "") && c.Policy.BanEmoji == c.Policy.UnbanEmoji {
+		return errors.New("policy.ban_emoji and policy.unban_emoji must not be identical")
+	}
+	if c.Policy.RestrictEmoji != "" {
+		if c.Policy.ModeratorPubKey == "" {
+			return errors.New("policy.moderator_pubkey must be set")
+		}
+		if c.Policy.RestrictEmoji == c.Policy.BanEmoji || c.Policy.RestrictEmoji == c.Policy.UnbanEmoji {
+			return errors.New("policy.restrict_emoji must differ from policy.ban_emoji and policy.unban_emoji")
+		}
+		if c.Policy.RestrictDuration <= 0 {
+			return errors.New("policy.restrict_duration must be a positive duration")
+		}
+	}
+	if c.Policy.NukeEmoji != "" {
+		if c.Policy.ModeratorPubKey == "" {
+			return errors.New("policy.moderator_pubkey must be set")
+		}
+		if slices.Contains([]string{c.Policy.BanEmoji, c.Policy.UnbanEmoji, c.Policy.RestrictEmoji}, c.Policy.NukeEmoji) {
+			return errors.New("policy.nuke_emoji must differ from the other moderation emojis")
+		}
+	}
+	if c.Policy.DeleteEmoji != "" {
+		if c.Policy.ModeratorPubKey == "" {
+			return errors.New("policy.moderator_pubkey must be set")
+		}
+		if slices.Contains([]string{c.Policy.BanEmoji, c.Policy.UnbanEmoji, c.Policy.RestrictEmoji, c.Policy.NukeEmoji}, c.Policy.DeleteEmoji) {
+			return errors.New("policy.delete_emoji must differ from the other moderation emojis")
+		}
+	}
+	if c.Policy.DeleteStrike {
+		if c.Policy.DeleteEmoji == "" {
+			return errors.New("policy.delete_strike requires policy.delete_emoji")
+		}
+		if !c.Filters.AutoBan.Enabled {
+			slog.Warn("policy.delete_strike is set but autoban is disabled; strikes will have no effect")
+		}
+	}
+	if c.Policy.BlockEmoji != "" {
+		if c.Policy.ModeratorPubKey == "" {
+			return errors.New("policy.moderator_pubkey must be set")
+		}
+		if slices.Contains([]string{c.Policy.BanEmoji, c.Policy.UnbanEmoji, c.Policy.RestrictEmoji, c.Policy.NukeEmoji, c.Policy.DeleteEmoji}, c.Policy.BlockEmoji) {
+			return errors.New("policy.block_emoji must differ from the other moderation emojis")
+		}
+		if !c.Filters.Blocklist.Enabled {
+			return errors.New("policy.block_emoji requires filters.blocklist to be enabled")
+		}
+	}
+	if c.Policy.ShadowBanDelay <= 0 {
+		return errors.New("policy.shadow_ban_delay must be positive")
+	}
+	if c.Policy.SlowModeEmoji != "" {
+		if c.Policy.ModeratorPubKey == "" {
+			return errors.New("policy.moderator_pubkey must be set")
+		}
+		if slices.Contains([]string{c.Policy.BanEmoji, c.Policy.NukeEmoji, c.Policy.UnbanEmoji, c.Policy.RestrictEmoji, c.Policy.DeleteEmoji, c.Policy.BlockEmoji}, c.Policy.SlowModeEmoji) {
+			return errors.New("policy.slow_mode_emoji must differ from the other moderation emojis")
+		}
+		if c.Policy.SlowModeDelay <= 0 || c.Policy.SlowModeDuration <= 0 {
+			return errors.New("policy.slow_mode_delay and policy.slow_mode_duration must be positive durations")
+		}
+		if !c.Filters.EphemeralChat.Enabled {
+			return errors.New("policy.slow_mode_emoji requires filters.ephemeral_chat to be enabled")
+		}
+	}
+	if common := findCommonElements(c.Filters.Kind.AllowedKinds, c.Filters.Kind.DeniedKinds); len(common) > 0 {
+		return fmt.Errorf("policy.allowed_kinds and policy.denied_kinds must not overlap: %v", common)
+	}
+
+	if c.Policy.UnknownKindAction == UnknownKindRateLimit && (c.Policy.UnknownKindRate <= 0 || c.Policy.UnknownKindBurst <= 0) {
+		return errors.New("policy.unknown_kind_rate and policy.unknown_kind_burst must be > 0 when unknown_kind_action is \"ratelimit\"")
+	}
+
+	// [policy.reports]
+	if r := c.Policy.Reports; r.Enabled {
+		if c.Policy.ModeratorPubKey == "" && len(r.TrustedReporters) == 0 {
+			return errors.New("policy.reports.trusted_reporters or policy.moderator_pubkey must be set when reports are enabled")
+		}
+		if r.Threshold <= 0 {
+			return errors.New("policy.reports.threshold must be > 0")
+		}
+		if r.Window <= 0 || r.BanDuration < 0 {
+			return errors.New("policy.reports.window must be a positive duration and policy.reports.ban_duration must not be negative")
+		}
+		if r.CacheSize <= 0 {
+			return errors.New("policy.reports.cache_size must be > 0")
+		}
+		for _, t := range r.Types {
+			if !slices.Contains(ReportTypes, t) {
+				return fmt.Errorf("policy.reports.types: unknown report type %q (must be one of %v)", t, ReportTypes)
+			}
+		}
+	}
+
+	// [policy.mute_list]
+	if ml := c.Policy.MuteList; ml.Enabled {
+		if len(ml.PubKeys) == 0 {
+			return errors.New("policy.mute_list needs pubkeys or policy.moderator_pubkey")
+		}
+		if ml.RefreshInterval <= 0 || ml.Timeout <= 0 || ml.BanDuration <= 0 {
+			return errors.New("policy.mute_list: refresh_interval, timeout and ban_duration must be positive durations")
+		}
+		for _, relay := range ml.Relays {
+			if !nostr.IsValidRelayURL(relay) {
+				return fmt.Errorf("policy.mute_list.relays: invalid relay URL %q", relay)
+			}
+		}
+	}
+
+	// --- [canary] ---
+	if c.Canary.Enabled {
+		if c.Canary.Path == "" {
+			return errors.New("canary.path must be set when enabled")
+		}
+		if c.Canary.LogSampleRate < 0 || c.Canary.LogSampleRate > 1 {
+			return errors.New("canary.log_sample_rate must be between 0 and 1")
+		}
+		if c.Canary.MaxInFlight <= 0 {
+			return errors.New("canary.max_in_flight must be > 0")
+		}
+	}
+
+	// --- [experiment] ---
+	if c.Experiment.Enabled {
+		if err := c.validateExperiment(); err != nil {
+			return err
+		}
+	}
+
+	// --- [mirror] ---
+	if c.Mirror.Enabled {
+		if len(c.Mirror.Relays) == 0 {
+			return errors.New("mirror.relays must not be empty when enabled")
+		}
+		for _, r := range c.Mirror.Relays {
+			if !nostr.IsValidRelayURL(r) {
+				return fmt.Errorf("mirror.relays: invalid relay URL %q", r)
+			}
+		}
+		if c.Mirror.QueueSize < 0 || c.Mirror.MaxRetries < 0 {
+			return errors.New("mirror.queue_size and mirror.max_retries must not be negative")
+		}
+		if c.Mirror.RetryDelay < 0 || c.Mirror.PublishTimeout < 0 {
+			return errors.New("mirror.retry_delay and mirror.publish_timeout must not be negative")
+		}
+	}
+
+	// --- [pipeline] ---
+	if c.Pipeline.LatencyBudget < 0 {
+		return errors.New("pipeline.latency_budget must not be negative")
+	}
+	if pl := c.Pipeline.PoWLane; pl.Enabled {
+		if pl.MinDifficulty <= 0 || pl.MinDifficulty > 256 {
+			return errors.New("pipeline.pow_lane.min_difficulty must be between 1 and 256")
+		}
+		if pl.MaxDifficulty < pl.MinDifficulty || pl.MaxDifficulty > 256 {
+			return errors.New("pipeline.pow_lane.max_difficulty must be between min_difficulty and 256")
+		}
+		if pl.TargetRate <= 0 {
+			return errors.New("pipeline.pow_lane.target_rate must be > 0")
+		}
+		if pl.Window <= 0 {
+			return errors.New("pipeline.pow_lane.window must be > 0")
+		}
+		if len(pl.Filters) == 0 {
+			return errors.New("pipeline.pow_lane.filters must not be empty")
+		}
+	}
+	if dg := c.Pipeline.Degradation; dg.Enabled {
+		if dg.Interval <= 0 || dg.RecoverAfter < 0 {
+			return errors.New("pipeline.degradation.interval must be > 0 and recover_after must not be negative")
+		}
+		if len(dg.Steps) == 0 {
+			return errors.New("pipeline.degradation.step must not be empty when enabled")
+		}
+		for i, step := range dg.Steps {
+			if step.CPU < 0 || step.CPU > 1 || step.Latency < 0 {
+				return fmt.Errorf("pipeline.degradation.step[%d] ('%s'): cpu must be between 0 and 1 and latency must not be negative", i, step.Description)
+			}
+			if step.CPU == 0 && step.Latency == 0 {
+				return fmt.Errorf("pipeline.degradation.step[%d] ('%s'): set cpu or latency", i, step.Description)
+			}
+			if len(step.Skip) == 0 && len(step.Only) == 0 {
+				return fmt.Errorf("pipeline.degradation.step[%d] ('%s'): set skip or only", i, step.Description)
+			}
+		}
+	}
+	if ls := c.Pipeline.LoadShedding; ls.Enabled {
+		if ls.Interval <= 0 || ls.RecoverAfter < 0 {
+			return errors.New("pipeline.load_shedding.interval must be > 0 and recover_after must not be negative")
+		}
+		if ls.QueueDepth < 0 || ls.Latency < 0 {
+			return errors.New("pipeline.load_shedding: queue_depth and latency must not be negative")
+		}
+		if ls.QueueDepth == 0 && ls.Latency == 0 {
+			return errors.New("pipeline.load_shedding: set queue_depth or latency")
+		}
+		if len(ls.Tiers) == 0 {
+			return errors.New("pipeline.load_shedding.tier must not be empty when enabled")
+		}
+		for i, tier := range ls.Tiers {
+			if len(tier.Kinds) == 0 && !tier.Ephemeral {
+				return fmt.Errorf("pipeline.load_shedding.tier[%d] ('%s'): set kinds or ephemeral", i, tier.Description)
+			}
+		}
+	}
+
+	// --- [runtime] ---
+	if c.Runtime.Workers < 1 {
+		return errors.New("runtime.workers must be at least 1")
+	}
+	if c.Runtime.MaxInputBytes < 1 {
+		return errors.New("runtime.max_input_bytes must be positive")
+	}
+
+	// --- [messages] ---
+	if _, err := template.New("appeal_url").Parse(c.Policy.AppealURL); err != nil {
+		return fmt.Errorf("policy.appeal_url: %w", err)
+	}
+	for filter, text := range c.Messages {
+		if _, err := template.New(filter).Parse(text); err != nil {
+			return fmt.Errorf("messages.%s: %w", filter, err)
+		}
+	}
+
+	// --- [digest] ---
+	if dg := c.Digest; dg.Enabled {
+		if dg.Window <= 0 || dg.Interval <= 0 {
+			return errors.New("digest: window and interval must be positive durations")
+		}
+		if dg.MaxItems <= 0 || dg.MinClusterSize < 2 || dg.Top <= 0 {
+			return errors.New("digest: max_items and top must be > 0 and min_cluster_size at least 2")
+		}
+		if dg.MaxDistance < 0 || dg.MaxDistance > 7 {
+			return errors.New("digest.max_distance must be between 0 and 7")
+		}
+	}
+
+	// --- [ban_review] ---
+	if br := c.BanReview; br.Enabled {
+		if _, err := time.Parse("15:04", br.At); err != nil {
+			return fmt.Errorf("ban_review.at %q must be a time of day such as \"03:00\"", br.At)
+		}
+		if br.Horizon <= 0 || br.Lookback <= 0 {
+			return errors.New("ban_review: horizon and lookback must be positive durations")
+		}
+		if br.Evidence < 0 {
+			return errors.New("ban_review.evidence must be >= 0")
+		}
+		if len(br.DMRelays) > 0 && c.Policy.ModeratorPubKey == "" {
+			return errors.New("ban_review.dm_relays requires policy.moderator_pubkey")
+		}
+	}
+
+	// --- [summary] ---
+	if sm := c.Summary; sm.Enabled {
+		if _, err := time.Parse("15:04", sm.At); err != nil {
+			return fmt.Errorf("summary.at %q must be a time of day such as \"00:00\"", sm.At)
+		}
+		if sm.Keep <= 0 || sm.Top <= 0 {
+			return errors.New("summary: keep and top must be > 0")
+		}
+		if len(sm.DMRelays) > 0 && c.Policy.ModeratorPubKey == "" {
+			return errors.New("summary.dm_relays requires policy.moderator_pubkey")
+		}
+	}
+
+	// --- [changelog] ---
+	if cl := c.Changelog; cl.Enabled {
+		if len(cl.Relays) == 0 {
+			return errors.New("changelog.relays must be set when enabled")
+		}
+		for _, relay := range cl.Relays {
+			if !nostr.IsValidRelayURL(relay) {
+				return fmt.Errorf("changelog.relays: invalid relay URL %q", relay)
+			}
+		}
+		if !cl.Public && c.Policy.ModeratorPubKey == "" {
+			return errors.New("changelog requires policy.moderator_pubkey unless public")
+		}
+	}
 
-	for _, item := range slice1 {
-		set[item] = struct{}{}
+	// --- [rule_packs] ---
+	if c.RulePacks.CheckInterval < 0 {
+		return errors.New("rule_packs.check_interval must not be negative")
 	}
 
-	for _, item := range slice2 {
-		if _, found := set[item]; found {
-			common = append(common, item)
+	// --- [flags] ---
+	if fl := c.Flags; fl.URL != "" {
+		if u, err := url.Parse(fl.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("flags.url %q must be an http(s) URL", fl.URL)
+		}
+		if fl.PollInterval <= 0 || fl.Timeout <= 0 {
+			return errors.New("flags: poll_interval and timeout must be positive durations")
+		}
+		if len(fl.Keys) == 0 {
+			return errors.New("flags.keys must list the keys the flag service may override")
+		}
+		for _, pattern := range fl.Keys {
+			if _, err := path.Match(strings.ReplaceAll(pattern, ".", "/"), ""); err != nil {
+				return fmt.Errorf("flags.keys: invalid pattern %q", pattern)
+			}
 		}
 	}
-	return common
-}
 
-func defaultConfig() *Config {
-	return &Config{
-		DB: DBConfig{
-			Path: "./plugin-db",
-		},
-		Strfry: StrfryConfig{
-			ExecutablePath: "/usr/local/bin/strfry",
-			ConfigPath:     "/etc/strfry.conf",
-		},
-		Policy: PolicyConfig{
-			BanEmoji:    "🔨",
-			UnbanEmoji:  "🔓",
-			BanDuration: 30 * 24 * time.Hour,
-		},
+	// --- [maintenance] ---
+	if c.Maintenance.Mode == MaintenanceAllowlist && len(c.Maintenance.AllowedPubKeys) == 0 {
+		return errors.New("maintenance.allowed_pubkeys must not be empty when mode is \"allowlist\"")
 	}
-}
 
-func (c *Config) validate() error {
-	// --- [policy] ---
-	if c.Policy.BanDuration <= 0 {
-		return errors.New("policy.ban_duration must be a positive duration (e.g., '24h')")
+	// --- [geoip] ---
+	if len(c.GeoIP.Regions) > 0 && c.GeoIP.Path == "" {
+		return errors.New("geoip.regions requires geoip.path")
 	}
-	if (c.Policy.BanEmoji != "" || c.Policy.UnbanEmoji != "") && c.Policy.ModeratorPubKey == "" {
-		return errors.New("policy.moderator_pubkey must be set")
+	for region, countries := range c.GeoIP.Regions {
+		for _, country := range countries {
+			if len(country) != 2 {
+				return fmt.Errorf("geoip.regions.%s: %q is not a two-letter country code", region, country)
+			}
+		}
 	}
-	if (c.Policy.BanEmoji != "" || c.Policy.UnbanEmoji != "") && c.Policy.BanEmoji == c.Policy.UnbanEmoji {
-		return errors.New("policy.ban_emoji and policy.unban_emoji must not be identical")
+
+	// --- [schedule] ---
+	if c.Schedule.Jitter < 0 {
+		return errors.New("schedule.jitter must not be negative")
 	}
-	if common := findCommonElements(c.Filters.Kind.AllowedKinds, c.Filters.Kind.DeniedKinds); len(common) > 0 {
-		return fmt.Errorf("policy.allowed_kinds and policy.denied_kinds must not overlap: %v", common)
+	for name, expr := range c.Schedule.Jobs {
+		if !slices.Contains(scheduledJobs, name) {
+			return fmt.Errorf("schedule.jobs: unknown job %q (must be one of %s)", name, strings.Join(scheduledJobs, ", "))
+		}
+		if _, err := schedule.Parse(expr); err != nil {
+			return fmt.Errorf("schedule.jobs.%s %q is invalid: %w", name, expr, err)
+		}
+	}
+
+	// --- [grpc] ---
+	if c.GRPC.Listen == "" {
+		return errors.New("grpc.listen must not be empty")
+	}
+
+	// --- [admin] ---
+	if c.Admin.Enabled {
+		if c.Admin.Listen == "" {
+			return errors.New("admin.listen must be set when enabled")
+		}
+		if c.Admin.Token == "" && len(c.Admin.PubKeys) == 0 {
+			return errors.New("admin.pubkeys or admin.token must be set when enabled")
+		}
+		if c.Admin.NIP86 && len(c.Admin.PubKeys) == 0 {
+			return errors.New("admin.pubkeys must be set when admin.nip86 is enabled")
+		}
+		if c.Admin.PublicURL != "" {
+			if u, err := url.Parse(c.Admin.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("admin.public_url %q must be an absolute http(s) URL", c.Admin.PublicURL)
+			}
+		}
+	}
+
+	// --- [metrics] ---
+	if c.Metrics.Enabled {
+		if c.Metrics.Listen == "" {
+			return errors.New("metrics.listen must be set when enabled")
+		}
+		if !strings.HasPrefix(c.Metrics.Path, "/") {
+			return fmt.Errorf("metrics.path %q must start with '/'", c.Metrics.Path)
+		}
 	}
 
 	// --- [filters] ---
 
+	// [filters.validation]
+	if c.Filters.Validation.MaxTags < 0 {
+		return errors.New("filters.validation.max_tags must not be negative")
+	}
+
 	// [filters.emergency]
 	ef := c.Filters.Emergency
 	if ef.Enabled {
@@ -195,6 +1816,23 @@ func (c *Config) validate() error {
 		}
 	}
 
+	// [filters.fairness]
+	fa := c.Filters.Fairness
+	if fa.Enabled {
+		if fa.SaturationRate <= 0 {
+			return errors.New("filters.fairness.saturation_rate must be > 0")
+		}
+		if fa.MaxShare <= 0.0 || fa.MaxShare > 1.0 {
+			return errors.New("filters.fairness.max_share must be in (0.0, 1.0]")
+		}
+		if fa.Window <= 0 {
+			return errors.New("filters.fairness.window must be a positive duration")
+		}
+		if fa.IPv4Prefix < 0 || fa.IPv4Prefix > 32 || fa.IPv6Prefix < 0 || fa.IPv6Prefix > 128 {
+			return errors.New("filters.fairness: ipv4_prefix must be in [0..32] and ipv6_prefix in [0..128]")
+		}
+	}
+
 	// [filters.rate_limiter]
 	if c.Filters.RateLimiter.Enabled {
 		if c.Filters.RateLimiter.DefaultRate < 0 || c.Filters.RateLimiter.DefaultBurst <= 0 {
@@ -205,6 +1843,20 @@ func (c *Config) validate() error {
 				return fmt.Errorf("filters.rate_limiter.rule[%d] ('%s'): rate must be >= 0 and burst must be > 0", i, rule.Description)
 			}
 		}
+		if wt := c.Filters.RateLimiter.WarnThreshold; wt < 0.0 || wt > 1.0 {
+			return errors.New("filters.rate_limiter.warn_threshold must be between 0.0 and 1.0")
+		}
+		if tr := c.Filters.RateLimiter.ThreadReplies; tr.Enabled {
+			if tr.RateMultiplier < 1.0 || tr.BurstMultiplier < 1.0 {
+				return errors.New("filters.rate_limiter.thread_replies: rate_multiplier and burst_multiplier must be >= 1.0")
+			}
+			if tr.CacheSize < 0 {
+				return errors.New("filters.rate_limiter.thread_replies.cache_size must not be negative")
+			}
+			if tr.ActiveWindow < 0 {
+				return errors.New("filters.rate_limiter.thread_replies.active_window must not be a negative duration")
+			}
+		}
 	}
 
 	// [filters.freshness]
@@ -231,10 +1883,16 @@ func (c *Config) validate() error {
 	if c.Filters.Size.DefaultMaxSize < 0 {
 		return errors.New("filters.size.default_max_size_bytes must not be negative")
 	}
+	if c.Filters.Size.DefaultMinContentLength < 0 {
+		return errors.New("filters.size.default_min_content_length must not be negative")
+	}
 	for i, rule := range c.Filters.Size.Rules {
 		if rule.MaxSize < 0 {
 			return fmt.Errorf("filters.size.rule[%d] ('%s'): max_size_bytes must not be negative", i, rule.Description)
 		}
+		if rule.MinContentLength != nil && *rule.MinContentLength < 0 {
+			return fmt.Errorf("filters.size.rule[%d] ('%s'): min_content_length must not be negative", i, rule.Description)
+		}
 	}
 
 	// [filters.tags]
@@ -249,6 +1907,21 @@ func (c *Config) validate() error {
 		}
 	}
 
+	// [filters.tag_stuffing]
+	if c.Filters.TagStuffing.Enabled {
+		for i, rule := range c.Filters.TagStuffing.Rules {
+			if len(rule.Kinds) == 0 {
+				return fmt.Errorf("filters.tag_stuffing.rule[%d] ('%s'): must specify kinds", i, rule.Description)
+			}
+			if rule.MaxHashtags < 0 || rule.MaxMentions < 0 || rule.MinContentLength < 0 {
+				return fmt.Errorf("filters.tag_stuffing.rule[%d] ('%s'): limits must not be negative", i, rule.Description)
+			}
+			if rule.MaxHashtagRatio < 0.0 || rule.MaxHashtagRatio > 1.0 {
+				return fmt.Errorf("filters.tag_stuffing.rule[%d] ('%s'): max_hashtag_ratio must be between 0.0 and 1.0", i, rule.Description)
+			}
+		}
+	}
+
 	// [filters.keywords]
 	if c.Filters.Keywords.Enabled {
 		for i, rule := range c.Filters.Keywords.Rules {
@@ -261,6 +1934,12 @@ func (c *Config) validate() error {
 		}
 	}
 
+	// [filters.references]
+	rf := c.Filters.References
+	if rf.Enabled && len(rf.DeniedPubKeys) == 0 && len(rf.DeniedEvents) == 0 && len(rf.DeniedRelays) == 0 {
+		return errors.New("filters.references: at least one of denied_pubkeys, denied_events, denied_relays must be set when enabled")
+	}
+
 	// [filters.language]
 	lang := c.Filters.Language
 	if lang.Enabled {
@@ -279,6 +1958,21 @@ func (c *Config) validate() error {
 		if lang.ApprovedCacheSize < 0 {
 			return errors.New("filters.language.approved_cache_size must not be negative")
 		}
+		if lang.WarmupTimeout < 0 {
+			return errors.New("filters.language.warmup_timeout must not be a negative duration")
+		}
+		if len(lang.RegionLanguages) > 0 && c.GeoIP.Path == "" {
+			return errors.New("filters.language.region_languages requires geoip.path")
+		}
+		for origin, langs := range lang.RegionLanguages {
+			if len(langs) == 0 {
+				return fmt.Errorf("filters.language.region_languages.%s must not be empty", origin)
+			}
+		}
+		if t := lang.Trust; t.CacheSize < 0 || t.MuteAfter < 0 || t.BilingualAfter < 0 ||
+			t.RejectionWindow < 0 || t.MuteDuration < 0 || t.BilingualTTL < 0 {
+			return errors.New("filters.language.trust: sizes, counts and durations must not be negative")
+		}
 		if len(lang.PrimaryAcceptThreshold) > 0 {
 			// Create a set for quick checking of allowed languages.
 			allowedSet := make(map[string]struct{}, len(lang.AllowedLanguages))
@@ -331,6 +2025,129 @@ func (c *Config) validate() error {
 		}
 	}
 
+	// [filters.live_activity]
+	la := c.Filters.LiveActivity
+	if la.Enabled {
+		if la.ChatRate < 0 || la.StreamRate < 0 || la.ChatBurst < 0 || la.StreamBurst < 0 {
+			return errors.New("filters.live_activity: chat and stream rates and bursts must not be negative")
+		}
+		if la.CacheSize < 0 || la.StreamTTL < 0 {
+			return errors.New("filters.live_activity: cache_size and stream_ttl must not be negative")
+		}
+	}
+
+	// [filters.file_sharing]
+	fsf := c.Filters.FileSharing
+	if fsf.Enabled {
+		if !fsf.BlockMagnetLinks && len(fsf.Domains) == 0 {
+			return errors.New("filters.file_sharing: enable block_magnet_links or list domains when enabled")
+		}
+		for i, rule := range fsf.Rules {
+			if len(rule.Kinds) == 0 {
+				return fmt.Errorf("filters.file_sharing.rule #%d: kinds must not be empty", i)
+			}
+		}
+	}
+
+	// [filters.phishing]
+	if pf := c.Filters.Phishing; pf.Enabled && pf.MaxEditDistance < 0 {
+		return errors.New("filters.phishing.max_edit_distance must not be negative")
+	}
+
+	// [filters.bot_signatures]
+	if bs := c.Filters.BotSignatures; bs.Enabled {
+		names := make(map[string]bool, len(bs.Signatures))
+		for i, sig := range bs.Signatures {
+			if sig.Name == "" {
+				return fmt.Errorf("filters.bot_signatures.signature #%d: name must be set", i)
+			}
+			if names[sig.Name] {
+				return fmt.Errorf("filters.bot_signatures.signature %q: duplicate name", sig.Name)
+			}
+			names[sig.Name] = true
+			if sig.Class == "" {
+				return fmt.Errorf("filters.bot_signatures.signature %q: class must be set", sig.Name)
+			}
+			if len(sig.PubKeys) == 0 && len(sig.Clients) == 0 && len(sig.Content) == 0 {
+				return fmt.Errorf("filters.bot_signatures.signature %q: needs pubkeys, clients or content", sig.Name)
+			}
+			for _, pk := range sig.PubKeys {
+				if !nostr.IsValid32ByteHex(pk) {
+					return fmt.Errorf("filters.bot_signatures.signature %q: invalid pubkey %q", sig.Name, pk)
+				}
+			}
+		}
+	}
+
+	// [filters.client]
+	if cf := c.Filters.Client; cf.Enabled {
+		for i, rule := range cf.Rules {
+			if len(rule.Clients) == 0 {
+				return fmt.Errorf("filters.client.rule #%d: clients must not be empty", i)
+			}
+			if rule.RateMultiplier < 0 || rule.BurstMultiplier < 0 {
+				return fmt.Errorf("filters.client.rule #%d: multipliers must not be negative", i)
+			}
+		}
+	}
+
+	// [filters.inline_data]
+	if id := c.Filters.InlineData; id.Enabled && (id.MaxDataURIBytes < 0 || id.MaxBase64Bytes < 0) {
+		return errors.New("filters.inline_data: max_data_uri_bytes and max_base64_bytes must not be negative")
+	}
+
+	// [filters.metadata]
+	if md := c.Filters.Metadata; md.Enabled && (md.MaxNameLength < 0 || md.MaxAboutLength < 0 || md.MaxURLLength < 0 || md.MaxDataURIBytes < 0) {
+		return errors.New("filters.metadata: length and size limits must not be negative")
+	}
+
+	// [filters.pow]
+	if pw := c.Filters.PoW; pw.Enabled {
+		if pw.DefaultMinDifficulty < 0 || pw.DefaultMinDifficulty > 256 {
+			return errors.New("filters.pow.default_min_difficulty must be between 0 and 256")
+		}
+		for i, rule := range pw.Rules {
+			if rule.MinDifficulty < 0 || rule.MinDifficulty > 256 {
+				return fmt.Errorf("filters.pow.rule[%d] ('%s'): min_difficulty must be between 0 and 256", i, rule.Description)
+			}
+		}
+	}
+
+	// [filters.kind_diversity]
+	if kd := c.Filters.KindDiversity; kd.Enabled {
+		if kd.MinEvents <= 0 {
+			return errors.New("filters.kind_diversity.min_events must be positive")
+		}
+		if kd.Window <= 0 {
+			return errors.New("filters.kind_diversity.window must be a positive duration")
+		}
+		if kd.CacheSize <= 0 {
+			return errors.New("filters.kind_diversity.cache_size must be positive")
+		}
+		if kd.PoWDifficulty < 0 || kd.PoWDifficulty > 256 {
+			return errors.New("filters.kind_diversity.pow_difficulty must be between 0 and 256")
+		}
+	}
+
+	// [filters.duplicate_content]
+	if dc := c.Filters.DuplicateContent; dc.Enabled {
+		if dc.MaxDuplicates <= 0 {
+			return errors.New("filters.duplicate_content.max_duplicates must be positive")
+		}
+		if dc.GlobalMaxDuplicates < 0 || dc.MinLength < 0 {
+			return errors.New("filters.duplicate_content: global_max_duplicates and min_length must not be negative")
+		}
+		if dc.Window <= 0 {
+			return errors.New("filters.duplicate_content.window must be a positive duration")
+		}
+		if dc.MaxDistance < 0 || dc.MaxDistance > 7 {
+			return errors.New("filters.duplicate_content.max_distance must be between 0 and 7")
+		}
+		if dc.CacheSize <= 0 {
+			return errors.New("filters.duplicate_content.cache_size must be positive")
+		}
+	}
+
 	// [filters.repost_abuse]
 	ra := c.Filters.RepostAbuse
 	if ra.Enabled {
@@ -351,6 +2168,262 @@ func (c *Config) validate() error {
 		}
 	}
 
+	// [filters.reply_flood]
+	if rf := c.Filters.ReplyFlood; rf.Enabled {
+		if len(rf.Kinds) == 0 {
+			return errors.New("filters.reply_flood.kinds must not be empty")
+		}
+		if rf.Window <= 0 {
+			return errors.New("filters.reply_flood.window must be a positive duration")
+		}
+		if rf.MaxThreads < 0 || rf.MaxAuthors < 0 {
+			return errors.New("filters.reply_flood: max_threads and max_authors must not be negative")
+		}
+		if rf.CacheSize <= 0 {
+			return errors.New("filters.reply_flood.cache_size must be positive")
+		}
+	}
+
+	// [filters.banned_reference]
+	br := c.Filters.BannedReference
+	if br.Enabled {
+		if br.Action == "" {
+			return errors.New("filters.banned_reference.action must be set when enabled")
+		}
+		if br.MaxPubKeyChecks < 0 {
+			return errors.New("filters.banned_reference.max_pubkey_checks must not be negative")
+		}
+		if br.Action == BannedReferenceStrike && !c.Filters.AutoBan.Enabled {
+			slog.Warn("filters.banned_reference.action is 'strike' but autoban is disabled; strikes will have no effect")
+		}
+	}
+
+	// [filters.ban_evasion]
+	be := c.Filters.BanEvasion
+	if be.Enabled {
+		if len(be.Kinds) == 0 {
+			return errors.New("filters.ban_evasion.kinds must not be empty when enabled")
+		}
+		if be.SimilarityThreshold <= 0.0 || be.SimilarityThreshold > 1.0 {
+			return errors.New("filters.ban_evasion.similarity_threshold must be in (0.0, 1.0]")
+		}
+		if be.MinChars < 0 || be.EarlyPosts <= 0 {
+			return errors.New("filters.ban_evasion: min_chars must not be negative and early_posts must be > 0")
+		}
+		if be.NewKeyWindow <= 0 || be.ProfileTTL <= 0 || be.BannedTTL <= 0 {
+			return errors.New("filters.ban_evasion: new_key_window, profile_ttl and banned_ttl must be positive durations")
+		}
+		if be.ProfileCacheSize <= 0 || be.BannedCacheSize <= 0 {
+			return errors.New("filters.ban_evasion: profile_cache_size and banned_cache_size must be > 0")
+		}
+	}
+
+	// [filters.banned_author]
+	ba := c.Filters.BannedAuthor
+	if ba.MaxDelegationWindow < 0 || ba.MaxDelegateesPerAuthor < 0 {
+		return errors.New("filters.banned_author: max_delegation_window and max_delegatees_per_delegator must not be negative")
+	}
+	if ba.MaxDelegateesPerAuthor > 0 && ba.DelegateeTTL <= 0 {
+		return errors.New("filters.banned_author.delegatee_ttl must be a positive duration when max_delegatees_per_delegator is set")
+	}
+	if !ba.CheckNIP26 && (ba.RequireTimeBounds || ba.MaxDelegationWindow > 0 || ba.RequireKindConditions || ba.MaxDelegateesPerAuthor > 0) {
+		slog.Warn("filters.banned_author: delegation policy is set but check_nip26 is disabled; it will have no effect")
+	}
+
+	// [filters.ip]
+	if ipf := c.Filters.IP; ipf.Enabled {
+		if len(ipf.Allow) == 0 && len(ipf.Deny) == 0 {
+			return errors.New("filters.ip: allow or deny must not be empty when enabled")
+		}
+		for name, list := range map[string][]string{"allow": ipf.Allow, "deny": ipf.Deny} {
+			for i, v := range list {
+				if !validIPOrCIDR(v) {
+					return fmt.Errorf("filters.ip.%s[%d]: invalid address or network %q", name, i, v)
+				}
+			}
+		}
+	}
+
+	// [filters.banned_ip]
+	if bi := c.Filters.BannedIP; bi.IPv4Prefix < 0 || bi.IPv4Prefix > 32 || bi.IPv6Prefix < 0 || bi.IPv6Prefix > 128 {
+		return errors.New("filters.banned_ip: ipv4_prefix must be in [0..32] and ipv6_prefix in [0..128]")
+	}
+
+	// [filters.blocklist]
+	if bl := c.Filters.Blocklist; bl.Enabled {
+		for _, id := range bl.EventIDs {
+			if !nostr.IsValid32ByteHex(id) {
+				return fmt.Errorf("filters.blocklist.event_ids: invalid event id %q", id)
+			}
+		}
+		for _, hash := range bl.ContentHashes {
+			if !nostr.IsValid32ByteHex(hash) {
+				return fmt.Errorf("filters.blocklist.content_hashes: invalid SHA-256 hash %q", hash)
+			}
+		}
+		if bl.Duration <= 0 {
+			return errors.New("filters.blocklist.duration must be a positive duration")
+		}
+	}
+
+	// [filters.cooldown]
+	cd := c.Filters.Cooldown
+	if cd.Enabled {
+		if cd.By == "" {
+			return errors.New("filters.cooldown.by must be set when enabled")
+		}
+		if cd.CacheSize <= 0 {
+			return errors.New("filters.cooldown.cache_size must be > 0")
+		}
+		for filter, d := range cd.OnReject {
+			if d <= 0 {
+				return fmt.Errorf("filters.cooldown.on_reject.%s must be a positive duration", filter)
+			}
+		}
+	}
+
+	// [filters.wot]
+	if wot := c.Filters.WoT; wot.Enabled {
+		if wot.OperatorPubKey == "" {
+			return errors.New("filters.wot needs operator_pubkey or policy.moderator_pubkey")
+		}
+		if wot.Depth < 1 || wot.Depth > 2 {
+			return errors.New("filters.wot.depth must be 1 or 2")
+		}
+		if wot.RefreshInterval <= 0 || wot.Timeout <= 0 {
+			return errors.New("filters.wot: refresh_interval and timeout must be positive durations")
+		}
+		for _, relay := range wot.Relays {
+			if !nostr.IsValidRelayURL(relay) {
+				return fmt.Errorf("filters.wot.relays: invalid relay URL %q", relay)
+			}
+		}
+	}
+
+	// [[filters.exec]]
+	execNames := make(map[string]struct{}, len(c.Filters.Exec))
+	for i, ex := range c.Filters.Exec {
+		if ex.Name == "" || (ex.Command == "") == (ex.Module == "") {
+			return fmt.Errorf("filters.exec[%d]: name and one of command and module are required", i)
+		}
+		if _, dup := execNames[ex.Name]; dup {
+			return fmt.Errorf("filters.exec[%d]: duplicate name '%s'", i, ex.Name)
+		}
+		execNames[ex.Name] = struct{}{}
+		if ex.Processes < 0 || ex.Timeout < 0 {
+			return fmt.Errorf("filters.exec[%d] ('%s'): processes and timeout must not be negative", i, ex.Name)
+		}
+	}
+
+	// [filters.whitelist]
+	if wl := c.Filters.Whitelist; wl.Enabled {
+		if len(wl.PubKeys) == 0 && wl.File == "" && wl.List == "" {
+			return errors.New("filters.whitelist needs pubkeys, file or list")
+		}
+		if wl.List != "" && (wl.RefreshInterval <= 0 || wl.Timeout <= 0) {
+			return errors.New("filters.whitelist: refresh_interval and timeout must be positive durations")
+		}
+		for _, relay := range wl.Relays {
+			if !nostr.IsValidRelayURL(relay) {
+				return fmt.Errorf("filters.whitelist.relays: invalid relay URL %q", relay)
+			}
+		}
+	}
+
+	// [filters.ip_reputation]
+	if ir := c.Filters.IPReputation; ir.Enabled {
+		if len(ir.Lists) == 0 {
+			return errors.New("filters.ip_reputation.lists must not be empty when enabled")
+		}
+		names := make(map[string]struct{}, len(ir.Lists))
+		for i, list := range ir.Lists {
+			if list.Name == "" {
+				return fmt.Errorf("filters.ip_reputation.lists[%d].name must not be empty", i)
+			}
+			if _, dup := names[list.Name]; dup {
+				return fmt.Errorf("filters.ip_reputation.lists[%d]: duplicate name %q", i, list.Name)
+			}
+			names[list.Name] = struct{}{}
+			if len(list.Sources) == 0 || slices.Contains(list.Sources, "") {
+				return fmt.Errorf("filters.ip_reputation.lists[%d].sources must not be empty", i)
+			}
+			switch list.Action {
+			case IPReputationReject:
+			case IPReputationRateLimit:
+				if list.Rate <= 0 || list.Burst < 1 {
+					return fmt.Errorf("filters.ip_reputation.lists[%d]: rate_limit requires a positive rate and a burst of at least 1", i)
+				}
+			case IPReputationPoW:
+				if list.PoWDifficulty < 1 || list.PoWDifficulty > 256 {
+					return fmt.Errorf("filters.ip_reputation.lists[%d].pow_difficulty must be between 1 and 256", i)
+				}
+			default:
+				return fmt.Errorf("filters.ip_reputation.lists[%d].action must be %q, %q or %q", i, IPReputationReject, IPReputationRateLimit, IPReputationPoW)
+			}
+		}
+		if ir.RefreshInterval <= 0 || ir.Timeout <= 0 {
+			return errors.New("filters.ip_reputation: refresh_interval and timeout must be positive durations")
+		}
+		if ir.CacheSize <= 0 {
+			return errors.New("filters.ip_reputation.cache_size must be positive")
+		}
+	}
+
+	// [filters.dnsbl]
+	if db := c.Filters.DNSBL; db.Enabled {
+		if len(db.Zones) == 0 {
+			return errors.New("filters.dnsbl.zones must not be empty when enabled")
+		}
+		for i, zone := range db.Zones {
+			if zone == "" || strings.HasPrefix(zone, ".") {
+				return fmt.Errorf("filters.dnsbl.zones[%d]: invalid zone %q", i, zone)
+			}
+		}
+		if db.Resolver != "" {
+			if _, _, err := net.SplitHostPort(db.Resolver); err != nil {
+				return fmt.Errorf("filters.dnsbl.resolver must be host:port: %w", err)
+			}
+		}
+		if db.Timeout <= 0 || db.CacheTTL <= 0 {
+			return errors.New("filters.dnsbl: timeout and cache_ttl must be positive durations")
+		}
+		if db.CacheSize <= 0 {
+			return errors.New("filters.dnsbl.cache_size must be positive")
+		}
+		if db.Action == kitconfig.ActionStrike && !c.Filters.AutoBan.Enabled {
+			slog.Warn("filters.dnsbl.action is 'strike' but autoban is disabled; strikes will have no effect")
+		}
+	}
+
+	// [filters.compromised_keys]
+	if ck := c.Filters.CompromisedKeys; ck.Enabled {
+		if len(ck.Sources) == 0 {
+			return errors.New("filters.compromised_keys.sources must not be empty when enabled")
+		}
+		for i, src := range ck.Sources {
+			if src == "" {
+				return fmt.Errorf("filters.compromised_keys.sources[%d] is empty", i)
+			}
+		}
+		if ck.RefreshInterval <= 0 || ck.Timeout <= 0 {
+			return errors.New("filters.compromised_keys: refresh_interval and timeout must be positive durations")
+		}
+	}
+
+	// [filters.origin]
+	og := c.Filters.Origin
+	if og.Enabled {
+		if og.SampleRate <= 0 || og.SampleRate > 1 {
+			return errors.New("filters.origin.sample_rate must be in (0.0, 1.0]")
+		}
+		if og.Timeout <= 0 || og.FailureTTL <= 0 || og.FlagDuration <= 0 {
+			return errors.New("filters.origin: timeout, failure_window and flag_duration must be positive durations")
+		}
+		if og.QueueSize <= 0 || og.MaxFailures <= 0 {
+			return errors.New("filters.origin: queue_size and max_failures must be > 0")
+		}
+	}
+
 	// [filters.autoban]
 	ab := c.Filters.AutoBan
 	if ab.Enabled {
@@ -376,11 +2449,64 @@ func (c *Config) validate() error {
 		if ab.BanTimeout < 0 {
 			return errors.New("filters.autoban.ban_timeout must not be negative")
 		}
+		if ab.BanIP && !c.Filters.BannedIP.Enabled {
+			return errors.New("filters.autoban.ban_ip requires filters.banned_ip to be enabled")
+		}
+		for i, tier := range ab.AgeTiers {
+			if tier.MinAge <= 0 {
+				return fmt.Errorf("filters.autoban.age_tier[%d]: min_age must be a positive duration", i)
+			}
+			if tier.MaxStrikes <= 0 {
+				return fmt.Errorf("filters.autoban.age_tier[%d]: max_strikes must be > 0", i)
+			}
+			if i > 0 && tier.MinAge <= ab.AgeTiers[i-1].MinAge {
+				return fmt.Errorf("filters.autoban.age_tier[%d]: tiers must be sorted by increasing min_age", i)
+			}
+		}
 	}
 
 	return nil
 }
 
+func (c *Config) validateExperiment() error {
+	e := &c.Experiment
+	if e.Name == "" {
+		return errors.New("experiment.name must be set when enabled")
+	}
+	if e.RetentionWindow <= 0 {
+		return errors.New("experiment.retention_window must be positive")
+	}
+	if len(e.Cohorts) < 2 {
+		return errors.New("experiment must have at least two cohorts")
+	}
+	// Each cohort's settings must apply to this config, with the experiment
+	// itself left alone.
+	base := *c
+	base.Experiment.Enabled = false
+	names := make(map[string]bool, len(e.Cohorts))
+	for i, cohort := range e.Cohorts {
+		if cohort.Name == "" {
+			return fmt.Errorf("experiment.cohort[%d]: name must be set", i)
+		}
+		if names[cohort.Name] {
+			return fmt.Errorf("experiment.cohort[%d]: duplicate name %q", i, cohort.Name)
+		}
+		names[cohort.Name] = true
+		if cohort.Weight <= 0 {
+			return fmt.Errorf("experiment.cohort %q: weight must be positive", cohort.Name)
+		}
+		for key := range cohort.Settings {
+			if strings.HasPrefix(key, "experiment.") || strings.HasPrefix(key, "canary.") {
+				return fmt.Errorf("experiment.cohort %q: setting %q cannot be overridden", cohort.Name, key)
+			}
+		}
+		if _, err := base.withFlags(cohort.Settings); err != nil {
+			return fmt.Errorf("experiment.cohort %q: %w", cohort.Name, err)
+		}
+	}
+	return nil
+}
+
 func Load(path string, useDefaults bool) (*Config, bool, error) {
 	cfg := defaultConfig()
 	defaultsUsed := false
@@ -389,18 +2515,37 @@ func Load(path string, useDefaults bool) (*Config, bool, error) {
 		if errors.Is(err, fs.ErrNotExist) {
 			if useDefaults {
 				defaultsUsed = true
-				if err := cfg.validate(); err != nil {
+				if err := cfg.check(); err != nil {
 					return nil, true, err
 				}
 				return cfg, defaultsUsed, nil
 			}
 			return nil, false, fmt.Errorf("config file not found at %s", path)
 		}
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) {
+			err = fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+		}
 		return nil, false, fmt.Errorf("failed to load config file %s: %w", path, err)
 	}
 
-	if err := cfg.validate(); err != nil {
+	if err := cfg.applyRulePacks(); err != nil {
+		return nil, false, err
+	}
+
+	if err := cfg.check(); err != nil {
 		return nil, false, err
 	}
 	return cfg, defaultsUsed, nil
 }
+
+// check normalizes and validates c; its errors wrap ErrConfigInvalid.
+func (c *Config) check() error {
+	if err := c.normalize(); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// maxFlagsSize bounds how much of a flag service response is read.
+const maxFlagsSize = 1 << 20
+
+// FlagsConfig connects the plugin to a remote flag service, letting a fleet
+// adjust selected settings centrally. The service answers GET requests with
+// a JSON object mapping dotted config keys, such as
+// "filters.emergency.enabled", to values; it is polled with If-None-Match so
+// an unchanged object costs a 304. Flags override the config file and are
+// applied like a config reload. Read once at startup, not on reload.
+type FlagsConfig struct {
+	URL string `toml:"url"` // Empty disables remote flags.
+	// Token, if set, is sent as a bearer token.
+	Token        string        `toml:"token"`
+	PollInterval time.Duration `toml:"poll_interval"`
+	Timeout      time.Duration `toml:"timeout"`
+	// Keys are the config keys the service may override, as dotted paths in
+	// which "*" matches one segment, e.g. "filters.emergency.*". Other keys
+	// are ignored.
+	Keys []string `toml:"keys"`
+	// CachePath keeps the last flags received, applied at startup while the
+	// service is unreachable.
+	CachePath string `toml:"cache_path"`
+}
+
+// Flags are remote overrides of config keys.
+type Flags map[string]any
+
+// allowed reports whether key matches one of the configured patterns.
+func (c *FlagsConfig) allowed(key string) bool {
+	for _, pattern := range c.Keys {
+		// path.Match treats "/" as the separator "*" does not cross.
+		if ok, _ := path.Match(strings.ReplaceAll(pattern, ".", "/"), strings.ReplaceAll(key, ".", "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WithFlags returns a copy of c with flags applied. Every key must name a
+// scalar setting (a toggle, number, string or duration) reached through
+// nested sections only, so the copy shares nothing that flags modify.
+func (c *Config) WithFlags(flags Flags) (*Config, error) {
+	cp, err := c.withFlags(flags)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
+	}
+	return cp, nil
+}
+
+func (c *Config) withFlags(flags Flags) (*Config, error) {
+	doc := make(map[string]any)
+	for key, value := range flags {
+		if err := checkFlagKey(key); err != nil {
+			return nil, fmt.Errorf("flag %q: %w", key, err)
+		}
+		if n, ok := value.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				value = i
+			} else if f, err := n.Float64(); err == nil {
+				value = f
+			}
+		}
+		switch value.(type) {
+		case bool, int64, float64, string:
+		default:
+			return nil, fmt.Errorf("flag %q: value must be a boolean, number or string", key)
+		}
+
+		segments := strings.Split(key, ".")
+		table := doc
+		for _, seg := range segments[:len(segments)-1] {
+			next, ok := table[seg].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				table[seg] = next
+			}
+			table = next
+		}
+		table[segments[len(segments)-1]] = value
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+		return nil, err
+	}
+	cp := *c
+	if _, err := toml.Decode(buf.String(), &cp); err != nil {
+		return nil, fmt.Errorf("invalid flag value: %w", err)
+	}
+	if err := cp.validate(); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// checkFlagKey checks that key names a scalar field of Config through struct
+// fields only.
+func checkFlagKey(key string) error {
+	t := reflect.TypeFor[Config]()
+	for seg := range strings.SplitSeq(key, ".") {
+		if t.Kind() != reflect.Struct {
+			return errors.New("not a scalar setting")
+		}
+		field, ok := fieldByTOMLName(t, seg)
+		if !ok {
+			return errors.New("unknown key")
+		}
+		t = field.Type
+	}
+	// Durations are int64s, enumerations strings.
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Float64:
+		return nil
+	}
+	return errors.New("not a scalar setting")
+}
+
+func fieldByTOMLName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if tag, _, _ := strings.Cut(field.Tag.Get("toml"), ","); tag == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// FlagPoller fetches flags from the flag service.
+type FlagPoller struct {
+	cfg    *FlagsConfig
+	client *http.Client
+
+	mu    sync.RWMutex
+	flags Flags
+	etag  string
+}
+
+// NewFlagPoller creates a poller starting from the cached flags, if any.
+func NewFlagPoller(cfg *FlagsConfig) *FlagPoller {
+	p := &FlagPoller{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+	if cfg.CachePath != "" {
+		if data, err := os.ReadFile(cfg.CachePath); err == nil {
+			if flags, err := p.parse(data); err == nil {
+				p.flags = flags
+				slog.Info("Loaded cached remote flags", "path", cfg.CachePath, "flags", len(flags))
+			} else {
+				slog.Warn("Ignoring invalid cached remote flags", "path", cfg.CachePath, "error", err)
+			}
+		}
+	}
+	return p
+}
+
+// Flags returns the current flags.
+func (p *FlagPoller) Flags() Flags {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return maps.Clone(p.flags)
+}
+
+// Apply returns cfg with the current flags applied, or cfg itself along with
+// the error if they do not apply to it.
+func (p *FlagPoller) Apply(cfg *Config) (*Config, error) {
+	flags := p.Flags()
+	if len(flags) == 0 {
+		return cfg, nil
+	}
+	flagged, err := cfg.WithFlags(flags)
+	if err != nil {
+		return cfg, err
+	}
+	return flagged, nil
+}
+
+// Poll fetches the flags once and reports whether they changed.
+func (p *FlagPoller) Poll(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	}
+	p.mu.RLock()
+	if p.etag != "" {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	p.mu.RUnlock()
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("%s returned %s", p.cfg.URL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFlagsSize))
+	if err != nil {
+		return false, err
+	}
+	flags, err := p.parse(data)
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	p.etag = resp.Header.Get("ETag")
+	changed := !reflect.DeepEqual(flags, p.flags)
+	p.flags = flags
+	p.mu.Unlock()
+	if changed && p.cfg.CachePath != "" {
+		if err := writeFlagsCache(p.cfg.CachePath, data); err != nil {
+			slog.Warn("Failed to cache remote flags", "path", p.cfg.CachePath, "error", err)
+		}
+	}
+	return changed, nil
+}
+
+// parse decodes a flags object, dropping keys that may not be overridden.
+func (p *FlagPoller) parse(data []byte) (Flags, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var flags Flags
+	if err := decoder.Decode(&flags); err != nil {
+		return nil, fmt.Errorf("invalid flags: %w", err)
+	}
+	for key := range flags {
+		if !p.cfg.allowed(key) {
+			slog.Warn("Ignoring remote flag not allowed by flags.keys", "key", key)
+			delete(flags, key)
+		}
+	}
+	return flags, nil
+}
+
+func writeFlagsCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Run polls every poll interval until ctx is done, calling onChange after
+// the flags changed. A failed poll keeps the current flags.
+func (p *FlagPoller) Run(ctx context.Context, onChange func(Flags)) {
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := p.Poll(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("Failed to poll remote flags, keeping the current ones", "url", p.cfg.URL, "error", err)
+			}
+			continue
+		}
+		if changed {
+			onChange(p.Flags())
+		}
+	}
+}
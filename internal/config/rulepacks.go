@@ -0,0 +1,334 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	kitconfig "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+)
+
+const (
+	// maxRulePackSize bounds how much of a pack (or signature) is read.
+	maxRulePackSize = 4 << 20
+	rulePackTimeout = 15 * time.Second
+)
+
+type RulePacksConfig struct {
+	// CacheDir keeps the last verified copy of every URL pack, used when its
+	// source is unreachable.
+	CacheDir      string           `toml:"cache_dir"`
+	CheckInterval time.Duration    `toml:"check_interval"`
+	Packs         []RulePackConfig `toml:"pack"`
+
+	// Loaded describes the packs merged into this configuration.
+	Loaded []RulePackInfo `toml:"-"`
+}
+
+type RulePackConfig struct {
+	// Source is a file path or an http(s) URL.
+	Source string `toml:"source"`
+	// Version and SHA256 pin the pack; a pack that does not match is refused.
+	Version string `toml:"version"`
+	SHA256  string `toml:"sha256"`
+	// PubKey, if set, requires a valid signature by this key in <source>.sig.
+	PubKey string `toml:"pubkey"`
+}
+
+// RulePackInfo identifies a loaded pack.
+type RulePackInfo struct {
+	Source      string `json:"source"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+	SHA256      string `json:"sha256"`
+	Signed      bool   `json:"signed"`
+	Cached      bool   `json:"cached,omitempty"`
+}
+
+// RulePack is a shareable bundle of anti-spam rules. Its sections use the
+// same schema as the corresponding [filters.*] sections of the config.
+type RulePack struct {
+	Pack struct {
+		Name        string `toml:"name"`
+		Version     string `toml:"version"`
+		Description string `toml:"description"`
+	} `toml:"pack"`
+	Policy struct {
+		DeniedKinds []int `toml:"denied_kinds"`
+	} `toml:"policy"`
+	Keywords struct {
+		Rules []kitconfig.KeywordRule `toml:"rule"`
+	} `toml:"keywords"`
+	RateLimiter struct {
+		Rules []kitconfig.RateLimitRule `toml:"rule"`
+	} `toml:"rate_limiter"`
+}
+
+// ParseRulePack decodes a pack and checks its header.
+func ParseRulePack(data []byte) (*RulePack, error) {
+	var pack RulePack
+	md, err := toml.Decode(string(data), &pack)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unsupported key %q", undecoded[0].String())
+	}
+	if pack.Pack.Name == "" || pack.Pack.Version == "" {
+		return nil, errors.New("[pack] name and version are required")
+	}
+	return &pack, nil
+}
+
+// RulePackDigest returns the hex SHA-256 of a pack, which is both its pin
+// and the message its signature covers.
+func RulePackDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyRulePackSignature checks a hex BIP-340 signature, as used by Nostr
+// events, of the pack digest by pubkey.
+func VerifyRulePackSignature(data []byte, sigHex, pubkey string) error {
+	pkBytes, err := hex.DecodeString(pubkey)
+	if err != nil {
+		return fmt.Errorf("invalid pubkey: %w", err)
+	}
+	pk, err := schnorr.ParsePubKey(pkBytes)
+	if err != nil {
+		return fmt.Errorf("invalid pubkey: %w", err)
+	}
+	sigBytes, err := hex.DecodeString(strings.TrimSpace(sigHex))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	if !sig.Verify(sum[:], pk) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+func isURLSource(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// readSource reads a pack or signature from a file or URL.
+func readSource(ctx context.Context, source string) ([]byte, error) {
+	if !isURLSource(source) {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(io.LimitReader(f, maxRulePackSize))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rulePackTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRulePackSize))
+}
+
+// fetchRulePack reads a pack and its signature, if one is required, and
+// verifies both against the pins.
+func fetchRulePack(ctx context.Context, pc *RulePackConfig) (*RulePack, RulePackInfo, []byte, string, error) {
+	info := RulePackInfo{Source: pc.Source}
+	data, err := readSource(ctx, pc.Source)
+	if err != nil {
+		return nil, info, nil, "", err
+	}
+	var sig string
+	if pc.PubKey != "" {
+		raw, err := readSource(ctx, pc.Source+".sig")
+		if err != nil {
+			return nil, info, nil, "", fmt.Errorf("failed to read signature: %w", err)
+		}
+		sig = string(raw)
+	}
+	pack, info, err := verifyRulePack(pc, data, sig)
+	return pack, info, data, sig, err
+}
+
+func verifyRulePack(pc *RulePackConfig, data []byte, sig string) (*RulePack, RulePackInfo, error) {
+	info := RulePackInfo{Source: pc.Source, SHA256: RulePackDigest(data)}
+	if pc.SHA256 != "" && !strings.EqualFold(pc.SHA256, info.SHA256) {
+		return nil, info, fmt.Errorf("sha256 %s does not match the pinned %s", info.SHA256, pc.SHA256)
+	}
+	if pc.PubKey != "" {
+		if err := VerifyRulePackSignature(data, sig, pc.PubKey); err != nil {
+			return nil, info, err
+		}
+		info.Signed = true
+	}
+	pack, err := ParseRulePack(data)
+	if err != nil {
+		return nil, info, err
+	}
+	info.Name, info.Version, info.Description = pack.Pack.Name, pack.Pack.Version, pack.Pack.Description
+	if pc.Version != "" && pc.Version != info.Version {
+		return nil, info, fmt.Errorf("version %s does not match the pinned %s", info.Version, pc.Version)
+	}
+	return pack, info, nil
+}
+
+// cachePath returns where the last verified copy of a URL pack is kept.
+func (c *RulePacksConfig) cachePath(source string) string {
+	return filepath.Join(c.CacheDir, RulePackDigest([]byte(source))[:16]+".toml")
+}
+
+// loadRulePack fetches a pack, falling back to the cached copy of a URL pack
+// when its source is unreachable or no longer matches the pins.
+func (c *RulePacksConfig) loadRulePack(pc *RulePackConfig) (*RulePack, RulePackInfo, error) {
+	pack, info, data, sig, err := fetchRulePack(context.Background(), pc)
+	if !isURLSource(pc.Source) || c.CacheDir == "" {
+		return pack, info, err
+	}
+
+	path := c.cachePath(pc.Source)
+	if err == nil {
+		if err := writeCache(path, data, sig); err != nil {
+			slog.Warn("Failed to cache rule pack", "source", pc.Source, "path", path, "error", err)
+		}
+		return pack, info, nil
+	}
+
+	cached, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, info, err
+	}
+	cachedSig, _ := os.ReadFile(path + ".sig")
+	pack, cachedInfo, cacheErr := verifyRulePack(pc, cached, string(cachedSig))
+	if cacheErr != nil {
+		return nil, info, err
+	}
+	slog.Warn("Using cached rule pack", "source", pc.Source, "version", cachedInfo.Version, "error", err)
+	cachedInfo.Cached = true
+	return pack, cachedInfo, nil
+}
+
+func writeCache(path string, data []byte, sig string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if sig != "" {
+		if err := os.WriteFile(path+".sig", []byte(sig), 0o644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// applyRulePacks loads the configured packs and merges their rules into the
+// config. Local settings take precedence: pack rate rules come before local
+// ones (later rules win for a kind), and kinds the config explicitly allows
+// are never denied by a pack.
+func (c *Config) applyRulePacks() error {
+	rp := &c.RulePacks
+	for i := range rp.Packs {
+		pc := &rp.Packs[i]
+		if pc.Source == "" {
+			return fmt.Errorf("rule_packs.pack[%d]: source is required", i)
+		}
+		if pc.PubKey != "" {
+			pk, err := nip.NormalizePubKey(pc.PubKey)
+			if err != nil {
+				return fmt.Errorf("rule_packs.pack[%d].pubkey: %w", i, err)
+			}
+			pc.PubKey = pk
+		}
+
+		pack, info, err := rp.loadRulePack(pc)
+		if err != nil {
+			return fmt.Errorf("rule pack %s: %w", pc.Source, err)
+		}
+		rp.Loaded = append(rp.Loaded, info)
+		slog.Info("Loaded rule pack", "name", info.Name, "version", info.Version, "source", info.Source,
+			"sha256", info.SHA256, "signed", info.Signed, "cached", info.Cached)
+
+		tag := fmt.Sprintf("[%s %s] ", info.Name, info.Version)
+		for _, rule := range pack.Keywords.Rules {
+			rule.Description = tag + rule.Description
+			c.Filters.Keywords.Rules = append(c.Filters.Keywords.Rules, rule)
+		}
+		rateRules := make([]kitconfig.RateLimitRule, 0, len(pack.RateLimiter.Rules))
+		for _, rule := range pack.RateLimiter.Rules {
+			rule.Description = tag + rule.Description
+			rateRules = append(rateRules, rule)
+		}
+		c.Filters.RateLimiter.Rules = append(rateRules, c.Filters.RateLimiter.Rules...)
+		for _, kind := range pack.Policy.DeniedKinds {
+			if !slices.Contains(c.Filters.Kind.AllowedKinds, kind) && !slices.Contains(c.Filters.Kind.DeniedKinds, kind) {
+				c.Filters.Kind.DeniedKinds = append(c.Filters.Kind.DeniedKinds, kind)
+			}
+		}
+	}
+	return nil
+}
+
+// StartRulePackChecker periodically re-fetches URL packs and logs when a
+// different version than the loaded one is published. It never applies
+// updates itself: unpinned packs pick them up on the next config reload,
+// pinned packs once their pin is changed.
+func StartRulePackChecker(ctx context.Context, cfg *RulePacksConfig) {
+	if cfg.CheckInterval <= 0 || len(cfg.Loaded) == 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for i, pc := range cfg.Packs {
+			if !isURLSource(pc.Source) {
+				continue
+			}
+			// Check the latest published pack, not the pinned one.
+			latest := RulePackConfig{Source: pc.Source, PubKey: pc.PubKey}
+			_, info, _, _, err := fetchRulePack(ctx, &latest)
+			if err != nil {
+				slog.Warn("Rule pack update check failed", "source", pc.Source, "error", err)
+				continue
+			}
+			current := cfg.Loaded[i]
+			if info.SHA256 == current.SHA256 {
+				continue
+			}
+			pinned := pc.Version != "" || pc.SHA256 != ""
+			slog.Info("Rule pack update available", "name", info.Name, "source", pc.Source,
+				"current_version", current.Version, "new_version", info.Version, "new_sha256", info.SHA256, "pinned", pinned)
+		}
+	}
+}
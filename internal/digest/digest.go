@@ -0,0 +1,279 @@
+// Package digest clusters recent content by similarity and reports the
+// largest clusters, so moderators can write targeted rules for templated spam
+// instead of chasing individual keywords.
+package digest
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+)
+
+const sampleChars = 280
+
+// item is one observed event, reduced to what clustering needs.
+type item struct {
+	hash   uint64
+	pubkey string
+	time   time.Time
+	sample string
+}
+
+// Cluster is a group of near-identical texts.
+type Cluster struct {
+	Events  int       `json:"events"`
+	Authors int       `json:"authors"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Sample  string    `json:"sample"`
+}
+
+// Report is one digest of the largest clusters.
+type Report struct {
+	Generated time.Time     `json:"generated"`
+	Window    time.Duration `json:"window_ns"`
+	Scope     string        `json:"scope"`
+	Items     int           `json:"items"`
+	Clusters  []Cluster     `json:"clusters"`
+}
+
+// Digest collects content from pipeline decisions and periodically reports
+// its largest similarity clusters.
+type Digest struct {
+	cfg   *config.DigestConfig
+	kinds map[int]struct{}
+
+	mu    sync.Mutex
+	items []item // Ring buffer of the most recent cfg.MaxItems items.
+	next  int
+	full  bool
+}
+
+func New(cfg *config.DigestConfig) *Digest {
+	kinds := make(map[int]struct{}, len(cfg.Kinds))
+	for _, k := range cfg.Kinds {
+		kinds[k] = struct{}{}
+	}
+	return &Digest{cfg: cfg, kinds: kinds, items: make([]item, cfg.MaxItems)}
+}
+
+// ObserveDecision implements policy.DecisionObserver.
+func (d *Digest) ObserveDecision(dec policy.Decision) {
+	if dec.Lookback || dec.Event == nil {
+		return
+	}
+	switch d.cfg.Scope {
+	case config.DigestRejected:
+		// Shadow-banned events count as rejected: they do not stay.
+		if dec.Action == "accept" {
+			return
+		}
+	case config.DigestAccepted:
+		if dec.Action != "accept" {
+			return
+		}
+	}
+	if len(d.kinds) > 0 {
+		if _, ok := d.kinds[dec.Kind]; !ok {
+			return
+		}
+	}
+	content := dec.Event.Content
+	if utf8.RuneCountInString(content) < d.cfg.MinChars {
+		return
+	}
+
+	it := item{hash: kitpolicy.SimHash(content), pubkey: dec.PubKey, time: dec.Time, sample: truncate(content, sampleChars)}
+	d.mu.Lock()
+	d.items[d.next] = it
+	d.next = (d.next + 1) % len(d.items)
+	if d.next == 0 {
+		d.full = true
+	}
+	d.mu.Unlock()
+}
+
+// Run reports the digest; it is scheduled every interval.
+func (d *Digest) Run(context.Context) error {
+	d.publish(d.Report())
+	return nil
+}
+
+// Report clusters the items of the last window.
+func (d *Digest) Report() Report {
+	now := time.Now()
+	cutoff := now.Add(-d.cfg.Window)
+
+	d.mu.Lock()
+	n := d.next
+	if d.full {
+		n = len(d.items)
+	}
+	items := make([]item, 0, n)
+	for _, it := range d.items[:n] {
+		if it.time.After(cutoff) {
+			items = append(items, it)
+		}
+	}
+	d.mu.Unlock()
+
+	return Report{
+		Generated: now,
+		Window:    d.cfg.Window,
+		Scope:     string(d.cfg.Scope),
+		Items:     len(items),
+		Clusters:  cluster(items, d.cfg.MaxDistance, d.cfg.MinClusterSize, d.cfg.Top),
+	}
+}
+
+// cluster groups items whose hashes differ in at most maxDistance bits. The
+// hash is split into maxDistance+1 bands; by the pigeonhole principle two
+// such items share at least one band, so only items sharing a band are
+// compared.
+func cluster(items []item, maxDistance, minSize, top int) []Cluster {
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	// Identical hashes are merged up front, so templates posted thousands of
+	// times do not make band buckets quadratic.
+	first := make(map[uint64]int)
+	var reps []int
+	for i, it := range items {
+		if j, ok := first[it.hash]; ok {
+			parent[find(i)] = find(j)
+			continue
+		}
+		first[it.hash] = i
+		reps = append(reps, i)
+	}
+
+	bands := maxDistance + 1
+	width := 64 / bands
+	mask := uint64(1)<<width - 1
+	for b := range bands {
+		shift := b * width
+		buckets := make(map[uint64][]int)
+		for _, i := range reps {
+			key := (items[i].hash >> shift) & mask
+			for _, j := range buckets[key] {
+				if find(i) != find(j) && bits.OnesCount64(items[i].hash^items[j].hash) <= maxDistance {
+					parent[find(i)] = find(j)
+				}
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i := range items {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+
+	var clusters []Cluster
+	for _, members := range groups {
+		if len(members) < minSize {
+			continue
+		}
+		c := Cluster{Events: len(members), First: items[members[0]].time, Last: items[members[0]].time}
+		authors := make(map[string]struct{})
+		for _, m := range members {
+			it := items[m]
+			authors[it.pubkey] = struct{}{}
+			if it.time.Before(c.First) {
+				c.First = it.time
+			}
+			if it.time.After(c.Last) {
+				c.Last = it.time
+				c.Sample = it.sample
+			}
+		}
+		if c.Sample == "" {
+			c.Sample = items[members[0]].sample
+		}
+		c.Authors = len(authors)
+		clusters = append(clusters, c)
+	}
+	slices.SortFunc(clusters, func(a, b Cluster) int {
+		return cmp.Or(cmp.Compare(b.Authors, a.Authors), cmp.Compare(b.Events, a.Events), a.First.Compare(b.First))
+	})
+	if len(clusters) > top {
+		clusters = clusters[:top]
+	}
+	return clusters
+}
+
+// publish logs the report and, if configured, writes it to the digest file.
+func (d *Digest) publish(r Report) {
+	slog.Info("Content cluster digest", "items", r.Items, "clusters", len(r.Clusters), "scope", r.Scope)
+	for i, c := range r.Clusters {
+		slog.Info("Content cluster",
+			"rank", i+1, "authors", c.Authors, "events", c.Events, "first", c.First, "last", c.Last, "sample", c.Sample)
+	}
+	if d.cfg.Path == "" {
+		return
+	}
+	if err := os.WriteFile(d.cfg.Path, []byte(r.Text()), 0o644); err != nil {
+		slog.Error("Failed to write content cluster digest", "path", d.cfg.Path, "error", err)
+	}
+}
+
+// Text renders the report for humans.
+func (r Report) Text() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Content cluster digest, %s (%s content of the last %s, %d events)\n",
+		r.Generated.Format(time.RFC3339), r.Scope, r.Window, r.Items)
+	if len(r.Clusters) == 0 {
+		sb.WriteString("\nNo clusters.\n")
+	}
+	for i, c := range r.Clusters {
+		fmt.Fprintf(&sb, "\n#%d: this template was posted by %d pubkeys (%d events, %s to %s)\n",
+			i+1, c.Authors, c.Events, c.First.Format(time.RFC3339), c.Last.Format(time.RFC3339))
+		fmt.Fprintf(&sb, "    %s\n", strings.ReplaceAll(c.Sample, "\n", "\n    "))
+	}
+	return sb.String()
+}
+
+// ServeHTTP returns a fresh report, as text or, with ?format=json, as JSON.
+func (d *Digest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := d.Report()
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, report.Text())
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n]) + "…"
+}
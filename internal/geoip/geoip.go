@@ -0,0 +1,121 @@
+// Package geoip resolves source IPs to countries and operator-defined
+// regions, so filters can apply policies by origin.
+package geoip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// ipRange maps the addresses from start to end to a country.
+type ipRange struct {
+	start, end netip.Addr
+	country    string
+}
+
+// Locator finds the country of an address in a range database, and the
+// regions that country belongs to.
+type Locator struct {
+	ranges []ipRange // Sorted by start, not overlapping.
+	// regions lists the regions of each country, sorted.
+	regions map[string][]string
+}
+
+// Open loads the country database configured in cfg. It returns nil,
+// meaning no GeoIP, if none is.
+func Open(cfg *config.GeoIPConfig) (*Locator, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database: %w", err)
+	}
+	defer file.Close()
+	ranges, err := parseRanges(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read geoip database %s: %w", cfg.Path, err)
+	}
+
+	regions := make(map[string][]string)
+	for region, countries := range cfg.Regions {
+		for _, country := range countries {
+			country = strings.ToUpper(country)
+			regions[country] = append(regions[country], strings.ToLower(region))
+		}
+	}
+	for _, r := range regions {
+		slices.Sort(r)
+	}
+	return &Locator{ranges: ranges, regions: regions}, nil
+}
+
+// parseRanges reads "start,end,country" lines, the layout of the free
+// DB-IP and IP2Location country databases in CSV form. Quotes around fields
+// are ignored, as are lines that do not parse, such as headers; ranges
+// without a country ("-" or "ZZ") are dropped.
+func parseRanges(r io.Reader) ([]ipRange, error) {
+	var ranges []ipRange
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := bytes.Split(scanner.Bytes(), []byte(","))
+		if len(fields) < 3 {
+			continue
+		}
+		start, err1 := netip.ParseAddr(unquote(fields[0]))
+		end, err2 := netip.ParseAddr(unquote(fields[1]))
+		country := strings.ToUpper(unquote(fields[2]))
+		if err1 != nil || err2 != nil || start.Is4() != end.Is4() || end.Less(start) {
+			continue
+		}
+		if len(country) != 2 || country == "ZZ" {
+			continue
+		}
+		ranges = append(ranges, ipRange{start: start, end: end, country: country})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 {
+		return nil, errors.New("no address ranges found")
+	}
+	slices.SortFunc(ranges, func(a, b ipRange) int { return a.start.Compare(b.start) })
+	return ranges, nil
+}
+
+func unquote(field []byte) string {
+	return strings.Trim(strings.TrimSpace(string(field)), `"`)
+}
+
+// Country returns the ISO 3166 code of the country of ip, or "" if it is
+// unknown.
+func (l *Locator) Country(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	// The last range starting at or before addr.
+	i, found := slices.BinarySearchFunc(l.ranges, addr, func(r ipRange, a netip.Addr) int { return r.start.Compare(a) })
+	if !found {
+		i--
+	}
+	if i < 0 || l.ranges[i].end.Less(addr) {
+		return ""
+	}
+	return l.ranges[i].country
+}
+
+// Regions returns the configured regions country belongs to.
+func (l *Locator) Regions(country string) []string {
+	return l.regions[country]
+}
@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+)
+
+// cardinalityHours is how many hourly sketches are kept per dimension.
+const cardinalityHours = 24
+
+// hourlySketches is a ring of per-hour HyperLogLog sketches.
+type hourlySketches struct {
+	hours    [cardinalityHours]int64 // Unix hour of each slot.
+	sketches [cardinalityHours]*hyperLogLog
+}
+
+func (hs *hourlySketches) add(now time.Time, s string) {
+	hour := now.Unix() / 3600
+	i := hour % cardinalityHours
+	if hs.sketches[i] == nil {
+		hs.sketches[i] = newHyperLogLog()
+	} else if hs.hours[i] != hour {
+		hs.sketches[i].reset()
+	}
+	hs.hours[i] = hour
+	hs.sketches[i].add(s)
+}
+
+// estimate returns the distinct count over the hours [now-back, now], where
+// back is given in whole hours before the current one.
+func (hs *hourlySketches) estimate(now time.Time, back int) uint64 {
+	current := now.Unix() / 3600
+	union := newHyperLogLog()
+	for i, sk := range hs.sketches {
+		if sk != nil && hs.hours[i] <= current && hs.hours[i] >= current-int64(back) {
+			union.merge(sk)
+		}
+	}
+	return union.estimate()
+}
+
+// single returns the distinct count of one hour, hoursAgo before the current.
+func (hs *hourlySketches) single(now time.Time, hoursAgo int) uint64 {
+	hour := now.Unix()/3600 - int64(hoursAgo)
+	i := hour % cardinalityHours
+	if hs.sketches[i] == nil || hs.hours[i] != hour {
+		return 0
+	}
+	return hs.sketches[i].estimate()
+}
+
+// Cardinality estimates the number of unique posting pubkeys and client IP
+// prefixes (/24 for IPv4, /48 for IPv6) per hour, in constant memory
+// regardless of relay size.
+type Cardinality struct {
+	mu         sync.Mutex
+	authors    hourlySketches
+	ipPrefixes hourlySketches
+}
+
+func NewCardinality() *Cardinality {
+	return &Cardinality{}
+}
+
+// ObserveDecision implements policy.DecisionObserver.
+func (c *Cardinality) ObserveDecision(d policy.Decision) {
+	if d.Lookback {
+		return
+	}
+	prefix := IPPrefix(d.RemoteIP)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authors.add(d.Time, d.PubKey)
+	if prefix != "" {
+		c.ipPrefixes.add(d.Time, prefix)
+	}
+}
+
+// CardinalityEstimates are the current unique counts.
+type CardinalityEstimates struct {
+	AuthorsThisHour    uint64
+	AuthorsLastHour    uint64
+	AuthorsDay         uint64
+	IPPrefixesThisHour uint64
+	IPPrefixesLastHour uint64
+	IPPrefixesDay      uint64
+}
+
+// Estimates returns the unique counts for the current hour, the previous
+// hour and the last 24 hours.
+func (c *Cardinality) Estimates() CardinalityEstimates {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CardinalityEstimates{
+		AuthorsThisHour:    c.authors.single(now, 0),
+		AuthorsLastHour:    c.authors.single(now, 1),
+		AuthorsDay:         c.authors.estimate(now, cardinalityHours-1),
+		IPPrefixesThisHour: c.ipPrefixes.single(now, 0),
+		IPPrefixesLastHour: c.ipPrefixes.single(now, 1),
+		IPPrefixesDay:      c.ipPrefixes.estimate(now, cardinalityHours-1),
+	}
+}
+
+// ServeHTTP renders the estimates in the OpenMetrics text format.
+func (c *Cardinality) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	c.WriteMetrics(w)
+	fmt.Fprintln(w, "# EOF")
+}
+
+// WriteMetrics writes the estimates as gauges, without the trailing "# EOF".
+func (c *Cardinality) WriteMetrics(w io.Writer) {
+	e := c.Estimates()
+	fmt.Fprintln(w, "# TYPE adresu_unique_authors gauge")
+	fmt.Fprintln(w, "# HELP adresu_unique_authors Estimated distinct pubkeys submitting events.")
+	fmt.Fprintf(w, "adresu_unique_authors{window=\"current_hour\"} %d\n", e.AuthorsThisHour)
+	fmt.Fprintf(w, "adresu_unique_authors{window=\"previous_hour\"} %d\n", e.AuthorsLastHour)
+	fmt.Fprintf(w, "adresu_unique_authors{window=\"24h\"} %d\n", e.AuthorsDay)
+	fmt.Fprintln(w, "# TYPE adresu_unique_ip_prefixes gauge")
+	fmt.Fprintln(w, "# HELP adresu_unique_ip_prefixes Estimated distinct client IP prefixes (/24 IPv4, /48 IPv6).")
+	fmt.Fprintf(w, "adresu_unique_ip_prefixes{window=\"current_hour\"} %d\n", e.IPPrefixesThisHour)
+	fmt.Fprintf(w, "adresu_unique_ip_prefixes{window=\"previous_hour\"} %d\n", e.IPPrefixesLastHour)
+	fmt.Fprintf(w, "adresu_unique_ip_prefixes{window=\"24h\"} %d\n", e.IPPrefixesDay)
+}
+
+// IPPrefix returns the /24 (IPv4) or /48 (IPv6) network of ip, or "" if ip
+// is not a valid address.
+func IPPrefix(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	p, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return p.String()
+}
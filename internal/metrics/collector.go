@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+)
+
+// maxReasonSeries bounds the number of distinct reason labels; further
+// reasons are counted as "other".
+const maxReasonSeries = 1000
+
+type filterCounts struct {
+	accepted uint64
+	rejected uint64
+}
+
+// errorKey is a filter and a class of its failures.
+type errorKey struct {
+	filter, class string
+}
+
+// Collector implements policy.MetricsCollector with per-filter accept and
+// reject counters, rejection reason counters and error counters by class.
+// Reasons are reduced to their code (the part before the first ':') to keep
+// label cardinality bounded.
+type Collector struct {
+	mu      sync.Mutex
+	filters map[string]*filterCounts
+	reasons map[ReasonKey]uint64
+	errors  map[errorKey]uint64
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		filters: make(map[string]*filterCounts),
+		reasons: make(map[ReasonKey]uint64),
+		errors:  make(map[errorKey]uint64),
+	}
+}
+
+// Report implements policy.MetricsCollector.
+func (c *Collector) Report(res kitpolicy.FilterResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fc := c.filters[res.Filter]
+	if fc == nil {
+		fc = &filterCounts{}
+		c.filters[res.Filter] = fc
+	}
+	if res.Allowed {
+		fc.accepted++
+		return
+	}
+	fc.rejected++
+
+	code, _, _ := strings.Cut(res.Reason, ":")
+	key := ReasonKey{Filter: res.Filter, Reason: code}
+	if _, ok := c.reasons[key]; !ok && len(c.reasons) >= maxReasonSeries {
+		key.Reason = "other"
+	}
+	c.reasons[key]++
+}
+
+// ReportError implements policy.MetricsCollector.
+func (c *Collector) ReportError(filter, class string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors[errorKey{filter: filter, class: class}]++
+}
+
+// WriteMetrics writes the counters in the OpenMetrics text format, without the
+// trailing "# EOF".
+func (c *Collector) WriteMetrics(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintln(w, "# TYPE adresu_filter_results counter")
+	fmt.Fprintln(w, "# HELP adresu_filter_results Events evaluated by each filter, by result.")
+	for _, name := range slices.Sorted(maps.Keys(c.filters)) {
+		fc := c.filters[name]
+		fmt.Fprintf(w, "adresu_filter_results_total{filter=%q,result=\"accept\"} %d\n", name, fc.accepted)
+		fmt.Fprintf(w, "adresu_filter_results_total{filter=%q,result=\"reject\"} %d\n", name, fc.rejected)
+	}
+
+	fmt.Fprintln(w, "# TYPE adresu_filter_rejections counter")
+	fmt.Fprintln(w, "# HELP adresu_filter_rejections Rejections by filter and reason code.")
+	keys := slices.SortedFunc(maps.Keys(c.reasons), func(a, b ReasonKey) int {
+		return cmp.Or(cmp.Compare(a.Filter, b.Filter), cmp.Compare(a.Reason, b.Reason))
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "adresu_filter_rejections_total{filter=%q,reason=%q} %d\n", k.Filter, k.Reason, c.reasons[k])
+	}
+
+	fmt.Fprintln(w, "# TYPE adresu_filter_errors counter")
+	fmt.Fprintln(w, "# HELP adresu_filter_errors Filter failures by filter and error class.")
+	errorKeys := slices.SortedFunc(maps.Keys(c.errors), func(a, b errorKey) int {
+		return cmp.Or(cmp.Compare(a.filter, b.filter), cmp.Compare(a.class, b.class))
+	})
+	for _, k := range errorKeys {
+		fmt.Fprintf(w, "adresu_filter_errors_total{filter=%q,class=%q} %d\n", k.filter, k.class, c.errors[k])
+	}
+}
+
+// Exporter serves the counters of a Collector together with other metric
+// sources on one OpenMetrics endpoint.
+type Exporter struct {
+	sources []interface{ WriteMetrics(io.Writer) }
+}
+
+func NewExporter(sources ...interface{ WriteMetrics(io.Writer) }) *Exporter {
+	return &Exporter{sources: sources}
+}
+
+// ServeHTTP renders every source in the OpenMetrics text format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	for _, s := range e.sources {
+		s.WriteMetrics(w)
+	}
+	fmt.Fprintln(w, "# EOF")
+}
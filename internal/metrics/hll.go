@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision gives 2^14 registers (16 KiB per sketch) and a standard error
+// of about 0.8%.
+const hllPrecision = 14
+
+var hllSeed = maphash.MakeSeed()
+
+// hyperLogLog is a HyperLogLog cardinality sketch: it estimates the number of
+// distinct strings added to it in constant memory. It is not safe for
+// concurrent use.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+func (h *hyperLogLog) add(s string) {
+	x := maphash.String(hllSeed, s)
+	idx := x >> (64 - hllPrecision)
+	// Rank of the first set bit in the remaining bits, counting from 1.
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// merge folds other into h, so h estimates the union of both sets.
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+func (h *hyperLogLog) reset() {
+	clear(h.registers)
+}
+
+// estimate returns the approximate number of distinct strings added.
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Small range correction: linear counting.
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(e + 0.5)
+}
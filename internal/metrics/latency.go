@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+)
+
+// latencyBuckets are the histogram upper bounds, from 50µs to 1s.
+var latencyBuckets = []time.Duration{
+	50 * time.Microsecond, 100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond,
+	25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second,
+}
+
+// exemplar links a histogram bucket to the most recent event that fell in it.
+type exemplar struct {
+	eventID string
+	kind    int
+	value   time.Duration
+	at      time.Time
+}
+
+type histogram struct {
+	counts    []uint64 // Per bucket, plus +Inf as the last element.
+	exemplars []exemplar
+	sum       time.Duration
+	count     uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{
+		counts:    make([]uint64, len(latencyBuckets)+1),
+		exemplars: make([]exemplar, len(latencyBuckets)+1),
+	}
+}
+
+func (h *histogram) observe(v time.Duration, ex exemplar) {
+	i, _ := slices.BinarySearch(latencyBuckets, v)
+	h.counts[i]++
+	h.exemplars[i] = ex
+	h.sum += v
+	h.count++
+}
+
+type filterKey struct {
+	filter    string
+	kindClass string
+}
+
+// LatencyRecorder attributes decision latency to filters and content types.
+// Every bucket keeps an exemplar event, so a tail-latency spike can be traced
+// to the concrete event that caused it.
+type LatencyRecorder struct {
+	mu        sync.Mutex
+	decisions map[string]*histogram    // kind class -> total decision latency
+	filters   map[filterKey]*histogram // filter and kind class -> filter latency
+}
+
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{
+		decisions: make(map[string]*histogram),
+		filters:   make(map[filterKey]*histogram),
+	}
+}
+
+// ObserveDecision implements policy.DecisionObserver.
+func (r *LatencyRecorder) ObserveDecision(d policy.Decision) {
+	class := KindClass(d.Kind)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h := r.decisions[class]
+	if h == nil {
+		h = newHistogram()
+		r.decisions[class] = h
+	}
+	h.observe(d.Latency, exemplar{eventID: d.EventID, kind: d.Kind, value: d.Latency, at: d.Time})
+
+	for _, st := range d.Stages {
+		key := filterKey{filter: st.Filter, kindClass: class}
+		fh := r.filters[key]
+		if fh == nil {
+			fh = newHistogram()
+			r.filters[key] = fh
+		}
+		fh.observe(st.Duration, exemplar{eventID: d.EventID, kind: d.Kind, value: st.Duration, at: d.Time})
+	}
+}
+
+// ServeHTTP renders the histograms in the OpenMetrics text format.
+func (r *LatencyRecorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	r.WriteMetrics(w)
+	fmt.Fprintln(w, "# EOF")
+}
+
+// WriteMetrics writes the histograms in the OpenMetrics text format, without the
+// trailing "# EOF" so the output can be combined with other metrics.
+func (r *LatencyRecorder) WriteMetrics(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintln(w, "# TYPE adresu_decision_latency_seconds histogram")
+	fmt.Fprintln(w, "# HELP adresu_decision_latency_seconds Time to decide on an event, by kind class.")
+	for _, class := range slices.Sorted(maps.Keys(r.decisions)) {
+		writeHistogram(w, "adresu_decision_latency_seconds", fmt.Sprintf("kind_class=%q", class), r.decisions[class])
+	}
+
+	fmt.Fprintln(w, "# TYPE adresu_filter_latency_seconds histogram")
+	fmt.Fprintln(w, "# HELP adresu_filter_latency_seconds Time spent in each filter, by kind class.")
+	keys := slices.SortedFunc(maps.Keys(r.filters), func(a, b filterKey) int {
+		return cmp.Or(cmp.Compare(a.filter, b.filter), cmp.Compare(a.kindClass, b.kindClass))
+	})
+	for _, key := range keys {
+		labels := fmt.Sprintf("filter=%q,kind_class=%q", key.filter, key.kindClass)
+		writeHistogram(w, "adresu_filter_latency_seconds", labels, r.filters[key])
+	}
+}
+
+func writeHistogram(w io.Writer, name, labels string, h *histogram) {
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += h.counts[i]
+		le := "+Inf"
+		if i < len(latencyBuckets) {
+			le = fmt.Sprintf("%g", latencyBuckets[i].Seconds())
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d", name, labels, le, cumulative)
+		if ex := h.exemplars[i]; ex.eventID != "" {
+			fmt.Fprintf(w, " # {event_id=%q,kind=\"%d\"} %g %.3f",
+				ex.eventID, ex.kind, ex.value.Seconds(), float64(ex.at.UnixMilli())/1000)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", name, labels, h.sum.Seconds())
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+// KindClass groups event kinds into the content types used as metric labels,
+// keeping label cardinality bounded.
+func KindClass(kind int) string {
+	switch {
+	case kind == 1:
+		return "note"
+	case kind == 7:
+		return "reaction"
+	case kind == 6 || kind == 16:
+		return "repost"
+	case kind == 4 || kind == 13 || kind == 14 || kind == 1059:
+		return "dm"
+	case kind == 0 || kind == 3 || (kind >= 10000 && kind < 20000):
+		return "replaceable"
+	case kind >= 20000 && kind < 30000:
+		return "ephemeral"
+	case kind >= 30000 && kind < 40000:
+		return "addressable"
+	default:
+		return "other"
+	}
+}
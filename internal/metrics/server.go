@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Serve exposes handler at cfg.Path on cfg.Listen in the background until ctx
+// is cancelled.
+func Serve(ctx context.Context, cfg *config.MetricsConfig, handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("GET "+cfg.Path, handler)
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		slog.Info("Metrics endpoint listening", "addr", cfg.Listen, "path", cfg.Path)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Metrics endpoint stopped", "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+}
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+)
+
+// statsRetention is how far back a Stats recorder can report.
+const statsRetention = 24 * time.Hour
+
+// statsBucket counts the decisions of one minute.
+type statsBucket struct {
+	minute   int64 // Unix minute; buckets of other minutes are stale.
+	accepted int
+	rejected int
+	bans     int
+	reasons  map[ReasonKey]int
+}
+
+// ReasonKey identifies a rejection cause: the filter and the reason code,
+// without the per-event details after the first ':'.
+type ReasonKey struct {
+	Filter string `json:"filter"`
+	Reason string `json:"reason"`
+}
+
+// ReasonCount is a rejection cause and how often it occurred.
+type ReasonCount struct {
+	ReasonKey
+	Count int `json:"count"`
+}
+
+// FilterCount is how many events a filter rejected.
+type FilterCount struct {
+	Filter string `json:"filter"`
+	Count  int    `json:"count"`
+}
+
+// StatsReport summarizes the decisions of a recent time window.
+type StatsReport struct {
+	Since       time.Duration `json:"since_ns"`
+	Accepted    int           `json:"accepted"`
+	Rejected    int           `json:"rejected"`
+	AcceptRatio float64       `json:"accept_ratio"`
+	Bans        int           `json:"bans"`
+	TopReasons  []ReasonCount `json:"top_reasons"`
+	// Filters are the rejections of every filter, not limited to the top.
+	Filters []FilterCount `json:"filters"`
+}
+
+// Stats keeps per-minute decision counts for the last 24 hours, so operators
+// can get a quick report from the running process.
+type Stats struct {
+	mu      sync.Mutex
+	buckets []statsBucket
+}
+
+func NewStats() *Stats {
+	return &Stats{buckets: make([]statsBucket, int(statsRetention/time.Minute))}
+}
+
+// bucket returns the bucket for now, resetting it if it is stale. The caller
+// must hold mu.
+func (s *Stats) bucket(now time.Time) *statsBucket {
+	minute := now.Unix() / 60
+	b := &s.buckets[minute%int64(len(s.buckets))]
+	if b.minute != minute {
+		*b = statsBucket{minute: minute}
+	}
+	return b
+}
+
+// ObserveDecision implements policy.DecisionObserver.
+func (s *Stats) ObserveDecision(d policy.Decision) {
+	if d.Lookback {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.bucket(d.Time)
+	if d.Action == "accept" {
+		b.accepted++
+		return
+	}
+	b.rejected++
+	code, _, _ := strings.Cut(d.Reason, ":")
+	if b.reasons == nil {
+		b.reasons = make(map[ReasonKey]int)
+	}
+	b.reasons[ReasonKey{Filter: d.Filter, Reason: code}]++
+}
+
+// OnBan is a store.BanListener counting issued bans.
+func (s *Stats) OnBan(string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bucket(time.Now()).bans++
+}
+
+// Report summarizes the last since (at most 24 hours), with up to top
+// rejection causes.
+func (s *Stats) Report(since time.Duration, top int) StatsReport {
+	since = min(since, statsRetention)
+	oldest := time.Now().Add(-since).Unix() / 60
+	report := StatsReport{Since: since}
+	reasons := make(map[ReasonKey]int)
+
+	s.mu.Lock()
+	for _, b := range s.buckets {
+		if b.minute < oldest {
+			continue
+		}
+		report.Accepted += b.accepted
+		report.Rejected += b.rejected
+		report.Bans += b.bans
+		for k, n := range b.reasons {
+			reasons[k] += n
+		}
+	}
+	s.mu.Unlock()
+
+	if total := report.Accepted + report.Rejected; total > 0 {
+		report.AcceptRatio = float64(report.Accepted) / float64(total)
+	}
+	filters := make(map[string]int)
+	for k, n := range reasons {
+		report.TopReasons = append(report.TopReasons, ReasonCount{ReasonKey: k, Count: n})
+		filters[k.Filter] += n
+	}
+	for filter, n := range filters {
+		report.Filters = append(report.Filters, FilterCount{Filter: filter, Count: n})
+	}
+	slices.SortFunc(report.Filters, func(a, b FilterCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Filter, b.Filter))
+	})
+	slices.SortFunc(report.TopReasons, func(a, b ReasonCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Filter, b.Filter), cmp.Compare(a.Reason, b.Reason))
+	})
+	if len(report.TopReasons) > top {
+		report.TopReasons = report.TopReasons[:top]
+	}
+	return report
+}
+
+// ServeHTTP returns a StatsReport as JSON. Query parameters: since (a Go
+// duration, default 1h) and top (default 10).
+func (s *Stats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	since := time.Hour
+	if v := q.Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid since: %q", v), http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+	top := 10
+	if v := q.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid top: %q", v), http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Report(since, top))
+}
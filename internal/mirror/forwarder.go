@@ -0,0 +1,155 @@
+package mirror
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/trace"
+)
+
+const (
+	defaultQueueSize      = 10000
+	defaultPublishTimeout = 10 * time.Second
+	defaultRetryDelay     = 2 * time.Second
+	closeDrainTimeout     = 5 * time.Second
+)
+
+// Forwarder republishes accepted events to backup or aggregator relays.
+// Every relay has its own queue and worker, so a slow or unreachable relay
+// never delays the others or the pipeline itself.
+type Forwarder struct {
+	cfg     *config.MirrorConfig
+	targets []*target
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type target struct {
+	url   string
+	queue chan queuedEvent
+	relay *nostr.Relay
+}
+
+// queuedEvent is an accepted event with the trace ID of its decision.
+type queuedEvent struct {
+	ev      nostr.Event
+	traceID string
+}
+
+// NewForwarder starts one publishing worker per configured relay.
+func NewForwarder(cfg *config.MirrorConfig) *Forwarder {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Forwarder{cfg: cfg, ctx: ctx, cancel: cancel}
+
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	for _, url := range cfg.Relays {
+		t := &target{url: nostr.NormalizeURL(url), queue: make(chan queuedEvent, size)}
+		f.targets = append(f.targets, t)
+		f.wg.Add(1)
+		go f.run(t)
+	}
+	slog.Info("Mirror forwarder started", "relays", len(f.targets))
+	return f
+}
+
+// HandleAcceptance queues an accepted event for every mirror relay. It never
+// blocks: when a relay's queue is full the event is dropped for that relay.
+func (f *Forwarder) HandleAcceptance(ctx context.Context, ev *nostr.Event) {
+	if len(f.cfg.Kinds) > 0 && !slices.Contains(f.cfg.Kinds, ev.Kind) {
+		return
+	}
+	for _, t := range f.targets {
+		select {
+		case t.queue <- queuedEvent{ev: *ev, traceID: trace.From(ctx)}:
+		default:
+			slog.WarnContext(ctx, "Mirror queue full, dropping event", "relay", t.url, "event_id", ev.ID)
+		}
+	}
+}
+
+// Close stops accepting events and gives workers a short grace period to
+// flush what is already queued.
+func (f *Forwarder) Close() error {
+	for _, t := range f.targets {
+		close(t.queue)
+	}
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(closeDrainTimeout):
+		slog.Warn("Mirror forwarder did not drain in time, dropping remaining events")
+	}
+	f.cancel()
+	return nil
+}
+
+func (f *Forwarder) run(t *target) {
+	defer f.wg.Done()
+	defer func() {
+		if t.relay != nil {
+			t.relay.Close()
+		}
+	}()
+
+	for q := range t.queue {
+		f.publishWithRetry(trace.With(f.ctx, q.traceID), t, q.ev)
+	}
+}
+
+func (f *Forwarder) publishWithRetry(ctx context.Context, t *target, ev nostr.Event) {
+	delay := f.cfg.RetryDelay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+
+	for attempt := 0; attempt <= f.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		err := f.publish(t, ev)
+		if err == nil {
+			slog.DebugContext(ctx, "Mirrored event", "relay", t.url, "event_id", ev.ID)
+			return
+		}
+		slog.WarnContext(ctx, "Failed to mirror event", "relay", t.url, "event_id", ev.ID, "attempt", attempt+1, "error", err)
+	}
+	slog.ErrorContext(ctx, "Giving up mirroring event", "relay", t.url, "event_id", ev.ID)
+}
+
+func (f *Forwarder) publish(t *target, ev nostr.Event) error {
+	timeout := f.cfg.PublishTimeout
+	if timeout <= 0 {
+		timeout = defaultPublishTimeout
+	}
+	ctx, cancel := context.WithTimeout(f.ctx, timeout)
+	defer cancel()
+
+	if t.relay == nil || !t.relay.IsConnected() {
+		relay, err := nostr.RelayConnect(f.ctx, t.url)
+		if err != nil {
+			return err
+		}
+		t.relay = relay
+	}
+	return t.relay.Publish(ctx, ev)
+}
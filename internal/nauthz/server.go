@@ -0,0 +1,116 @@
+// Package nauthz serves nostr-rs-relay's gRPC event admission interface
+// (nauthz.proto) with the policy pipeline, so the plugin can judge the events
+// of that relay as it does strfry's.
+package nauthz
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative nauthz.proto
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/trace"
+)
+
+// Server answers EventAdmit requests with the pipeline in use. The request's
+// client address becomes the event's IP4/IP6 source, and its origin,
+// user agent, NIP-42 pubkey and NIP-05 address are shared with the filters
+// through meta (see kitpolicy.MetaKeyOrigin).
+type Server struct {
+	UnimplementedAuthorizationServer
+	pipeline func() *policy.Pipeline
+	dryRun   bool
+}
+
+// NewServer returns a server judging events with the pipeline returned by
+// pipeline, which may change between requests on config reloads.
+func NewServer(pipeline func() *policy.Pipeline, dryRun bool) *Server {
+	return &Server{pipeline: pipeline, dryRun: dryRun}
+}
+
+func (s *Server) EventAdmit(ctx context.Context, req *EventRequest) (*EventReply, error) {
+	event, err := decodeEvent(req.GetEvent())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx = trace.With(ctx, trace.NewID())
+
+	remoteIP := req.GetIpAddr()
+	if src, ok := policy.ClientSource(remoteIP); ok {
+		ctx = policy.WithSource(ctx, src)
+	} else {
+		remoteIP = ""
+	}
+	if meta := requestMeta(req); len(meta) > 0 {
+		ctx = policy.WithMeta(ctx, meta)
+	}
+
+	res, err := s.pipeline().ProcessEvent(ctx, event, remoteIP, s.dryRun)
+	if err != nil {
+		// A failed filter comes with a rejection, which is still the answer.
+		slog.ErrorContext(ctx, "Error processing event", "event_id", event.ID, "error", err)
+	}
+	if res.Action == "accept" {
+		return &EventReply{Decision: Decision_DECISION_PERMIT}, nil
+	}
+	reply := &EventReply{Decision: Decision_DECISION_DENY}
+	if res.Msg != "" {
+		reply.Message = &res.Msg
+	}
+	return reply, nil
+}
+
+// decodeEvent converts the binary fields of an admission request's event to
+// those of a Nostr event.
+func decodeEvent(e *Event) (*nostr.Event, error) {
+	if e == nil {
+		return nil, fmt.Errorf("missing event")
+	}
+	if len(e.GetId()) != 32 || len(e.GetPubkey()) != 32 || len(e.GetSig()) != 64 {
+		return nil, fmt.Errorf("malformed event: id, pubkey and sig must be 32, 32 and 64 bytes")
+	}
+	if e.GetKind() > math.MaxInt32 || e.GetCreatedAt() > math.MaxInt64 {
+		return nil, fmt.Errorf("malformed event: kind or created_at out of range")
+	}
+	event := &nostr.Event{
+		ID:        hex.EncodeToString(e.GetId()),
+		PubKey:    hex.EncodeToString(e.GetPubkey()),
+		CreatedAt: nostr.Timestamp(e.GetCreatedAt()),
+		Kind:      int(e.GetKind()),
+		Content:   e.GetContent(),
+		Sig:       hex.EncodeToString(e.GetSig()),
+		Tags:      make(nostr.Tags, 0, len(e.GetTags())),
+	}
+	for _, tag := range e.GetTags() {
+		event.Tags = append(event.Tags, nostr.Tag(tag.GetValues()))
+	}
+	return event, nil
+}
+
+// requestMeta returns the meta entries of what the relay knows of the
+// client.
+func requestMeta(req *EventRequest) map[string]any {
+	meta := make(map[string]any)
+	if req.Origin != nil {
+		meta[kitpolicy.MetaKeyOrigin] = req.GetOrigin()
+	}
+	if req.UserAgent != nil {
+		meta[kitpolicy.MetaKeyUserAgent] = req.GetUserAgent()
+	}
+	if len(req.GetAuthPubkey()) == 32 {
+		meta[kitpolicy.MetaKeyAuthPubKey] = hex.EncodeToString(req.GetAuthPubkey())
+	}
+	if n := req.GetNip05(); n != nil && n.GetDomain() != "" {
+		meta[kitpolicy.MetaKeyNIP05] = n.GetLocal() + "@" + n.GetDomain()
+	}
+	return meta
+}
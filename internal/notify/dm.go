@@ -0,0 +1,124 @@
+// Package notify delivers operator reports as NIP-17 direct messages or
+// public notes.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip17"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+const publishTimeout = 10 * time.Second
+
+// DM sends direct messages to one recipient through a list of relays.
+type DM struct {
+	signer    nostr.Keyer
+	recipient string
+	relays    []string
+}
+
+// NewDM creates a sender signing with the key (nsec or hex) in the
+// environment variable keyEnv.
+func NewDM(keyEnv, recipient string, relays []string) (*DM, error) {
+	sk, err := secretKeyFromEnv(keyEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyEnv, err)
+	}
+	signer, err := keyer.NewPlainKeySigner(sk)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyEnv, err)
+	}
+	return &DM{signer: signer, recipient: recipient, relays: relays}, nil
+}
+
+// Send sends text to the recipient, succeeding if at least one relay
+// accepts it.
+func (d *DM) Send(ctx context.Context, text string) error {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	_, toThem, err := nip17.PrepareMessage(ctx, text, nil, d.signer, d.recipient, nil)
+	if err != nil {
+		return err
+	}
+	return publish(ctx, d.relays, toThem)
+}
+
+// Note publishes public notes (kind 1) through a list of relays.
+type Note struct {
+	signer nostr.Keyer
+	tags   nostr.Tags
+	relays []string
+}
+
+// NewNote creates a publisher signing with the key (nsec or hex) in the
+// environment variable keyEnv and adding tags to every note.
+func NewNote(keyEnv string, tags nostr.Tags, relays []string) (*Note, error) {
+	sk, err := secretKeyFromEnv(keyEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyEnv, err)
+	}
+	signer, err := keyer.NewPlainKeySigner(sk)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyEnv, err)
+	}
+	return &Note{signer: signer, tags: tags, relays: relays}, nil
+}
+
+// Send publishes text as a note, succeeding if at least one relay accepts
+// it.
+func (n *Note) Send(ctx context.Context, text string) error {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	event := nostr.Event{Kind: nostr.KindTextNote, CreatedAt: nostr.Now(), Tags: n.tags, Content: text}
+	if err := n.signer.SignEvent(ctx, &event); err != nil {
+		return err
+	}
+	return publish(ctx, n.relays, event)
+}
+
+// publish sends event to relays in turn until one accepts it.
+func publish(ctx context.Context, relays []string, event nostr.Event) error {
+	var errs []error
+	for _, url := range relays {
+		relay, err := nostr.RelayConnect(ctx, url)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+			continue
+		}
+		err = relay.Publish(ctx, event)
+		relay.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+			continue
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// secretKeyFromEnv reads the signing key (nsec or hex) as hex.
+func secretKeyFromEnv(keyEnv string) (string, error) {
+	s := strings.TrimSpace(os.Getenv(keyEnv))
+	if s == "" {
+		return "", errors.New("not set")
+	}
+	if strings.HasPrefix(s, "nsec1") {
+		prefix, v, err := nip19.Decode(s)
+		if err != nil || prefix != "nsec" {
+			return "", errors.New("invalid nsec")
+		}
+		return v.(string), nil
+	}
+	if !nostr.IsValid32ByteHex(s) {
+		return "", errors.New("invalid secret key")
+	}
+	return s, nil
+}
@@ -0,0 +1,414 @@
+// Package pipeline assembles the filter pipeline described by a
+// configuration.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/geoip"
+	"github.com/lessucettes/adresu-plugin/internal/mirror"
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/priming"
+	"github.com/lessucettes/adresu-plugin/internal/schedule"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+	"github.com/lessucettes/adresu-plugin/internal/strfry"
+)
+
+// Deps are the long-lived components a pipeline is built around. The plugin
+// creates them once and shares them by every pipeline across reloads.
+type Deps struct {
+	DB          store.Store
+	Observers   []policy.DecisionObserver
+	Maintenance *policy.MaintenanceSwitch // nil means a switch from cfg.Maintenance
+	Cooldowns   *kitpolicy.Cooldowns      // nil means a fresh registry
+	SlowMode    *kitpolicy.SlowMode       // nil means a fresh registry
+	Ledger      *policy.FirstSeenLedger   // nil means a fresh ledger
+	// AutoBanListeners are notified of bans issued by the AutoBanFilter only.
+	AutoBanListeners []store.BanListener
+	Collector        policy.MetricsCollector // nil disables per-filter metrics
+	CanaryStats      *policy.CanaryStats     // nil means fresh counts
+	ExperimentStats  *policy.ExperimentStats // nil means fresh counts
+	Scheduler        *schedule.Scheduler     // nil means a fresh scheduler
+	// QueueDepth returns the number of input lines read but not yet
+	// answered; nil leaves the queue out of load shedding.
+	QueueDepth func() int
+}
+
+// Build builds the pipeline of cfg around deps.
+func Build(cfg *config.Config, deps Deps) (*policy.Pipeline, error) {
+	strfry.AlignWithStrfry(cfg)
+	strfryClient := strfry.NewClient(cfg.Strfry.ExecutablePath, cfg.Strfry.ConfigPath)
+	db := deps.DB
+
+	var stages []policy.PipelineStage
+
+	sched := deps.Scheduler
+	if sched == nil {
+		var err error
+		if sched, err = schedule.New(cfg.Schedule.Jitter, cfg.Schedule.Jobs); err != nil {
+			return nil, fmt.Errorf("failed to create scheduler: %w", err)
+		}
+		sched.Start(context.Background())
+	}
+
+	maintenance := deps.Maintenance
+	if maintenance == nil {
+		maintenance = policy.NewMaintenanceSwitch(&cfg.Maintenance)
+	}
+	maintenanceFilter, err := policy.NewMaintenanceFilter(maintenance, &cfg.Maintenance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MaintenanceFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: maintenanceFilter, Name: "MaintenanceFilter"})
+
+	// Shed events cost nothing beyond this check.
+	loadShedder := policy.NewLoadShedder(&cfg.Pipeline.LoadShedding, deps.QueueDepth)
+	stages = append(stages, policy.PipelineStage{Filter: loadShedder, Name: "LoadShedder"})
+
+	// Denied networks are turned away before signatures are verified.
+	ipFilter, err := policy.NewIPFilter(&cfg.Filters.IP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IPFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: ipFilter, Name: "IPFilter"})
+
+	// Malformed events are rejected before any filter keeps state about them.
+	validationFilter, err := kitpolicy.NewValidationFilter(&cfg.Filters.Validation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ValidationFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: validationFilter, Name: "ValidationFilter"})
+
+	compromisedKeysFilter, err := policy.NewCompromisedKeysFilter(&cfg.Filters.CompromisedKeys, sched)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CompromisedKeysFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: compromisedKeysFilter, Name: "CompromisedKeysFilter"})
+
+	cooldowns := deps.Cooldowns
+	if cooldowns == nil {
+		cooldowns = kitpolicy.NewCooldowns(cfg.Filters.Cooldown.CacheSize)
+	}
+	cooldownFilter, err := policy.NewCooldownFilter(cooldowns, &cfg.Filters.Cooldown)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CooldownFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: cooldownFilter, Name: "CooldownFilter"})
+
+	slowMode := deps.SlowMode
+	if slowMode == nil {
+		slowMode = kitpolicy.NewSlowMode(cfg.Filters.EphemeralChat.CacheSize)
+	}
+
+	originFilter, err := policy.NewOriginFilter(&cfg.Filters.Origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OriginFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: originFilter, Name: "OriginFilter"})
+
+	wotFilter, err := policy.NewWoTFilter(cfg, strfryClient, sched)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WoTFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: wotFilter, Name: "WoTFilter"})
+
+	whitelistFilter, err := policy.NewWhitelistFilter(cfg, strfryClient, sched)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WhitelistFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: whitelistFilter, Name: "WhitelistFilter"})
+
+	type kitFilterFactory struct {
+		name        string
+		constructor func() (kitpolicy.Filter, error)
+	}
+
+	var langDetector *kitpolicy.WarmingDetector
+	if cfg.Filters.Language.Enabled {
+		langDetector = kitpolicy.WarmGlobalDetector()
+	}
+
+	kitFactories := []kitFilterFactory{
+		{"EmergencyFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewEmergencyFilter(&cfg.Filters.Emergency) }},
+		{"FairnessFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewFairnessFilter(&cfg.Filters.Fairness) }},
+		{"KindFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewKindFilter(&cfg.Filters.Kind) }},
+		// Not a kit filter, but it belongs next to KindFilter, ahead of heavier checks.
+		{"UnknownKindFilter", func() (kitpolicy.Filter, error) { return policy.NewUnknownKindFilter(cfg) }},
+		// ClientFilter shares client rate adjustments with RateLimiterFilter.
+		{"ClientFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewClientFilter(&cfg.Filters.Client) }},
+		{"BotSignatureFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewBotSignatureFilter(&cfg.Filters.BotSignatures) }},
+		{"PoWFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewPoWFilter(&cfg.Filters.PoW) }},
+		{"RateLimiterFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewRateLimiterFilter(&cfg.Filters.RateLimiter) }},
+		{"FreshnessFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewFreshnessFilter(&cfg.Filters.Freshness) }},
+		{"SizeFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewSizeFilter(&cfg.Filters.Size) }},
+		{"TagsFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewTagsFilter(&cfg.Filters.Tags) }},
+		{"TagStuffingFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewTagStuffingFilter(&cfg.Filters.TagStuffing) }},
+		{"KeywordFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewKeywordFilter(&cfg.Filters.Keywords) }},
+		{"MetadataFilter", func() (kitpolicy.Filter, error) {
+			return kitpolicy.NewMetadataFilter(&cfg.Filters.Metadata, &cfg.Filters.Keywords)
+		}},
+		{"InlineDataFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewInlineDataFilter(&cfg.Filters.InlineData) }},
+		{"FileSharingFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewFileSharingFilter(&cfg.Filters.FileSharing) }},
+		{"PhishingFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewPhishingFilter(&cfg.Filters.Phishing) }},
+		{"ReferenceFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewReferenceFilter(&cfg.Filters.References) }},
+		{"RepostAbuseFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewRepostAbuseFilter(&cfg.Filters.RepostAbuse) }},
+		{"ReplyFloodFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewReplyFloodFilter(&cfg.Filters.ReplyFlood) }},
+		{"DuplicateContentFilter", func() (kitpolicy.Filter, error) {
+			return kitpolicy.NewDuplicateContentFilter(&cfg.Filters.DuplicateContent)
+		}},
+		{"KindDiversityFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewKindDiversityFilter(&cfg.Filters.KindDiversity) }},
+		{"EphemeralChatFilter", func() (kitpolicy.Filter, error) {
+			return kitpolicy.NewEphemeralChatFilterWithSlowMode(&cfg.Filters.EphemeralChat, slowMode)
+		}},
+		{"LiveActivityFilter", func() (kitpolicy.Filter, error) { return kitpolicy.NewLiveActivityFilter(&cfg.Filters.LiveActivity) }},
+		{"LanguageFilter", func() (kitpolicy.Filter, error) {
+			return kitpolicy.NewLanguageFilterWithWarmup(&cfg.Filters.Language, langDetector)
+		}},
+	}
+
+	var saturation policy.SaturationGuard
+	for _, factory := range kitFactories {
+		filter, err := factory.constructor()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kit filter '%s': %w", factory.name, err)
+		}
+		if guard, ok := filter.(*kitpolicy.FairnessFilter); ok && cfg.Filters.Fairness.Enabled {
+			saturation = guard
+		}
+		if filter != nil {
+			stages = append(stages, policy.PipelineStage{Filter: filter, Name: factory.name})
+		}
+	}
+
+	bannedAuthorFilter, err := policy.NewBannedAuthorFilter(db, &cfg.Filters.BannedAuthor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BannedAuthorFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: bannedAuthorFilter, Name: "BannedAuthorFilter"})
+
+	bannedIPFilter, err := policy.NewBannedIPFilter(db, &cfg.Filters.BannedIP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BannedIPFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: bannedIPFilter, Name: "BannedIPFilter"})
+
+	ipReputationFilter, err := policy.NewIPReputationFilter(&cfg.Filters.IPReputation, sched)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IPReputationFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: ipReputationFilter, Name: "IPReputationFilter"})
+
+	dnsblFilter, err := policy.NewDNSBLFilter(&cfg.Filters.DNSBL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DNSBLFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: dnsblFilter, Name: "DNSBLFilter"})
+
+	blocklistFilter, err := policy.NewBlocklistFilter(&cfg.Filters.Blocklist, db, strfryClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BlocklistFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: blocklistFilter, Name: "BlocklistFilter"})
+
+	restrictionFilter, err := policy.NewRestrictionFilter(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RestrictionFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: restrictionFilter, Name: "RestrictionFilter"})
+
+	bannedReferenceFilter, err := policy.NewBannedReferenceFilter(bannedAuthorFilter, &cfg.Filters.BannedReference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BannedReferenceFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: bannedReferenceFilter, Name: "BannedReferenceFilter"})
+
+	banEvasionFilter, err := policy.NewBanEvasionFilter(&cfg.Filters.BanEvasion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BanEvasionFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: banEvasionFilter, Name: "BanEvasionFilter"})
+	if cfg.Filters.BanEvasion.Enabled {
+		// Snapshot fingerprints of authors as they get banned.
+		db = store.WithBanListeners(db, banEvasionFilter.OnBan)
+	}
+
+	observers := deps.Observers
+	ledger := deps.Ledger
+	if ledger == nil {
+		ledger = policy.NewFirstSeenLedger(0)
+		observers = append(slices.Clone(observers), ledger)
+	}
+	protection := policy.NewProtection(cfg, whitelistFilter)
+	autoBanFilter, err := policy.NewAutoBanFilter(store.WithBanListeners(db, deps.AutoBanListeners...), bannedIPFilter, ledger,
+		protection, &cfg.Filters.AutoBan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AutoBanFilter: %w", err)
+	}
+
+	muteListSync := policy.NewMuteListSync(&cfg.Policy.MuteList, db, strfryClient, bannedAuthorFilter, sched)
+	stages = append(stages, policy.PipelineStage{Filter: muteListSync, Name: "MuteListSync"})
+
+	moderationFilter, err := policy.NewModerationFilter(&cfg.Policy, db, strfryClient, slowMode, autoBanFilter, blocklistFilter, protection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ModerationFilter: %w", err)
+	}
+	stages = append(stages, policy.PipelineStage{Filter: moderationFilter, Name: "ModerationFilter"})
+
+	if stages, err = insertExecStages(stages, cfg.Filters.Exec); err != nil {
+		return nil, err
+	}
+
+	rejectionHandlers := []policy.RejectionHandler{autoBanFilter}
+
+	if cfg.Priming.Path != "" {
+		primeStages(cfg.Priming.Path, stages, ledger)
+	}
+
+	var canary *policy.Canary
+	if cfg.Canary.Enabled {
+		if canary, err = buildCanary(cfg, deps); err != nil {
+			return nil, err
+		}
+	}
+
+	var experiment *policy.Experiment
+	if cfg.Experiment.Enabled {
+		if experiment, err = buildExperiment(cfg, deps); err != nil {
+			return nil, err
+		}
+	}
+
+	geoIP, err := geoip.Open(&cfg.GeoIP)
+	if err != nil {
+		return nil, err
+	}
+
+	var acceptHandlers []policy.AcceptanceHandler
+	if cfg.Mirror.Enabled {
+		acceptHandlers = append(acceptHandlers, mirror.NewForwarder(&cfg.Mirror))
+	}
+
+	pipeline := policy.NewPipeline(cfg, stages, policy.Hooks{
+		RejectionHandlers: rejectionHandlers,
+		AcceptHandlers:    acceptHandlers,
+		DecisionObservers: observers,
+		Cooldown:          cooldownFilter,
+		Collector:         deps.Collector,
+		PoWLane:           policy.NewPoWLane(cfg, saturation),
+		Degrader:          policy.NewDegrader(&cfg.Pipeline.Degradation),
+		LoadShedder:       loadShedder,
+		Canary:            canary,
+		Experiment:        experiment,
+		GeoIP:             geoIP,
+		ShadowBan:         policy.NewShadowBan(db, strfryClient, cfg.Policy.ShadowBanDelay),
+	})
+
+	return pipeline, nil
+}
+
+// buildCanary builds the pipeline of the candidate config at cfg.Canary.Path.
+// It reads the live store and maintenance switch but keeps its own filter
+// state, and feeds neither the observers nor the metrics of the live one.
+func buildCanary(cfg *config.Config, deps Deps) (*policy.Canary, error) {
+	candidateCfg, _, err := config.Load(cfg.Canary.Path, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load canary config: %w", err)
+	}
+	candidateCfg.Canary.Enabled = false
+	candidateCfg.Mirror.Enabled = false
+	candidate, err := Build(candidateCfg, Deps{DB: deps.DB, Maintenance: deps.Maintenance, Ledger: deps.Ledger, Scheduler: deps.Scheduler})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build canary pipeline: %w", err)
+	}
+	stats := deps.CanaryStats
+	if stats == nil {
+		stats = policy.NewCanaryStats()
+	}
+	slog.Info("Canary config loaded", "path", cfg.Canary.Path)
+	return policy.NewCanary(candidate, stats, &cfg.Canary), nil
+}
+
+// buildExperiment builds a pipeline for each cohort of cfg.Experiment with
+// settings of its own. Unlike the canary's, these pipelines are live: they
+// share the state, observers and metrics of the live one.
+func buildExperiment(cfg *config.Config, deps Deps) (*policy.Experiment, error) {
+	pipelines := make(map[string]*policy.Pipeline)
+	for _, cohort := range cfg.Experiment.Cohorts {
+		if len(cohort.Settings) == 0 {
+			continue
+		}
+		cohortCfg, err := cfg.WithFlags(cohort.Settings)
+		if err == nil {
+			cohortCfg.Experiment.Enabled = false
+			cohortCfg.Canary.Enabled = false
+			pipelines[cohort.Name], err = Build(cohortCfg, deps)
+		}
+		if err != nil {
+			for _, p := range pipelines {
+				p.Close()
+			}
+			return nil, fmt.Errorf("failed to build pipeline of experiment cohort %s: %w", cohort.Name, err)
+		}
+	}
+	stats := deps.ExperimentStats
+	if stats == nil {
+		stats = policy.NewExperimentStats()
+	}
+	slog.Info("Experiment loaded", "name", cfg.Experiment.Name, "cohorts", len(cfg.Experiment.Cohorts))
+	return policy.NewExperiment(&cfg.Experiment, pipelines, stats), nil
+}
+
+// insertExecStages adds the exec filters after the stages they name or, if
+// they name none, just before ModerationFilter, the last stage.
+func insertExecStages(stages []policy.PipelineStage, cfgs []config.ExecFilterConfig) ([]policy.PipelineStage, error) {
+	for i := range cfgs {
+		ex := &cfgs[i]
+		named := func(name string) func(policy.PipelineStage) bool {
+			return func(s policy.PipelineStage) bool { return s.Name == name }
+		}
+		if slices.ContainsFunc(stages, named(ex.Name)) {
+			return nil, fmt.Errorf("%w: filters.exec: the name '%s' is already taken", config.ErrConfigInvalid, ex.Name)
+		}
+		pos := len(stages) - 1
+		if ex.After != "" {
+			j := slices.IndexFunc(stages, named(ex.After))
+			if j < 0 {
+				return nil, fmt.Errorf("%w: filters.exec ('%s'): no filter named '%s' to run after", config.ErrConfigInvalid, ex.Name, ex.After)
+			}
+			pos = j + 1
+		}
+		filter, err := policy.NewExecFilter(ex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create exec filter %s: %w", ex.Name, err)
+		}
+		stages = slices.Insert(stages, pos, policy.PipelineStage{Filter: filter, Name: ex.Name})
+	}
+	return stages, nil
+}
+
+// primeStages seeds the stages' filters, and the other primers, with the
+// author history at path. A missing or unreadable snapshot only costs the
+// head start, so it is logged rather than failing the build.
+func primeStages(path string, stages []policy.PipelineStage, primers ...kitpolicy.Primer) {
+	snapshot, err := priming.Load(path)
+	if err != nil {
+		slog.Warn("Failed to load priming snapshot, starting with empty state", "path", path, "error", err)
+		return
+	}
+	filters := make([]kitpolicy.Filter, len(stages))
+	for i, stage := range stages {
+		filters[i] = stage.Filter
+	}
+	primed := priming.Prime(snapshot, filters...)
+	for _, p := range primers {
+		p.Prime(snapshot.Authors)
+	}
+	slog.Info("Primed filters from author history", "path", path, "authors", len(snapshot.Authors),
+		"filters", primed, "generated_at", snapshot.GeneratedAt)
+}
@@ -2,6 +2,7 @@ package policy
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"slices"
 	"sync"
@@ -14,6 +15,8 @@ import (
 	"github.com/lessucettes/adresu-plugin/internal/store"
 )
 
+const autoBanFilterName = "AutoBanFilter"
+
 // AutoBanFilter automatically bans users who repeatedly trigger rejections.
 type AutoBanFilter struct {
 	mu sync.Mutex
@@ -22,7 +25,13 @@ type AutoBanFilter struct {
 	banningCooldown *lru.LRU[string, struct{}]
 
 	store store.Store
-	cfg   *config.AutoBanFilterConfig
+	// ipBans bans the offending addresses when cfg.BanIP is set.
+	ipBans *BannedIPFilter
+	// ledger gives the author ages that cfg.AgeTiers depend on.
+	ledger *FirstSeenLedger
+	// protection spares the pubkeys of protected roles.
+	protection *Protection
+	cfg        *config.AutoBanFilterConfig
 }
 
 // RejectionStats stores the violation history for a pubkey.
@@ -32,12 +41,15 @@ type RejectionStats struct {
 }
 
 // NewAutoBanFilter wires dependencies and cache TTLs from config.
-func NewAutoBanFilter(s store.Store, cfg *config.AutoBanFilterConfig) (*AutoBanFilter, error) {
+func NewAutoBanFilter(s store.Store, ipBans *BannedIPFilter, ledger *FirstSeenLedger, protection *Protection, cfg *config.AutoBanFilterConfig) (*AutoBanFilter, error) {
 	strikesCache := lru.NewLRU[string, *RejectionStats](cfg.StrikesCacheSize, nil, cfg.StrikeWindow)
 	cooldownCache := lru.NewLRU[string, struct{}](cfg.CooldownCacheSize, nil, cfg.CooldownDuration)
 
 	return &AutoBanFilter{
 		store:           s,
+		ipBans:          ipBans,
+		ledger:          ledger,
+		protection:      protection,
 		strikes:         strikesCache,
 		banningCooldown: cooldownCache,
 		cfg:             cfg,
@@ -46,27 +58,30 @@ func NewAutoBanFilter(s store.Store, cfg *config.AutoBanFilterConfig) (*AutoBanF
 
 // HandleRejection is called when an event has been rejected by another filter.
 func (f *AutoBanFilter) HandleRejection(ctx context.Context, event *nostr.Event, filterName string) {
+	if len(f.cfg.ExcludeFilters) > 0 && slices.Contains(f.cfg.ExcludeFilters, filterName) {
+		return
+	}
+	f.Strike(ctx, event.PubKey, filterName, remoteIPFrom(ctx))
+}
+
+// Strike counts a strike against pubkey on behalf of filterName, banning it
+// once it reaches its limit, along with ip if cfg.BanIP is set and ip is not
+// empty.
+func (f *AutoBanFilter) Strike(ctx context.Context, pubkey, filterName, ip string) {
 	if !f.cfg.Enabled {
 		return
 	}
-	if len(f.cfg.ExcludeFilters) > 0 && slices.Contains(f.cfg.ExcludeFilters, filterName) {
+	if role := f.protection.Role(pubkey); role != "" {
+		slog.DebugContext(ctx, "Not striking a protected pubkey", "pubkey", pubkey, "role", role, "by_filter", filterName)
 		return
 	}
-
-	pubkey := event.PubKey
-
-	var (
-		shouldBan        bool
-		finalStrikeCount int
-	)
+	maxStrikes := f.maxStrikes(pubkey)
 
 	f.mu.Lock()
-
 	if _, onCooldown := f.banningCooldown.Get(pubkey); onCooldown {
 		f.mu.Unlock()
 		return
 	}
-
 	stats, ok := f.strikes.Get(pubkey)
 	if !ok {
 		stats = &RejectionStats{StrikeCount: 1, FirstStrikeTime: time.Now()}
@@ -74,29 +89,80 @@ func (f *AutoBanFilter) HandleRejection(ctx context.Context, event *nostr.Event,
 		stats.StrikeCount++
 	}
 	f.strikes.Add(pubkey, stats)
+	strikeCount := stats.StrikeCount
+	f.mu.Unlock()
 
-	if stats.StrikeCount >= f.cfg.MaxStrikes {
-		shouldBan = true
-		finalStrikeCount = stats.StrikeCount
-		f.strikes.Remove(pubkey)
-		f.banningCooldown.Add(pubkey, struct{}{})
+	if f.cfg.PersistStrikes {
+		strikeCount = f.persistStrike(ctx, pubkey, strikeCount)
+	}
+	if strikeCount < maxStrikes {
+		return
 	}
 
+	f.mu.Lock()
+	if _, onCooldown := f.banningCooldown.Get(pubkey); onCooldown {
+		// Another rejection of pubkey reached the limit first.
+		f.mu.Unlock()
+		return
+	}
+	f.strikes.Remove(pubkey)
+	f.banningCooldown.Add(pubkey, struct{}{})
 	f.mu.Unlock()
 
-	if shouldBan {
-		slog.Warn("Auto-banning user for repeated violations",
-			"pubkey", pubkey,
-			"strike_count", finalStrikeCount,
-			"ban_duration", f.cfg.BanDuration,
-			"by_filter", filterName,
-		)
-		go f.banUser(ctx, pubkey)
+	slog.WarnContext(ctx, "Auto-banning user for repeated violations",
+		"pubkey", pubkey,
+		"strike_count", strikeCount,
+		"max_strikes", maxStrikes,
+		"ban_duration", f.cfg.BanDuration,
+		"by_filter", filterName,
+	)
+	info := &store.BanInfo{
+		Reason: fmt.Sprintf("repeated_violations:strikes_%d,last_filter_%s", strikeCount, filterName),
+		Source: autoBanFilterName,
+	}
+	action := journal(ctx, f.store, store.Action{Type: store.ActionBan, PubKey: pubkey, Duration: f.cfg.BanDuration, Ban: info})
+	go f.banUser(ctx, action)
+
+	if f.cfg.BanIP && f.ipBans != nil && ip != "" {
+		ipAction := journal(ctx, f.store, store.Action{
+			Type: store.ActionBanIP, PubKey: pubkey, IP: f.ipBans.Key(ip), Duration: f.cfg.BanDuration, Ban: info,
+		})
+		go f.banUser(ctx, ipAction)
 	}
 }
 
-// banUser performs the ban operation in a separate goroutine.
-func (f *AutoBanFilter) banUser(parentCtx context.Context, pubkey string) {
+// persistStrike counts a strike of pubkey in the store and returns its
+// strikes there, or memoryCount if the store fails.
+func (f *AutoBanFilter) persistStrike(ctx context.Context, pubkey string, memoryCount int) int {
+	count, err := f.store.AddStrike(ctx, pubkey, f.cfg.StrikeWindow)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to persist strike, counting it in memory only", "pubkey", pubkey, "error", err)
+		return memoryCount
+	}
+	return count
+}
+
+// maxStrikes returns the strike limit of pubkey: that of the oldest age tier
+// it qualifies for, or max_strikes. Authors the ledger does not know are new.
+func (f *AutoBanFilter) maxStrikes(pubkey string) int {
+	if len(f.cfg.AgeTiers) == 0 || f.ledger == nil {
+		return f.cfg.MaxStrikes
+	}
+	age := f.ledger.Age(pubkey, time.Now())
+	limit := f.cfg.MaxStrikes
+	for _, tier := range f.cfg.AgeTiers {
+		if age < tier.MinAge {
+			break
+		}
+		limit = tier.MaxStrikes
+	}
+	return limit
+}
+
+// banUser performs the journaled ban of a pubkey or, for ActionBanIP, of
+// its address in a separate goroutine.
+func (f *AutoBanFilter) banUser(parentCtx context.Context, action store.Action) {
+	pubkey := action.PubKey
 	timeout := f.cfg.BanTimeout
 	if timeout <= 0 {
 		timeout = 5 * time.Second
@@ -105,12 +171,25 @@ func (f *AutoBanFilter) banUser(parentCtx context.Context, pubkey string) {
 	banCtx, cancel := context.WithTimeout(parentCtx, timeout)
 	defer cancel()
 
-	if err := f.store.BanAuthor(banCtx, pubkey, f.cfg.BanDuration); err != nil {
+	var err error
+	if action.Type == store.ActionBanIP {
+		err = f.ipBans.Ban(banCtx, action.IP, f.cfg.BanDuration, *action.Ban)
+	} else {
+		err = f.store.BanAuthor(banCtx, pubkey, f.cfg.BanDuration, *action.Ban)
+	}
+	if err != nil {
 		select {
 		case <-banCtx.Done():
-			slog.Warn("Auto-ban cancelled by context", "pubkey", pubkey, "error", banCtx.Err())
+			slog.WarnContext(banCtx, "Auto-ban cancelled by context", "pubkey", pubkey, "ip", action.IP, "error", banCtx.Err())
 		default:
-			slog.Error("Failed to auto-ban author", "pubkey", pubkey, "error", err)
+			slog.ErrorContext(banCtx, "Failed to auto-ban author", "pubkey", pubkey, "ip", action.IP, "error", err)
+		}
+		return
+	}
+	if f.cfg.PersistStrikes && action.Type != store.ActionBanIP {
+		if err := f.store.ClearStrikes(banCtx, pubkey); err != nil {
+			slog.WarnContext(banCtx, "Failed to clear persisted strikes", "pubkey", pubkey, "error", err)
 		}
 	}
+	complete(banCtx, f.store, action)
 }
@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const (
+	banEvasionFilterName = "BanEvasionFilter"
+	maxEvasionCandidates = 100
+)
+
+// EvasionCandidate is a new pubkey whose writing style closely matches a
+// recently banned author.
+type EvasionCandidate struct {
+	PubKey       string    `json:"pubkey"`
+	BannedPubKey string    `json:"banned_pubkey"`
+	Similarity   float64   `json:"similarity"`
+	EventID      string    `json:"event_id"`
+	DetectedAt   time.Time `json:"detected_at"`
+}
+
+type authorStyle struct {
+	sketch    styleSketch
+	firstSeen time.Time
+	reported  bool
+}
+
+// BanEvasionFilter is an experimental, never-rejecting filter that builds
+// stylometric fingerprints of authors and flags new pubkeys whose early posts
+// resemble a recently banned author. Candidates are logged and kept for
+// moderators to review on the admin API; nothing is enforced automatically.
+type BanEvasionFilter struct {
+	mu         sync.Mutex
+	cfg        *config.BanEvasionFilterConfig
+	authors    *lru.LRU[string, *authorStyle]
+	banned     *lru.LRU[string, *styleSketch]
+	candidates []EvasionCandidate
+}
+
+func NewBanEvasionFilter(cfg *config.BanEvasionFilterConfig) (*BanEvasionFilter, error) {
+	if !cfg.Enabled {
+		return &BanEvasionFilter{cfg: cfg}, nil
+	}
+	return &BanEvasionFilter{
+		cfg:     cfg,
+		authors: lru.NewLRU[string, *authorStyle](cfg.ProfileCacheSize, nil, cfg.ProfileTTL),
+		banned:  lru.NewLRU[string, *styleSketch](cfg.BannedCacheSize, nil, cfg.BannedTTL),
+	}, nil
+}
+
+// Prime records when the authors in history were first seen, so established
+// authors are not mistaken for new pubkeys after a restart.
+func (f *BanEvasionFilter) Prime(history []kitpolicy.AuthorHistory) {
+	if !f.cfg.Enabled {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, h := range history {
+		f.authors.Add(h.PubKey, &authorStyle{firstSeen: h.FirstSeen})
+	}
+}
+
+// OnBan snapshots the fingerprint of a freshly banned author. It is meant to
+// be registered as a store.BanListener.
+func (f *BanEvasionFilter) OnBan(pubkey string) {
+	if !f.cfg.Enabled {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	style, ok := f.authors.Get(pubkey)
+	if !ok || style.sketch.chars < f.cfg.MinChars {
+		return
+	}
+	snapshot := style.sketch
+	f.banned.Add(pubkey, &snapshot)
+	f.authors.Remove(pubkey)
+}
+
+// Candidates returns the most recent ban evasion candidates, newest last.
+func (f *BanEvasionFilter) Candidates() []EvasionCandidate {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.candidates)
+}
+
+// EvasionCandidates returns the candidates of the BanEvasionFilter of p, if
+// any, newest last.
+func EvasionCandidates(p *Pipeline) []EvasionCandidate {
+	var candidates []EvasionCandidate
+	eachFilter(p, func(f *BanEvasionFilter) { candidates = append(candidates, f.Candidates()...) })
+	return candidates
+}
+
+func (f *BanEvasionFilter) Match(ctx context.Context, event *nostr.Event, meta map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(banEvasionFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if !slices.Contains(f.cfg.Kinds, event.Kind) {
+		return newResult(true, "kind_not_checked", nil)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	style, ok := f.authors.Get(event.PubKey)
+	if !ok {
+		style = &authorStyle{firstSeen: now}
+	}
+	style.sketch.add(event.Content)
+	f.authors.Add(event.PubKey, style)
+
+	isNew := now.Sub(style.firstSeen) <= f.cfg.NewKeyWindow && style.sketch.posts <= f.cfg.EarlyPosts
+	if !isNew || style.reported || style.sketch.chars < f.cfg.MinChars || f.banned.Len() == 0 {
+		return newResult(true, "no_evasion_check", nil)
+	}
+
+	var (
+		bestKey   string
+		bestScore float64
+	)
+	for _, bannedKey := range f.banned.Keys() {
+		sketch, ok := f.banned.Peek(bannedKey)
+		if !ok || bannedKey == event.PubKey {
+			continue
+		}
+		if score := style.sketch.similarity(sketch); score > bestScore {
+			bestKey, bestScore = bannedKey, score
+		}
+	}
+	if bestScore < f.cfg.SimilarityThreshold {
+		return newResult(true, "no_style_match", nil)
+	}
+
+	style.reported = true
+	candidate := EvasionCandidate{
+		PubKey:       event.PubKey,
+		BannedPubKey: bestKey,
+		Similarity:   bestScore,
+		EventID:      event.ID,
+		DetectedAt:   now,
+	}
+	f.candidates = append(f.candidates, candidate)
+	if len(f.candidates) > maxEvasionCandidates {
+		f.candidates = f.candidates[len(f.candidates)-maxEvasionCandidates:]
+	}
+	slog.WarnContext(ctx, "Possible ban evasion: writing style matches a banned author",
+		"pubkey", event.PubKey,
+		"banned_pubkey", bestKey,
+		"similarity", bestScore,
+		"event_id", event.ID,
+	)
+
+	return newResult(true, "style_matches_banned_author", nil)
+}
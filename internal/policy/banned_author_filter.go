@@ -2,6 +2,7 @@ package policy
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
@@ -23,13 +24,14 @@ const (
 
 type BannedAuthorFilter struct {
 	store store.Store
-	cache *lru.LRU[string, bool]
+	// cache holds the ban of each looked up pubkey, nil if not banned.
+	cache *lru.LRU[string, *store.BanInfo]
 	sf    singleflight.Group
 	cfg   *config.BannedAuthorFilterConfig
 }
 
 func NewBannedAuthorFilter(s store.Store, cfg *config.BannedAuthorFilterConfig) (*BannedAuthorFilter, error) {
-	cache := lru.NewLRU[string, bool](defaultCacheSize, nil, defaultCacheTTL)
+	cache := lru.NewLRU[string, *store.BanInfo](defaultCacheSize, nil, defaultCacheTTL)
 	return &BannedAuthorFilter{
 		store: s,
 		cache: cache,
@@ -37,29 +39,57 @@ func NewBannedAuthorFilter(s store.Store, cfg *config.BannedAuthorFilterConfig)
 	}, nil
 }
 
-func (f *BannedAuthorFilter) isBanned(ctx context.Context, pubkey string) (bool, error) {
+// IsBanned reports whether pubkey is banned, using the filter's lookup cache.
+func (f *BannedAuthorFilter) IsBanned(ctx context.Context, pubkey string) (bool, error) {
+	ban, err := f.ban(ctx, pubkey)
+	return ban != nil, err
+}
+
+// ban returns the ban of pubkey, or nil if it is not banned.
+func (f *BannedAuthorFilter) ban(ctx context.Context, pubkey string) (*store.BanInfo, error) {
 	normalizedPubkey := strings.ToLower(pubkey)
 
-	if isBanned, ok := f.cache.Get(normalizedPubkey); ok {
-		return isBanned, nil
+	if ban, ok := f.cache.Get(normalizedPubkey); ok {
+		return ban, nil
 	}
 
 	v, err, _ := f.sf.Do(normalizedPubkey, func() (any, error) {
-		if isBanned, ok := f.cache.Get(normalizedPubkey); ok {
-			return isBanned, nil
+		if ban, ok := f.cache.Get(normalizedPubkey); ok {
+			return ban, nil
 		}
+		// Most pubkeys are not banned; only fetch the details of bans.
 		isBanned, err := f.store.IsAuthorBanned(ctx, normalizedPubkey)
 		if err != nil {
-			return false, err
+			return nil, err
+		}
+		var ban *store.BanInfo
+		if isBanned {
+			if ban, err = f.store.GetBanInfo(ctx, normalizedPubkey); err != nil {
+				return nil, err
+			}
+			if ban == nil {
+				ban = &store.BanInfo{}
+			}
 		}
-		f.cache.Add(normalizedPubkey, isBanned)
-		return isBanned, nil
+		f.cache.Add(normalizedPubkey, ban)
+		return ban, nil
 	})
 
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return v.(bool), nil
+	return v.(*store.BanInfo), nil
+}
+
+// banResult rejects with reason, exposing the ban details to [messages]
+// templates.
+func banResult(newResult func(bool, string, error) (kitpolicy.FilterResult, error), reason string, ban *store.BanInfo) (kitpolicy.FilterResult, error) {
+	res, err := newResult(false, reason, nil)
+	res.Values = map[string]any{"reason": ban.Reason, "source": ban.Source}
+	if !ban.ExpiresAt.IsZero() {
+		res.Values["expires_at"] = ban.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return res, err
 }
 
 func (f *BannedAuthorFilter) Match(ctx context.Context, event *nostr.Event, meta map[string]any) (kitpolicy.FilterResult, error) {
@@ -69,28 +99,42 @@ func (f *BannedAuthorFilter) Match(ctx context.Context, event *nostr.Event, meta
 		return newResult(false, "invalid_event", nil)
 	}
 
-	banned, err := f.isBanned(ctx, event.PubKey)
+	ban, err := f.ban(ctx, event.PubKey)
 	if err != nil {
 		return newResult(false, "internal_author_check_failed", err)
 	}
-	if banned {
-		return newResult(false, "author_banned", nil)
+	if ban != nil {
+		return banResult(newResult, "author_banned", ban)
 	}
 
 	if f.cfg != nil && f.cfg.CheckNIP26 {
 		if delegationTag := event.Tags.Find("delegation"); delegationTag != nil {
-			delegator, err := nip.ValidateDelegation(event)
+			delegation, err := nip.ParseDelegation(event)
 			if err != nil {
 				return newResult(false, "invalid_delegation", nil)
 			}
+			if reason := f.delegationPolicyViolation(delegation.Conditions); reason != "" {
+				return newResult(false, reason, nil)
+			}
 
-			if delegator != "" {
-				banned, err := f.isBanned(ctx, delegator)
+			if delegator := delegation.Delegator; delegator != "" {
+				ban, err := f.ban(ctx, delegator)
 				if err != nil {
 					return newResult(false, "internal_delegator_check_failed", err)
 				}
-				if banned {
-					return newResult(false, "delegator_banned", nil)
+				if ban != nil {
+					return banResult(newResult, "delegator_banned", ban)
+				}
+				ttl := f.delegateeTTL(delegation.Conditions)
+				if f.cfg.MaxDelegateesPerAuthor > 0 && ttl > 0 && !SideEffectsSuppressed(ctx) {
+					ok, err := f.store.AddDelegatee(ctx, delegator, event.PubKey, ttl, f.cfg.MaxDelegateesPerAuthor)
+					if err != nil {
+						return newResult(false, "internal_delegatee_check_failed", err)
+					}
+					if !ok {
+						reason := fmt.Sprintf("too_many_delegatees:limit_%d", f.cfg.MaxDelegateesPerAuthor)
+						return newResult(false, reason, nil)
+					}
 				}
 			}
 		}
@@ -98,3 +142,30 @@ func (f *BannedAuthorFilter) Match(ctx context.Context, event *nostr.Event, meta
 
 	return newResult(true, "author_not_banned", nil)
 }
+
+// delegationPolicyViolation checks a valid delegation against the operator's
+// delegation policy and returns the rejection reason, if any.
+func (f *BannedAuthorFilter) delegationPolicyViolation(c nip.DelegationConditions) string {
+	if f.cfg.RequireKindConditions && len(c.Kinds) == 0 {
+		return "delegation_without_kind_conditions"
+	}
+	if (f.cfg.RequireTimeBounds || f.cfg.MaxDelegationWindow > 0) && !c.Bounded() {
+		return "delegation_without_time_bounds"
+	}
+	if f.cfg.MaxDelegationWindow > 0 {
+		if window := time.Duration(c.Until-c.Since) * time.Second; window > f.cfg.MaxDelegationWindow {
+			return fmt.Sprintf("delegation_window_too_long:window_%s,max_%s", window, f.cfg.MaxDelegationWindow)
+		}
+	}
+	return ""
+}
+
+// delegateeTTL is how long a delegatee stays active: until its delegation
+// expires, or delegatee_ttl for delegations without an upper bound. It is not
+// positive for delegations that have already expired.
+func (f *BannedAuthorFilter) delegateeTTL(c nip.DelegationConditions) time.Duration {
+	if c.Until > 0 {
+		return time.Until(time.Unix(c.Until, 0))
+	}
+	return f.cfg.DelegateeTTL
+}
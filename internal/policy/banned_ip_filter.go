@@ -0,0 +1,90 @@
+package policy
+
+import (
+	"context"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+const bannedIPFilterName = "BannedIPFilter"
+
+// BannedIPFilter rejects events submitted from banned addresses or networks,
+// normalized to the configured prefixes the same way as by EmergencyFilter.
+type BannedIPFilter struct {
+	store store.Store
+	cache *lru.LRU[string, bool]
+	sf    singleflight.Group
+	cfg   *config.BannedIPFilterConfig
+}
+
+func NewBannedIPFilter(s store.Store, cfg *config.BannedIPFilterConfig) (*BannedIPFilter, error) {
+	return &BannedIPFilter{
+		store: s,
+		cache: lru.NewLRU[string, bool](defaultCacheSize, nil, defaultCacheTTL),
+		cfg:   cfg,
+	}, nil
+}
+
+// Key is the normalized form under which bans of ip are recorded.
+func (f *BannedIPFilter) Key(ip string) string {
+	return kitpolicy.NormalizeIP(ip, f.cfg.IPv4Prefix, f.cfg.IPv6Prefix)
+}
+
+// Ban bans the address or network of ip for duration.
+func (f *BannedIPFilter) Ban(ctx context.Context, ip string, duration time.Duration, info store.BanInfo) error {
+	key := f.Key(ip)
+	if err := f.store.BanIP(ctx, key, duration, info); err != nil {
+		return err
+	}
+	f.cache.Add(key, true)
+	return nil
+}
+
+func (f *BannedIPFilter) isBanned(ctx context.Context, key string) (bool, error) {
+	if banned, ok := f.cache.Get(key); ok {
+		return banned, nil
+	}
+	v, err, _ := f.sf.Do(key, func() (any, error) {
+		banned, err := f.store.IsIPBanned(ctx, key)
+		if err != nil {
+			return false, err
+		}
+		f.cache.Add(key, banned)
+		return banned, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+func (f *BannedIPFilter) Match(ctx context.Context, event *nostr.Event, meta map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(bannedIPFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	remoteIP, _ := meta["remote_ip"].(string)
+	if remoteIP == "" {
+		return newResult(true, "no_remote_ip", nil)
+	}
+
+	key := f.Key(remoteIP)
+	banned, err := f.isBanned(ctx, key)
+	if err != nil {
+		return newResult(false, "internal_ip_check_failed", err)
+	}
+	if banned {
+		res, err := newResult(false, "ip_banned", nil)
+		res.Values = map[string]any{"ip": key}
+		return res, err
+	}
+	return newResult(true, "ip_not_banned", nil)
+}
@@ -0,0 +1,133 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const (
+	bannedReferenceFilterName = "BannedReferenceFilter"
+	defaultMaxPubKeyChecks    = 20
+)
+
+// defaultPromoPatterns are used when require_promo is set without explicit patterns.
+var defaultPromoPatterns = []string{
+	`(?i)\b(follow|check\s+out|subscribe|support|zap|boost|repost)\b`,
+	`https?://`,
+}
+
+// BanChecker answers whether a pubkey is currently banned.
+type BanChecker interface {
+	IsBanned(ctx context.Context, pubkey string) (bool, error)
+}
+
+// BannedReferenceFilter catches "ban evasion by proxy promotion": events that
+// tag or mention a banned pubkey, optionally only when the content looks
+// promotional. Depending on config it rejects them or just issues a strike.
+type BannedReferenceFilter struct {
+	cfg       *config.BannedReferenceFilterConfig
+	bans      BanChecker
+	promoRegs []*regexp.Regexp
+	maxChecks int
+}
+
+func NewBannedReferenceFilter(bans BanChecker, cfg *config.BannedReferenceFilterConfig) (*BannedReferenceFilter, error) {
+	filter := &BannedReferenceFilter{cfg: cfg, bans: bans}
+	if !cfg.Enabled {
+		return filter, nil
+	}
+
+	if cfg.RequirePromo {
+		patterns := cfg.PromoPatterns
+		if len(patterns) == 0 {
+			patterns = defaultPromoPatterns
+		}
+		for _, p := range patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile promo pattern '%s': %w", p, err)
+			}
+			filter.promoRegs = append(filter.promoRegs, re)
+		}
+	}
+
+	filter.maxChecks = cfg.MaxPubKeyChecks
+	if filter.maxChecks <= 0 {
+		filter.maxChecks = defaultMaxPubKeyChecks
+	}
+	return filter, nil
+}
+
+func (f *BannedReferenceFilter) Match(ctx context.Context, event *nostr.Event, meta map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(bannedReferenceFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if len(f.cfg.Kinds) > 0 && !slices.Contains(f.cfg.Kinds, event.Kind) {
+		return newResult(true, "kind_not_checked", nil)
+	}
+	if f.promoRegs != nil && !f.looksPromotional(event.Content) {
+		return newResult(true, "not_promotional", nil)
+	}
+
+	candidates := f.referencedPubKeys(event, meta)
+	for _, pk := range candidates {
+		banned, err := f.bans.IsBanned(ctx, pk)
+		if err != nil {
+			return newResult(false, "internal_reference_check_failed", err)
+		}
+		if !banned {
+			continue
+		}
+
+		reason := fmt.Sprintf("banned_pubkey_referenced:'%s'", pk)
+		if f.cfg.Action == config.BannedReferenceStrike {
+			res, err := newResult(true, reason, nil)
+			res.Strike = true
+			return res, err
+		}
+		return newResult(false, reason, nil)
+	}
+
+	return newResult(true, "no_banned_references", nil)
+}
+
+// referencedPubKeys collects distinct pubkeys from "p" tags and, if enabled,
+// from nostr: mentions in content, capped to bound store lookups.
+func (f *BannedReferenceFilter) referencedPubKeys(event *nostr.Event, meta map[string]any) []string {
+	var pks []string
+	add := func(pk string) {
+		if pk != event.PubKey && len(pks) < f.maxChecks && !slices.Contains(pks, pk) {
+			pks = append(pks, pk)
+		}
+	}
+
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "p" && nostr.IsValidPublicKey(tag[1]) {
+			add(tag[1])
+		}
+	}
+	if f.cfg.CheckMentions {
+		for _, pk := range kitpolicy.ContentEntities(event, meta).PubKeys {
+			add(pk)
+		}
+	}
+	return pks
+}
+
+func (f *BannedReferenceFilter) looksPromotional(content string) bool {
+	for _, re := range f.promoRegs {
+		if re.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package policy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+const (
+	blocklistFilterName = "BlocklistFilter"
+	// blocklistScanTimeout bounds the lookup of a blocked event's content in
+	// the strfry database.
+	blocklistScanTimeout = 10 * time.Second
+)
+
+// EventBlockKey is the blocklist key of the event id.
+func EventBlockKey(id string) string {
+	return store.BlockedEventPrefix + strings.ToLower(id)
+}
+
+// ContentBlockKey is the blocklist key of every event with content.
+func ContentBlockKey(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return store.BlockedContentPrefix + hex.EncodeToString(sum[:])
+}
+
+// BlocklistFilter rejects events whose ID or exact content is blocked, such
+// as a viral spam payload re-broadcast from many keys. Entries are listed in
+// the config or blocked at runtime, which keeps them in the database.
+type BlocklistFilter struct {
+	cfg     *config.BlocklistFilterConfig
+	store   store.Store
+	scanner EventScanner
+	listed  map[string]struct{}
+	cache   *lru.LRU[string, bool]
+	sf      singleflight.Group
+}
+
+// NewBlocklistFilter creates a BlocklistFilter; scanner finds the content of
+// events blocked by ID.
+func NewBlocklistFilter(cfg *config.BlocklistFilterConfig, s store.Store, scanner EventScanner) (*BlocklistFilter, error) {
+	f := &BlocklistFilter{
+		cfg:     cfg,
+		store:   s,
+		scanner: scanner,
+		listed:  make(map[string]struct{}, len(cfg.EventIDs)+len(cfg.ContentHashes)),
+		cache:   lru.NewLRU[string, bool](defaultCacheSize, nil, defaultCacheTTL),
+	}
+	for _, id := range cfg.EventIDs {
+		f.listed[EventBlockKey(id)] = struct{}{}
+	}
+	for _, hash := range cfg.ContentHashes {
+		f.listed[store.BlockedContentPrefix+hash] = struct{}{}
+	}
+	return f, nil
+}
+
+func (f *BlocklistFilter) Match(ctx context.Context, event *nostr.Event, _ map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(blocklistFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+
+	keys := []string{EventBlockKey(event.ID)}
+	// Empty content is too common to block.
+	if event.Content != "" {
+		keys = append(keys, ContentBlockKey(event.Content))
+	}
+	for _, key := range keys {
+		blocked, err := f.isBlocked(ctx, key)
+		if err != nil {
+			return newResult(false, "internal_blocklist_check_failed", err)
+		}
+		if blocked {
+			reason := "event_blocked"
+			if strings.HasPrefix(key, store.BlockedContentPrefix) {
+				reason = "content_blocked"
+			}
+			res, err := newResult(false, reason, nil)
+			res.Values = map[string]any{"key": key}
+			return res, err
+		}
+	}
+	return newResult(true, "not_blocked", nil)
+}
+
+func (f *BlocklistFilter) isBlocked(ctx context.Context, key string) (bool, error) {
+	if _, ok := f.listed[key]; ok {
+		return true, nil
+	}
+	if blocked, ok := f.cache.Get(key); ok {
+		return blocked, nil
+	}
+	v, err, _ := f.sf.Do(key, func() (any, error) {
+		blocked, err := f.store.IsBlocked(ctx, key)
+		if err != nil {
+			return false, err
+		}
+		f.cache.Add(key, blocked)
+		return blocked, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+// BlockEvent blocks the event id for duration and, if the event is found in
+// the strfry database, its content too. It returns the keys blocked.
+func (f *BlocklistFilter) BlockEvent(ctx context.Context, id string, duration time.Duration, info store.BanInfo) ([]string, error) {
+	keys := []string{EventBlockKey(id)}
+	if content, err := f.contentOf(ctx, id); err != nil {
+		slog.WarnContext(ctx, "Failed to look up the content of a blocked event, blocking its ID only", "event_id", id, "error", err)
+	} else if content != "" {
+		keys = append(keys, ContentBlockKey(content))
+	}
+	for _, key := range keys {
+		if err := f.Block(ctx, key, duration, info); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// Block adds key to the blocklist for duration.
+func (f *BlocklistFilter) Block(ctx context.Context, key string, duration time.Duration, info store.BanInfo) error {
+	if err := f.store.Block(ctx, key, duration, info); err != nil {
+		return err
+	}
+	f.cache.Add(key, true)
+	return nil
+}
+
+// contentOf returns the content of the stored event id, or "" if it is not
+// stored.
+func (f *BlocklistFilter) contentOf(ctx context.Context, id string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, blocklistScanTimeout)
+	defer cancel()
+	events, err := f.scanner.ScanEvents(ctx, nostr.Filter{IDs: []string{id}})
+	if err != nil {
+		return "", err
+	}
+	for _, ev := range events {
+		if ev.ID == id {
+			return ev.Content, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,139 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// Canary outcomes, comparing the candidate's decision with the live one.
+const (
+	CanaryMatch          = "match"
+	CanaryAcceptToReject = "accept_to_reject" // Live accepts, the candidate rejects.
+	CanaryRejectToAccept = "reject_to_accept" // Live rejects, the candidate accepts.
+	CanaryMessage        = "message"          // Both reject, with different messages.
+	CanarySkipped        = "skipped"          // The candidate was saturated.
+)
+
+var canaryOutcomes = []string{CanaryMatch, CanaryAcceptToReject, CanaryRejectToAccept, CanaryMessage, CanarySkipped}
+
+// CanaryStats counts canary outcomes. It outlives the pipelines, so the
+// counts carry over reloads.
+type CanaryStats struct {
+	mu       sync.Mutex
+	outcomes map[string]uint64
+}
+
+func NewCanaryStats() *CanaryStats {
+	return &CanaryStats{outcomes: make(map[string]uint64)}
+}
+
+func (s *CanaryStats) add(outcome string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outcomes[outcome]++
+}
+
+// Counts returns the events seen for each outcome.
+func (s *CanaryStats) Counts() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]uint64, len(canaryOutcomes))
+	for _, o := range canaryOutcomes {
+		counts[o] = s.outcomes[o]
+	}
+	return counts
+}
+
+// WriteMetrics writes the counts in the OpenMetrics text format.
+func (s *CanaryStats) WriteMetrics(w io.Writer) {
+	counts := s.Counts()
+	fmt.Fprintln(w, "# TYPE adresu_canary_events counter")
+	fmt.Fprintln(w, "# HELP adresu_canary_events Events judged by the canary config, by comparison with the live decision.")
+	for _, o := range canaryOutcomes {
+		fmt.Fprintf(w, "adresu_canary_events_total{outcome=%q} %d\n", o, counts[o])
+	}
+}
+
+// ServeHTTP returns the counts as JSON.
+func (s *CanaryStats) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Counts())
+}
+
+// Canary judges events with a candidate pipeline in the background, without
+// side effects, and compares its decisions with the live ones, so a policy
+// rewrite can be validated on real traffic before it is put in place.
+type Canary struct {
+	candidate  *Pipeline
+	stats      *CanaryStats
+	sampleRate float64
+	slots      chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewCanary creates a canary around candidate, which it closes on Close.
+func NewCanary(candidate *Pipeline, stats *CanaryStats, cfg *config.CanaryConfig) *Canary {
+	return &Canary{
+		candidate:  candidate,
+		stats:      stats,
+		sampleRate: cfg.LogSampleRate,
+		slots:      make(chan struct{}, max(cfg.MaxInFlight, 1)),
+	}
+}
+
+// Shadow has the candidate judge event, which the live pipeline answered
+// with live, unless the candidate is saturated.
+func (c *Canary) Shadow(ctx context.Context, event *nostr.Event, remoteIP string, live PolicyResponse) {
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		c.stats.add(CanarySkipped)
+		return
+	}
+	// The event's context ends with its answer; the candidate runs past it.
+	ctx = WithoutSideEffects(context.WithoutCancel(ctx))
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer func() { <-c.slots }()
+
+		candidate, _ := c.candidate.ProcessEvent(ctx, event, remoteIP, false)
+		outcome := compareDecisions(live, candidate)
+		c.stats.add(outcome)
+		if outcome != CanaryMatch && rand.Float64() < c.sampleRate {
+			slog.InfoContext(ctx, "Canary config diverged from the live config", "outcome", outcome,
+				"event_id", event.ID, "pubkey", event.PubKey, "kind", event.Kind,
+				"live_action", live.Action, "live_msg", live.Msg,
+				"canary_action", candidate.Action, "canary_msg", candidate.Msg)
+		}
+	}()
+}
+
+func compareDecisions(live, candidate PolicyResponse) string {
+	switch {
+	case live.Action == candidate.Action && (live.Action != "reject" || live.Msg == candidate.Msg):
+		return CanaryMatch
+	case live.Action == candidate.Action:
+		return CanaryMessage
+	case candidate.Action == "reject":
+		return CanaryAcceptToReject
+	default:
+		return CanaryRejectToAccept
+	}
+}
+
+// Close waits for the events being judged and closes the candidate.
+func (c *Canary) Close() error {
+	c.wg.Wait()
+	return c.candidate.Close()
+}
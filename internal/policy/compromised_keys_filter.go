@@ -0,0 +1,180 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/schedule"
+)
+
+const (
+	compromisedKeysFilterName = "CompromisedKeysFilter"
+	// maxCompromisedFeedSize bounds the download of one feed.
+	maxCompromisedFeedSize = 64 << 20
+)
+
+// CompromisedKeysFilter rejects events signed with keys whose secret key has
+// leaked, since anyone may be publishing with them. The keys are listed by
+// files and URLs, all reloaded every refresh_interval; a source that fails to
+// load keeps its previous keys. URLs are first fetched in the background, so
+// their keys only count once downloaded.
+type CompromisedKeysFilter struct {
+	cfg *config.CompromisedKeysFilterConfig
+
+	mu sync.RWMutex
+	// bySource holds the keys of each source that loaded; keys is their union.
+	bySource map[string]map[string]struct{}
+	keys     map[string]struct{}
+
+	// unschedule removes the refresh job.
+	unschedule func()
+}
+
+func NewCompromisedKeysFilter(cfg *config.CompromisedKeysFilterConfig, sched *schedule.Scheduler) (*CompromisedKeysFilter, error) {
+	f := &CompromisedKeysFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	f.bySource = make(map[string]map[string]struct{}, len(cfg.Sources))
+	// Files are read up front, so that a wrong path fails the build.
+	for _, src := range cfg.Sources {
+		if isURL(src) {
+			continue
+		}
+		keys, err := readCompromisedFile(src)
+		if err != nil {
+			return nil, err
+		}
+		f.bySource[src] = keys
+	}
+	f.merge()
+
+	// The files were just read; only the URLs are due at first.
+	urlsOnly := true
+	f.unschedule = sched.Add(schedule.Job{
+		Name:     config.JobCompromisedKeysRefresh,
+		Schedule: schedule.Every(cfg.RefreshInterval),
+		Run: func(ctx context.Context) error {
+			err := f.refresh(ctx, urlsOnly)
+			urlsOnly = false
+			return err
+		},
+		Immediately: true,
+	})
+	return f, nil
+}
+
+func (f *CompromisedKeysFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(compromisedKeysFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	f.mu.RLock()
+	_, compromised := f.keys[event.PubKey]
+	f.mu.RUnlock()
+	if !compromised {
+		return newResult(true, "key_not_compromised", nil)
+	}
+	return kitpolicy.ActionResult(newResult, f.cfg.Action, "compromised_key")
+}
+
+// Close removes the refresh job.
+func (f *CompromisedKeysFilter) Close() error {
+	if f.unschedule != nil {
+		f.unschedule()
+	}
+	return nil
+}
+
+// refresh reloads every source, or only the URLs. A source that fails to
+// load keeps its previous keys.
+func (f *CompromisedKeysFilter) refresh(ctx context.Context, urlsOnly bool) error {
+	changed := false
+	var errs []error
+	for _, src := range f.cfg.Sources {
+		var keys map[string]struct{}
+		var err error
+		switch {
+		case isURL(src):
+			keys, err = f.fetch(ctx, src)
+		case urlsOnly:
+			continue
+		default:
+			keys, err = readCompromisedFile(src)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load compromised keys from %s, keeping the previous ones: %w", src, err))
+			continue
+		}
+		f.mu.Lock()
+		f.bySource[src] = keys
+		f.mu.Unlock()
+		changed = true
+	}
+	if changed {
+		f.merge()
+	}
+	return errors.Join(errs...)
+}
+
+// merge recomputes the union of the sources' keys.
+func (f *CompromisedKeysFilter) merge() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make(map[string]struct{})
+	for _, srcKeys := range f.bySource {
+		for pk := range srcKeys {
+			keys[pk] = struct{}{}
+		}
+	}
+	f.keys = keys
+	slog.Info("Compromised keys loaded", "sources", len(f.bySource), "pubkeys", len(keys))
+}
+
+// fetch downloads the feed at url.
+func (f *CompromisedKeysFilter) fetch(parent context.Context, url string) (map[string]struct{}, error) {
+	ctx, cancel := context.WithTimeout(parent, f.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return parsePubKeyList(io.LimitReader(resp.Body, maxCompromisedFeedSize), url)
+}
+
+func readCompromisedFile(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open compromised keys file: %w", err)
+	}
+	defer file.Close()
+	keys, err := parsePubKeyList(file, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compromised keys file: %w", err)
+	}
+	return keys, nil
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
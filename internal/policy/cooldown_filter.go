@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	kitconfig "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const (
+	cooldownFilterName = "CooldownFilter"
+)
+
+// CooldownFilter enforces the cooldowns in the shared registry. It runs at
+// the top of the pipeline, so authors on cooldown are turned away before any
+// expensive check.
+type CooldownFilter struct {
+	cooldowns *kitpolicy.Cooldowns
+	cfg       *config.CooldownFilterConfig
+}
+
+func NewCooldownFilter(cooldowns *kitpolicy.Cooldowns, cfg *config.CooldownFilterConfig) (*CooldownFilter, error) {
+	return &CooldownFilter{cooldowns: cooldowns, cfg: cfg}, nil
+}
+
+func (f *CooldownFilter) Match(_ context.Context, event *nostr.Event, meta map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(cooldownFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+
+	remoteIP, _ := meta["remote_ip"].(string)
+	pubkey, ip := cooldownTargets(f.cfg.By, event.PubKey, remoteIP)
+	cd, ok := f.cooldowns.Active(pubkey, ip)
+	if !ok {
+		return newResult(true, "no_cooldown", nil)
+	}
+
+	retryAfter := int(math.Ceil(time.Until(cd.Until).Seconds()))
+	res, err := newResult(false, fmt.Sprintf("cooldown_active:retry_after_%ds", retryAfter), nil)
+	res.Values = map[string]any{"retry_after": retryAfter, "cause": cd.Reason}
+	return res, err
+}
+
+// share exposes the registry to filters through meta, so they can impose
+// cooldowns of their own.
+func (f *CooldownFilter) share(meta map[string]any) {
+	if f.cfg.Enabled {
+		meta[kitpolicy.MetaKeyCooldowns] = f.cooldowns
+	}
+}
+
+// OnReject imposes the cooldown configured for the rejecting filter.
+func (f *CooldownFilter) OnReject(event *nostr.Event, remoteIP string, res kitpolicy.FilterResult) {
+	if !f.cfg.Enabled || res.Filter == cooldownFilterName {
+		return
+	}
+	d, ok := f.cfg.OnReject[res.Filter]
+	if !ok {
+		return
+	}
+	pubkey, ip := cooldownTargets(f.cfg.By, event.PubKey, remoteIP)
+	f.cooldowns.Impose(pubkey, ip, d, res.Filter)
+}
+
+// cooldownTargets selects which of pubkey and ip a cooldown applies to.
+func cooldownTargets(by kitconfig.RateLimiterBy, pubkey, ip string) (string, string) {
+	switch by {
+	case kitconfig.RateByIP:
+		return "", ip
+	case kitconfig.RateByPubKey:
+		return pubkey, ""
+	default:
+		return pubkey, ip
+	}
+}
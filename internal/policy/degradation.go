@@ -0,0 +1,201 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// degradationLevel is the set of filters skipped at one step of the ladder.
+type degradationLevel struct {
+	step int // 1-based.
+	skip map[string]struct{}
+	only map[string]struct{} // nil runs every filter not skipped.
+}
+
+func (l *degradationLevel) skips(name string) bool {
+	if _, ok := l.skip[name]; ok {
+		return true
+	}
+	if l.only != nil {
+		_, ok := l.only[name]
+		return !ok
+	}
+	return false
+}
+
+// filter returns the stages of group still run at this level.
+func (l *degradationLevel) filter(group []PipelineStage) []PipelineStage {
+	var kept []PipelineStage
+	for _, stage := range group {
+		if !l.skips(stage.Name) {
+			kept = append(kept, stage)
+		}
+	}
+	return kept
+}
+
+// Degrader walks the configured degradation ladder, driven by the plugin's
+// own CPU use and average decision latency, so that under load it sheds the
+// filters the operator chose instead of falling behind.
+type Degrader struct {
+	cfg     *config.DegradationConfig
+	levels  []*degradationLevel
+	current atomic.Pointer[degradationLevel] // nil at full service.
+
+	latencySum atomic.Int64 // Nanoseconds, since the last sample.
+	decisions  atomic.Int64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDegrader starts sampling load. It returns nil when degradation is
+// disabled; a nil Degrader never skips anything.
+func NewDegrader(cfg *config.DegradationConfig) *Degrader {
+	if !cfg.Enabled {
+		return nil
+	}
+	d := &Degrader{cfg: cfg}
+	skip := make(map[string]struct{})
+	var only map[string]struct{}
+	for i, step := range cfg.Steps {
+		for _, name := range step.Skip {
+			skip[name] = struct{}{}
+		}
+		if len(step.Only) > 0 {
+			next := make(map[string]struct{}, len(step.Only))
+			for _, name := range step.Only {
+				// A lower step's Only still applies.
+				if _, ok := only[name]; ok || only == nil {
+					next[name] = struct{}{}
+				}
+			}
+			only = next
+		}
+		d.levels = append(d.levels, &degradationLevel{step: i + 1, skip: maps.Clone(skip), only: only})
+	}
+
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	d.wg.Add(1)
+	go d.run(ctx)
+	return d
+}
+
+// level returns the current degradation level, nil at full service.
+func (d *Degrader) level() *degradationLevel {
+	if d == nil {
+		return nil
+	}
+	return d.current.Load()
+}
+
+// Observe records the latency of one decision.
+func (d *Degrader) Observe(latency time.Duration) {
+	d.latencySum.Add(int64(latency))
+	d.decisions.Add(1)
+}
+
+// Close stops sampling.
+func (d *Degrader) Close() error {
+	if d == nil {
+		return nil
+	}
+	d.cancel()
+	d.wg.Wait()
+	return nil
+}
+
+func (d *Degrader) run(ctx context.Context) {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	lastCPU, cpuOK := processCPUTime()
+	last := time.Now()
+	var calmSince time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		cpu := -1.0 // Unknown.
+		if t, ok := processCPUTime(); ok && cpuOK {
+			cpu = float64(t-lastCPU) / (float64(now.Sub(last)) * float64(runtime.GOMAXPROCS(0)))
+			lastCPU = t
+		}
+		last = now
+		var latency time.Duration
+		if n := d.decisions.Swap(0); n > 0 {
+			latency = time.Duration(d.latencySum.Swap(0) / n)
+		}
+
+		calmSince = d.adjust(cpu, latency, now, calmSince)
+	}
+}
+
+// adjust moves to the step the load calls for: up at once, down one step at
+// a time after RecoverAfter below the current step. It returns when the load
+// last dropped below the current step, zero if it has not.
+func (d *Degrader) adjust(cpu float64, latency time.Duration, now, calmSince time.Time) time.Time {
+	target := 0
+	for i := len(d.cfg.Steps) - 1; i >= 0; i-- {
+		step := d.cfg.Steps[i]
+		if (step.CPU > 0 && cpu >= step.CPU) || (step.Latency > 0 && latency >= step.Latency) {
+			target = i + 1
+			break
+		}
+	}
+	current := 0
+	if l := d.current.Load(); l != nil {
+		current = l.step
+	}
+
+	switch {
+	case target > current:
+		d.set(target, cpu, latency)
+		return time.Time{}
+	case target == current:
+		return time.Time{}
+	case calmSince.IsZero():
+		return now
+	case now.Sub(calmSince) >= d.cfg.RecoverAfter:
+		d.set(current-1, cpu, latency)
+		return now
+	}
+	return calmSince
+}
+
+func (d *Degrader) set(step int, cpu float64, latency time.Duration) {
+	if step == 0 {
+		d.current.Store(nil)
+		slog.Info("Load recovered, running all filters", "cpu", cpu, "latency", latency)
+		return
+	}
+	l := d.levels[step-1]
+	d.current.Store(l)
+	slog.Warn("Load degradation step changed",
+		"step", step, "description", d.cfg.Steps[step-1].Description, "cpu", cpu, "latency", latency,
+		"skipped", slices.Sorted(maps.Keys(l.skip)), "only", slices.Sorted(maps.Keys(l.only)))
+}
+
+// processCPUTime returns the user and system CPU time used by the process.
+func processCPUTime() (time.Duration, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, false
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
@@ -0,0 +1,169 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const dnsblFilterName = "DNSBLFilter"
+
+var (
+	// dnsblListed holds the answers of a listed address.
+	dnsblListed = netip.MustParsePrefix("127.0.0.0/8")
+	// dnsblRefused holds the answers Spamhaus-style blocklists give when they
+	// refuse to answer, e.g. queries through public resolvers; these do not
+	// mean that the address is listed.
+	dnsblRefused = netip.MustParsePrefix("127.255.255.0/24")
+)
+
+// DNSBLFilter checks the address an event is submitted from against DNS
+// blocklists, querying all zones at once within the timeout. Results are
+// cached per address; lookups that fail count as not listed and are not
+// cached.
+type DNSBLFilter struct {
+	cfg      *config.DNSBLFilterConfig
+	resolver *net.Resolver
+	// cache maps addresses to the first zone listing them, or "".
+	cache *lru.LRU[string, string]
+	sf    singleflight.Group
+}
+
+func NewDNSBLFilter(cfg *config.DNSBLFilterConfig) (*DNSBLFilter, error) {
+	f := &DNSBLFilter{cfg: cfg, resolver: net.DefaultResolver}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	if cfg.Resolver != "" {
+		f.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, cfg.Resolver)
+			},
+		}
+	}
+	f.cache = lru.NewLRU[string, string](cfg.CacheSize, nil, cfg.CacheTTL)
+	return f, nil
+}
+
+func (f *DNSBLFilter) Match(ctx context.Context, event *nostr.Event, meta map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(dnsblFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	remoteIP, _ := meta["remote_ip"].(string)
+	if remoteIP == "" {
+		return newResult(true, "no_remote_ip", nil)
+	}
+	addr, err := netip.ParseAddr(remoteIP)
+	if err != nil {
+		return newResult(true, "invalid_remote_ip", nil)
+	}
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return newResult(true, "ip_not_public", nil)
+	}
+
+	zone, err := f.listedIn(ctx, addr)
+	if err != nil {
+		slog.WarnContext(ctx, "DNSBL lookup failed, treating the address as not listed", "ip", addr, "error", err)
+		return newResult(true, "dnsbl_lookup_failed", nil)
+	}
+	if zone == "" {
+		return newResult(true, "ip_not_listed", nil)
+	}
+	res, err := kitpolicy.ActionResult(newResult, f.cfg.Action, "ip_listed_in_dnsbl:"+zone)
+	res.Values = map[string]any{"zone": zone, "ip": addr.String()}
+	return res, err
+}
+
+// listedIn returns the first zone, in the configured order, that lists addr,
+// or "" if none does.
+func (f *DNSBLFilter) listedIn(ctx context.Context, addr netip.Addr) (string, error) {
+	key := addr.String()
+	if zone, ok := f.cache.Get(key); ok {
+		return zone, nil
+	}
+	v, err, _ := f.sf.Do(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(ctx, f.cfg.Timeout)
+		defer cancel()
+
+		name := dnsblName(addr)
+		listed := make([]bool, len(f.cfg.Zones))
+		errs := make([]error, len(f.cfg.Zones))
+		var wg sync.WaitGroup
+		for i, zone := range f.cfg.Zones {
+			wg.Go(func() {
+				listed[i], errs[i] = f.lookup(ctx, name+"."+zone+".")
+			})
+		}
+		wg.Wait()
+
+		for i, zone := range f.cfg.Zones {
+			if listed[i] {
+				f.cache.Add(key, zone)
+				return zone, nil
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			return "", err
+		}
+		f.cache.Add(key, "")
+		return "", nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// lookup reports whether the DNSBL query name resolves to a listing.
+func (f *DNSBLFilter) lookup(ctx context.Context, name string) (bool, error) {
+	answers, err := f.resolver.LookupNetIP(ctx, "ip4", name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, a := range answers {
+		a = a.Unmap()
+		if dnsblRefused.Contains(a) {
+			return false, fmt.Errorf("query refused by %s (answer %s)", strings.TrimSuffix(name, "."), a)
+		}
+		if dnsblListed.Contains(a) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// dnsblName is addr as queried in a blocklist zone: the octets of an IPv4
+// address, or the nibbles of an IPv6 address, in reverse order.
+func dnsblName(addr netip.Addr) string {
+	if addr.Is4() {
+		b := addr.As4()
+		return fmt.Sprintf("%d.%d.%d.%d", b[3], b[2], b[1], b[0])
+	}
+	b := addr.As16()
+	nibbles := make([]string, 0, 32)
+	for i := 15; i >= 0; i-- {
+		nibbles = append(nibbles, fmt.Sprintf("%x", b[i]&0x0f), fmt.Sprintf("%x", b[i]>>4))
+	}
+	return strings.Join(nibbles, ".")
+}
@@ -0,0 +1,35 @@
+package policy
+
+import (
+	"context"
+	"errors"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+// Error classes, as returned by ErrorClass.
+const (
+	ErrorClassStoreUnavailable = "store_unavailable"
+	ErrorClassTimeout          = "timeout"
+	ErrorClassConfigInvalid    = "config_invalid"
+	ErrorClassInternal         = "internal"
+)
+
+// ErrorClass names the class of err for logs and metrics: a store that
+// could not be reached, a deadline that passed, an invalid configuration, or
+// anything else.
+func ErrorClass(err error) string {
+	switch {
+	case errors.Is(err, store.ErrStoreUnavailable):
+		return ErrorClassStoreUnavailable
+	case errors.Is(err, kitpolicy.ErrFilterTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.Is(err, config.ErrConfigInvalid):
+		return ErrorClassConfigInvalid
+	default:
+		return ErrorClassInternal
+	}
+}
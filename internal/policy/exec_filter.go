@@ -0,0 +1,345 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	kitconfig "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const (
+	defaultExecTimeout = time.Second
+	// execRestartDelay spaces out restarts of a program that keeps exiting.
+	execRestartDelay = time.Second
+	// execStopGrace is how long a program may take to exit once its stdin
+	// is closed before it is killed.
+	execStopGrace   = 2 * time.Second
+	maxExecLineSize = 1024 * 1024
+)
+
+// execRequest is a strfry write policy request.
+type execRequest struct {
+	Type       string       `json:"type"`
+	Event      *nostr.Event `json:"event"`
+	ReceivedAt int64        `json:"receivedAt"`
+	SourceType string       `json:"sourceType"`
+	SourceInfo string       `json:"sourceInfo"`
+	// Bot is not part of strfry's request: it is the known bot
+	// BotSignatureFilter identified the event as, if any.
+	Bot *kitpolicy.BotIdentity `json:"bot,omitempty"`
+}
+
+// execResponse is a strfry write policy response.
+type execResponse struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	Msg    string `json:"msg"`
+}
+
+// execProcess is one running copy of the program.
+type execProcess struct {
+	// id names the copy in logs: the pid of a command.
+	id    string
+	stdin io.WriteCloser
+	// lines carries the answers read from stdout; it is closed when the
+	// program exits.
+	lines chan []byte
+	done  chan struct{}
+	// terminate stops the program at once.
+	terminate func()
+}
+
+// ExecFilter hands events to an operator-provided program speaking strfry's
+// write policy protocol, so filters can be written in any language. The
+// program is a command or a WASI module. Copies of it are started on demand,
+// up to cfg.Processes, each judging one event at a time. A copy that times
+// out, answers out of turn or exits is replaced; events it could not judge
+// are rejected unless cfg.FailOpen.
+type ExecFilter struct {
+	cfg     *config.ExecFilterConfig
+	kinds   map[int]struct{}
+	timeout time.Duration
+	module  *wasmModule // Nil for a command.
+	// idle holds the copies free to take an event; nil stands for a copy
+	// yet to be started.
+	idle chan *execProcess
+
+	mu      sync.Mutex
+	retryAt time.Time
+}
+
+func NewExecFilter(cfg *config.ExecFilterConfig) (*ExecFilter, error) {
+	f := &ExecFilter{cfg: cfg, timeout: cfg.Timeout}
+	if cfg.Module != "" {
+		module, err := compileWASMModule(cfg.Module)
+		if err != nil {
+			return nil, fmt.Errorf("exec filter %s: %w", cfg.Name, err)
+		}
+		f.module = module
+	} else if _, err := exec.LookPath(cfg.Command); err != nil {
+		return nil, fmt.Errorf("exec filter %s: %w", cfg.Name, err)
+	}
+	if f.timeout <= 0 {
+		f.timeout = defaultExecTimeout
+	}
+	if len(cfg.Kinds) > 0 {
+		f.kinds = make(map[int]struct{}, len(cfg.Kinds))
+		for _, k := range cfg.Kinds {
+			f.kinds[k] = struct{}{}
+		}
+	}
+	processes := max(cfg.Processes, 1)
+	f.idle = make(chan *execProcess, processes)
+	for range processes {
+		f.idle <- nil
+	}
+	return f, nil
+}
+
+func (f *ExecFilter) Match(ctx context.Context, event *nostr.Event, meta map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(f.cfg.Name)
+
+	if f.kinds != nil {
+		if _, ok := f.kinds[event.Kind]; !ok {
+			return newResult(true, "kind_not_checked", nil)
+		}
+	}
+
+	resp, err := f.ask(ctx, event, kitpolicy.IdentifiedBot(meta))
+	if err != nil {
+		if f.cfg.FailOpen {
+			slog.WarnContext(ctx, "Exec filter failed, accepting the event", "filter", f.cfg.Name, "event_id", event.ID, "error", err)
+			return newResult(true, "exec_failed_open", nil)
+		}
+		return newResult(false, "exec_failed", err)
+	}
+
+	switch resp.Action {
+	case "accept":
+		return newResult(true, "exec_accepted", nil)
+	case "reject":
+		reason := resp.Msg
+		if reason == "" {
+			reason = "exec_rejected"
+		}
+		return kitpolicy.ActionResult(newResult, f.cfg.Action, reason)
+	case "shadowReject":
+		reason := resp.Msg
+		if reason == "" {
+			reason = "exec_shadow_rejected"
+		}
+		return kitpolicy.ActionResult(newResult, kitconfig.ActionShadow, reason)
+	default:
+		err := fmt.Errorf("exec filter %s: unknown action %q", f.cfg.Name, resp.Action)
+		if f.cfg.FailOpen {
+			slog.WarnContext(ctx, "Exec filter failed, accepting the event", "filter", f.cfg.Name, "event_id", event.ID, "error", err)
+			return newResult(true, "exec_failed_open", nil)
+		}
+		return newResult(false, "exec_failed", err)
+	}
+}
+
+// ask sends event to a free copy of the program and returns its answer.
+func (f *ExecFilter) ask(ctx context.Context, event *nostr.Event, bot *kitpolicy.BotIdentity) (execResponse, error) {
+	timer := time.NewTimer(f.timeout)
+	defer timer.Stop()
+
+	var p *execProcess
+	select {
+	case p = <-f.idle:
+	case <-timer.C:
+		return execResponse{}, fmt.Errorf("%w: exec filter %s: no process free within %s", kitpolicy.ErrFilterTimeout, f.cfg.Name, f.timeout)
+	case <-ctx.Done():
+		return execResponse{}, ctx.Err()
+	}
+	healthy := false
+	defer func() {
+		if !healthy && p != nil {
+			p.kill()
+			p = nil
+		}
+		f.idle <- p
+	}()
+
+	if p == nil {
+		var err error
+		if p, err = f.start(); err != nil {
+			return execResponse{}, err
+		}
+	}
+
+	src := SourceFrom(ctx)
+	req := execRequest{Type: "new", Event: event, ReceivedAt: time.Now().Unix(), SourceType: src.Type, SourceInfo: src.Info, Bot: bot}
+	if SideEffectsSuppressed(ctx) {
+		req.Type = "lookback"
+	}
+	line, err := json.Marshal(req)
+	if err != nil {
+		return execResponse{}, err
+	}
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		f.backOff()
+		return execResponse{}, fmt.Errorf("exec filter %s: write request: %w", f.cfg.Name, err)
+	}
+
+	var answer []byte
+	select {
+	case l, ok := <-p.lines:
+		if !ok {
+			f.backOff()
+			return execResponse{}, fmt.Errorf("exec filter %s: program exited", f.cfg.Name)
+		}
+		answer = l
+	case <-timer.C:
+		return execResponse{}, fmt.Errorf("%w: exec filter %s: no answer within %s", kitpolicy.ErrFilterTimeout, f.cfg.Name, f.timeout)
+	case <-ctx.Done():
+		return execResponse{}, ctx.Err()
+	}
+
+	var resp execResponse
+	if err := json.Unmarshal(answer, &resp); err != nil {
+		return execResponse{}, fmt.Errorf("exec filter %s: invalid answer: %w", f.cfg.Name, err)
+	}
+	if resp.ID != event.ID {
+		return execResponse{}, fmt.Errorf("exec filter %s: answer is for event %q", f.cfg.Name, resp.ID)
+	}
+	healthy = true
+	return resp, nil
+}
+
+// start starts a copy of the program, unless one exited too recently.
+func (f *ExecFilter) start() (*execProcess, error) {
+	f.mu.Lock()
+	wait := time.Until(f.retryAt)
+	f.mu.Unlock()
+	if wait > 0 {
+		return nil, fmt.Errorf("exec filter %s: restarting in %s after a failure", f.cfg.Name, wait.Round(time.Millisecond))
+	}
+
+	var run execRun
+	var err error
+	if f.module != nil {
+		run, err = f.module.start(f.cfg.Name, f.cfg.Args)
+	} else {
+		run, err = startCommand(f.cfg.Command, f.cfg.Args)
+	}
+	if err != nil {
+		f.backOff()
+		return nil, fmt.Errorf("exec filter %s: %w", f.cfg.Name, err)
+	}
+	slog.Info("Started exec filter program", "filter", f.cfg.Name, "id", run.id)
+
+	p := &execProcess{id: run.id, stdin: run.stdin, lines: make(chan []byte, 1), done: make(chan struct{}), terminate: run.terminate}
+	go func() {
+		defer close(p.lines)
+		scanner := bufio.NewScanner(run.stdout)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxExecLineSize)
+		for scanner.Scan() {
+			// Once killed, the output is drained until the program is gone.
+			select {
+			case p.lines <- append([]byte(nil), scanner.Bytes()...):
+			case <-p.done:
+			}
+		}
+		err := run.wait()
+		select {
+		case <-p.done:
+		default:
+			slog.Warn("Exec filter program exited", "filter", f.cfg.Name, "id", p.id, "error", err)
+		}
+	}()
+	return p, nil
+}
+
+// execRun is a started program, command or module.
+type execRun struct {
+	id     string
+	stdin  io.WriteCloser
+	stdout io.Reader
+	// wait returns once the program has exited and its output is consumed.
+	wait      func() error
+	terminate func()
+}
+
+func startCommand(command string, args []string) (execRun, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return execRun{}, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return execRun{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return execRun{}, err
+	}
+	return execRun{
+		id:        "pid " + strconv.Itoa(cmd.Process.Pid),
+		stdin:     stdin,
+		stdout:    stdout,
+		wait:      cmd.Wait,
+		terminate: func() { cmd.Process.Kill() },
+	}, nil
+}
+
+// backOff delays the next start after a copy failed.
+func (f *ExecFilter) backOff() {
+	f.mu.Lock()
+	f.retryAt = time.Now().Add(execRestartDelay)
+	f.mu.Unlock()
+}
+
+// kill stops p at once.
+func (p *execProcess) kill() {
+	close(p.done)
+	p.terminate()
+	p.stdin.Close()
+}
+
+// stop asks p to exit by closing its stdin, as strfry does, and kills it if
+// it does not within execStopGrace.
+func (p *execProcess) stop() {
+	close(p.done)
+	p.stdin.Close()
+	timer := time.NewTimer(execStopGrace)
+	defer timer.Stop()
+	for {
+		select {
+		case _, ok := <-p.lines:
+			if !ok {
+				return
+			}
+		case <-timer.C:
+			p.terminate()
+			return
+		}
+	}
+}
+
+// Close stops every copy of the program, waiting for those judging an event.
+func (f *ExecFilter) Close() error {
+	for range cap(f.idle) {
+		if p := <-f.idle; p != nil {
+			p.stop()
+		}
+	}
+	if f.module != nil {
+		return f.module.close()
+	}
+	return nil
+}
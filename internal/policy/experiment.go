@@ -0,0 +1,219 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// experimentAuthors bounds the authors whose first event is remembered for
+// the retention counts; an author forgotten and seen again counts anew.
+const experimentAuthors = 100_000
+
+// CohortStats are the counts of one cohort of an experiment.
+type CohortStats struct {
+	Accepted uint64 `json:"accepted"`
+	Rejected uint64 `json:"rejected"`
+	// Authors are the distinct authors seen, Retained those of them with an
+	// event accepted at least the retention window after their first one.
+	Authors  uint64 `json:"authors"`
+	Retained uint64 `json:"retained"`
+}
+
+// AcceptanceRate is the fraction of the cohort's events accepted.
+func (s CohortStats) AcceptanceRate() float64 {
+	if total := s.Accepted + s.Rejected; total > 0 {
+		return float64(s.Accepted) / float64(total)
+	}
+	return 0
+}
+
+// RetentionRate is the fraction of the cohort's authors retained.
+func (s CohortStats) RetentionRate() float64 {
+	if s.Authors > 0 {
+		return float64(s.Retained) / float64(s.Authors)
+	}
+	return 0
+}
+
+func (s CohortStats) MarshalJSON() ([]byte, error) {
+	type counts CohortStats
+	return json.Marshal(struct {
+		counts
+		AcceptanceRate float64 `json:"acceptance_rate"`
+		RetentionRate  float64 `json:"retention_rate"`
+	}{counts(s), s.AcceptanceRate(), s.RetentionRate()})
+}
+
+type authorVisit struct {
+	first    time.Time
+	retained bool
+}
+
+// ExperimentStats counts the events and authors of each cohort. It outlives
+// the pipelines, so the counts carry over reloads; they restart when the
+// experiment is renamed.
+type ExperimentStats struct {
+	mu         sync.Mutex
+	experiment string
+	cohorts    map[string]*CohortStats
+	authors    *lru.LRU[string, *authorVisit] // By cohort and pubkey.
+}
+
+func NewExperimentStats() *ExperimentStats {
+	return &ExperimentStats{
+		cohorts: make(map[string]*CohortStats),
+		authors: lru.NewLRU[string, *authorVisit](experimentAuthors, nil, 0),
+	}
+}
+
+func (s *ExperimentStats) record(experiment, cohort, pubkey string, accepted bool, retention time.Duration, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if experiment != s.experiment {
+		s.experiment = experiment
+		clear(s.cohorts)
+		s.authors.Purge()
+	}
+	st, ok := s.cohorts[cohort]
+	if !ok {
+		st = &CohortStats{}
+		s.cohorts[cohort] = st
+	}
+	if accepted {
+		st.Accepted++
+	} else {
+		st.Rejected++
+	}
+
+	key := cohort + ":" + pubkey
+	visit, ok := s.authors.Get(key)
+	if !ok {
+		st.Authors++
+		s.authors.Add(key, &authorVisit{first: now})
+		return
+	}
+	if accepted && !visit.retained && now.Sub(visit.first) >= retention {
+		visit.retained = true
+		st.Retained++
+	}
+}
+
+// Counts returns the name of the experiment and the counts of its cohorts.
+func (s *ExperimentStats) Counts() (string, map[string]CohortStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]CohortStats, len(s.cohorts))
+	for name, st := range s.cohorts {
+		counts[name] = *st
+	}
+	return s.experiment, counts
+}
+
+// WriteMetrics writes the counts in the OpenMetrics text format.
+func (s *ExperimentStats) WriteMetrics(w io.Writer) {
+	experiment, counts := s.Counts()
+	cohorts := make([]string, 0, len(counts))
+	for name := range counts {
+		cohorts = append(cohorts, name)
+	}
+	slices.Sort(cohorts)
+
+	fmt.Fprintln(w, "# TYPE adresu_experiment_events counter")
+	fmt.Fprintln(w, "# HELP adresu_experiment_events Events of the authors of each experiment cohort, by decision.")
+	for _, c := range cohorts {
+		fmt.Fprintf(w, "adresu_experiment_events_total{experiment=%q,cohort=%q,action=\"accept\"} %d\n", experiment, c, counts[c].Accepted)
+		fmt.Fprintf(w, "adresu_experiment_events_total{experiment=%q,cohort=%q,action=\"reject\"} %d\n", experiment, c, counts[c].Rejected)
+	}
+	fmt.Fprintln(w, "# TYPE adresu_experiment_authors counter")
+	fmt.Fprintln(w, "# HELP adresu_experiment_authors Distinct authors seen in each experiment cohort.")
+	for _, c := range cohorts {
+		fmt.Fprintf(w, "adresu_experiment_authors_total{experiment=%q,cohort=%q} %d\n", experiment, c, counts[c].Authors)
+	}
+	fmt.Fprintln(w, "# TYPE adresu_experiment_retained_authors counter")
+	fmt.Fprintln(w, "# HELP adresu_experiment_retained_authors Authors of each experiment cohort with an event accepted after the retention window.")
+	for _, c := range cohorts {
+		fmt.Fprintf(w, "adresu_experiment_retained_authors_total{experiment=%q,cohort=%q} %d\n", experiment, c, counts[c].Retained)
+	}
+}
+
+// ServeHTTP returns the counts as JSON.
+func (s *ExperimentStats) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	experiment, counts := s.Counts()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"experiment": experiment, "cohorts": counts})
+}
+
+type cohort struct {
+	name   string
+	weight uint64
+	// pipeline judges the cohort's events; nil means the live pipeline.
+	pipeline *Pipeline
+}
+
+// Experiment splits authors into cohorts, each judged by a pipeline built
+// with its own settings, so the effect of a setting on acceptance and
+// retention can be measured on real traffic.
+type Experiment struct {
+	name      string
+	retention time.Duration
+	cohorts   []cohort
+	total     uint64
+	stats     *ExperimentStats
+}
+
+// NewExperiment creates an experiment judging the cohorts of cfg with
+// pipelines, by cohort name, which it closes on Close. Cohorts missing from
+// pipelines are judged by the live pipeline.
+func NewExperiment(cfg *config.ExperimentConfig, pipelines map[string]*Pipeline, stats *ExperimentStats) *Experiment {
+	e := &Experiment{name: cfg.Name, retention: cfg.RetentionWindow, stats: stats}
+	for _, c := range cfg.Cohorts {
+		e.cohorts = append(e.cohorts, cohort{name: c.Name, weight: uint64(c.Weight), pipeline: pipelines[c.Name]})
+		e.total += uint64(c.Weight)
+	}
+	return e
+}
+
+// assign returns the cohort of pubkey. The assignment depends on the
+// experiment name only, so an author stays in the same cohort across
+// restarts and reloads.
+func (e *Experiment) assign(pubkey string) *cohort {
+	sum := sha256.Sum256([]byte(e.name + ":" + pubkey))
+	n := binary.BigEndian.Uint64(sum[:8]) % e.total
+	for i := range e.cohorts {
+		if n < e.cohorts[i].weight {
+			return &e.cohorts[i]
+		}
+		n -= e.cohorts[i].weight
+	}
+	return &e.cohorts[len(e.cohorts)-1]
+}
+
+func (e *Experiment) record(c *cohort, event *nostr.Event, response PolicyResponse) {
+	e.stats.record(e.name, c.name, event.PubKey, response.Action == "accept", e.retention, time.Now())
+}
+
+// Close waits for the events being judged and closes the cohort pipelines.
+func (e *Experiment) Close() error {
+	for _, c := range e.cohorts {
+		if c.pipeline == nil {
+			continue
+		}
+		if err := c.pipeline.Close(); err != nil {
+			slog.Error("Failed to close the pipeline of an experiment cohort", "cohort", c.name, "error", err)
+		}
+	}
+	return nil
+}
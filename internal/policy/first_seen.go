@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+)
+
+// defaultLedgerSize bounds the authors a FirstSeenLedger remembers.
+const defaultLedgerSize = 100000
+
+// FirstSeenLedger records when each author was first seen publishing on the
+// relay, as a measure of reputation: an author is only recorded once one of
+// its events is accepted, so a fresh key cannot age itself by being rejected.
+// It is seeded from the priming snapshot and outlives pipeline reloads; the
+// least recently active authors are forgotten first.
+type FirstSeenLedger struct {
+	seen *lru.LRU[string, time.Time]
+}
+
+// NewFirstSeenLedger creates a ledger of up to size authors (100000 if size
+// is not positive).
+func NewFirstSeenLedger(size int) *FirstSeenLedger {
+	if size <= 0 {
+		size = defaultLedgerSize
+	}
+	return &FirstSeenLedger{seen: lru.NewLRU[string, time.Time](size, nil, 0)}
+}
+
+// Age returns how long ago pubkey was first seen, or 0 if it never was.
+func (l *FirstSeenLedger) Age(pubkey string, now time.Time) time.Duration {
+	first, ok := l.seen.Peek(pubkey)
+	if !ok || now.Before(first) {
+		return 0
+	}
+	return now.Sub(first)
+}
+
+// ObserveDecision records the authors of accepted events.
+func (l *FirstSeenLedger) ObserveDecision(d Decision) {
+	if d.Action != "accept" || d.Lookback || d.PubKey == "" {
+		return
+	}
+	l.record(d.PubKey, d.Time)
+}
+
+// Prime records the first-seen times of the history, keeping earlier times
+// already known, so priming again on a reload changes nothing.
+func (l *FirstSeenLedger) Prime(history []kitpolicy.AuthorHistory) {
+	for _, h := range history {
+		if !h.FirstSeen.IsZero() {
+			l.record(h.PubKey, h.FirstSeen)
+		}
+	}
+}
+
+func (l *FirstSeenLedger) record(pubkey string, at time.Time) {
+	// Get refreshes the recency of known authors, so active ones are kept.
+	if first, ok := l.seen.Get(pubkey); ok && !at.Before(first) {
+		return
+	}
+	l.seen.Add(pubkey, at)
+}
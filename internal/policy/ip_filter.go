@@ -0,0 +1,71 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const ipFilterName = "IPFilter"
+
+// IPFilter rejects events submitted from the networks of the deny list and,
+// if the allow list is not empty, from outside its networks. The deny list
+// takes priority, so a subnet can be carved out of an allowed network.
+type IPFilter struct {
+	cfg          *config.IPFilterConfig
+	allow, deny  *ipSet
+	allowListSet bool
+}
+
+func NewIPFilter(cfg *config.IPFilterConfig) (*IPFilter, error) {
+	f := &IPFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	var err error
+	if f.allow, err = newIPSet(cfg.Allow); err != nil {
+		return nil, fmt.Errorf("filters.ip.allow: %w", err)
+	}
+	if f.deny, err = newIPSet(cfg.Deny); err != nil {
+		return nil, fmt.Errorf("filters.ip.deny: %w", err)
+	}
+	f.allowListSet = len(cfg.Allow) > 0
+	return f, nil
+}
+
+func (f *IPFilter) Match(_ context.Context, _ *nostr.Event, meta map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(ipFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	// Events without an address, e.g. imported or synced ones, did not come
+	// from a client.
+	remoteIP, _ := meta["remote_ip"].(string)
+	if remoteIP == "" {
+		return newResult(true, "no_remote_ip", nil)
+	}
+	addr, err := netip.ParseAddr(remoteIP)
+	if err != nil {
+		// An allow list admits only addresses it can place.
+		return newResult(!f.allowListSet, "invalid_remote_ip", nil)
+	}
+	addr = addr.Unmap()
+
+	if f.deny.contains(addr) {
+		res, err := newResult(false, "ip_denied", nil)
+		res.Values = map[string]any{"ip": addr.String()}
+		return res, err
+	}
+	if f.allowListSet && !f.allow.contains(addr) {
+		res, err := newResult(false, "ip_not_allowed", nil)
+		res.Values = map[string]any{"ip": addr.String()}
+		return res, err
+	}
+	return newResult(true, "ip_allowed", nil)
+}
@@ -0,0 +1,361 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+	"golang.org/x/time/rate"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/schedule"
+)
+
+const (
+	ipReputationFilterName = "IPReputationFilter"
+	// maxIPListSize bounds the download of one list.
+	maxIPListSize = 64 << 20
+)
+
+// IPReputationFilter treats events from listed addresses, such as Tor exit
+// nodes or datacenter networks, with suspicion: depending on the list, they
+// are rejected, rate limited per address (per /64 for IPv6) or must carry
+// proof of work. The lists are loaded from files and URLs, all reloaded every
+// refresh_interval; a source that fails to load keeps its previous entries.
+// URLs are first fetched in the background, so their entries only count once
+// downloaded.
+type IPReputationFilter struct {
+	cfg *config.IPReputationFilterConfig
+
+	mu sync.RWMutex
+	// bySource holds the networks of each source that loaded; sets holds
+	// those of each list, in the order of cfg.Lists.
+	bySource map[string][]netip.Prefix
+	sets     []*ipSet
+
+	limitersMu sync.Mutex
+	limiters   *lru.LRU[string, *rate.Limiter]
+
+	// unschedule removes the refresh job.
+	unschedule func()
+}
+
+func NewIPReputationFilter(cfg *config.IPReputationFilterConfig, sched *schedule.Scheduler) (*IPReputationFilter, error) {
+	f := &IPReputationFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	f.bySource = make(map[string][]netip.Prefix)
+	f.limiters = lru.NewLRU[string, *rate.Limiter](cfg.CacheSize, nil, 15*time.Minute)
+	// Files are read up front, so that a wrong path fails the build.
+	for _, list := range cfg.Lists {
+		for _, src := range list.Sources {
+			if _, done := f.bySource[src]; done || isURL(src) {
+				continue
+			}
+			nets, err := readIPListFile(src)
+			if err != nil {
+				return nil, err
+			}
+			f.bySource[src] = nets
+		}
+	}
+	f.merge()
+
+	// The files were just read; only the URLs are due at first.
+	urlsOnly := true
+	f.unschedule = sched.Add(schedule.Job{
+		Name:     config.JobIPReputationRefresh,
+		Schedule: schedule.Every(cfg.RefreshInterval),
+		Run: func(ctx context.Context) error {
+			err := f.refresh(ctx, urlsOnly)
+			urlsOnly = false
+			return err
+		},
+		Immediately: true,
+	})
+	return f, nil
+}
+
+func (f *IPReputationFilter) Match(_ context.Context, event *nostr.Event, meta map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(ipReputationFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	remoteIP, _ := meta["remote_ip"].(string)
+	if remoteIP == "" {
+		return newResult(true, "no_remote_ip", nil)
+	}
+	addr, err := netip.ParseAddr(remoteIP)
+	if err != nil {
+		return newResult(true, "invalid_remote_ip", nil)
+	}
+	addr = addr.Unmap()
+
+	f.mu.RLock()
+	listed := -1
+	for i, set := range f.sets {
+		if set.contains(addr) {
+			listed = i
+			break
+		}
+	}
+	f.mu.RUnlock()
+	if listed < 0 {
+		return newResult(true, "ip_not_listed", nil)
+	}
+
+	list := &f.cfg.Lists[listed]
+	switch list.Action {
+	case config.IPReputationRateLimit:
+		if f.limiter(list, addr).Allow() {
+			return newResult(true, "ip_listed_within_rate", nil)
+		}
+		reason := fmt.Sprintf("ip_listed_rate_exceeded:list_%s,rate_%.2f/s", list.Name, list.Rate)
+		res, err := newResult(false, reason, nil)
+		res.Values = map[string]any{"list": list.Name, "rate": list.Rate, "burst": list.Burst}
+		return res, err
+
+	case config.IPReputationPoW:
+		if nip.IsPoWValid(event, list.PoWDifficulty) {
+			return newResult(true, "ip_listed_pow_valid", nil)
+		}
+		reason := fmt.Sprintf("ip_listed_pow_required:list_%s,pow_required_%d", list.Name, list.PoWDifficulty)
+		res, err := newResult(false, reason, nil)
+		res.Values = map[string]any{"list": list.Name, "pow_difficulty": list.PoWDifficulty}
+		return res, err
+
+	default:
+		res, err := newResult(false, "ip_listed:"+list.Name, nil)
+		res.Values = map[string]any{"list": list.Name}
+		return res, err
+	}
+}
+
+// Close removes the refresh job.
+func (f *IPReputationFilter) Close() error {
+	if f.unschedule != nil {
+		f.unschedule()
+	}
+	return nil
+}
+
+// limiter returns the limiter of addr, or of its /64 for IPv6, in list.
+func (f *IPReputationFilter) limiter(list *config.IPReputationList, addr netip.Addr) *rate.Limiter {
+	key := addr.String()
+	if addr.Is6() {
+		p, _ := addr.Prefix(64)
+		key = p.String()
+	}
+	key = list.Name + ":" + key
+
+	f.limitersMu.Lock()
+	defer f.limitersMu.Unlock()
+	if limiter, ok := f.limiters.Get(key); ok {
+		return limiter
+	}
+	limiter := rate.NewLimiter(rate.Limit(list.Rate), list.Burst)
+	f.limiters.Add(key, limiter)
+	return limiter
+}
+
+// refresh reloads every source, or only the URLs. A source that fails to
+// load keeps its previous entries.
+func (f *IPReputationFilter) refresh(ctx context.Context, urlsOnly bool) error {
+	changed := false
+	var errs []error
+	loaded := make(map[string]struct{})
+	for _, list := range f.cfg.Lists {
+		for _, src := range list.Sources {
+			if _, done := loaded[src]; done {
+				continue
+			}
+			loaded[src] = struct{}{}
+			var nets []netip.Prefix
+			var err error
+			switch {
+			case isURL(src):
+				nets, err = f.fetch(ctx, src)
+			case urlsOnly:
+				continue
+			default:
+				nets, err = readIPListFile(src)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to load IP list from %s, keeping the previous one: %w", src, err))
+				continue
+			}
+			f.mu.Lock()
+			f.bySource[src] = nets
+			f.mu.Unlock()
+			changed = true
+		}
+	}
+	if changed {
+		f.merge()
+	}
+	return errors.Join(errs...)
+}
+
+// merge rebuilds the set of each list from its sources.
+func (f *IPReputationFilter) merge() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sets := make([]*ipSet, len(f.cfg.Lists))
+	for i, list := range f.cfg.Lists {
+		set := &ipSet{nets: make(map[netip.Prefix]struct{})}
+		for _, src := range list.Sources {
+			for _, p := range f.bySource[src] {
+				set.add(p)
+			}
+		}
+		sets[i] = set
+		slog.Info("IP reputation list loaded", "list", list.Name, "networks", len(set.nets))
+	}
+	f.sets = sets
+}
+
+// fetch downloads the list at url.
+func (f *IPReputationFilter) fetch(parent context.Context, url string) ([]netip.Prefix, error) {
+	ctx, cancel := context.WithTimeout(parent, f.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return parseIPList(io.LimitReader(resp.Body, maxIPListSize), url)
+}
+
+func readIPListFile(path string) ([]netip.Prefix, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IP list file: %w", err)
+	}
+	defer file.Close()
+	nets, err := parseIPList(file, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IP list file: %w", err)
+	}
+	return nets, nil
+}
+
+// parseIPList reads one address or CIDR network per line, skipping blank
+// lines and "#" comments. Of Tor's exit-addresses format, only the
+// ExitAddress lines are read.
+func parseIPList(r io.Reader, name string) ([]netip.Prefix, error) {
+	var nets []netip.Prefix
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		text = fields[0]
+		switch text {
+		case "ExitNode", "Published", "LastStatus":
+			continue
+		case "ExitAddress":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%s:%d: ExitAddress without an address", name, line)
+			}
+			text = fields[1]
+		}
+		p, err := parseIPOrPrefix(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		nets = append(nets, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nets, nil
+}
+
+// parseIPOrPrefix parses an address, as a single-address network, or a CIDR
+// network.
+func parseIPOrPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if p.Addr().Is4In6() {
+			p = netip.PrefixFrom(p.Addr().Unmap(), max(p.Bits()-96, 0))
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ipSet holds networks, indexed by their prefix length so that a lookup
+// masks the address once per distinct length.
+type ipSet struct {
+	nets map[netip.Prefix]struct{}
+	bits []int
+}
+
+// newIPSet parses addresses and CIDR networks into a set.
+func newIPSet(entries []string) (*ipSet, error) {
+	set := &ipSet{nets: make(map[netip.Prefix]struct{}, len(entries))}
+	for _, e := range entries {
+		p, err := parseIPOrPrefix(e)
+		if err != nil {
+			return nil, err
+		}
+		set.add(p)
+	}
+	return set, nil
+}
+
+func (s *ipSet) add(p netip.Prefix) {
+	if _, ok := s.nets[p]; ok {
+		return
+	}
+	s.nets[p] = struct{}{}
+	if !slices.Contains(s.bits, p.Bits()) {
+		s.bits = append(s.bits, p.Bits())
+	}
+}
+
+func (s *ipSet) contains(addr netip.Addr) bool {
+	for _, b := range s.bits {
+		p, err := addr.Prefix(b)
+		if err != nil {
+			continue
+		}
+		if _, ok := s.nets[p]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/store"
+	"github.com/lessucettes/adresu-plugin/internal/strfry"
+	"github.com/lessucettes/adresu-plugin/internal/trace"
+)
+
+// journal records a side effect before it is started asynchronously. The
+// action is still executed if journaling fails, only without the crash
+// guarantee.
+func journal(ctx context.Context, s store.Store, a store.Action) store.Action {
+	a.TraceID = trace.From(ctx)
+	journaled, err := s.JournalAction(ctx, a)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to journal side effect", "type", a.Type, "pubkey", a.PubKey, "error", err)
+		return a
+	}
+	return journaled
+}
+
+// complete removes an executed side effect from the journal.
+func complete(ctx context.Context, s store.Store, a store.Action) {
+	if a.ID == "" {
+		return
+	}
+	// The action ran; finishing the bookkeeping must not depend on the
+	// caller's deadline.
+	if err := s.CompleteAction(context.WithoutCancel(ctx), a.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to complete journaled side effect", "id", a.ID, "error", err)
+	}
+}
+
+// ReplayJournal executes the side effects of pending, the actions journaled
+// but not completed before the last shutdown or crash, oldest first. pending
+// must be read from s before any event is processed, or replay could repeat
+// side effects still in flight. Actions that fail again stay in the journal
+// for the next start. It returns the number of actions completed.
+func ReplayJournal(ctx context.Context, s store.Store, sf strfry.ClientInterface, pending []store.Action) int {
+	if len(pending) == 0 {
+		return 0
+	}
+	slog.Warn("Replaying side effects interrupted by the last shutdown", "pending", len(pending))
+
+	done := 0
+	for _, a := range pending {
+		actx := trace.With(ctx, a.TraceID)
+		if err := replay(actx, s, sf, a); err != nil {
+			slog.ErrorContext(actx, "Failed to replay side effect", "type", a.Type, "pubkey", a.PubKey, "error", err)
+			continue
+		}
+		complete(actx, s, a)
+		done++
+	}
+	return done
+}
+
+func replay(ctx context.Context, s store.Store, sf strfry.ClientInterface, a store.Action) error {
+	switch a.Type {
+	case store.ActionBan, store.ActionBanIP:
+		// The ban lasts as long as it would have had it been applied on time.
+		remaining := a.Duration - time.Since(a.Created)
+		if remaining <= 0 {
+			slog.InfoContext(ctx, "Skipping replay of a ban that would have expired", "pubkey", a.PubKey, "ip", a.IP)
+			return nil
+		}
+		var info store.BanInfo
+		if a.Ban != nil {
+			info = *a.Ban
+		}
+		if a.Type == store.ActionBanIP {
+			slog.InfoContext(ctx, "Replaying IP ban", "ip", a.IP, "duration", remaining)
+			return s.BanIP(ctx, a.IP, remaining, info)
+		}
+		slog.InfoContext(ctx, "Replaying ban", "pubkey", a.PubKey, "duration", remaining)
+		return s.BanAuthor(ctx, a.PubKey, remaining, info)
+	case store.ActionDeleteEvents:
+		slog.InfoContext(ctx, "Replaying event deletion", "pubkey", a.PubKey)
+		return sf.DeleteEventsByAuthor(a.PubKey)
+	case store.ActionDeleteEvent:
+		slog.InfoContext(ctx, "Replaying event deletion", "event_id", a.EventID)
+		return sf.DeleteEvent(a.EventID)
+	default:
+		slog.WarnContext(ctx, "Dropping journaled side effect of unknown type", "type", a.Type, "id", a.ID)
+		return nil
+	}
+}
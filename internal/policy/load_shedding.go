@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const loadShedderName = "LoadShedder"
+
+// LoadShedder rejects the events of the least important kinds while the
+// plugin is overloaded, so that notes and DMs keep being answered promptly
+// instead of queueing behind reactions. Every interval it compares the input
+// queue depth and the average decision latency with their thresholds: while
+// either is reached, one more tier of kinds is shed; once neither has been
+// for RecoverAfter, the last tier shed is let back in.
+type LoadShedder struct {
+	cfg        *config.LoadSheddingConfig
+	queueDepth func() int // nil when the host has no queue to report.
+	// tierOf maps a kind to its 1-based tier; ephemeralTier is that of the
+	// ephemeral kinds without a tier of their own, 0 if none.
+	tierOf        map[int]int
+	ephemeralTier int
+	shed          atomic.Int32 // Tiers shed, from the first.
+
+	latencySum atomic.Int64 // Nanoseconds, since the last sample.
+	decisions  atomic.Int64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewLoadShedder starts sampling load if shedding is enabled. queueDepth
+// returns the number of input lines read but not yet answered; it may be
+// nil.
+func NewLoadShedder(cfg *config.LoadSheddingConfig, queueDepth func() int) *LoadShedder {
+	s := &LoadShedder{cfg: cfg, queueDepth: queueDepth, tierOf: make(map[int]int)}
+	if !cfg.Enabled {
+		return s
+	}
+	for i, tier := range cfg.Tiers {
+		for _, k := range tier.Kinds {
+			if _, ok := s.tierOf[k]; !ok {
+				s.tierOf[k] = i + 1
+			}
+		}
+		if tier.Ephemeral && s.ephemeralTier == 0 {
+			s.ephemeralTier = i + 1
+		}
+	}
+
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.wg.Add(1)
+	go s.run(ctx)
+	return s
+}
+
+func (s *LoadShedder) Match(_ context.Context, event *nostr.Event, _ map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(loadShedderName)
+
+	if !s.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	shed := int(s.shed.Load())
+	if shed == 0 {
+		return newResult(true, "not_overloaded", nil)
+	}
+	tier, ok := s.tierOf[event.Kind]
+	if !ok && nostr.IsEphemeralKind(event.Kind) {
+		tier = s.ephemeralTier
+	}
+	if tier == 0 || tier > shed {
+		return newResult(true, "kind_not_shed", nil)
+	}
+	res, err := newResult(false, s.cfg.Message, nil)
+	res.Values = map[string]any{"tier": tier, "description": s.cfg.Tiers[tier-1].Description}
+	return res, err
+}
+
+// Observe records the latency of one decision.
+func (s *LoadShedder) Observe(latency time.Duration) {
+	s.latencySum.Add(int64(latency))
+	s.decisions.Add(1)
+}
+
+// Close stops sampling.
+func (s *LoadShedder) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+		s.wg.Wait()
+	}
+	return nil
+}
+
+func (s *LoadShedder) run(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	var calmSince time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var latency time.Duration
+			if n := s.decisions.Swap(0); n > 0 {
+				latency = time.Duration(s.latencySum.Swap(0) / n)
+			}
+			depth := 0
+			if s.queueDepth != nil {
+				depth = s.queueDepth()
+			}
+			calmSince = s.adjust(depth, latency, now, calmSince)
+		}
+	}
+}
+
+// adjust sheds one more tier while overloaded and lets one back in after
+// RecoverAfter without overload. It returns when the overload last ended,
+// zero if it has not.
+func (s *LoadShedder) adjust(depth int, latency time.Duration, now, calmSince time.Time) time.Time {
+	overloaded := (s.cfg.QueueDepth > 0 && depth >= s.cfg.QueueDepth) ||
+		(s.cfg.Latency > 0 && latency >= s.cfg.Latency)
+	shed := int(s.shed.Load())
+
+	switch {
+	case overloaded:
+		if shed < len(s.cfg.Tiers) {
+			s.set(shed+1, depth, latency)
+		}
+		return time.Time{}
+	case shed == 0:
+		return time.Time{}
+	case calmSince.IsZero():
+		return now
+	case now.Sub(calmSince) >= s.cfg.RecoverAfter:
+		s.set(shed-1, depth, latency)
+		return now
+	}
+	return calmSince
+}
+
+func (s *LoadShedder) set(shed, depth int, latency time.Duration) {
+	s.shed.Store(int32(shed))
+	if shed == 0 {
+		slog.Info("Load recovered, no longer shedding events", "queue_depth", depth, "latency", latency)
+		return
+	}
+	slog.Warn("Shedding the events of low-priority kinds", "tiers", shed,
+		"description", s.cfg.Tiers[shed-1].Description, "queue_depth", depth, "latency", latency)
+}
@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"context"
+	"sync"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const (
+	maintenanceFilterName = "MaintenanceFilter"
+)
+
+// MaintenanceSwitch holds the current maintenance mode. It outlives pipeline
+// reloads, so a mode switched at runtime stays in effect until switched back.
+type MaintenanceSwitch struct {
+	mu      sync.RWMutex
+	mode    config.MaintenanceMode
+	message string
+}
+
+func NewMaintenanceSwitch(cfg *config.MaintenanceConfig) *MaintenanceSwitch {
+	s := &MaintenanceSwitch{}
+	s.Set(cfg.Mode, cfg.Message)
+	return s
+}
+
+// Set switches the mode. An empty message keeps the current one.
+func (s *MaintenanceSwitch) Set(mode config.MaintenanceMode, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if mode == "" {
+		mode = config.MaintenanceOff
+	}
+	s.mode = mode
+	if message != "" {
+		s.message = message
+	}
+}
+
+func (s *MaintenanceSwitch) Get() (config.MaintenanceMode, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.mode, s.message
+}
+
+// MaintenanceFilter rejects writes while the relay is in maintenance, either
+// all of them (readonly) or all but those from allowlisted keys.
+type MaintenanceFilter struct {
+	sw      *MaintenanceSwitch
+	allowed map[string]struct{}
+}
+
+func NewMaintenanceFilter(sw *MaintenanceSwitch, cfg *config.MaintenanceConfig) (*MaintenanceFilter, error) {
+	allowed := make(map[string]struct{}, len(cfg.AllowedPubKeys))
+	for _, pk := range cfg.AllowedPubKeys {
+		allowed[pk] = struct{}{}
+	}
+	return &MaintenanceFilter{sw: sw, allowed: allowed}, nil
+}
+
+func (f *MaintenanceFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(maintenanceFilterName)
+
+	mode, message := f.sw.Get()
+	switch mode {
+	case config.MaintenanceReadOnly:
+		return newResult(false, message, nil)
+	case config.MaintenanceAllowlist:
+		if _, ok := f.allowed[event.PubKey]; ok {
+			return newResult(true, "maintenance_allowlisted", nil)
+		}
+		return newResult(false, message, nil)
+	}
+	return newResult(true, "maintenance_off", nil)
+}
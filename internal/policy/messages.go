@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"log/slog"
+	"strings"
+	"text/template"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// MessageData is what rejection message templates are executed against, e.g.
+//
+//	"rate-limited: slow down, retry in {{.Values.retry_after}}s"
+type MessageData struct {
+	kitpolicy.FilterResult
+	Kind    int
+	PubKey  string
+	EventID string
+	// Relay, Contact and AppealURL are the relay's persona from [policy];
+	// AppealURL is empty while the appeal URL template itself is rendered.
+	Relay     string
+	Contact   string
+	AppealURL string
+}
+
+// messageTemplates renders client-facing rejection messages per filter.
+type messageTemplates struct {
+	byFilter map[string]*template.Template
+	relay    string
+	contact  string
+	appeal   *template.Template // Nil without an appeal URL.
+}
+
+func newMessageTemplates(messages map[string]string, persona *config.PolicyConfig) messageTemplates {
+	t := messageTemplates{
+		byFilter: make(map[string]*template.Template, len(messages)),
+		relay:    persona.RelayName,
+		contact:  persona.Contact,
+	}
+	for filter, text := range messages {
+		tmpl, err := template.New(filter).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			// Unreachable for validated configurations.
+			slog.Error("Invalid rejection message template, using the filter reason", "filter", filter, "error", err)
+			continue
+		}
+		t.byFilter[filter] = tmpl
+	}
+	if persona.AppealURL != "" {
+		tmpl, err := template.New("appeal_url").Option("missingkey=zero").Parse(persona.AppealURL)
+		if err != nil {
+			slog.Error("Invalid appeal URL template, leaving it out of messages", "error", err)
+		} else {
+			t.appeal = tmpl
+		}
+	}
+	return t
+}
+
+// render returns the message for a rejection. Filters with a template get it
+// rendered; the others get their reason, followed by the relay's persona if
+// one is configured. A template that fails to execute falls back to the
+// reason.
+func (t messageTemplates) render(res kitpolicy.FilterResult, event *nostr.Event) string {
+	data := MessageData{FilterResult: res, Kind: event.Kind, PubKey: event.PubKey, EventID: event.ID, Relay: t.relay, Contact: t.contact}
+	if t.appeal != nil {
+		data.AppealURL, _ = t.execute(t.appeal, data)
+	}
+	tmpl, ok := t.byFilter[res.Filter]
+	if !ok {
+		return res.Reason + persona(data)
+	}
+	msg, ok := t.execute(tmpl, data)
+	if !ok {
+		return res.Reason
+	}
+	return msg
+}
+
+func (t messageTemplates) execute(tmpl *template.Template, data MessageData) (string, bool) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		slog.Warn("Failed to render rejection message", "template", tmpl.Name(), "error", err)
+		return "", false
+	}
+	// text/template prints missing map entries as "<no value>"; filters only
+	// provide some values, so render them as empty instead.
+	return strings.ReplaceAll(sb.String(), "<no value>", ""), true
+}
+
+// persona returns the " (rejected by <relay>; contact <contact> or appeal at
+// <url>)" suffix for the configured parts, or "" if none is.
+func persona(data MessageData) string {
+	var parts []string
+	if data.Relay != "" {
+		parts = append(parts, "rejected by "+data.Relay)
+	}
+	switch {
+	case data.Contact != "" && data.AppealURL != "":
+		parts = append(parts, "contact "+data.Contact+" or appeal at "+data.AppealURL)
+	case data.Contact != "":
+		parts = append(parts, "contact "+data.Contact+" to appeal")
+	case data.AppealURL != "":
+		parts = append(parts, "appeal at "+data.AppealURL)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, "; ") + ")"
+}
@@ -2,12 +2,19 @@ package policy
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
 	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
 	"github.com/nbd-wtf/go-nostr"
 
+	"github.com/lessucettes/adresu-plugin/internal/config"
 	"github.com/lessucettes/adresu-plugin/internal/store"
 	"github.com/lessucettes/adresu-plugin/internal/strfry"
 )
@@ -17,64 +24,395 @@ const (
 )
 
 type ModerationFilter struct {
-	moderatorPubKey, banEmoji, unbanEmoji string
-	store                                 store.Store
-	sf                                    strfry.ClientInterface
-	banDuration                           time.Duration
+	moderatorPubKey, banEmoji, nukeEmoji, unbanEmoji, restrictEmoji, deleteEmoji string
+	store                                                                        store.Store
+	sf                                                                           strfry.ClientInterface
+	banDuration, restrictDuration                                                time.Duration
+	trainees                                                                     map[string]struct{}
+	// autoBan receives a strike for every delete reaction if deleteStrike.
+	autoBan      *AutoBanFilter
+	deleteStrike bool
+	// protection refuses ban, nuke and report bans of protected pubkeys.
+	protection *Protection
+	// blocklist receives the reacted-to event on block reactions.
+	blockEmoji string
+	blocklist  *BlocklistFilter
+
+	slowModeEmoji                   string
+	slowModeDelay, slowModeDuration time.Duration
+	slowMode                        *kitpolicy.SlowMode
+
+	reports           *config.ReportsConfig
+	reporters         map[string]struct{}
+	reportBanDuration time.Duration
+	mu                sync.Mutex
+	// strikes holds the distinct trusted reporters of each reported pubkey.
+	strikes *lru.LRU[string, map[string]struct{}]
 }
 
-func NewModerationFilter(moderatorPubKey, banEmoji, unbanEmoji string, s store.Store, sf strfry.ClientInterface, banDuration time.Duration) (*ModerationFilter, error) {
-	if moderatorPubKey == "" {
+// NewModerationFilter creates the filter executing moderators' ban, nuke,
+// unban and restrict reactions, and deletes single events on delete
+// reactions, striking their authors through autoBan. Reactions by trainees are only logged, never enforced.
+// With reports enabled, it also bans authors reported by enough trusted
+// reporters. Slow mode reactions toggle rooms in slowMode, and block
+// reactions add the reacted-to event and its content to blocklist. Pubkeys
+// holding a role of protection are never banned.
+func NewModerationFilter(cfg *config.PolicyConfig, s store.Store, sf strfry.ClientInterface, slowMode *kitpolicy.SlowMode, autoBan *AutoBanFilter, blocklist *BlocklistFilter, protection *Protection) (*ModerationFilter, error) {
+	if cfg.ModeratorPubKey == "" {
 		slog.Warn("Policy.moderator_pubkey is not set in config, moderation filter will be disabled.")
 	}
-	return &ModerationFilter{
-		moderatorPubKey: moderatorPubKey,
-		banEmoji:        banEmoji,
-		unbanEmoji:      unbanEmoji,
-		store:           s,
-		sf:              sf,
-		banDuration:     banDuration,
-	}, nil
+	traineeSet := make(map[string]struct{}, len(cfg.TraineeModerators))
+	for _, pk := range cfg.TraineeModerators {
+		traineeSet[pk] = struct{}{}
+	}
+	f := &ModerationFilter{
+		moderatorPubKey:  cfg.ModeratorPubKey,
+		banEmoji:         cfg.BanEmoji,
+		nukeEmoji:        cfg.NukeEmoji,
+		unbanEmoji:       cfg.UnbanEmoji,
+		restrictEmoji:    cfg.RestrictEmoji,
+		deleteEmoji:      cfg.DeleteEmoji,
+		autoBan:          autoBan,
+		deleteStrike:     cfg.DeleteStrike,
+		protection:       protection,
+		blockEmoji:       cfg.BlockEmoji,
+		blocklist:        blocklist,
+		store:            s,
+		sf:               sf,
+		banDuration:      cfg.BanDuration,
+		restrictDuration: cfg.RestrictDuration,
+		trainees:         traineeSet,
+		reports:          &cfg.Reports,
+		slowModeEmoji:    cfg.SlowModeEmoji,
+		slowModeDelay:    cfg.SlowModeDelay,
+		slowModeDuration: cfg.SlowModeDuration,
+		slowMode:         slowMode,
+	}
+	if cfg.Reports.Enabled {
+		f.reporters = make(map[string]struct{}, len(cfg.Reports.TrustedReporters)+1)
+		for _, pk := range cfg.Reports.TrustedReporters {
+			f.reporters[pk] = struct{}{}
+		}
+		if cfg.ModeratorPubKey != "" {
+			f.reporters[cfg.ModeratorPubKey] = struct{}{}
+		}
+		f.reportBanDuration = cfg.Reports.BanDuration
+		if f.reportBanDuration == 0 {
+			f.reportBanDuration = cfg.BanDuration
+		}
+		f.strikes = lru.NewLRU[string, map[string]struct{}](cfg.Reports.CacheSize, nil, cfg.Reports.Window)
+	}
+	return f, nil
 }
 
 func (f *ModerationFilter) Match(ctx context.Context, event *nostr.Event, meta map[string]any) (kitpolicy.FilterResult, error) {
 	newResult := kitpolicy.NewResultFunc(moderationFilterName)
 
-	if f.moderatorPubKey == "" || event.Kind != nostr.KindReaction || event.PubKey != f.moderatorPubKey {
+	if event.Kind == nostr.KindReporting && f.strikes != nil {
+		return f.report(ctx, event, newResult)
+	}
+	if event.Kind != nostr.KindReaction {
+		return newResult(true, "not_a_moderation_event", nil)
+	}
+	if _, ok := f.trainees[event.PubKey]; ok {
+		return f.traineeAction(ctx, event, newResult)
+	}
+	if f.moderatorPubKey == "" || event.PubKey != f.moderatorPubKey {
 		return newResult(true, "not_a_moderation_event", nil)
 	}
+	if f.isSlowMode(event.Content) {
+		return f.toggleSlowMode(ctx, event, newResult)
+	}
 
 	pTag := event.Tags.FindLast("p")
 	if len(pTag) < 2 {
 		return newResult(true, "no_pubkey_tag_in_reaction", nil)
 	}
 
-	pubkeyToModify := pTag[1]
-	if !nostr.IsValidPublicKey(pubkeyToModify) || pubkeyToModify == f.moderatorPubKey {
+	// Some clients put npub strings into "p" tags; accept them too.
+	pubkeyToModify, err := nip.NormalizePubKey(pTag[1])
+	if err != nil || pubkeyToModify == f.moderatorPubKey {
 		return newResult(true, "invalid_target_pubkey", nil)
 	}
 
+	if !f.isAction(event.Content) {
+		return newResult(true, "emoji_not_matched", nil)
+	}
+	if event.Content == f.banEmoji || event.Content == f.nukeEmoji {
+		if role := f.protection.Role(pubkeyToModify); role != "" {
+			slog.WarnContext(ctx, "Moderator action refused: pubkey is protected", "pubkey", pubkeyToModify, "role", role)
+			return newResult(true, "moderator_ban_refused:protected_"+string(role), nil)
+		}
+	}
+	if SideEffectsSuppressed(ctx) {
+		return newResult(true, "moderator_action_skipped_without_side_effects", nil)
+	}
+
 	switch event.Content {
 	case f.banEmoji:
-		slog.Info("Moderator action: banning pubkey", "banned_pubkey", pubkeyToModify)
-		if err := f.store.BanAuthor(ctx, pubkeyToModify, f.banDuration); err != nil {
+		// Only the reacted-to event goes, if the reaction names one.
+		eventID, _ := reactedEvent(event)
+		slog.InfoContext(ctx, "Moderator action: banning pubkey", "banned_pubkey", pubkeyToModify, "deleted_event_id", eventID)
+		if err := f.ban(ctx, pubkeyToModify, eventID, f.banDuration, store.BanInfo{Reason: "moderator_reaction", Source: event.PubKey}); err != nil {
 			// A side-effect failed. Propagate the error to the pipeline.
 			return newResult(true, "moderator_ban_failed", err)
 		}
-		go func() {
-			if err := f.sf.DeleteEventsByAuthor(pubkeyToModify); err != nil {
-				slog.Error("Failed to delete events after moderator ban", "error", err, "pubkey", pubkeyToModify)
-			}
-		}()
 		return newResult(true, "moderator_ban_executed", nil)
 
+	case f.nukeEmoji:
+		slog.InfoContext(ctx, "Moderator action: banning pubkey and deleting all its events", "banned_pubkey", pubkeyToModify)
+		if err := f.ban(ctx, pubkeyToModify, "", f.banDuration, store.BanInfo{Reason: "moderator_reaction", Source: event.PubKey}); err != nil {
+			return newResult(true, "moderator_nuke_failed", err)
+		}
+		return newResult(true, "moderator_nuke_executed", nil)
+
 	case f.unbanEmoji:
-		slog.Info("Moderator action: unbanning pubkey", "unbanned_pubkey", pubkeyToModify)
+		slog.InfoContext(ctx, "Moderator action: unbanning pubkey", "unbanned_pubkey", pubkeyToModify)
 		if err := f.store.UnbanAuthor(ctx, pubkeyToModify); err != nil {
 			return newResult(true, "moderator_unban_failed", err)
 		}
+		// Unbanning restores full access, so restrictions go too.
+		if err := f.store.LiftRestrictions(ctx, pubkeyToModify, nil); err != nil {
+			return newResult(true, "moderator_unban_failed", err)
+		}
 		return newResult(true, "moderator_unban_executed", nil)
+
+	case f.restrictEmoji:
+		kind, ok := reactedKind(event)
+		if !ok {
+			return newResult(true, "no_kind_tag_in_reaction", nil)
+		}
+		slog.InfoContext(ctx, "Moderator action: restricting pubkey", "restricted_pubkey", pubkeyToModify, "kind", kind)
+		if err := f.store.RestrictKinds(ctx, pubkeyToModify, []int{kind}, f.restrictDuration); err != nil {
+			return newResult(true, "moderator_restrict_failed", err)
+		}
+		return newResult(true, "moderator_restrict_executed", nil)
+
+	case f.deleteEmoji:
+		eventID, ok := reactedEvent(event)
+		if !ok {
+			return newResult(true, "no_event_tag_in_reaction", nil)
+		}
+		slog.InfoContext(ctx, "Moderator action: deleting event", "deleted_event_id", eventID, "author_pubkey", pubkeyToModify)
+		f.deleteEvent(ctx, eventID, pubkeyToModify)
+		if f.deleteStrike && f.autoBan != nil {
+			// The moderator's address is not the author's: no IP ban.
+			f.autoBan.Strike(ctx, pubkeyToModify, moderationFilterName, "")
+		}
+		return newResult(true, "moderator_delete_executed", nil)
+
+	case f.blockEmoji:
+		eventID, ok := reactedEvent(event)
+		if !ok {
+			return newResult(true, "no_event_tag_in_reaction", nil)
+		}
+		slog.InfoContext(ctx, "Moderator action: blocking event", "blocked_event_id", eventID, "author_pubkey", pubkeyToModify)
+		keys, err := f.blocklist.BlockEvent(ctx, eventID, f.blocklist.cfg.Duration, store.BanInfo{Reason: "moderator_reaction", Source: event.PubKey})
+		if err != nil {
+			return newResult(true, "moderator_block_failed", err)
+		}
+		slog.InfoContext(ctx, "Moderator action: blocked", "keys", keys)
+		f.deleteEvent(ctx, eventID, pubkeyToModify)
+		return newResult(true, "moderator_block_executed", nil)
 	}
 
 	return newResult(true, "emoji_not_matched", nil)
 }
+
+// ban bans pubkey and deletes its stored event eventID or, if eventID is
+// empty, all its stored events in the background.
+func (f *ModerationFilter) ban(ctx context.Context, pubkey, eventID string, duration time.Duration, info store.BanInfo) error {
+	if err := f.store.BanAuthor(ctx, pubkey, duration, info); err != nil {
+		return err
+	}
+	if eventID != "" {
+		f.deleteEvent(ctx, eventID, pubkey)
+		return nil
+	}
+	action := journal(ctx, f.store, store.Action{Type: store.ActionDeleteEvents, PubKey: pubkey})
+	go func() {
+		if err := f.sf.DeleteEventsByAuthor(pubkey); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete events after ban", "error", err, "pubkey", pubkey)
+			return
+		}
+		complete(ctx, f.store, action)
+	}()
+	return nil
+}
+
+// deleteEvent deletes the stored event id in the background.
+func (f *ModerationFilter) deleteEvent(ctx context.Context, id, author string) {
+	action := journal(ctx, f.store, store.Action{Type: store.ActionDeleteEvent, PubKey: author, EventID: id})
+	go func() {
+		if err := f.sf.DeleteEvent(id); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete event", "error", err, "event_id", id)
+			return
+		}
+		complete(ctx, f.store, action)
+	}()
+}
+
+// toggleSlowMode puts the room of the reacted-to chat message in slow mode,
+// or lifts it if the room is in slow mode already.
+func (f *ModerationFilter) toggleSlowMode(ctx context.Context, event *nostr.Event, newResult func(bool, string, error) (kitpolicy.FilterResult, error)) (kitpolicy.FilterResult, error) {
+	room, ok := f.slowMode.RoomOf(event)
+	if !ok {
+		return newResult(true, "chat_room_not_found", nil)
+	}
+	if SideEffectsSuppressed(ctx) {
+		return newResult(true, "moderator_action_skipped_without_side_effects", nil)
+	}
+	if !f.slowMode.Toggle(room, f.slowModeDelay, f.slowModeDuration) {
+		slog.InfoContext(ctx, "Moderator action: slow mode lifted", "room", room)
+		return newResult(true, "moderator_slow_mode_lifted", nil)
+	}
+	slog.InfoContext(ctx, "Moderator action: slow mode enabled",
+		"room", room, "delay", f.slowModeDelay, "duration", f.slowModeDuration)
+	return newResult(true, "moderator_slow_mode_enabled", nil)
+}
+
+// report counts a NIP-56 report by a trusted reporter as a strike against
+// the reported pubkey, banning it once enough distinct reporters agree. The
+// report itself is always accepted.
+func (f *ModerationFilter) report(ctx context.Context, event *nostr.Event, newResult func(bool, string, error) (kitpolicy.FilterResult, error)) (kitpolicy.FilterResult, error) {
+	if _, ok := f.reporters[event.PubKey]; !ok {
+		return newResult(true, "reporter_not_trusted", nil)
+	}
+
+	pTag := event.Tags.Find("p")
+	if len(pTag) < 2 {
+		return newResult(true, "no_pubkey_tag_in_report", nil)
+	}
+	target, err := nip.NormalizePubKey(pTag[1])
+	if err != nil || target == f.moderatorPubKey || target == event.PubKey {
+		return newResult(true, "invalid_target_pubkey", nil)
+	}
+	if len(f.reports.Types) > 0 && !slices.Contains(f.reports.Types, reportType(event, pTag)) {
+		return newResult(true, "report_type_not_counted", nil)
+	}
+	if role := f.protection.Role(target); role != "" {
+		slog.DebugContext(ctx, "Not counting a report against a protected pubkey", "pubkey", target, "role", role)
+		return newResult(true, "report_target_protected:"+string(role), nil)
+	}
+	if SideEffectsSuppressed(ctx) {
+		return newResult(true, "report_skipped_without_side_effects", nil)
+	}
+
+	f.mu.Lock()
+	reporters, ok := f.strikes.Get(target)
+	if !ok {
+		// Added once, so the window runs from the first report.
+		reporters = make(map[string]struct{})
+		f.strikes.Add(target, reporters)
+	}
+	reporters[event.PubKey] = struct{}{}
+	count := len(reporters)
+	if count >= f.reports.Threshold {
+		f.strikes.Remove(target)
+	}
+	f.mu.Unlock()
+
+	if count < f.reports.Threshold {
+		return newResult(true, fmt.Sprintf("report_strike_recorded:reporters_%d,threshold_%d", count, f.reports.Threshold), nil)
+	}
+
+	slog.WarnContext(ctx, "Banning pubkey reported by trusted reporters",
+		"banned_pubkey", target, "reporters", count, "ban_duration", f.reportBanDuration)
+	if err := f.ban(ctx, target, "", f.reportBanDuration, store.BanInfo{
+		Reason: fmt.Sprintf("reported:reporters_%d", count),
+		Source: moderationFilterName,
+	}); err != nil {
+		return newResult(true, "report_ban_failed", err)
+	}
+	return newResult(true, "report_ban_executed", nil)
+}
+
+// reportType returns the NIP-56 report type, given as the third element of
+// the "p" tag or, for reported notes, of the "e" tag.
+func reportType(event *nostr.Event, pTag nostr.Tag) string {
+	if len(pTag) >= 3 && pTag[2] != "" {
+		return pTag[2]
+	}
+	if eTag := event.Tags.Find("e"); len(eTag) >= 3 {
+		return eTag[2]
+	}
+	return ""
+}
+
+// traineeAction records what a trainee moderator's reaction would have done.
+func (f *ModerationFilter) traineeAction(ctx context.Context, event *nostr.Event, newResult func(bool, string, error) (kitpolicy.FilterResult, error)) (kitpolicy.FilterResult, error) {
+	if !f.isAction(event.Content) {
+		return newResult(true, "emoji_not_matched", nil)
+	}
+	if f.isSlowMode(event.Content) {
+		room, ok := f.slowMode.RoomOf(event)
+		if !ok {
+			return newResult(true, "chat_room_not_found", nil)
+		}
+		slog.InfoContext(ctx, "Trainee moderator action (not enforced)",
+			"trainee_pubkey", event.PubKey, "action", "slow_mode", "room", room, "event_id", event.ID)
+		return newResult(true, "trainee_slow_mode_not_enforced", nil)
+	}
+	var action string
+	switch event.Content {
+	case f.banEmoji:
+		action = "ban"
+	case f.nukeEmoji:
+		action = "nuke"
+	case f.unbanEmoji:
+		action = "unban"
+	case f.restrictEmoji:
+		action = "restrict"
+	case f.deleteEmoji:
+		action = "delete"
+	case f.blockEmoji:
+		action = "block"
+	default:
+		return newResult(true, "emoji_not_matched", nil)
+	}
+
+	target := ""
+	if pTag := event.Tags.FindLast("p"); len(pTag) >= 2 {
+		target, _ = nip.NormalizePubKey(pTag[1])
+	}
+	if target == "" {
+		return newResult(true, "no_pubkey_tag_in_reaction", nil)
+	}
+
+	slog.InfoContext(ctx, "Trainee moderator action (not enforced)",
+		"trainee_pubkey", event.PubKey, "action", action, "target_pubkey", target, "event_id", event.ID)
+	return newResult(true, "trainee_"+action+"_not_enforced", nil)
+}
+
+// isAction reports whether content is one of the configured action emojis.
+func (f *ModerationFilter) isAction(content string) bool {
+	return content != "" && (content == f.banEmoji || content == f.nukeEmoji || content == f.unbanEmoji ||
+		content == f.restrictEmoji || content == f.deleteEmoji || content == f.slowModeEmoji ||
+		(content == f.blockEmoji && f.blocklist != nil))
+}
+
+// isSlowMode reports whether content is the slow mode emoji.
+func (f *ModerationFilter) isSlowMode(content string) bool {
+	return content != "" && content == f.slowModeEmoji && f.slowMode != nil
+}
+
+// reactedEvent returns the ID of the reacted-to event from the NIP-25 "e"
+// tag, the last one being the reacted-to event.
+func reactedEvent(event *nostr.Event) (string, bool) {
+	tag := event.Tags.FindLast("e")
+	if len(tag) < 2 || !nostr.IsValid32ByteHex(tag[1]) {
+		return "", false
+	}
+	return tag[1], true
+}
+
+// reactedKind returns the kind of the reacted-to event from the NIP-25 "k"
+// tag; restricting an author applies to that kind.
+func reactedKind(event *nostr.Event) (int, bool) {
+	tag := event.Tags.Find("k")
+	if len(tag) < 2 {
+		return 0, false
+	}
+	kind, err := strconv.Atoi(tag[1])
+	return kind, err == nil && kind >= 0
+}
@@ -0,0 +1,155 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/store"
+	"github.com/lessucettes/adresu-plugin/internal/strfry"
+)
+
+// Moderator bans and unbans pubkeys and addresses outside of the event
+// stream, e.g. from the admin API, with the side effects of moderator
+// reactions: bans can delete the pubkey's events from strfry and unbans lift
+// its kind restrictions. Changes are dropped from the ban caches of the
+// current pipeline, so they take effect with the next event.
+type Moderator struct {
+	store   store.Store
+	sf      strfry.ClientInterface
+	current func() *Pipeline
+}
+
+// NewModerator creates a Moderator; current returns the pipeline in use,
+// which changes on reloads.
+func NewModerator(s store.Store, sf strfry.ClientInterface, current func() *Pipeline) *Moderator {
+	return &Moderator{store: s, sf: sf, current: current}
+}
+
+// Ban bans pubkey for duration and, with deleteEvents, deletes its stored
+// events in the background.
+func (m *Moderator) Ban(ctx context.Context, pubkey string, duration time.Duration, info store.BanInfo, deleteEvents bool) error {
+	if err := m.store.BanAuthor(ctx, pubkey, duration, info); err != nil {
+		return err
+	}
+	eachFilter(m.current(), func(f *BannedAuthorFilter) { f.cache.Remove(strings.ToLower(pubkey)) })
+	if !deleteEvents {
+		return nil
+	}
+	ctx = context.WithoutCancel(ctx)
+	action := journal(ctx, m.store, store.Action{Type: store.ActionDeleteEvents, PubKey: pubkey})
+	go func() {
+		if err := m.sf.DeleteEventsByAuthor(pubkey); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete events after ban", "error", err, "pubkey", pubkey)
+			return
+		}
+		complete(ctx, m.store, action)
+	}()
+	return nil
+}
+
+// Unban lifts the ban and the kind restrictions of pubkey.
+func (m *Moderator) Unban(ctx context.Context, pubkey string) error {
+	if err := m.store.UnbanAuthor(ctx, pubkey); err != nil {
+		return err
+	}
+	eachFilter(m.current(), func(f *BannedAuthorFilter) { f.cache.Remove(strings.ToLower(pubkey)) })
+	return m.store.LiftRestrictions(ctx, pubkey, nil)
+}
+
+// BanIP bans the address or network of ip, normalized like by the
+// BannedIPFilter, and returns the banned key.
+func (m *Moderator) BanIP(ctx context.Context, ip string, duration time.Duration, info store.BanInfo) (string, error) {
+	key := m.ipKey(ip)
+	if err := m.store.BanIP(ctx, key, duration, info); err != nil {
+		return "", err
+	}
+	eachFilter(m.current(), func(f *BannedIPFilter) { f.cache.Remove(key) })
+	return key, nil
+}
+
+// UnbanIP lifts the ban of the address or network of ip and returns its key.
+func (m *Moderator) UnbanIP(ctx context.Context, ip string) (string, error) {
+	key := m.ipKey(ip)
+	if err := m.store.UnbanIP(ctx, key); err != nil {
+		return "", err
+	}
+	eachFilter(m.current(), func(f *BannedIPFilter) { f.cache.Remove(key) })
+	return key, nil
+}
+
+// BlockEvent blocks the event id and its content with the current
+// BlocklistFilter, or only the id if there is none, and deletes the stored
+// event in the background. It returns the blocked keys.
+func (m *Moderator) BlockEvent(ctx context.Context, id string, duration time.Duration, info store.BanInfo) ([]string, error) {
+	id = strings.ToLower(id)
+	var keys []string
+	var err error
+	blocked := false
+	eachFilter(m.current(), func(f *BlocklistFilter) {
+		if !blocked {
+			keys, err = f.BlockEvent(ctx, id, duration, info)
+			blocked = true
+		}
+	})
+	if !blocked {
+		keys = []string{EventBlockKey(id)}
+		err = m.Block(ctx, keys[0], duration, info)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithoutCancel(ctx)
+	action := journal(ctx, m.store, store.Action{Type: store.ActionDeleteEvent, EventID: id})
+	go func() {
+		if err := m.sf.DeleteEvent(id); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete event after block", "error", err, "event_id", id)
+			return
+		}
+		complete(ctx, m.store, action)
+	}()
+	return keys, nil
+}
+
+// Block adds a blocklist key, as built by EventBlockKey or ContentBlockKey,
+// for duration.
+func (m *Moderator) Block(ctx context.Context, key string, duration time.Duration, info store.BanInfo) error {
+	if err := m.store.Block(ctx, key, duration, info); err != nil {
+		return err
+	}
+	eachFilter(m.current(), func(f *BlocklistFilter) { f.cache.Remove(key) })
+	return nil
+}
+
+// Unblock removes a blocklist key. Keys listed in the config stay blocked.
+func (m *Moderator) Unblock(ctx context.Context, key string) error {
+	if err := m.store.Unblock(ctx, key); err != nil {
+		return err
+	}
+	eachFilter(m.current(), func(f *BlocklistFilter) { f.cache.Remove(key) })
+	return nil
+}
+
+// ipKey normalizes ip with the prefixes of the current BannedIPFilter.
+// Networks in CIDR notation, as listed by IPBans, are kept as they are.
+func (m *Moderator) ipKey(ip string) string {
+	if strings.Contains(ip, "/") {
+		return ip
+	}
+	key := ip
+	eachFilter(m.current(), func(f *BannedIPFilter) { key = f.Key(ip) })
+	return key
+}
+
+// eachFilter calls fn with every filter of type F in p, if any.
+func eachFilter[F any](p *Pipeline, fn func(F)) {
+	if p == nil {
+		return
+	}
+	for _, stage := range p.stages {
+		if f, ok := stage.Filter.(F); ok {
+			fn(f)
+		}
+	}
+}
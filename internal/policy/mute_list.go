@@ -0,0 +1,242 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/schedule"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+const (
+	muteListSyncName = "MuteListSync"
+	// muteListBanReason marks the bans mirrored from mute lists, with the
+	// list owner as their source.
+	muteListBanReason = "mute_list"
+)
+
+// MuteListSync mirrors the mute lists of moderators into bans, so that muting
+// a pubkey from any client bans it from the relay and unmuting it lifts the
+// ban. It never judges events: it applies the lists it sees passing through
+// the pipeline and refreshes them periodically. Bans issued by anything else
+// are left alone, even for muted pubkeys.
+type MuteListSync struct {
+	cfg     *config.MuteListConfig
+	store   store.Store
+	scanner EventScanner
+	banned  *BannedAuthorFilter
+	owners  map[string]struct{}
+
+	// mu serializes the application of lists, guarding lists.
+	mu sync.Mutex
+	// lists holds the applied version of each owner's list.
+	lists map[string]muteList
+
+	// unschedule removes the refresh job.
+	unschedule func()
+}
+
+type muteList struct {
+	createdAt nostr.Timestamp
+	pubkeys   map[string]struct{}
+}
+
+// NewMuteListSync starts refreshing the mute lists, if enabled. banned, whose
+// ban cache is kept up to date, may be nil.
+func NewMuteListSync(cfg *config.MuteListConfig, s store.Store, scanner EventScanner, banned *BannedAuthorFilter, sched *schedule.Scheduler) *MuteListSync {
+	m := &MuteListSync{cfg: cfg, store: s, scanner: scanner, banned: banned, lists: make(map[string]muteList)}
+	if !cfg.Enabled {
+		return m
+	}
+	m.owners = make(map[string]struct{}, len(cfg.PubKeys))
+	for _, pk := range cfg.PubKeys {
+		m.owners[pk] = struct{}{}
+	}
+	m.unschedule = sched.Add(schedule.Job{
+		Name:        config.JobMuteListRefresh,
+		Schedule:    schedule.Every(cfg.RefreshInterval),
+		Run:         m.refresh,
+		Immediately: true,
+	})
+	return m
+}
+
+func (m *MuteListSync) Match(ctx context.Context, event *nostr.Event, _ map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(muteListSyncName)
+
+	if !m.isMuteList(event) {
+		return newResult(true, "not_a_mute_list", nil)
+	}
+	if SideEffectsSuppressed(ctx) {
+		return newResult(true, "mute_list_skipped_without_side_effects", nil)
+	}
+	// The list is accepted even if mirroring it fails; the next refresh
+	// retries.
+	if err := m.apply(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Failed to apply mute list", "owner", event.PubKey, "error", err)
+		return newResult(true, "mute_list_apply_failed", nil)
+	}
+	return newResult(true, "mute_list_applied", nil)
+}
+
+// Close removes the refresh job.
+func (m *MuteListSync) Close() error {
+	if m.unschedule != nil {
+		m.unschedule()
+	}
+	return nil
+}
+
+func (m *MuteListSync) isMuteList(event *nostr.Event) bool {
+	if event.Kind != nostr.KindMuteList {
+		return false
+	}
+	_, ok := m.owners[event.PubKey]
+	return ok
+}
+
+// refresh fetches and applies the latest list of every owner. A failed or
+// empty fetch keeps the current bans.
+func (m *MuteListSync) refresh(parent context.Context) error {
+	ctx, cancel := context.WithTimeout(parent, m.cfg.Timeout)
+	defer cancel()
+
+	filter := nostr.Filter{Kinds: []int{nostr.KindMuteList}, Authors: m.cfg.PubKeys}
+	events, err := queryEvents(ctx, m.scanner, m.cfg.Relays, filter)
+	if err != nil {
+		return fmt.Errorf("failed to fetch mute lists, keeping the current bans: %w", err)
+	}
+	latest := make(map[string]*nostr.Event, len(m.cfg.PubKeys))
+	for _, ev := range events {
+		if cur, ok := latest[ev.PubKey]; m.isMuteList(ev) && (!ok || ev.CreatedAt > cur.CreatedAt) {
+			latest[ev.PubKey] = ev
+		}
+	}
+	var errs []error
+	for _, ev := range latest {
+		if err := m.apply(ctx, ev); err != nil {
+			errs = append(errs, fmt.Errorf("mute list of %s: %w", ev.PubKey, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// apply bans the pubkeys muted by event, renewing their bans, and unbans
+// those its owner no longer mutes. An older version than the one applied is
+// ignored; the same version renews the bans.
+func (m *MuteListSync) apply(ctx context.Context, event *nostr.Event) error {
+	owner := event.PubKey
+	muted := make(map[string]struct{})
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "p" && nostr.IsValidPublicKey(tag[1]) && !m.isOwner(tag[1]) {
+			muted[strings.ToLower(tag[1])] = struct{}{}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur, ok := m.lists[owner]; ok && event.CreatedAt < cur.createdAt {
+		return nil
+	}
+
+	var banned, renewed int
+	for pk := range muted {
+		ban, err := m.store.GetBanInfo(ctx, pk)
+		if err != nil {
+			return err
+		}
+		if ban != nil {
+			if ban.Reason != muteListBanReason {
+				continue // Banned otherwise: the stricter ban stays.
+			}
+			if time.Until(ban.ExpiresAt) > m.cfg.BanDuration/2 {
+				continue // Renewed recently enough.
+			}
+			renewed++
+		} else {
+			banned++
+		}
+		if err := m.store.BanAuthor(ctx, pk, m.cfg.BanDuration, store.BanInfo{Reason: muteListBanReason, Source: owner}); err != nil {
+			return err
+		}
+		m.forget(pk)
+	}
+
+	unbanned, err := m.unbanUnmuted(ctx, owner, muted)
+	if err != nil {
+		return err
+	}
+	m.lists[owner] = muteList{createdAt: event.CreatedAt, pubkeys: muted}
+	if banned > 0 || unbanned > 0 {
+		slog.InfoContext(ctx, "Mute list applied", "owner", owner, "created_at", event.CreatedAt,
+			"muted", len(muted), "banned", banned, "renewed", renewed, "unbanned", unbanned)
+	}
+	return nil
+}
+
+// unbanUnmuted lifts the bans mirrored from owner's list for the pubkeys it
+// no longer mutes, unless another owner's list still mutes them.
+func (m *MuteListSync) unbanUnmuted(ctx context.Context, owner string, muted map[string]struct{}) (int, error) {
+	authors, err := m.store.Authors(ctx)
+	if err != nil {
+		return 0, err
+	}
+	unbanned := 0
+	for _, a := range authors {
+		if a.BannedUntil.IsZero() || m.mutedByAny(a.PubKey, owner, muted) {
+			continue
+		}
+		ban, err := m.store.GetBanInfo(ctx, a.PubKey)
+		if err != nil {
+			return unbanned, err
+		}
+		if ban == nil || ban.Reason != muteListBanReason || ban.Source != owner {
+			continue
+		}
+		if err := m.store.UnbanAuthor(ctx, a.PubKey); err != nil {
+			return unbanned, err
+		}
+		m.forget(a.PubKey)
+		unbanned++
+	}
+	return unbanned, nil
+}
+
+// mutedByAny reports whether pubkey is in muted, owner's new list, or in the
+// applied list of another owner. m.mu must be held.
+func (m *MuteListSync) mutedByAny(pubkey, owner string, muted map[string]struct{}) bool {
+	if _, ok := muted[pubkey]; ok {
+		return true
+	}
+	for other, list := range m.lists {
+		if other == owner {
+			continue
+		}
+		if _, ok := list.pubkeys[pubkey]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MuteListSync) isOwner(pubkey string) bool {
+	_, ok := m.owners[pubkey]
+	return ok
+}
+
+// forget drops pubkey from the ban cache, so the change takes effect with
+// the next event.
+func (m *MuteListSync) forget(pubkey string) {
+	if m.banned != nil {
+		m.banned.cache.Remove(pubkey)
+	}
+}
@@ -0,0 +1,177 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/trace"
+)
+
+const (
+	originFilterName = "OriginFilter"
+	originPeerCache  = 1024
+)
+
+// originClaim is an assertion that relay serves the event with the given ID.
+type originClaim struct {
+	peer    string // The relay that delivered the event.
+	relay   string
+	eventID string
+	traceID string // Of the event that made the claim.
+}
+
+// OriginFilter verifies, for a sample of events synced or streamed from other
+// relays, that the delivering relay actually serves them. For NIP-03
+// attestations it also checks that the attested event is served by the
+// relay the attestation points to. Verification runs in the background, so
+// it cannot reject the sampled event itself; instead, peers that repeatedly
+// deliver events they do not serve are flagged, and their events are handled
+// per the configured action for flag_duration.
+type OriginFilter struct {
+	cfg      *config.OriginFilterConfig
+	queue    chan originClaim
+	failures *lru.LRU[string, int]
+	flagged  *lru.LRU[string, struct{}]
+	mu       sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewOriginFilter(cfg *config.OriginFilterConfig) (*OriginFilter, error) {
+	f := &OriginFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	f.queue = make(chan originClaim, cfg.QueueSize)
+	f.failures = lru.NewLRU[string, int](originPeerCache, nil, cfg.FailureTTL)
+	f.flagged = lru.NewLRU[string, struct{}](originPeerCache, nil, cfg.FlagDuration)
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	f.wg.Add(1)
+	go f.run()
+	return f, nil
+}
+
+func (f *OriginFilter) Match(ctx context.Context, event *nostr.Event, _ map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(originFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	peer, ok := SourceFrom(ctx).FromRelay()
+	if !ok {
+		return newResult(true, "not_from_relay", nil)
+	}
+	peer = nostr.NormalizeURL(peer)
+
+	if _, flagged := f.flagged.Get(peer); flagged {
+		return kitpolicy.ActionResult(newResult, f.cfg.Action, fmt.Sprintf("origin_peer_flagged:'%s'", peer))
+	}
+
+	if !SideEffectsSuppressed(ctx) && rand.Float64() < f.cfg.SampleRate {
+		f.enqueue(ctx, originClaim{peer: peer, relay: peer, eventID: event.ID, traceID: trace.From(ctx)})
+		if event.Kind == nostr.KindOpenTimestamps {
+			if tag := event.Tags.Find("e"); len(tag) >= 3 && tag[2] != "" {
+				f.enqueue(ctx, originClaim{peer: peer, relay: nostr.NormalizeURL(tag[2]), eventID: tag[1], traceID: trace.From(ctx)})
+			}
+		}
+	}
+	return newResult(true, "origin_not_flagged", nil)
+}
+
+// enqueue never blocks; claims are dropped while the queue is full.
+func (f *OriginFilter) enqueue(ctx context.Context, c originClaim) {
+	select {
+	case f.queue <- c:
+	default:
+		slog.DebugContext(ctx, "Origin verification queue full, skipping claim", "relay", c.relay, "event_id", c.eventID)
+	}
+}
+
+func (f *OriginFilter) run() {
+	defer f.wg.Done()
+	relays := make(map[string]*nostr.Relay)
+	defer func() {
+		for _, r := range relays {
+			r.Close()
+		}
+	}()
+
+	for c := range f.queue {
+		served, err := f.verify(relays, c)
+		if err != nil {
+			// An unreachable relay proves nothing either way.
+			slog.DebugContext(trace.With(f.ctx, c.traceID), "Origin verification inconclusive",
+				"relay", c.relay, "event_id", c.eventID, "error", err)
+			continue
+		}
+		if !served {
+			f.recordFailure(c)
+		}
+	}
+}
+
+// verify asks the claimed relay for the event by ID.
+func (f *OriginFilter) verify(relays map[string]*nostr.Relay, c originClaim) (bool, error) {
+	relay := relays[c.relay]
+	if relay == nil || !relay.IsConnected() {
+		var err error
+		relay, err = nostr.RelayConnect(f.ctx, c.relay)
+		if err != nil {
+			delete(relays, c.relay)
+			return false, err
+		}
+		relays[c.relay] = relay
+	}
+
+	ctx, cancel := context.WithTimeout(f.ctx, f.cfg.Timeout)
+	defer cancel()
+	events, err := relay.QuerySync(ctx, nostr.Filter{IDs: []string{c.eventID}, Limit: 1})
+	if err != nil {
+		return false, err
+	}
+	if len(events) == 0 && ctx.Err() != nil {
+		// Timed out before EOSE: the relay never answered.
+		return false, ctx.Err()
+	}
+	return len(events) > 0, nil
+}
+
+func (f *OriginFilter) recordFailure(c originClaim) {
+	f.mu.Lock()
+	count, _ := f.failures.Get(c.peer)
+	count++
+	f.failures.Add(c.peer, count)
+	flag := count >= f.cfg.MaxFailures
+	if flag {
+		f.failures.Remove(c.peer)
+		f.flagged.Add(c.peer, struct{}{})
+	}
+	f.mu.Unlock()
+
+	slog.WarnContext(trace.With(f.ctx, c.traceID), "Relay does not serve an event it claims to have",
+		"peer", c.peer, "relay", c.relay, "event_id", c.eventID, "failures", count)
+	if flag {
+		slog.Error("Flagging peer for delivering fabricated events",
+			"peer", c.peer, "flag_duration", f.cfg.FlagDuration, "action", f.cfg.Action)
+	}
+}
+
+// Close stops the verification worker, abandoning queued claims.
+func (f *OriginFilter) Close() error {
+	if f.cancel == nil {
+		return nil
+	}
+	f.cancel()
+	close(f.queue)
+	f.wg.Wait()
+	return nil
+}
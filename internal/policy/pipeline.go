@@ -2,43 +2,103 @@ package policy
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"time"
 
 	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
 	"github.com/nbd-wtf/go-nostr"
 
 	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/geoip"
+	"github.com/lessucettes/adresu-plugin/internal/trace"
 )
 
 type MetricsCollector interface {
 	Report(res kitpolicy.FilterResult)
+	// ReportError counts a filter failure by its ErrorClass.
+	ReportError(filter, class string)
 }
 
 type PipelineStage struct {
 	Filter kitpolicy.Filter
+	// Name is the filter name the degradation ladder refers to.
+	Name string
+}
+
+// Hooks are the optional consumers of pipeline outcomes.
+type Hooks struct {
+	RejectionHandlers []RejectionHandler
+	AcceptHandlers    []AcceptanceHandler
+	DecisionObservers []DecisionObserver
+	// Cooldown, if set, imposes the configured cooldowns on rejections.
+	Cooldown  *CooldownFilter
+	Collector MetricsCollector
+	// PoWLane, if set, may override rejections during overload.
+	PoWLane *PoWLane
+	// Degrader, if set, skips filters under load.
+	Degrader *Degrader
+	// LoadShedder, if set, is told the latency of every decision.
+	LoadShedder *LoadShedder
+	// Canary, if set, compares every decision with a candidate config's.
+	Canary *Canary
+	// Experiment, if set, hands the events of some authors to the pipelines
+	// of their cohorts.
+	Experiment *Experiment
+	// GeoIP, if set, shares the origin of events with filters.
+	GeoIP *geoip.Locator
+	// ShadowBan, if set, deletes the shadow-banned events the pipeline
+	// accepts.
+	ShadowBan *ShadowBan
 }
 
 type Pipeline struct {
 	stages            []PipelineStage
+	groups            [][]PipelineStage
 	rejectionHandlers []RejectionHandler
+	acceptHandlers    []AcceptanceHandler
+	observers         []DecisionObserver
+	cooldown          *CooldownFilter
 	rejectionLevels   map[string]config.LogLevel
+	acceptWarnings    bool
+	latencyBudget     time.Duration
+	messages          messageTemplates
 	collector         MetricsCollector
+	powLane           *PoWLane
+	degrader          *Degrader
+	loadShedder       *LoadShedder
+	canary            *Canary
+	experiment        *Experiment
+	geoIP             *geoip.Locator
+	shadowBan         *ShadowBan
 	wg                sync.WaitGroup
 }
 
-func NewPipeline(
-	cfg *config.Config,
-	stages []PipelineStage,
-	handlers []RejectionHandler,
-	collector MetricsCollector,
-) *Pipeline {
+func NewPipeline(cfg *config.Config, stages []PipelineStage, hooks Hooks) *Pipeline {
 	return &Pipeline{
 		stages:            stages,
-		rejectionHandlers: handlers,
+		groups:            groupStages(stages, cfg.Pipeline.ParallelStages),
+		rejectionHandlers: hooks.RejectionHandlers,
+		acceptHandlers:    hooks.AcceptHandlers,
+		observers:         hooks.DecisionObservers,
+		cooldown:          hooks.Cooldown,
 		rejectionLevels:   cfg.Log.RejectionLevels,
-		collector:         collector,
+		acceptWarnings:    cfg.Policy.AcceptWarnings,
+		latencyBudget:     cfg.Pipeline.LatencyBudget,
+		messages:          newMessageTemplates(cfg.Messages, &cfg.Policy),
+		collector:         hooks.Collector,
+		powLane:           hooks.PoWLane,
+		degrader:          hooks.Degrader,
+		loadShedder:       hooks.LoadShedder,
+		geoIP:             hooks.GeoIP,
+		canary:            hooks.Canary,
+		experiment:        hooks.Experiment,
+		shadowBan:         hooks.ShadowBan,
 	}
 }
 
@@ -50,10 +110,43 @@ func (p *Pipeline) ProcessEvent(
 ) (response PolicyResponse, err error) {
 	p.wg.Add(1)
 	defer p.wg.Done()
+	ctx = withRemoteIP(ctx, remoteIP)
+
+	if p.experiment != nil {
+		c := p.experiment.assign(event.PubKey)
+		if c.pipeline != nil {
+			response, err = c.pipeline.ProcessEvent(ctx, event, remoteIP, dryRun)
+			p.experiment.record(c, event, response)
+			return response, err
+		}
+		defer func() { p.experiment.record(c, event, response) }()
+	}
+
+	// decidedBy is the result of the filter that rejected or shadow-banned
+	// the event, if any.
+	var decidedBy kitpolicy.FilterResult
+	var timings []StageTiming
+	start := time.Now()
+	if len(p.observers) > 0 || p.latencyBudget > 0 {
+		// Registered before the recover handler, so it also sees panic responses.
+		defer func() {
+			p.finish(ctx, event, remoteIP, response, decidedBy, time.Since(start), timings)
+		}()
+	}
+
+	if p.degrader != nil {
+		defer func() { p.degrader.Observe(time.Since(start)) }()
+	}
+	if p.loadShedder != nil {
+		defer func() { p.loadShedder.Observe(time.Since(start)) }()
+	}
+	if p.canary != nil {
+		defer func() { p.canary.Shadow(ctx, event, remoteIP, response) }()
+	}
 
 	defer func() {
 		if r := recover(); r != nil {
-			slog.Error("Panic recovered in filter pipeline",
+			slog.ErrorContext(ctx, "Panic recovered in filter pipeline",
 				"panic", r, "event_id", event.ID, "pubkey", event.PubKey, "stack", string(debug.Stack()),
 			)
 			response = PolicyResponse{ID: event.ID, Action: "reject", Msg: "internal: an unexpected error occurred"}
@@ -61,55 +154,302 @@ func (p *Pipeline) ProcessEvent(
 		}
 	}()
 
-	meta := map[string]any{
-		"remote_ip": remoteIP,
+	hostMeta := metaFrom(ctx)
+	meta := make(map[string]any, len(hostMeta)+1)
+	maps.Copy(meta, hostMeta)
+	meta["remote_ip"] = remoteIP
+	p.locate(meta, remoteIP)
+
+	var warnings []string
+	// shadowedBy is the first result shadow-banning the event, if any.
+	var shadowedBy kitpolicy.FilterResult
+	enforce := !dryRun && !SideEffectsSuppressed(ctx)
+	if enforce && p.cooldown != nil {
+		p.cooldown.share(meta)
 	}
 
-	for _, stage := range p.stages {
-		res, filterErr := stage.Filter.Match(ctx, event, meta)
-		if filterErr != nil {
-			slog.Error("Filter execution failed", "error", filterErr, "filter_name", res.Filter, "event_id", event.ID)
-			return PolicyResponse{ID: event.ID, Action: "reject", Msg: "internal: error in filter " + res.Filter}, filterErr
+	level := p.degrader.level()
+	for _, group := range p.groups {
+		if level != nil {
+			if group = level.filter(group); len(group) == 0 {
+				continue
+			}
 		}
+		results := p.runGroup(ctx, group, event, meta)
+		for _, r := range results {
+			res, filterErr := r.res, r.err
+			timings = append(timings, StageTiming{Filter: res.Filter, Reason: res.Reason, Duration: res.Duration})
+			if filterErr != nil {
+				decidedBy = res
+				if errors.Is(filterErr, context.DeadlineExceeded) && !errors.Is(filterErr, kitpolicy.ErrFilterTimeout) {
+					filterErr = fmt.Errorf("%w: %w", kitpolicy.ErrFilterTimeout, filterErr)
+				}
+				class := ErrorClass(filterErr)
+				slog.ErrorContext(ctx, "Filter execution failed", "error", filterErr, "error_class", class,
+					"filter_name", res.Filter, "event_id", event.ID)
+				if p.collector != nil {
+					p.collector.ReportError(res.Filter, class)
+				}
+				return PolicyResponse{ID: event.ID, Action: "reject", Msg: "internal: error in filter " + res.Filter}, filterErr
+			}
 
-		if p.collector != nil {
-			p.collector.Report(res)
-		}
+			if !res.Allowed && p.powLane != nil {
+				res = p.powLane.Admit(ctx, event, res)
+			}
+
+			if p.collector != nil {
+				p.collector.Report(res)
+			}
 
-		if !res.Allowed {
-			logAttrs := []slog.Attr{
-				slog.String("filter_name", res.Filter),
-				slog.String("remote_ip", remoteIP),
-				slog.String("event_id", event.ID),
-				slog.Int("kind", event.Kind),
-				slog.String("pubkey", event.PubKey),
-				slog.String("reason", res.Reason),
+			if res.Allowed && res.Warning != "" {
+				warnings = append(warnings, res.Warning)
 			}
-			logLevel := slog.LevelWarn
-			if level, ok := p.rejectionLevels[res.Filter]; ok {
-				logLevel = level.ToSlogLevel()
+
+			if res.Allowed && res.Strike {
+				slog.InfoContext(ctx, "Event accepted with a strike",
+					"filter_name", res.Filter, "event_id", event.ID, "pubkey", event.PubKey, "reason", res.Reason)
+				if enforce {
+					for _, handler := range p.rejectionHandlers {
+						handler.HandleRejection(ctx, event, res.Filter)
+					}
+				}
 			}
-			slog.LogAttrs(ctx, logLevel, "Event rejected by filter", logAttrs...)
 
-			if dryRun {
-				slog.LogAttrs(ctx, slog.LevelInfo, "Dry-run: Event would be rejected", logAttrs...)
-				return PolicyResponse{ID: event.ID, Action: "accept"}, nil
+			if res.Allowed && res.ShadowBan && shadowedBy.Filter == "" {
+				shadowedBy = res
 			}
 
-			for _, handler := range p.rejectionHandlers {
-				handler.HandleRejection(ctx, event, res.Filter)
+			if !res.Allowed {
+				decidedBy = res
+				logAttrs := decisionAttrs(res, event, remoteIP)
+				slog.LogAttrs(ctx, p.rejectionLevel(res.Filter), "Event rejected by filter", logAttrs...)
+
+				if dryRun {
+					slog.LogAttrs(ctx, slog.LevelInfo, "Dry-run: Event would be rejected", logAttrs...)
+					return PolicyResponse{ID: event.ID, Action: "accept"}, nil
+				}
+
+				if enforce {
+					for _, handler := range p.rejectionHandlers {
+						handler.HandleRejection(ctx, event, res.Filter)
+					}
+					if p.cooldown != nil {
+						p.cooldown.OnReject(event, remoteIP, res)
+					}
+				}
+
+				return PolicyResponse{ID: event.ID, Action: "reject", Msg: p.messages.render(res, event)}, nil
 			}
+		}
+	}
+
+	if shadowedBy.Filter != "" {
+		// Accepted like any other event, so its author cannot tell, but
+		// neither passed on to acceptance handlers nor warned about.
+		decidedBy = shadowedBy
+		logAttrs := decisionAttrs(shadowedBy, event, remoteIP)
+		slog.LogAttrs(ctx, p.rejectionLevel(shadowedBy.Filter), "Event shadow-banned by filter", logAttrs...)
+		if dryRun {
+			slog.LogAttrs(ctx, slog.LevelInfo, "Dry-run: Event would be shadow-banned", logAttrs...)
+			// Observed as accepted, as dry-run rejections are.
+			decidedBy.ShadowBan = false
+		} else if enforce && p.shadowBan != nil {
+			p.shadowBan.Remove(ctx, event)
+		}
+		return PolicyResponse{ID: event.ID, Action: "accept"}, nil
+	}
+
+	slog.DebugContext(ctx, "Event accepted by all filters", "event_id", event.ID, "pubkey", event.PubKey)
+	if !SideEffectsSuppressed(ctx) {
+		for _, handler := range p.acceptHandlers {
+			handler.HandleAcceptance(ctx, event)
+		}
+	}
+
+	response = PolicyResponse{ID: event.ID, Action: "accept"}
+	if p.acceptWarnings && len(warnings) > 0 {
+		response.Msg = "warning: " + strings.Join(warnings, "; ")
+	}
+	return response, nil
+}
+
+// Explain runs every stage on event in order, without stopping at a
+// rejection and without side effects, and returns all their results along
+// with the message a rejection would carry. Stateful filters still update
+// their own state, so it is meant for scratch pipelines.
+func (p *Pipeline) Explain(ctx context.Context, event *nostr.Event, remoteIP string) ([]kitpolicy.FilterResult, string, error) {
+	ctx = withRemoteIP(WithoutSideEffects(ctx), remoteIP)
+	meta := map[string]any{
+		"remote_ip": remoteIP,
+	}
+	p.locate(meta, remoteIP)
+	results := make([]kitpolicy.FilterResult, 0, len(p.stages))
+	msg := ""
+	for _, stage := range p.stages {
+		res, err := stage.Filter.Match(ctx, event, meta)
+		if err != nil {
+			return results, msg, fmt.Errorf("filter %s: %w", stage.Name, err)
+		}
+		if !res.Allowed && msg == "" {
+			msg = p.messages.render(res, event)
+		}
+		results = append(results, res)
+	}
+	return results, msg, nil
+}
+
+// decisionAttrs are the log attributes of a rejection or shadow ban by res.
+func decisionAttrs(res kitpolicy.FilterResult, event *nostr.Event, remoteIP string) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("filter_name", res.Filter),
+		slog.String("remote_ip", remoteIP),
+		slog.String("event_id", event.ID),
+		slog.Int("kind", event.Kind),
+		slog.String("pubkey", event.PubKey),
+		slog.String("reason", res.Reason),
+	}
+	if len(res.Values) > 0 {
+		attrs = append(attrs, slog.Any("values", res.Values))
+	}
+	return attrs
+}
+
+// rejectionLevel is the level rejections by filter are logged at.
+func (p *Pipeline) rejectionLevel(filter string) slog.Level {
+	if level, ok := p.rejectionLevels[filter]; ok {
+		return level.ToSlogLevel()
+	}
+	return slog.LevelWarn
+}
+
+// finish reports a completed decision to observers and logs events that
+// exceeded the latency budget, with the time each filter took.
+func (p *Pipeline) finish(
+	ctx context.Context,
+	event *nostr.Event,
+	remoteIP string,
+	response PolicyResponse,
+	res kitpolicy.FilterResult,
+	latency time.Duration,
+	timings []StageTiming,
+) {
+	if p.latencyBudget > 0 && latency > p.latencyBudget {
+		attrs := []any{"event_id", event.ID, "kind", event.Kind, "latency", latency, "budget", p.latencyBudget}
+		for _, t := range timings {
+			attrs = append(attrs, slog.Duration(t.Filter, t.Duration))
+		}
+		slog.WarnContext(ctx, "Event exceeded the latency budget", attrs...)
+	}
+	if len(p.observers) == 0 {
+		return
+	}
+
+	action := response.Action
+	if action == "accept" && res.ShadowBan {
+		action = "shadow"
+	}
+	d := Decision{
+		Time:     time.Now(),
+		TraceID:  trace.From(ctx),
+		EventID:  event.ID,
+		PubKey:   event.PubKey,
+		Kind:     event.Kind,
+		RemoteIP: remoteIP,
+		Action:   action,
+		Filter:   res.Filter,
+		Reason:   res.Reason,
+		Values:   res.Values,
+		Msg:      response.Msg,
+		Lookback: SideEffectsSuppressed(ctx),
+		Latency:  latency,
+		Stages:   timings,
+		Event:    event,
+	}
+	for _, o := range p.observers {
+		o.ObserveDecision(d)
+	}
+}
+
+type stageResult struct {
+	res kitpolicy.FilterResult
+	err error
+}
 
-			return PolicyResponse{ID: event.ID, Action: "reject", Msg: res.Reason}, nil
+// locate shares the country and regions of remoteIP with filters, if known.
+func (p *Pipeline) locate(meta map[string]any, remoteIP string) {
+	if p.geoIP == nil || remoteIP == "" {
+		return
+	}
+	country := p.geoIP.Country(remoteIP)
+	if country == "" {
+		return
+	}
+	meta[kitpolicy.MetaKeyCountry] = country
+	if regions := p.geoIP.Regions(country); len(regions) > 0 {
+		meta[kitpolicy.MetaKeyRegions] = regions
+	}
+}
+
+// runGroup evaluates a group of stages. Single stages run inline; groups of
+// independent stages run concurrently. Results are returned in stage order,
+// so the first rejection wins exactly as in sequential evaluation.
+func (p *Pipeline) runGroup(ctx context.Context, group []PipelineStage, event *nostr.Event, meta map[string]any) []stageResult {
+	results := make([]stageResult, len(group))
+	if len(group) == 1 {
+		results[0].res, results[0].err = group[0].Filter.Match(ctx, event, meta)
+		return results
+	}
+
+	var wg sync.WaitGroup
+	for i, stage := range group {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					slog.ErrorContext(ctx, "Panic recovered in parallel filter stage",
+						"panic", r, "event_id", event.ID, "stack", string(debug.Stack()))
+					results[i].err = fmt.Errorf("panic in filter: %v", r)
+				}
+			}()
+			results[i].res, results[i].err = stage.Filter.Match(ctx, event, meta)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// groupStages splits stages into evaluation groups. With parallelism enabled,
+// consecutive filters that declare themselves independent share a group.
+func groupStages(stages []PipelineStage, parallel bool) [][]PipelineStage {
+	var groups [][]PipelineStage
+	for _, stage := range stages {
+		n := len(groups)
+		if parallel && stage.independent() && n > 0 && groups[n-1][0].independent() {
+			groups[n-1] = append(groups[n-1], stage)
+			continue
 		}
+		groups = append(groups, []PipelineStage{stage})
 	}
+	return groups
+}
 
-	slog.Debug("Event accepted by all filters", "event_id", event.ID, "pubkey", event.PubKey)
-	return PolicyResponse{ID: event.ID, Action: "accept"}, nil
+func (s PipelineStage) independent() bool {
+	ind, ok := s.Filter.(kitpolicy.Independent)
+	return ok && ind.Independent()
 }
 
 func (p *Pipeline) Close() error {
 	p.wg.Wait()
+	p.degrader.Close()
+	if p.canary != nil {
+		if err := p.canary.Close(); err != nil {
+			slog.Error("Failed to close the canary pipeline", "error", err)
+		}
+	}
+	if p.experiment != nil {
+		p.experiment.Close()
+	}
 
 	for _, stage := range p.stages {
 		if closer, ok := stage.Filter.(interface{ Close() error }); ok {
@@ -118,5 +458,12 @@ func (p *Pipeline) Close() error {
 			}
 		}
 	}
+	for _, handler := range p.acceptHandlers {
+		if closer, ok := handler.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				slog.Error("Failed to close an acceptance handler", "handler", handler, "error", err)
+			}
+		}
+	}
 	return nil
 }
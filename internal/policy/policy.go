@@ -2,6 +2,8 @@ package policy
 
 import (
 	"context"
+	"net"
+	"time"
 
 	"github.com/nbd-wtf/go-nostr"
 )
@@ -15,3 +17,135 @@ type PolicyResponse struct {
 type RejectionHandler interface {
 	HandleRejection(ctx context.Context, ev *nostr.Event, filterName string)
 }
+
+// AcceptanceHandler is notified about every event the pipeline accepts.
+type AcceptanceHandler interface {
+	HandleAcceptance(ctx context.Context, ev *nostr.Event)
+}
+
+type sideEffectsKey struct{}
+
+// WithoutSideEffects marks ctx as belonging to an event that must be judged
+// but not enforced on, such as strfry "lookback" deliveries of stored events.
+// Strikes, bans, deletions and acceptance handlers are skipped for it.
+func WithoutSideEffects(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sideEffectsKey{}, true)
+}
+
+// SideEffectsSuppressed reports whether ctx was marked by WithoutSideEffects.
+func SideEffectsSuppressed(ctx context.Context) bool {
+	suppressed, _ := ctx.Value(sideEffectsKey{}).(bool)
+	return suppressed
+}
+
+type sourceKey struct{}
+
+// Source is where strfry received an event from: "IP4"/"IP6" for clients,
+// "Stream"/"Sync" for relays (with the relay URL as Info), "Import" or "Stored".
+type Source struct {
+	Type string
+	Info string
+}
+
+// FromRelay reports whether the event was delivered by another relay, and
+// which one.
+func (s Source) FromRelay() (string, bool) {
+	if (s.Type == "Stream" || s.Type == "Sync") && s.Info != "" {
+		return s.Info, true
+	}
+	return "", false
+}
+
+// WithSource attaches the event's source to ctx.
+func WithSource(ctx context.Context, src Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, src)
+}
+
+// SourceFrom returns the source attached by WithSource, if any.
+func SourceFrom(ctx context.Context) Source {
+	src, _ := ctx.Value(sourceKey{}).(Source)
+	return src
+}
+
+// ClientSource returns the source strfry reports for the events of a client
+// at ip, or false if ip is not an address.
+func ClientSource(ip string) (Source, bool) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return Source{}, false
+	}
+	if addr.To4() != nil {
+		return Source{Type: "IP4", Info: ip}, true
+	}
+	return Source{Type: "IP6", Info: ip}, true
+}
+
+type metaKey struct{}
+
+// WithMeta attaches entries for the meta map of an event's filters to ctx,
+// for hosts that know more of the submitting client than its address (see
+// kitpolicy.MetaKeyOrigin).
+func WithMeta(ctx context.Context, meta map[string]any) context.Context {
+	return context.WithValue(ctx, metaKey{}, meta)
+}
+
+// metaFrom returns the entries attached by WithMeta, if any.
+func metaFrom(ctx context.Context) map[string]any {
+	meta, _ := ctx.Value(metaKey{}).(map[string]any)
+	return meta
+}
+
+type remoteIPKey struct{}
+
+// withRemoteIP attaches the submitting client's address to ctx, for
+// handlers that only receive the event.
+func withRemoteIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, remoteIPKey{}, ip)
+}
+
+// remoteIPFrom returns the address attached by withRemoteIP, if any.
+func remoteIPFrom(ctx context.Context) string {
+	ip, _ := ctx.Value(remoteIPKey{}).(string)
+	return ip
+}
+
+// Decision describes the final outcome for one event. Action is "accept",
+// "reject" or "shadow" for shadow-banned events, accepted but deleted after.
+// Filter and Reason are set when a filter rejected or shadow-banned the event
+// (or would have, in dry-run mode).
+type Decision struct {
+	Time     time.Time `json:"time"`
+	TraceID  string    `json:"trace_id,omitempty"`
+	EventID  string    `json:"event_id"`
+	PubKey   string    `json:"pubkey"`
+	Kind     int       `json:"kind"`
+	RemoteIP string    `json:"remote_ip,omitempty"`
+	Action   string    `json:"action"`
+	Filter   string    `json:"filter,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	// Values are the details behind Reason, as the filter computed them
+	// (limits, retry-after seconds, detected language...).
+	Values map[string]any `json:"values,omitempty"`
+	Msg    string         `json:"msg,omitempty"`
+	// Lookback is set for events judged without side effects.
+	Lookback bool `json:"lookback,omitempty"`
+	// Latency is the total processing time; Stages attributes it to filters.
+	Latency time.Duration `json:"latency_ns"`
+	Stages  []StageTiming `json:"stages,omitempty"`
+	// Event is the judged event, for observers that inspect content. It is
+	// not serialized; observers must not modify it.
+	Event *nostr.Event `json:"-"`
+}
+
+// StageTiming is the time one filter spent on an event, and its verdict.
+type StageTiming struct {
+	Filter   string        `json:"filter"`
+	Reason   string        `json:"reason,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// DecisionObserver receives every decision the pipeline makes. Implementations
+// must not block.
+type DecisionObserver interface {
+	ObserveDecision(d Decision)
+}
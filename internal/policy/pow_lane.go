@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+)
+
+// SaturationGuard reports whether global throughput is being capped, as
+// kitpolicy.FairnessFilter does.
+type SaturationGuard interface {
+	Saturated() bool
+}
+
+// PoWLane is a priority lane for events carrying NIP-13 proof of work. While
+// the relay is overloaded it overrides rejections by the configured filters
+// for events meeting the current difficulty, and advertises that difficulty
+// in the rejections of everyone else.
+type PoWLane struct {
+	cfg       *config.PoWLaneConfig
+	emergency bool
+	guard     SaturationGuard
+
+	mu          sync.Mutex
+	windowStart time.Time
+	current     int
+	previous    int
+}
+
+// NewPoWLane returns nil when the lane is disabled. guard may be nil.
+func NewPoWLane(cfg *config.Config, guard SaturationGuard) *PoWLane {
+	if !cfg.Pipeline.PoWLane.Enabled {
+		return nil
+	}
+	return &PoWLane{
+		cfg:         &cfg.Pipeline.PoWLane,
+		emergency:   cfg.Filters.Emergency.Enabled,
+		guard:       guard,
+		windowStart: time.Now(),
+	}
+}
+
+// Active reports whether the relay is overloaded.
+func (l *PoWLane) Active() bool {
+	return l.emergency || (l.guard != nil && l.guard.Saturated())
+}
+
+// Admit reviews a rejection. It returns res unchanged if the lane does not
+// apply, an accepting result if the event has enough proof of work, and
+// otherwise res with the required difficulty added to its reason and values.
+func (l *PoWLane) Admit(ctx context.Context, event *nostr.Event, res kitpolicy.FilterResult) kitpolicy.FilterResult {
+	if res.Allowed || !slices.Contains(l.cfg.Filters, res.Filter) || !l.Active() {
+		return res
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	difficulty := l.difficulty(now)
+	admitted := nip.IsPoWValid(event, difficulty)
+	if admitted {
+		l.current++
+	}
+	l.mu.Unlock()
+
+	if admitted {
+		slog.DebugContext(ctx, "Event admitted through the PoW lane",
+			"filter_name", res.Filter, "event_id", event.ID, "difficulty", difficulty, "overridden_reason", res.Reason)
+		return kitpolicy.FilterResult{
+			Allowed:  true,
+			Reason:   fmt.Sprintf("pow_lane_admitted:difficulty_%d", difficulty),
+			Filter:   res.Filter,
+			Duration: res.Duration,
+		}
+	}
+
+	sep := ":"
+	if strings.Contains(res.Reason, ":") {
+		sep = ","
+	}
+	res.Reason += fmt.Sprintf("%spow_required_%d", sep, difficulty)
+	res.Values = maps.Clone(res.Values)
+	if res.Values == nil {
+		res.Values = make(map[string]any, 1)
+	}
+	res.Values["pow_difficulty"] = difficulty
+	return res
+}
+
+// difficulty is MinDifficulty plus one bit per doubling of the lane's
+// admission rate past TargetRate. The caller must hold l.mu.
+func (l *PoWLane) difficulty(now time.Time) int {
+	elapsed := now.Sub(l.windowStart)
+	switch {
+	case elapsed >= 2*l.cfg.Window:
+		l.previous, l.current = 0, 0
+		l.windowStart = now
+		elapsed = 0
+	case elapsed >= l.cfg.Window:
+		l.previous, l.current = l.current, 0
+		l.windowStart = l.windowStart.Add(l.cfg.Window)
+		elapsed = now.Sub(l.windowStart)
+	}
+	weight := 1 - float64(elapsed)/float64(l.cfg.Window)
+	rate := (float64(l.previous)*weight + float64(l.current)) / l.cfg.Window.Seconds()
+
+	difficulty := l.cfg.MinDifficulty
+	if rate > l.cfg.TargetRate {
+		difficulty += int(math.Ceil(math.Log2(rate / l.cfg.TargetRate)))
+	}
+	return min(difficulty, l.cfg.MaxDifficulty)
+}
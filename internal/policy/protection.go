@@ -0,0 +1,64 @@
+package policy
+
+import (
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// Protection tells which pubkeys automatic sanctions must spare: those
+// holding one of the policy.protected_roles.
+type Protection struct {
+	roles []config.ProtectedRole
+	// members holds the pubkeys of the moderator and bot roles.
+	members map[config.ProtectedRole]map[string]struct{}
+	// allowlist decides the allowlisted role; nil without an enabled
+	// whitelist.
+	allowlist *WhitelistFilter
+}
+
+// NewProtection builds the protection of cfg's roles. Allowlisted pubkeys
+// are those allowlist accepts.
+func NewProtection(cfg *config.Config, allowlist *WhitelistFilter) *Protection {
+	p := &Protection{
+		roles:   cfg.Policy.ProtectedRoles,
+		members: make(map[config.ProtectedRole]map[string]struct{}, 2),
+	}
+	moderators := make(map[string]struct{}, len(cfg.Policy.TraineeModerators)+1)
+	if cfg.Policy.ModeratorPubKey != "" {
+		moderators[cfg.Policy.ModeratorPubKey] = struct{}{}
+	}
+	for _, pk := range cfg.Policy.TraineeModerators {
+		moderators[pk] = struct{}{}
+	}
+	p.members[config.RoleModerator] = moderators
+
+	bots := make(map[string]struct{}, len(cfg.Policy.Bots))
+	for _, pk := range cfg.Policy.Bots {
+		bots[pk] = struct{}{}
+	}
+	p.members[config.RoleBot] = bots
+
+	if allowlist != nil && allowlist.cfg.Enabled {
+		p.allowlist = allowlist
+	}
+	return p
+}
+
+// Role returns the protected role held by pubkey, or "" if it holds none.
+// A nil Protection protects nobody.
+func (p *Protection) Role(pubkey string) config.ProtectedRole {
+	if p == nil {
+		return ""
+	}
+	for _, role := range p.roles {
+		if role == config.RoleAllowlisted {
+			if p.allowlist != nil && p.allowlist.allowed(pubkey) {
+				return role
+			}
+			continue
+		}
+		if _, ok := p.members[role][pubkey]; ok {
+			return role
+		}
+	}
+	return ""
+}
@@ -0,0 +1,204 @@
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/testkit"
+)
+
+var (
+	moderatorKey   = testkit.NewKey(1)
+	traineeKey     = testkit.NewKey(2)
+	botKey         = testkit.NewKey(3)
+	allowlistedKey = testkit.NewKey(4)
+	userKey        = testkit.NewKey(5)
+)
+
+// protectionConfig returns a config in which every key above but userKey
+// holds a role, protecting roles.
+func protectionConfig(whitelist bool, roles ...config.ProtectedRole) *config.Config {
+	return &config.Config{
+		Policy: config.PolicyConfig{
+			ModeratorPubKey:   moderatorKey.Public,
+			TraineeModerators: []string{traineeKey.Public},
+			Bots:              []string{botKey.Public},
+			ProtectedRoles:    roles,
+			BanEmoji:          "🔨",
+			NukeEmoji:         "💣",
+			BanDuration:       time.Hour,
+		},
+		Filters: config.FiltersConfig{
+			Whitelist: config.WhitelistFilterConfig{Enabled: whitelist, PubKeys: []string{allowlistedKey.Public}},
+			AutoBan: config.AutoBanFilterConfig{
+				Enabled: true, MaxStrikes: 1, StrikeWindow: time.Hour, BanDuration: time.Hour,
+				StrikesCacheSize: 16, CooldownCacheSize: 16, CooldownDuration: time.Minute, BanTimeout: time.Second,
+			},
+		},
+	}
+}
+
+func newTestProtection(t *testing.T, cfg *config.Config) *Protection {
+	t.Helper()
+	whitelist, err := NewWhitelistFilter(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { whitelist.Close() })
+	return NewProtection(cfg, whitelist)
+}
+
+var allRoles = []config.ProtectedRole{config.RoleModerator, config.RoleBot, config.RoleAllowlisted}
+
+func TestProtectionRole(t *testing.T) {
+	tests := []struct {
+		name      string
+		roles     []config.ProtectedRole
+		whitelist bool
+		pubkey    string
+		want      config.ProtectedRole
+	}{
+		{"moderator", allRoles, true, moderatorKey.Public, config.RoleModerator},
+		{"trainee", allRoles, true, traineeKey.Public, config.RoleModerator},
+		{"bot", allRoles, true, botKey.Public, config.RoleBot},
+		{"allowlisted", allRoles, true, allowlistedKey.Public, config.RoleAllowlisted},
+		{"allowlisted without whitelist", allRoles, false, allowlistedKey.Public, ""},
+		{"unprotected", allRoles, true, userKey.Public, ""},
+		{"role not listed", []config.ProtectedRole{config.RoleModerator}, true, botKey.Public, ""},
+		{"no roles", nil, true, moderatorKey.Public, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProtection(t, protectionConfig(tt.whitelist, tt.roles...))
+			if got := p.Role(tt.pubkey); got != tt.want {
+				t.Errorf("Role(%s) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	var p *Protection
+	if got := p.Role(moderatorKey.Public); got != "" {
+		t.Errorf("nil Protection: Role = %q, want none", got)
+	}
+}
+
+func TestAutoBanSparesProtectedRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		pubkey string
+		struck bool
+	}{
+		{"moderator", moderatorKey.Public, false},
+		{"trainee", traineeKey.Public, false},
+		{"bot", botKey.Public, false},
+		{"allowlisted", allowlistedKey.Public, false},
+		{"unprotected", userKey.Public, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := protectionConfig(true, allRoles...)
+			// One strike short of a ban, so that only the strike is observed.
+			cfg.Filters.AutoBan.MaxStrikes = 2
+			db := testkit.NewStore()
+			defer db.Close()
+			autoBan, err := NewAutoBanFilter(db, nil, nil, newTestProtection(t, cfg), &cfg.Filters.AutoBan)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			autoBan.Strike(context.Background(), tt.pubkey, "TestFilter", "")
+			if _, struck := autoBan.strikes.Get(tt.pubkey); struck != tt.struck {
+				t.Errorf("struck = %v, want %v", struck, tt.struck)
+			}
+		})
+	}
+}
+
+func TestModerationRefusesBansOfProtectedRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		target testkit.Key
+		emoji  string
+		reason string
+		banned bool
+	}{
+		{"ban trainee", traineeKey, "🔨", "moderator_ban_refused:protected_moderator", false},
+		{"ban bot", botKey, "🔨", "moderator_ban_refused:protected_bot", false},
+		{"ban allowlisted", allowlistedKey, "🔨", "moderator_ban_refused:protected_allowlisted", false},
+		{"nuke trainee", traineeKey, "💣", "moderator_ban_refused:protected_moderator", false},
+		{"nuke bot", botKey, "💣", "moderator_ban_refused:protected_bot", false},
+		{"nuke allowlisted", allowlistedKey, "💣", "moderator_ban_refused:protected_allowlisted", false},
+		{"ban unprotected", userKey, "🔨", "moderator_ban_executed", true},
+		{"nuke unprotected", userKey, "💣", "moderator_nuke_executed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := protectionConfig(true, allRoles...)
+			db := testkit.NewStore()
+			defer db.Close()
+			note := testkit.NewEvent(nostr.KindTextNote).By(tt.target).Content("gm").Build()
+			relay := testkit.NewStrfry(note)
+			f, err := NewModerationFilter(&cfg.Policy, db, relay, nil, nil, nil, newTestProtection(t, cfg))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			reaction := testkit.Reaction(note, tt.emoji).By(moderatorKey).Build()
+			res, err := f.Match(ctx, reaction, map[string]any{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q", res.Reason, tt.reason)
+			}
+			banned, err := db.IsAuthorBanned(ctx, tt.target.Public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if banned != tt.banned {
+				t.Errorf("banned = %v, want %v", banned, tt.banned)
+			}
+			if !tt.banned && (len(relay.DeletedAuthors()) > 0 || len(relay.DeletedEvents()) > 0) {
+				t.Errorf("deleted events of a protected pubkey")
+			}
+		})
+	}
+}
+
+func TestReportsSpareProtectedRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		target testkit.Key
+		reason string
+	}{
+		{"bot", botKey, "report_target_protected:bot"},
+		{"allowlisted", allowlistedKey, "report_target_protected:allowlisted"},
+		{"unprotected", userKey, "report_ban_executed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := protectionConfig(true, allRoles...)
+			cfg.Policy.Reports = config.ReportsConfig{Enabled: true, Threshold: 1, CacheSize: 16, Window: time.Hour}
+			db := testkit.NewStore()
+			defer db.Close()
+			f, err := NewModerationFilter(&cfg.Policy, db, testkit.NewStrfry(), nil, nil, nil, newTestProtection(t, cfg))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report := testkit.NewEvent(nostr.KindReporting).By(moderatorKey).Tag("p", tt.target.Public, "spam").Build()
+			res, err := f.Match(context.Background(), report, map[string]any{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q", res.Reason, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+const restrictionFilterName = "RestrictionFilter"
+
+// RestrictionFilter rejects kinds an author has been restricted from posting,
+// a middle ground between a full ban and unrestricted access. Lookups are not
+// cached, so restrictions and lifts take effect with the next event.
+type RestrictionFilter struct {
+	store store.Store
+}
+
+func NewRestrictionFilter(s store.Store) (*RestrictionFilter, error) {
+	return &RestrictionFilter{store: s}, nil
+}
+
+func (f *RestrictionFilter) Match(ctx context.Context, event *nostr.Event, _ map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(restrictionFilterName)
+
+	restricted, err := f.store.IsKindRestricted(ctx, event.PubKey, event.Kind)
+	if err != nil {
+		return newResult(false, "internal_restriction_check_failed", err)
+	}
+	if restricted {
+		return newResult(false, fmt.Sprintf("kind_%d_restricted_for_author", event.Kind), nil)
+	}
+	return newResult(true, "kind_not_restricted", nil)
+}
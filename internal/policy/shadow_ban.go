@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/store"
+	"github.com/lessucettes/adresu-plugin/internal/strfry"
+)
+
+// ShadowBan removes shadow-banned events: the pipeline accepts them, so
+// their authors are not told, and ShadowBan deletes them from strfry once it
+// has had time to store them.
+type ShadowBan struct {
+	store store.Store
+	sf    strfry.ClientInterface
+	delay time.Duration
+}
+
+func NewShadowBan(s store.Store, sf strfry.ClientInterface, delay time.Duration) *ShadowBan {
+	return &ShadowBan{store: s, sf: sf, delay: delay}
+}
+
+// Remove journals the deletion of event and carries it out after the delay.
+// A deletion the plugin does not live to carry out is replayed from the
+// journal on the next start.
+func (b *ShadowBan) Remove(ctx context.Context, event *nostr.Event) {
+	ctx = context.WithoutCancel(ctx)
+	action := journal(ctx, b.store, store.Action{Type: store.ActionDeleteEvent, PubKey: event.PubKey, EventID: event.ID})
+	time.AfterFunc(b.delay, func() {
+		if err := b.sf.DeleteEvent(event.ID); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete shadow-banned event", "error", err, "event_id", event.ID)
+			return
+		}
+		complete(ctx, b.store, action)
+	})
+}
@@ -0,0 +1,64 @@
+package policy
+
+import (
+	"hash/fnv"
+	"math"
+	"unicode"
+)
+
+// styleBuckets is the size of the hashed character n-gram sketch.
+const styleBuckets = 512
+
+// styleSketch is a lightweight stylometric fingerprint: hashed character
+// trigram frequencies accumulated over an author's posts.
+type styleSketch struct {
+	counts [styleBuckets]float32
+	chars  int
+	posts  int
+}
+
+// add folds a post into the sketch. Text is lowercased and whitespace is
+// collapsed, but punctuation and emoji are kept as they carry most of the style.
+func (s *styleSketch) add(content string) {
+	runes := make([]rune, 0, len(content))
+	lastSpace := true
+	for _, r := range content {
+		if unicode.IsSpace(r) {
+			if lastSpace {
+				continue
+			}
+			r = ' '
+			lastSpace = true
+		} else {
+			lastSpace = false
+		}
+		runes = append(runes, unicode.ToLower(r))
+	}
+	if len(runes) < 3 {
+		return
+	}
+
+	h := fnv.New32a()
+	for i := 0; i+3 <= len(runes); i++ {
+		h.Reset()
+		h.Write([]byte(string(runes[i : i+3])))
+		s.counts[h.Sum32()%styleBuckets]++
+	}
+	s.chars += len(runes)
+	s.posts++
+}
+
+// similarity returns the cosine similarity of two sketches in [0, 1].
+func (s *styleSketch) similarity(o *styleSketch) float64 {
+	var dot, na, nb float64
+	for i := range s.counts {
+		a, b := float64(s.counts[i]), float64(o.counts[i])
+		dot += a * b
+		na += a * a
+		nb += b * b
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,75 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+	"golang.org/x/time/rate"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const (
+	unknownKindFilterName = "UnknownKindFilter"
+)
+
+// UnknownKindFilter applies policy.unknown_kind_action to kinds that no
+// configured rule mentions, so brand-new kinds can be handled conservatively
+// until the operator writes rules for them.
+type UnknownKindFilter struct {
+	action   config.UnknownKindAction
+	known    map[int]struct{}
+	cfg      *config.PolicyConfig
+	limiters *lru.LRU[string, *rate.Limiter]
+}
+
+func NewUnknownKindFilter(cfg *config.Config) (*UnknownKindFilter, error) {
+	f := &UnknownKindFilter{
+		action: cfg.Policy.UnknownKindAction,
+		known:  cfg.KnownKinds(),
+		cfg:    &cfg.Policy,
+	}
+	if f.action == config.UnknownKindRateLimit {
+		f.limiters = lru.NewLRU[string, *rate.Limiter](defaultCacheSize, nil, 15*time.Minute)
+	}
+	return f, nil
+}
+
+func (f *UnknownKindFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(unknownKindFilterName)
+
+	if f.action == "" || f.action == config.UnknownKindAccept {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if _, ok := f.known[event.Kind]; ok {
+		return newResult(true, "kind_known", nil)
+	}
+
+	if f.action == config.UnknownKindReject {
+		return newResult(false, fmt.Sprintf("unknown_kind_rejected:kind_%d", event.Kind), nil)
+	}
+
+	limiter, ok := f.limiters.Get(event.PubKey)
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(f.cfg.UnknownKindRate), f.cfg.UnknownKindBurst)
+		f.limiters.Add(event.PubKey, limiter)
+	}
+	if !limiter.Allow() {
+		res, err := newResult(false, fmt.Sprintf("unknown_kind_rate_exceeded:kind_%d", event.Kind), nil)
+		res.Values = map[string]any{
+			"rate":        f.cfg.UnknownKindRate,
+			"burst":       f.cfg.UnknownKindBurst,
+			"retry_after": int(math.Ceil((1 - limiter.Tokens()) / f.cfg.UnknownKindRate)),
+		}
+		return res, err
+	}
+	return newResult(true, "unknown_kind_rate_ok", nil)
+}
+
+// Independent reports that UnknownKindFilter only inspects the event itself.
+func (f *UnknownKindFilter) Independent() bool { return true }
@@ -0,0 +1,100 @@
+package policy
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// wasmMemoryLimitPages bounds the memory of a module instance, in 64 KiB
+// pages (256 MiB).
+const wasmMemoryLimitPages = 4096
+
+// wasmModule is a compiled WASI module an ExecFilter runs instead of a
+// command. Each copy is an instance reading requests on stdin and writing
+// answers on stdout, as a command would; it gets the clocks and a source of
+// randomness, but no access to files, the network or the environment.
+type wasmModule struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	started  atomic.Int64
+}
+
+func compileWASMModule(path string) (*wasmModule, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	// Cancelling an instance's context interrupts it even in a busy loop.
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(wasmMemoryLimitPages))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	compiled, err := runtime.CompileModule(ctx, code)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to compile %s: %w", path, err)
+	}
+	return &wasmModule{runtime: runtime, compiled: compiled}, nil
+}
+
+// start runs a new instance of the module, with args after the program name.
+func (m *wasmModule) start(name string, args []string) (execRun, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	config := wazero.NewModuleConfig().
+		WithName(""). // Anonymous, so that instances may run side by side.
+		WithArgs(append([]string{name}, args...)...).
+		WithStdin(stdinR).
+		WithStdout(stdoutW).
+		WithStderr(os.Stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+
+	exited := make(chan error, 1)
+	go func() {
+		mod, err := m.runtime.InstantiateModule(ctx, m.compiled, config)
+		if mod != nil {
+			mod.Close(context.Background())
+		}
+		var exitErr *sys.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 0 {
+			err = nil
+		}
+		stdinR.Close()
+		stdoutW.Close()
+		cancel()
+		exited <- err
+	}()
+
+	return execRun{
+		id:     "wasm " + strconv.FormatInt(m.started.Add(1), 10),
+		stdin:  stdinW,
+		stdout: stdoutR,
+		wait:   func() error { return <-exited },
+		terminate: func() {
+			cancel()
+			// Unblocks an instance waiting for its next request.
+			stdinR.CloseWithError(context.Canceled)
+		},
+	}, nil
+}
+
+func (m *wasmModule) close() error {
+	return m.runtime.Close(context.Background())
+}
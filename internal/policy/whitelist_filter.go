@@ -0,0 +1,310 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/schedule"
+)
+
+const (
+	whitelistFilterName = "WhitelistFilter"
+	// whitelistReloadDelay debounces the writes of one edit of the file.
+	whitelistReloadDelay = 500 * time.Millisecond
+)
+
+// WhitelistFilter makes the relay invite-only, accepting events only from the
+// configured pubkeys, those in the whitelist file and those tagged in the
+// whitelist follow set, plus moderators. The file is reloaded when it
+// changes; the follow set is refreshed periodically and updated as soon as
+// its owner publishes a new version through the relay. Unlike WoTFilter, it
+// fails closed: until the follow set is fetched, only the other sources count.
+type WhitelistFilter struct {
+	cfg     *config.WhitelistFilterConfig
+	scanner EventScanner
+	kinds   map[int]struct{}
+	// always are the inline pubkeys and moderators.
+	always map[string]struct{}
+	// listPubKey and listD identify the follow set, if any.
+	listPubKey, listD string
+
+	mu       sync.RWMutex
+	fromFile map[string]struct{}
+	fromList map[string]struct{}
+	listAt   nostr.Timestamp // created_at of the applied follow set.
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// unschedule removes the list refresh job.
+	unschedule func()
+}
+
+func NewWhitelistFilter(cfg *config.Config, scanner EventScanner, sched *schedule.Scheduler) (*WhitelistFilter, error) {
+	wl := &cfg.Filters.Whitelist
+	f := &WhitelistFilter{cfg: wl, scanner: scanner}
+	if !wl.Enabled {
+		return f, nil
+	}
+	if len(wl.Kinds) > 0 {
+		f.kinds = make(map[int]struct{}, len(wl.Kinds))
+		for _, k := range wl.Kinds {
+			f.kinds[k] = struct{}{}
+		}
+	}
+	f.always = make(map[string]struct{}, len(wl.PubKeys)+1)
+	for _, pk := range wl.PubKeys {
+		f.always[pk] = struct{}{}
+	}
+	if cfg.Policy.ModeratorPubKey != "" {
+		f.always[cfg.Policy.ModeratorPubKey] = struct{}{}
+	}
+	for _, pk := range cfg.Policy.TraineeModerators {
+		f.always[pk] = struct{}{}
+	}
+
+	if wl.File != "" {
+		pubkeys, err := readWhitelistFile(wl.File)
+		if err != nil {
+			return nil, err
+		}
+		f.fromFile = pubkeys
+	}
+	if wl.List != "" {
+		// Normalized by the config to "30000:<pubkey>:<d>".
+		parts := strings.SplitN(wl.List, ":", 3)
+		f.listPubKey, f.listD = parts[1], parts[2]
+	}
+
+	var ctx context.Context
+	ctx, f.cancel = context.WithCancel(context.Background())
+	if wl.File != "" {
+		f.wg.Add(1)
+		go f.watchFile(ctx)
+	}
+	if wl.List != "" {
+		f.unschedule = sched.Add(schedule.Job{
+			Name:        config.JobWhitelistRefresh,
+			Schedule:    schedule.Every(wl.RefreshInterval),
+			Run:         f.refreshList,
+			Immediately: true,
+		})
+	}
+	return f, nil
+}
+
+func (f *WhitelistFilter) Match(ctx context.Context, event *nostr.Event, _ map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(whitelistFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if f.isListEvent(event) && !SideEffectsSuppressed(ctx) {
+		f.applyList(event)
+	}
+	if f.kinds != nil {
+		if _, ok := f.kinds[event.Kind]; !ok {
+			return newResult(true, "kind_not_checked", nil)
+		}
+	}
+	if f.allowed(event.PubKey) {
+		return newResult(true, "whitelisted", nil)
+	}
+	if f.cfg.AllowDelegates && event.Tags.Find("delegation") != nil {
+		if delegation, err := nip.ParseDelegation(event); err == nil && f.allowed(delegation.Delegator) {
+			return newResult(true, "delegator_whitelisted", nil)
+		}
+	}
+	return kitpolicy.ActionResult(newResult, f.cfg.Action, "not_whitelisted")
+}
+
+// Close stops the file watcher and removes the refresh job.
+func (f *WhitelistFilter) Close() error {
+	if f.cancel == nil {
+		return nil
+	}
+	if f.unschedule != nil {
+		f.unschedule()
+	}
+	f.cancel()
+	f.wg.Wait()
+	return nil
+}
+
+func (f *WhitelistFilter) allowed(pubkey string) bool {
+	if _, ok := f.always[pubkey]; ok {
+		return true
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if _, ok := f.fromFile[pubkey]; ok {
+		return true
+	}
+	_, ok := f.fromList[pubkey]
+	return ok
+}
+
+// readWhitelistFile parses one npub or hex pubkey per line. Blank lines and
+// text after "#" are ignored.
+func readWhitelistFile(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open whitelist file: %w", err)
+	}
+	defer file.Close()
+
+	pubkeys, err := parsePubKeyList(file, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read whitelist file: %w", err)
+	}
+	return pubkeys, nil
+}
+
+// parsePubKeyList parses one npub or hex pubkey per line, read from the source
+// named name. Blank lines and text after "#" are ignored.
+func parsePubKeyList(r io.Reader, name string) (map[string]struct{}, error) {
+	pubkeys := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		pk, err := nip.NormalizePubKey(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		pubkeys[pk] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return pubkeys, nil
+}
+
+// watchFile reloads the whitelist file whenever it is written or replaced.
+// A file that fails to parse keeps the previous list.
+func (f *WhitelistFilter) watchFile(ctx context.Context) {
+	defer f.wg.Done()
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("Failed to create whitelist file watcher", "error", err)
+		return
+	}
+	defer watcher.Close()
+
+	path := filepath.Clean(f.cfg.File)
+	// Watch the directory so that editors replacing the file are noticed.
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		slog.Error("Failed to watch whitelist file", "path", path, "error", err)
+		return
+	}
+
+	var debounceTimer *time.Timer
+	defer func() {
+		if debounceTimer != nil {
+			debounceTimer.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != path || !(event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename)) {
+				continue
+			}
+			if debounceTimer != nil {
+				debounceTimer.Stop()
+			}
+			debounceTimer = time.AfterFunc(whitelistReloadDelay, f.reloadFile)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("Error watching whitelist file", "error", err)
+		}
+	}
+}
+
+func (f *WhitelistFilter) reloadFile() {
+	pubkeys, err := readWhitelistFile(f.cfg.File)
+	if err != nil {
+		slog.Error("Failed to reload whitelist file, keeping the previous list", "path", f.cfg.File, "error", err)
+		return
+	}
+	f.mu.Lock()
+	f.fromFile = pubkeys
+	f.mu.Unlock()
+	slog.Info("Whitelist file reloaded", "path", f.cfg.File, "pubkeys", len(pubkeys))
+}
+
+// isListEvent reports whether event is a version of the whitelist follow set.
+func (f *WhitelistFilter) isListEvent(event *nostr.Event) bool {
+	return f.listPubKey != "" && event.Kind == nostr.KindCategorizedPeopleList &&
+		event.PubKey == f.listPubKey && event.Tags.GetD() == f.listD
+}
+
+// applyList replaces the pubkeys of the follow set with those tagged in
+// event, unless a newer version has been applied already.
+func (f *WhitelistFilter) applyList(event *nostr.Event) {
+	pubkeys := make(map[string]struct{})
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "p" && nostr.IsValidPublicKey(tag[1]) {
+			pubkeys[tag[1]] = struct{}{}
+		}
+	}
+
+	f.mu.Lock()
+	if f.fromList != nil && event.CreatedAt <= f.listAt {
+		f.mu.Unlock()
+		return
+	}
+	f.fromList, f.listAt = pubkeys, event.CreatedAt
+	f.mu.Unlock()
+	slog.Info("Whitelist follow set updated", "list", f.cfg.List, "pubkeys", len(pubkeys), "created_at", event.CreatedAt)
+}
+
+// refreshList fetches the latest version of the follow set. A failed or
+// empty fetch keeps the current list.
+func (f *WhitelistFilter) refreshList(parent context.Context) error {
+	ctx, cancel := context.WithTimeout(parent, f.cfg.Timeout)
+	defer cancel()
+
+	filter := nostr.Filter{
+		Kinds:   []int{nostr.KindCategorizedPeopleList},
+		Authors: []string{f.listPubKey},
+		Tags:    nostr.TagMap{"d": []string{f.listD}},
+	}
+	events, err := queryEvents(ctx, f.scanner, f.cfg.Relays, filter)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the whitelist follow set %s, keeping the previous list: %w", f.cfg.List, err)
+	}
+	var latest *nostr.Event
+	for _, ev := range events {
+		if f.isListEvent(ev) && (latest == nil || ev.CreatedAt > latest.CreatedAt) {
+			latest = ev
+		}
+	}
+	if latest == nil {
+		return fmt.Errorf("whitelist follow set %s not found", f.cfg.List)
+	}
+	f.applyList(latest)
+	return nil
+}
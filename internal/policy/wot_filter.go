@@ -0,0 +1,215 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/schedule"
+)
+
+const (
+	wotFilterName = "WoTFilter"
+	// wotAuthorsPerQuery bounds the authors of one contact list query.
+	wotAuthorsPerQuery = 500
+)
+
+// EventScanner queries a local event store, as strfry.Client does.
+type EventScanner interface {
+	ScanEvents(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error)
+}
+
+// WoTFilter accepts events only from the operator's web of trust, built from
+// kind 3 contact lists fetched from the configured relays or the local strfry
+// database and refreshed periodically. Until the first fetch succeeds every
+// event is allowed; afterwards a failed refresh keeps the previous graph.
+type WoTFilter struct {
+	cfg     *config.WoTFilterConfig
+	scanner EventScanner
+	kinds   map[int]struct{}
+	// always are trusted regardless of the graph.
+	always map[string]struct{}
+
+	mu      sync.RWMutex
+	trusted map[string]struct{} // nil until loaded.
+
+	// unschedule removes the refresh job.
+	unschedule func()
+}
+
+func NewWoTFilter(cfg *config.Config, scanner EventScanner, sched *schedule.Scheduler) (*WoTFilter, error) {
+	wot := &cfg.Filters.WoT
+	f := &WoTFilter{cfg: wot, scanner: scanner}
+	if !wot.Enabled {
+		return f, nil
+	}
+	if len(wot.Kinds) > 0 {
+		f.kinds = make(map[int]struct{}, len(wot.Kinds))
+		for _, k := range wot.Kinds {
+			f.kinds[k] = struct{}{}
+		}
+	}
+	f.always = map[string]struct{}{wot.OperatorPubKey: {}}
+	if cfg.Policy.ModeratorPubKey != "" {
+		f.always[cfg.Policy.ModeratorPubKey] = struct{}{}
+	}
+	for _, pk := range cfg.Policy.TraineeModerators {
+		f.always[pk] = struct{}{}
+	}
+
+	f.unschedule = sched.Add(schedule.Job{
+		Name:        config.JobWoTRefresh,
+		Schedule:    schedule.Every(wot.RefreshInterval),
+		Run:         f.refresh,
+		Immediately: true,
+	})
+	return f, nil
+}
+
+func (f *WoTFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (kitpolicy.FilterResult, error) {
+	newResult := kitpolicy.NewResultFunc(wotFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if f.kinds != nil {
+		if _, ok := f.kinds[event.Kind]; !ok {
+			return newResult(true, "kind_not_checked", nil)
+		}
+	}
+	if _, ok := f.always[event.PubKey]; ok {
+		return newResult(true, "in_web_of_trust", nil)
+	}
+
+	f.mu.RLock()
+	trusted := f.trusted
+	f.mu.RUnlock()
+	if trusted == nil {
+		return newResult(true, "web_of_trust_not_loaded", nil)
+	}
+	if _, ok := trusted[event.PubKey]; ok {
+		return newResult(true, "in_web_of_trust", nil)
+	}
+	res, err := kitpolicy.ActionResult(newResult, f.cfg.Action, fmt.Sprintf("not_in_web_of_trust:depth_%d", f.cfg.Depth))
+	res.Values = map[string]any{"depth": f.cfg.Depth}
+	return res, err
+}
+
+// Close removes the refresh job.
+func (f *WoTFilter) Close() error {
+	if f.unschedule != nil {
+		f.unschedule()
+	}
+	return nil
+}
+
+// refresh rebuilds the graph. A failed refresh keeps the previous one.
+func (f *WoTFilter) refresh(parent context.Context) error {
+	ctx, cancel := context.WithTimeout(parent, f.cfg.Timeout)
+	defer cancel()
+
+	trusted, err := f.build(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to refresh the web of trust, keeping the previous graph: %w", err)
+	}
+	f.mu.Lock()
+	f.trusted = trusted
+	f.mu.Unlock()
+	slog.Info("Web of trust refreshed", "operator", f.cfg.OperatorPubKey, "depth", f.cfg.Depth, "pubkeys", len(trusted))
+	return nil
+}
+
+// build walks contact lists from the operator up to the configured depth.
+func (f *WoTFilter) build(ctx context.Context) (map[string]struct{}, error) {
+	trusted := map[string]struct{}{f.cfg.OperatorPubKey: {}}
+	frontier := []string{f.cfg.OperatorPubKey}
+	for depth := 0; depth < f.cfg.Depth && len(frontier) > 0; depth++ {
+		follows, err := f.follows(ctx, frontier)
+		if err != nil {
+			return nil, err
+		}
+		if depth == 0 && len(follows) == 0 {
+			return nil, errors.New("operator contact list not found")
+		}
+		var next []string
+		for _, pk := range follows {
+			if _, ok := trusted[pk]; !ok {
+				trusted[pk] = struct{}{}
+				next = append(next, pk)
+			}
+		}
+		frontier = next
+	}
+	return trusted, nil
+}
+
+// follows returns the pubkeys followed in the latest contact lists of authors.
+func (f *WoTFilter) follows(ctx context.Context, authors []string) ([]string, error) {
+	latest := make(map[string]*nostr.Event, len(authors))
+	for chunk := range slices.Chunk(authors, wotAuthorsPerQuery) {
+		filter := nostr.Filter{Kinds: []int{nostr.KindFollowList}, Authors: chunk}
+		events, err := f.fetch(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, ev := range events {
+			if !filter.Matches(ev) {
+				continue
+			}
+			if cur, ok := latest[ev.PubKey]; !ok || ev.CreatedAt > cur.CreatedAt {
+				latest[ev.PubKey] = ev
+			}
+		}
+	}
+
+	var follows []string
+	for _, ev := range latest {
+		for _, tag := range ev.Tags {
+			if len(tag) >= 2 && tag[0] == "p" && nostr.IsValidPublicKey(tag[1]) {
+				follows = append(follows, tag[1])
+			}
+		}
+	}
+	return follows, nil
+}
+
+// fetch queries the configured relays, or the local database without any.
+func (f *WoTFilter) fetch(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	return queryEvents(ctx, f.scanner, f.cfg.Relays, filter)
+}
+
+// queryEvents queries relays, or the local database through scanner without
+// any. With relays, it fails only if none of them answers.
+func queryEvents(ctx context.Context, scanner EventScanner, relays []string, filter nostr.Filter) ([]*nostr.Event, error) {
+	if len(relays) == 0 {
+		return scanner.ScanEvents(ctx, filter)
+	}
+
+	var events []*nostr.Event
+	var errs []error
+	for _, url := range relays {
+		relay, err := nostr.RelayConnect(ctx, url)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		got, err := relay.QuerySync(ctx, filter)
+		relay.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+			continue
+		}
+		events = append(events, got...)
+	}
+	if len(errs) == len(relays) {
+		return nil, errors.Join(errs...)
+	}
+	return events, nil
+}
@@ -0,0 +1,59 @@
+// Package priming persists the author history scanned from a relay's
+// existing events, so a freshly started plugin can seed its behavioral
+// filters instead of treating every regular as an unknown newcomer.
+package priming
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+)
+
+// Snapshot is the history written by "adresu-plugin prime".
+type Snapshot struct {
+	GeneratedAt time.Time                 `json:"generated_at"`
+	Since       time.Time                 `json:"since"`
+	Events      int                       `json:"events"`
+	Authors     []kitpolicy.AuthorHistory `json:"authors"`
+}
+
+// Load reads the snapshot at path.
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse priming snapshot %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Write stores s at path, replacing any previous snapshot atomically.
+func Write(path string, s *Snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Prime seeds every filter implementing kitpolicy.Primer with the authors in s.
+func Prime(s *Snapshot, filters ...kitpolicy.Filter) int {
+	primed := 0
+	for _, f := range filters {
+		if p, ok := f.(kitpolicy.Primer); ok {
+			p.Prime(s.Authors)
+			primed++
+		}
+	}
+	return primed
+}
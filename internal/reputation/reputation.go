@@ -0,0 +1,199 @@
+// Package reputation defines the format in which cooperating relay operators
+// exchange per-pubkey moderation aggregates. A summary is a signed Nostr
+// event (kind 30078, application-specific data, d tag "adresu-reputation")
+// whose content is a JSON Summary, so any Nostr library can verify it and it
+// can be handed over as a file or published to a relay. Only aggregates are
+// shared (ban and restriction expiry), never the events or audit data behind
+// them.
+package reputation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+const (
+	// FormatVersion is the version of the Summary schema.
+	FormatVersion = 1
+	dTag          = "adresu-reputation"
+)
+
+// Entry summarizes the moderation state of one pubkey on the issuing relay.
+// Times are Unix seconds.
+type Entry struct {
+	PubKey       string        `json:"pubkey"`
+	BannedUntil  int64         `json:"banned_until,omitempty"`
+	Restrictions []Restriction `json:"restrictions,omitempty"`
+}
+
+type Restriction struct {
+	Kind  int   `json:"kind"`
+	Until int64 `json:"until"`
+}
+
+// Summary is the signed content of an exchange event.
+type Summary struct {
+	Version int     `json:"version"`
+	Relay   string  `json:"relay,omitempty"` // Issuing relay, informational.
+	Entries []Entry `json:"entries"`
+}
+
+// FromRecords builds a summary of the records still active at now.
+func FromRecords(records []store.AuthorRecord, relay string, now time.Time) Summary {
+	s := Summary{Version: FormatVersion, Relay: relay, Entries: []Entry{}}
+	for _, r := range records {
+		e := Entry{PubKey: r.PubKey}
+		if r.BannedUntil.After(now) {
+			e.BannedUntil = r.BannedUntil.Unix()
+		}
+		for _, res := range r.Restrictions {
+			if res.Until.After(now) {
+				e.Restrictions = append(e.Restrictions, Restriction{Kind: res.Kind, Until: res.Until.Unix()})
+			}
+		}
+		if e.BannedUntil != 0 || len(e.Restrictions) > 0 {
+			s.Entries = append(s.Entries, e)
+		}
+	}
+	return s
+}
+
+// Sign wraps a summary in an event signed with the hex secret key.
+func Sign(s Summary, secretKey string, now time.Time) (*nostr.Event, error) {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	ev := &nostr.Event{
+		Kind:      nostr.KindApplicationSpecificData,
+		CreatedAt: nostr.Timestamp(now.Unix()),
+		Tags:      nostr.Tags{{"d", dTag}},
+		Content:   string(content),
+	}
+	if err := ev.Sign(secretKey); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// Verify checks that ev is a reputation summary signed by one of issuers
+// (hex pubkeys) and returns its content.
+func Verify(ev *nostr.Event, issuers []string) (*Summary, error) {
+	if ev.Kind != nostr.KindApplicationSpecificData || ev.Tags.GetD() != dTag {
+		return nil, errors.New("not a reputation summary")
+	}
+	if !slices.Contains(issuers, ev.PubKey) {
+		return nil, fmt.Errorf("issuer %s is not trusted", ev.PubKey)
+	}
+	if ev.GetID() != ev.ID {
+		return nil, errors.New("event id does not match its content")
+	}
+	if ok, err := ev.CheckSignature(); err != nil || !ok {
+		return nil, errors.New("invalid signature")
+	}
+
+	var s Summary
+	if err := json.Unmarshal([]byte(ev.Content), &s); err != nil {
+		return nil, fmt.Errorf("invalid summary: %w", err)
+	}
+	if s.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported summary version %d", s.Version)
+	}
+	for _, e := range s.Entries {
+		if !nostr.IsValidPublicKey(e.PubKey) {
+			return nil, fmt.Errorf("invalid pubkey %q in summary", e.PubKey)
+		}
+	}
+	return &s, nil
+}
+
+// ImportOptions controls how a trusted summary is applied to the local store.
+type ImportOptions struct {
+	Bans         bool
+	Restrictions bool
+	// MaxDuration caps how long an imported ban or restriction lasts locally.
+	MaxDuration time.Duration
+	DryRun      bool
+	// Issuer is recorded as the source of imported bans.
+	Issuer string
+}
+
+// ImportResult counts what an import did (or would do, in a dry run).
+type ImportResult struct {
+	Banned     int
+	Restricted int
+	// Skipped entries were expired or already at least as strict locally.
+	Skipped int
+}
+
+// Apply adopts the bans and restrictions of a summary. Local state is never
+// weakened: pubkeys already banned, or kinds already restricted, are left
+// alone.
+func Apply(ctx context.Context, db store.Store, s *Summary, opts ImportOptions, now time.Time) (ImportResult, error) {
+	var res ImportResult
+	remaining := func(until int64) time.Duration {
+		d := time.Unix(until, 0).Sub(now)
+		if opts.MaxDuration > 0 {
+			d = min(d, opts.MaxDuration)
+		}
+		return d
+	}
+
+	for _, e := range s.Entries {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		applied := false
+		banned, err := db.IsAuthorBanned(ctx, e.PubKey)
+		if err != nil {
+			return res, err
+		}
+		if opts.Bans && e.BannedUntil != 0 && !banned {
+			if d := remaining(e.BannedUntil); d > 0 {
+				if !opts.DryRun {
+					if err := db.BanAuthor(ctx, e.PubKey, d, store.BanInfo{Reason: "reputation_import", Source: opts.Issuer}); err != nil {
+						return res, err
+					}
+				}
+				res.Banned++
+				applied, banned = true, true
+			}
+		}
+
+		if opts.Restrictions && !banned {
+			for _, r := range e.Restrictions {
+				d := remaining(r.Until)
+				if d <= 0 {
+					continue
+				}
+				restricted, err := db.IsKindRestricted(ctx, e.PubKey, r.Kind)
+				if err != nil {
+					return res, err
+				}
+				if restricted {
+					continue
+				}
+				if !opts.DryRun {
+					if err := db.RestrictKinds(ctx, e.PubKey, []int{r.Kind}, d); err != nil {
+						return res, err
+					}
+				}
+				res.Restricted++
+				applied = true
+			}
+		}
+
+		if !applied {
+			res.Skipped++
+		}
+	}
+	return res, nil
+}
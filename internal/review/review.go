@@ -0,0 +1,247 @@
+// Package review compiles a daily ban review: bans about to expire and recent
+// auto-bans, each with the rejections that led to it, so moderators can
+// extend, shorten or convert bans before they lapse instead of after.
+package review
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/nbd-wtf/go-nostr/nip19"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/notify"
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+const (
+	// KeyEnv names the environment variable holding the key that signs
+	// review direct messages.
+	KeyEnv = "ADRESU_REVIEW_KEY"
+
+	cacheSize   = 100000
+	sampleChars = 140
+)
+
+// Evidence is one rejection of a pubkey's event.
+type Evidence struct {
+	Time    time.Time `json:"time"`
+	EventID string    `json:"event_id"`
+	Kind    int       `json:"kind"`
+	Filter  string    `json:"filter"`
+	Reason  string    `json:"reason"`
+	Sample  string    `json:"sample,omitempty"`
+}
+
+// Entry is one banned pubkey up for review.
+type Entry struct {
+	PubKey      string     `json:"pubkey"`
+	BannedUntil time.Time  `json:"banned_until"`
+	AutoBanned  time.Time  `json:"auto_banned,omitzero"`
+	Evidence    []Evidence `json:"evidence,omitempty"`
+}
+
+// Report is one ban review.
+type Report struct {
+	Generated time.Time `json:"generated"`
+	// Expiring bans end within the horizon; AutoBanned were issued by the
+	// AutoBanFilter within the lookback and are not already expiring.
+	Expiring   []Entry `json:"expiring"`
+	AutoBanned []Entry `json:"auto_banned"`
+}
+
+// BanLister lists every pubkey with a ban or restriction.
+type BanLister interface {
+	Authors(ctx context.Context) ([]store.AuthorRecord, error)
+}
+
+// Review collects rejection evidence from pipeline decisions, learns about
+// auto-bans through OnAutoBan, and publishes a report once a day.
+type Review struct {
+	cfg  *config.BanReviewConfig
+	bans BanLister
+	dm   *notify.DM // Nil unless direct messages are configured.
+
+	mu       sync.Mutex
+	evidence *lru.LRU[string, []Evidence]
+	autoBans *lru.LRU[string, time.Time]
+}
+
+// New creates a review. Direct messages need moderator and the key in
+// $ADRESU_REVIEW_KEY.
+func New(cfg *config.BanReviewConfig, bans BanLister, moderator string) (*Review, error) {
+	r := &Review{
+		cfg:      cfg,
+		bans:     bans,
+		evidence: lru.NewLRU[string, []Evidence](cacheSize, nil, cfg.Lookback),
+		autoBans: lru.NewLRU[string, time.Time](cacheSize, nil, cfg.Lookback),
+	}
+	if len(cfg.DMRelays) > 0 {
+		dm, err := notify.NewDM(KeyEnv, moderator, cfg.DMRelays)
+		if err != nil {
+			return nil, err
+		}
+		r.dm = dm
+	}
+	return r, nil
+}
+
+// ObserveDecision implements policy.DecisionObserver.
+func (r *Review) ObserveDecision(d policy.Decision) {
+	if d.Action == "accept" || d.Lookback || r.cfg.Evidence == 0 {
+		return
+	}
+	ev := Evidence{Time: d.Time, EventID: d.EventID, Kind: d.Kind, Filter: d.Filter, Reason: d.Reason}
+	if d.Event != nil {
+		ev.Sample = truncate(d.Event.Content, sampleChars)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list, _ := r.evidence.Peek(d.PubKey)
+	list = append(list, ev)
+	if len(list) > r.cfg.Evidence {
+		list = slices.Clone(list[len(list)-r.cfg.Evidence:])
+	}
+	r.evidence.Add(d.PubKey, list)
+}
+
+// OnAutoBan is a store.BanListener for bans issued by the AutoBanFilter.
+func (r *Review) OnAutoBan(pubkey string) {
+	r.autoBans.Add(pubkey, time.Now())
+}
+
+// Run compiles and publishes the review; it is scheduled daily at the
+// configured time.
+func (r *Review) Run(ctx context.Context) error {
+	report, err := r.Report(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to compile ban review: %w", err)
+	}
+	r.publish(ctx, report)
+	return nil
+}
+
+// Report compiles a fresh review.
+func (r *Review) Report(ctx context.Context) (Report, error) {
+	records, err := r.bans.Authors(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	now := time.Now()
+	report := Report{Generated: now, Expiring: []Entry{}, AutoBanned: []Entry{}}
+	horizon := now.Add(r.cfg.Horizon)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rec := range records {
+		if !rec.BannedUntil.After(now) {
+			continue
+		}
+		e := Entry{PubKey: rec.PubKey, BannedUntil: rec.BannedUntil}
+		e.AutoBanned, _ = r.autoBans.Peek(rec.PubKey)
+		e.Evidence, _ = r.evidence.Peek(rec.PubKey)
+		switch {
+		case rec.BannedUntil.Before(horizon):
+			report.Expiring = append(report.Expiring, e)
+		case !e.AutoBanned.IsZero():
+			report.AutoBanned = append(report.AutoBanned, e)
+		}
+	}
+	slices.SortFunc(report.Expiring, func(a, b Entry) int { return a.BannedUntil.Compare(b.BannedUntil) })
+	slices.SortFunc(report.AutoBanned, func(a, b Entry) int {
+		return cmp.Or(b.AutoBanned.Compare(a.AutoBanned), strings.Compare(a.PubKey, b.PubKey))
+	})
+	return report, nil
+}
+
+// publish logs the report and delivers it to the configured file and
+// moderator.
+func (r *Review) publish(ctx context.Context, report Report) {
+	slog.Info("Ban review", "expiring", len(report.Expiring), "auto_banned", len(report.AutoBanned))
+	text := report.Text()
+	if r.cfg.Path != "" {
+		if err := os.WriteFile(r.cfg.Path, []byte(text), 0o644); err != nil {
+			slog.Error("Failed to write ban review", "path", r.cfg.Path, "error", err)
+		}
+	}
+	if r.dm != nil {
+		if err := r.dm.Send(ctx, text); err != nil {
+			slog.Error("Failed to send ban review to the moderator", "error", err)
+		}
+	}
+}
+
+// Text renders the report for humans.
+func (r Report) Text() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Ban review, %s\n", r.Generated.UTC().Format(time.RFC3339))
+
+	fmt.Fprintf(&sb, "\nExpiring soon (%d):\n", len(r.Expiring))
+	if len(r.Expiring) == 0 {
+		sb.WriteString("  none\n")
+	}
+	for _, e := range r.Expiring {
+		writeEntry(&sb, e)
+	}
+
+	fmt.Fprintf(&sb, "\nRecently auto-banned (%d):\n", len(r.AutoBanned))
+	if len(r.AutoBanned) == 0 {
+		sb.WriteString("  none\n")
+	}
+	for _, e := range r.AutoBanned {
+		writeEntry(&sb, e)
+	}
+	return sb.String()
+}
+
+func writeEntry(sb *strings.Builder, e Entry) {
+	npub, _ := nip19.EncodePublicKey(e.PubKey)
+	fmt.Fprintf(sb, "\n  %s\n    banned until %s", npub, e.BannedUntil.UTC().Format(time.RFC3339))
+	if !e.AutoBanned.IsZero() {
+		fmt.Fprintf(sb, ", auto-banned %s", e.AutoBanned.UTC().Format(time.RFC3339))
+	}
+	sb.WriteString("\n")
+	for _, ev := range e.Evidence {
+		fmt.Fprintf(sb, "    - %s %s kind %d: %s (%s)\n", ev.Time.UTC().Format(time.RFC3339), ev.Filter, ev.Kind, ev.Reason, ev.EventID)
+		if ev.Sample != "" {
+			fmt.Fprintf(sb, "      %q\n", ev.Sample)
+		}
+	}
+}
+
+// ServeHTTP returns a fresh report, as text or, with ?format=json, as JSON.
+func (r *Review) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	report, err := r.Report(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if req.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, report.Text())
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n]) + "…"
+}
@@ -0,0 +1,249 @@
+// Package schedule runs the plugin's periodic maintenance jobs (database
+// garbage collection, list refreshes, reports) on cron schedules, with
+// jitter, overlap protection and metrics.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Job is a periodic task.
+type Job struct {
+	// Name identifies the job in the configuration, logs and metrics.
+	// Several jobs may share a name, such as the refreshes of the live and
+	// canary pipelines.
+	Name string
+	// Schedule applies unless the configuration overrides it.
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+	// Immediately runs the job once as soon as it is added (or the
+	// scheduler started) rather than waiting for its first scheduled time.
+	Immediately bool
+}
+
+// JobStats are the counts of the runs of the jobs of a name.
+type JobStats struct {
+	Runs    uint64 `json:"runs"`
+	Errors  uint64 `json:"errors"`
+	Skipped uint64 `json:"skipped"`
+	// LastDuration is that of the last finished run.
+	LastDuration time.Duration `json:"last_duration"`
+	LastSuccess  time.Time     `json:"last_success,omitzero"`
+	NextRun      time.Time     `json:"next_run,omitzero"`
+}
+
+// Scheduler runs jobs, each in its own goroutine. A run due while the
+// previous one of the same job is still going is skipped.
+type Scheduler struct {
+	jitter    time.Duration
+	overrides map[string]Schedule
+
+	mu      sync.Mutex
+	ctx     context.Context // nil until started.
+	pending []*entry
+	stats   map[string]*JobStats
+}
+
+type entry struct {
+	job      Job
+	schedule Schedule
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// New creates a scheduler delaying every run by up to jitter, and running the
+// jobs named in overrides on the given schedules instead of their own.
+func New(jitter time.Duration, overrides map[string]string) (*Scheduler, error) {
+	s := &Scheduler{
+		jitter:    jitter,
+		overrides: make(map[string]Schedule, len(overrides)),
+		stats:     make(map[string]*JobStats),
+	}
+	for name, expr := range overrides {
+		sched, err := Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule for job %s: %w", name, err)
+		}
+		s.overrides[name] = sched
+	}
+	return s, nil
+}
+
+// Start runs the jobs added so far, and those added later, until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ctx = ctx
+	for _, e := range s.pending {
+		s.launch(e)
+	}
+	s.pending = nil
+}
+
+// Add schedules job. The returned function removes it, waiting for a run in
+// progress to finish.
+func (s *Scheduler) Add(job Job) (remove func()) {
+	e := &entry{job: job, schedule: job.Schedule, done: make(chan struct{})}
+	if sched, ok := s.overrides[job.Name]; ok {
+		e.schedule = sched
+	}
+
+	s.mu.Lock()
+	if _, ok := s.stats[job.Name]; !ok {
+		s.stats[job.Name] = &JobStats{}
+	}
+	if s.ctx == nil {
+		s.pending = append(s.pending, e)
+	} else {
+		s.launch(e)
+	}
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		if i := slices.Index(s.pending, e); i >= 0 {
+			s.pending = slices.Delete(s.pending, i, i+1)
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+		e.cancel()
+		<-e.done
+	}
+}
+
+// launch starts the loop of e; s.mu is held.
+func (s *Scheduler) launch(e *entry) {
+	var ctx context.Context
+	ctx, e.cancel = context.WithCancel(s.ctx)
+	go s.loop(ctx, e)
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	defer close(e.done)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	running := make(chan struct{}, 1)
+	run := func() {
+		select {
+		case running <- struct{}{}:
+		default:
+			s.record(e.job.Name, func(st *JobStats) { st.Skipped++ })
+			slog.Warn("Scheduled job still running, skipping this run", "job", e.job.Name)
+			return
+		}
+		wg.Go(func() {
+			defer func() { <-running }()
+			s.execute(ctx, e.job)
+		})
+	}
+
+	if e.job.Immediately {
+		run()
+	}
+	for {
+		next := e.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		if s.jitter > 0 {
+			next = next.Add(rand.N(s.jitter))
+		}
+		s.record(e.job.Name, func(st *JobStats) { st.NextRun = next })
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		run()
+	}
+}
+
+func (s *Scheduler) execute(ctx context.Context, job Job) {
+	start := time.Now()
+	err := job.Run(ctx)
+	elapsed := time.Since(start)
+	if ctx.Err() != nil {
+		// Interrupted by a shutdown or the job's removal.
+		return
+	}
+	s.record(job.Name, func(st *JobStats) {
+		st.Runs++
+		st.LastDuration = elapsed
+		if err != nil {
+			st.Errors++
+		} else {
+			st.LastSuccess = start.Add(elapsed)
+		}
+	})
+	if err != nil {
+		slog.Warn("Scheduled job failed", "job", job.Name, "duration", elapsed, "error", err)
+	} else {
+		slog.Debug("Scheduled job finished", "job", job.Name, "duration", elapsed)
+	}
+}
+
+func (s *Scheduler) record(name string, update func(*JobStats)) {
+	s.mu.Lock()
+	update(s.stats[name])
+	s.mu.Unlock()
+}
+
+// Stats returns the counts of each job name.
+func (s *Scheduler) Stats() map[string]JobStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[string]JobStats, len(s.stats))
+	for name, st := range s.stats {
+		stats[name] = *st
+	}
+	return stats
+}
+
+// WriteMetrics writes the job counts in the OpenMetrics text format.
+func (s *Scheduler) WriteMetrics(w io.Writer) {
+	stats := s.Stats()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	fmt.Fprintln(w, "# TYPE adresu_scheduled_job_runs counter")
+	fmt.Fprintln(w, "# HELP adresu_scheduled_job_runs Runs of the scheduled jobs, by result; skipped runs were due while the previous one was still going.")
+	for _, name := range names {
+		st := stats[name]
+		fmt.Fprintf(w, "adresu_scheduled_job_runs_total{job=%q,result=\"ok\"} %d\n", name, st.Runs-st.Errors)
+		fmt.Fprintf(w, "adresu_scheduled_job_runs_total{job=%q,result=\"error\"} %d\n", name, st.Errors)
+		fmt.Fprintf(w, "adresu_scheduled_job_runs_total{job=%q,result=\"skipped\"} %d\n", name, st.Skipped)
+	}
+	fmt.Fprintln(w, "# TYPE adresu_scheduled_job_last_duration_seconds gauge")
+	fmt.Fprintln(w, "# HELP adresu_scheduled_job_last_duration_seconds Duration of the last finished run of the scheduled jobs.")
+	for _, name := range names {
+		fmt.Fprintf(w, "adresu_scheduled_job_last_duration_seconds{job=%q} %g\n", name, stats[name].LastDuration.Seconds())
+	}
+	fmt.Fprintln(w, "# TYPE adresu_scheduled_job_last_success_timestamp_seconds gauge")
+	fmt.Fprintln(w, "# HELP adresu_scheduled_job_last_success_timestamp_seconds Time the scheduled jobs last succeeded.")
+	for _, name := range names {
+		if st := stats[name]; !st.LastSuccess.IsZero() {
+			fmt.Fprintf(w, "adresu_scheduled_job_last_success_timestamp_seconds{job=%q} %d\n", name, st.LastSuccess.Unix())
+		}
+	}
+}
+
+// ServeHTTP returns the job counts as JSON.
+func (s *Scheduler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Stats())
+}
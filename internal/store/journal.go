@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ActionType is a moderation side effect that can be journaled.
+type ActionType string
+
+const (
+	ActionBan          ActionType = "ban"
+	ActionDeleteEvents ActionType = "delete_events"
+	ActionDeleteEvent  ActionType = "delete_event"
+	ActionBanIP        ActionType = "ban_ip"
+)
+
+// Action is a pending side effect. It is journaled before it is executed and
+// completed afterwards, so actions interrupted by a crash are found again by
+// PendingActions and replayed: every journaled action runs at least once.
+type Action struct {
+	ID       string        `json:"-"`
+	Type     ActionType    `json:"type"`
+	PubKey   string        `json:"pubkey"`
+	IP       string        `json:"ip,omitempty"`       // For IP bans: the normalized address.
+	EventID  string        `json:"event_id,omitempty"` // For single event deletions.
+	Duration time.Duration `json:"duration,omitempty"` // For bans.
+	Ban      *BanInfo      `json:"ban,omitempty"`      // For bans: the reason and source to record.
+	Created  time.Time     `json:"created"`
+	TraceID  string        `json:"trace_id,omitempty"`
+}
+
+// journalSeq disambiguates actions journaled within the same nanosecond. It
+// starts at a random value, so processes sharing a database do not collide.
+var journalSeq atomic.Uint32
+
+func init() {
+	journalSeq.Store(rand.Uint32())
+}
+
+// newJournalEntry stamps a with its creation time and ID. IDs sort by
+// creation time, so pending actions replay in order.
+func newJournalEntry(a Action) Action {
+	if a.Created.IsZero() {
+		a.Created = time.Now()
+	}
+	a.ID = fmt.Sprintf("%020d-%08x", a.Created.UnixNano(), journalSeq.Add(1))
+	return a
+}
+
+// JournalAction records a to a write-ahead journal and returns it with its ID.
+func (s *BadgerStore) JournalAction(ctx context.Context, a Action) (Action, error) {
+	a = newJournalEntry(a)
+	value, err := json.Marshal(a)
+	if err != nil {
+		return a, err
+	}
+	err = s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(journalPrefix+a.ID), value)
+	})
+	return a, err
+}
+
+// CompleteAction removes an executed action from the journal.
+func (s *BadgerStore) CompleteAction(ctx context.Context, id string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(journalPrefix + id))
+	})
+}
+
+// PendingActions returns the journaled actions not yet completed, oldest
+// first. Unreadable entries are skipped.
+func (s *BadgerStore) PendingActions(ctx context.Context) ([]Action, error) {
+	var actions []Action
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(journalPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item := it.Item()
+			var a Action
+			err := item.Value(func(v []byte) error { return json.Unmarshal(v, &a) })
+			if err != nil {
+				continue
+			}
+			a.ID = strings.TrimPrefix(string(item.Key()), journalPrefix)
+			actions = append(actions, a)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
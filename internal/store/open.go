@@ -0,0 +1,55 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// Open opens the store selected by cfg.Driver. Its errors wrap
+// ErrStoreUnavailable.
+func Open(cfg *config.DBConfig) (Store, error) {
+	switch cfg.Driver {
+	case config.DBBadger, "":
+		return classified(NewBadgerStore(cfg))
+	case config.DBRedis:
+		return classified(NewRedisStore(cfg))
+	case config.DBSQLite:
+		return classified(NewSQLiteStore(cfg))
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+}
+
+// classified returns the opened backend s wrapped in a classifyingStore.
+func classified[S Store](s S, err error) (Store, error) {
+	if err != nil {
+		return nil, err
+	}
+	if gc, ok := any(s).(GarbageCollector); ok {
+		return collectingClassifyingStore{classifyingStore{Store: s}, gc}, nil
+	}
+	return classifyingStore{Store: s}, nil
+}
+
+// recordFor returns the record of pubkey in records, adding it if missing.
+func recordFor(records map[string]*AuthorRecord, pubkey string) *AuthorRecord {
+	r := records[pubkey]
+	if r == nil {
+		r = &AuthorRecord{PubKey: pubkey}
+		records[pubkey] = r
+	}
+	return r
+}
+
+// sortRecords flattens records into a slice ordered by pubkey.
+func sortRecords(records map[string]*AuthorRecord) []AuthorRecord {
+	out := make([]AuthorRecord, 0, len(records))
+	for _, r := range records {
+		out = append(out, *r)
+	}
+	slices.SortFunc(out, func(a, b AuthorRecord) int { return strings.Compare(a.PubKey, b.PubKey) })
+	return out
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const (
+	// snapshotAttempts bounds the copies of a live badger database tried
+	// when compactions keep changing its files during the copy.
+	snapshotAttempts = 3
+	snapshotRetry    = 200 * time.Millisecond
+)
+
+// OpenReadOnly opens the configured database for inspection, such as listing
+// bans, while the plugin may be running. SQLite and Redis are shared safely
+// and opened as usual. A badger database is opened read-only or, while the
+// plugin holds its lock, from a copy taken on the spot, so the result is a
+// snapshot and anything written to it is lost on Close.
+func OpenReadOnly(cfg *config.DBConfig) (Store, error) {
+	if cfg.Driver != config.DBBadger && cfg.Driver != "" {
+		return Open(cfg)
+	}
+	return classified(NewBadgerReadOnlyStore(cfg))
+}
+
+// NewBadgerReadOnlyStore opens the badger database at cfg.Path read-only, or
+// a snapshot of it if another process holds it open.
+func NewBadgerReadOnlyStore(cfg *config.DBConfig) (*BadgerStore, error) {
+	db, err := badger.Open(badgerOptions(cfg.Path).WithReadOnly(true))
+	if err == nil {
+		return &BadgerStore{db: db}, nil
+	}
+	if !badgerLocked(err) {
+		return nil, fmt.Errorf("failed to open badger db read-only: %w", err)
+	}
+
+	var errs []error
+	for range snapshotAttempts {
+		s, err := openBadgerSnapshot(cfg.Path)
+		if err == nil {
+			return s, nil
+		}
+		errs = append(errs, err)
+		time.Sleep(snapshotRetry)
+	}
+	return nil, fmt.Errorf("failed to snapshot badger db %s: %w", cfg.Path, errors.Join(errs...))
+}
+
+// openBadgerSnapshot copies the database at path to a temporary directory
+// and opens the copy. Badger recovers the copy like a database after a
+// crash, discarding a partly written tail.
+func openBadgerSnapshot(path string) (*BadgerStore, error) {
+	dir, err := os.MkdirTemp("", "adresu-snapshot-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := copyBadgerFiles(path, dir); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	db, err := badger.Open(badgerOptions(dir))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &BadgerStore{db: db, snapshotDir: dir}, nil
+}
+
+// copyBadgerFiles copies the files of the database at src, except its lock,
+// to dst.
+func copyBadgerFiles(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || e.Name() == "LOCK" {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,419 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// addDelegateeScript adds a delegatee to the sorted set of a delegator
+// (scored by expiry in Unix milliseconds), enforcing the limit atomically so
+// that relays sharing the database cannot race past it.
+var addDelegateeScript = redis.NewScript(`
+local key, member = KEYS[1], ARGV[1]
+local now, expires, limit = tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now)
+if limit > 0 and not redis.call('ZSCORE', key, member) and redis.call('ZCARD', key) >= limit then
+	return 0
+end
+redis.call('ZADD', key, expires, member)
+local last = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+redis.call('PEXPIREAT', key, last[2])
+return 1
+`)
+
+// RedisStore keeps moderation state in Redis, so several relay instances can
+// share one ban list. Keys mirror the BadgerStore layout under KeyPrefix and
+// expire with Redis TTLs; bans and restrictions store their expiry (Unix
+// seconds) as the value so they can be listed without extra round trips.
+// Each instance journals to a hash of its own.
+type RedisStore struct {
+	client   *redis.Client
+	prefix   string
+	instance string
+}
+
+// NewRedisStore connects to the Redis server at cfg.URL.
+func NewRedisStore(cfg *config.DBConfig) (*RedisStore, error) {
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database.url: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("%w: failed to connect to redis: %w", ErrStoreUnavailable, err)
+	}
+	slog.Info("Connected to redis store", "addr", opts.Addr, "db", opts.DB, "key_prefix", cfg.KeyPrefix)
+	return &RedisStore{client: client, prefix: cfg.KeyPrefix, instance: cfg.InstanceID}, nil
+}
+
+func (s *RedisStore) key(parts ...string) string {
+	return s.prefix + strings.Join(parts, "")
+}
+
+// pattern returns a SCAN pattern matching keys starting with parts.
+func (s *RedisStore) pattern(parts ...string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return escaper.Replace(s.key(parts...)) + "*"
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisStore) IsAuthorBanned(ctx context.Context, pubkey string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.key(banPrefix, pubkey)).Result()
+	return n > 0, err
+}
+
+// BanAuthor stores the expiry under the ban key, as for restrictions, and
+// the JSON encoded BanInfo under a ban info key expiring with it.
+func (s *RedisStore) BanAuthor(ctx context.Context, pubkey string, duration time.Duration, info BanInfo) error {
+	slog.InfoContext(ctx, "Banning author", "pubkey", pubkey, "duration", duration.String(), "reason", info.Reason, "source", info.Source)
+	info = newBanInfo(info, duration)
+	value, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.key(banPrefix, pubkey), info.ExpiresAt.Unix(), duration)
+		pipe.Set(ctx, s.key(banInfoPrefix, pubkey), value, duration)
+		return nil
+	})
+	return err
+}
+
+// GetBanInfo reads the ban of pubkey. Bans stored without ban info only
+// report their expiry.
+func (s *RedisStore) GetBanInfo(ctx context.Context, pubkey string) (*BanInfo, error) {
+	values, err := s.client.MGet(ctx, s.key(banPrefix, pubkey), s.key(banInfoPrefix, pubkey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	until, ok := values[0].(string)
+	if !ok {
+		return nil, nil
+	}
+	info := &BanInfo{}
+	if raw, ok := values[1].(string); !ok || json.Unmarshal([]byte(raw), info) != nil {
+		*info = BanInfo{}
+	}
+	if secs, err := strconv.ParseInt(until, 10, 64); err == nil {
+		info.ExpiresAt = time.Unix(secs, 0)
+	}
+	return info, nil
+}
+
+func (s *RedisStore) UnbanAuthor(ctx context.Context, pubkey string) error {
+	slog.InfoContext(ctx, "Unbanning author", "pubkey", pubkey)
+	return s.client.Del(ctx, s.key(banPrefix, pubkey), s.key(banInfoPrefix, pubkey)).Err()
+}
+
+// BanIP stores the JSON encoded BanInfo under the IP ban key.
+func (s *RedisStore) BanIP(ctx context.Context, ip string, duration time.Duration, info BanInfo) error {
+	slog.InfoContext(ctx, "Banning IP", "ip", ip, "duration", duration.String(), "reason", info.Reason, "source", info.Source)
+	value, err := json.Marshal(newBanInfo(info, duration))
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.key(ipBanPrefix, ip), value, duration).Err()
+}
+
+func (s *RedisStore) IsIPBanned(ctx context.Context, ip string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.key(ipBanPrefix, ip)).Result()
+	return n > 0, err
+}
+
+func (s *RedisStore) UnbanIP(ctx context.Context, ip string) error {
+	slog.InfoContext(ctx, "Unbanning IP", "ip", ip)
+	return s.client.Del(ctx, s.key(ipBanPrefix, ip)).Err()
+}
+
+func (s *RedisStore) IPBans(ctx context.Context) ([]IPBan, error) {
+	var keys []string
+	it := s.client.Scan(ctx, 0, s.pattern(ipBanPrefix), 500).Iterator()
+	for it.Next(ctx) {
+		keys = append(keys, it.Val())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	var bans []IPBan
+	for chunk := range slices.Chunk(keys, 500) {
+		values, err := s.client.MGet(ctx, chunk...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			raw, ok := v.(string)
+			if !ok {
+				continue // Expired during the scan.
+			}
+			ban := IPBan{IP: strings.TrimPrefix(chunk[i], s.key(ipBanPrefix))}
+			if json.Unmarshal([]byte(raw), &ban.BanInfo) != nil {
+				ban.BanInfo = BanInfo{}
+			}
+			bans = append(bans, ban)
+		}
+	}
+	return sortIPBans(bans), nil
+}
+
+// Block stores the JSON encoded BanInfo under the blocklist key.
+func (s *RedisStore) Block(ctx context.Context, key string, duration time.Duration, info BanInfo) error {
+	slog.InfoContext(ctx, "Blocking", "key", key, "duration", duration.String(), "reason", info.Reason, "source", info.Source)
+	value, err := json.Marshal(newBanInfo(info, duration))
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.key(blockPrefix, key), value, duration).Err()
+}
+
+func (s *RedisStore) IsBlocked(ctx context.Context, key string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.key(blockPrefix, key)).Result()
+	return n > 0, err
+}
+
+func (s *RedisStore) Unblock(ctx context.Context, key string) error {
+	slog.InfoContext(ctx, "Unblocking", "key", key)
+	return s.client.Del(ctx, s.key(blockPrefix, key)).Err()
+}
+
+func (s *RedisStore) Blocklist(ctx context.Context) ([]BlockedEntry, error) {
+	var keys []string
+	it := s.client.Scan(ctx, 0, s.pattern(blockPrefix), 500).Iterator()
+	for it.Next(ctx) {
+		keys = append(keys, it.Val())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	var entries []BlockedEntry
+	for chunk := range slices.Chunk(keys, 500) {
+		values, err := s.client.MGet(ctx, chunk...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			raw, ok := v.(string)
+			if !ok {
+				continue // Expired during the scan.
+			}
+			entry := BlockedEntry{Key: strings.TrimPrefix(chunk[i], s.key(blockPrefix))}
+			if json.Unmarshal([]byte(raw), &entry.BanInfo) != nil {
+				entry.BanInfo = BanInfo{}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return sortBlocklist(entries), nil
+}
+
+func (s *RedisStore) AddDelegatee(ctx context.Context, delegator, delegatee string, ttl time.Duration, limit int) (bool, error) {
+	now := time.Now()
+	n, err := addDelegateeScript.Run(ctx, s.client, []string{s.key(delegateePrefix, delegator)},
+		delegatee, now.UnixMilli(), now.Add(ttl).UnixMilli(), limit).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *RedisStore) AddStrike(ctx context.Context, pubkey string, window time.Duration) (int, error) {
+	key := s.key(strikePrefix, pubkey)
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.PExpire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+func (s *RedisStore) ClearStrikes(ctx context.Context, pubkey string) error {
+	return s.client.Del(ctx, s.key(strikePrefix, pubkey)).Err()
+}
+
+func (s *RedisStore) RestrictKinds(ctx context.Context, pubkey string, kinds []int, duration time.Duration) error {
+	slog.InfoContext(ctx, "Restricting author", "pubkey", pubkey, "kinds", kinds, "duration", duration.String())
+	until := time.Now().Add(duration).Unix()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, kind := range kinds {
+			pipe.Set(ctx, s.key(restrictPrefix, pubkey, ":", strconv.Itoa(kind)), until, duration)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) LiftRestrictions(ctx context.Context, pubkey string, kinds []int) error {
+	if len(kinds) == 0 {
+		current, err := s.Restrictions(ctx, pubkey)
+		if err != nil {
+			return err
+		}
+		for _, r := range current {
+			kinds = append(kinds, r.Kind)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil
+	}
+	slog.InfoContext(ctx, "Lifting author restrictions", "pubkey", pubkey, "kinds", kinds)
+	keys := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		keys = append(keys, s.key(restrictPrefix, pubkey, ":", strconv.Itoa(kind)))
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+func (s *RedisStore) IsKindRestricted(ctx context.Context, pubkey string, kind int) (bool, error) {
+	n, err := s.client.Exists(ctx, s.key(restrictPrefix, pubkey, ":", strconv.Itoa(kind))).Result()
+	return n > 0, err
+}
+
+func (s *RedisStore) Restrictions(ctx context.Context, pubkey string) ([]Restriction, error) {
+	var restrictions []Restriction
+	err := s.scanValues(ctx, s.pattern(restrictPrefix, pubkey, ":"), func(key string, until time.Time) {
+		kind, err := strconv.Atoi(key[strings.LastIndexByte(key, ':')+1:])
+		if err == nil {
+			restrictions = append(restrictions, Restriction{Kind: kind, Until: until})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(restrictions, func(a, b Restriction) int { return a.Kind - b.Kind })
+	return restrictions, nil
+}
+
+func (s *RedisStore) Authors(ctx context.Context) ([]AuthorRecord, error) {
+	records := make(map[string]*AuthorRecord)
+	err := s.scanValues(ctx, s.pattern(banPrefix), func(key string, until time.Time) {
+		rest := strings.TrimPrefix(key, s.key(banPrefix))
+		if validKey(banPrefix, rest) {
+			recordFor(records, rest).BannedUntil = until
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.scanValues(ctx, s.pattern(restrictPrefix), func(key string, until time.Time) {
+		rest := strings.TrimPrefix(key, s.key(restrictPrefix))
+		if !validKey(restrictPrefix, rest) {
+			return
+		}
+		pubkey, kind, _ := strings.Cut(rest, ":")
+		k, _ := strconv.Atoi(kind)
+		r := recordFor(records, pubkey)
+		r.Restrictions = append(r.Restrictions, Restriction{Kind: k, Until: until})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortRecords(records), nil
+}
+
+// scanValues calls fn for every key matching pattern whose value is an
+// expiry in Unix seconds. Keys expiring during the scan are skipped.
+func (s *RedisStore) scanValues(ctx context.Context, pattern string, fn func(key string, until time.Time)) error {
+	const batch = 500
+	var keys []string
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		values, err := s.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			str, ok := v.(string)
+			if !ok {
+				continue
+			}
+			if secs, err := strconv.ParseInt(str, 10, 64); err == nil {
+				fn(keys[i], time.Unix(secs, 0))
+			}
+		}
+		keys = keys[:0]
+		return nil
+	}
+
+	it := s.client.Scan(ctx, 0, pattern, batch).Iterator()
+	for it.Next(ctx) {
+		keys = append(keys, it.Val())
+		if len(keys) == batch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// journalKeys returns the journal hash of this instance and the one shared
+// by all instances before actions had an instance, which any instance
+// replays.
+func (s *RedisStore) journalKeys() []string {
+	return []string{s.key(journalPrefix, s.instance), s.key(journalPrefix)}
+}
+
+func (s *RedisStore) JournalAction(ctx context.Context, a Action) (Action, error) {
+	a = newJournalEntry(a)
+	value, err := json.Marshal(a)
+	if err != nil {
+		return a, err
+	}
+	return a, s.client.HSet(ctx, s.journalKeys()[0], a.ID, value).Err()
+}
+
+func (s *RedisStore) CompleteAction(ctx context.Context, id string) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range s.journalKeys() {
+			pipe.HDel(ctx, key, id)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) PendingActions(ctx context.Context) ([]Action, error) {
+	var actions []Action
+	for _, key := range s.journalKeys() {
+		entries, err := s.client.HGetAll(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		for id, value := range entries {
+			var a Action
+			if err := json.Unmarshal([]byte(value), &a); err != nil {
+				continue
+			}
+			a.ID = id
+			actions = append(actions, a)
+		}
+	}
+	slices.SortFunc(actions, func(a, b Action) int { return strings.Compare(a.ID, b.ID) })
+	return actions, nil
+}
@@ -0,0 +1,484 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite" // Registers the pure-Go "sqlite" driver.
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS bans (
+	pubkey     TEXT PRIMARY KEY,
+	expires_at INTEGER NOT NULL,
+	reason     TEXT NOT NULL DEFAULT '',
+	source     TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS ip_bans (
+	ip         TEXT PRIMARY KEY,
+	expires_at INTEGER NOT NULL,
+	reason     TEXT NOT NULL DEFAULT '',
+	source     TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS blocklist (
+	key        TEXT PRIMARY KEY,
+	expires_at INTEGER NOT NULL,
+	reason     TEXT NOT NULL DEFAULT '',
+	source     TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS delegatees (
+	delegator  TEXT NOT NULL,
+	delegatee  TEXT NOT NULL,
+	expires_at INTEGER NOT NULL,
+	PRIMARY KEY (delegator, delegatee)
+);
+CREATE TABLE IF NOT EXISTS restrictions (
+	pubkey     TEXT NOT NULL,
+	kind       INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	PRIMARY KEY (pubkey, kind)
+);
+CREATE TABLE IF NOT EXISTS strikes (
+	pubkey     TEXT PRIMARY KEY,
+	count      INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS journal (
+	id       TEXT PRIMARY KEY,
+	action   TEXT NOT NULL,
+	instance TEXT NOT NULL DEFAULT ''
+);
+`
+
+// SQLiteStore keeps moderation state in an SQLite file, which relay
+// instances on the same host can share. Expiry times are Unix seconds; expired
+// rows are ignored by reads and purged when the store is opened. Journaled
+// actions belong to the instance that journaled them.
+type SQLiteStore struct {
+	db       *sql.DB
+	instance string
+}
+
+// NewSQLiteStore opens (or creates) the SQLite database at cfg.Path.
+func NewSQLiteStore(cfg *config.DBConfig) (*SQLiteStore, error) {
+	// WAL lets readers proceed during writes; the busy timeout makes
+	// processes sharing the file wait for each other's locks.
+	dsn := "file:" + (&url.URL{Path: cfg.Path}).EscapedPath() +
+		"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite db: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize sqlite db: %w", err)
+	}
+	s := &SQLiteStore{db: db, instance: cfg.InstanceID}
+	if err := s.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := s.purgeExpired(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	slog.Info("Opened sqlite store", "path", cfg.Path)
+	return s, nil
+}
+
+// migrate adds the ban metadata columns and the journal instance column to
+// databases created before them.
+func (s *SQLiteStore) migrate(ctx context.Context) error {
+	hasColumn := func(table, column string) (bool, error) {
+		var n int
+		err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+		if err != nil {
+			return false, fmt.Errorf("failed to inspect sqlite schema: %w", err)
+		}
+		return n > 0, nil
+	}
+
+	ok, err := hasColumn("bans", "reason")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		for _, column := range []string{
+			"reason TEXT NOT NULL DEFAULT ''",
+			"source TEXT NOT NULL DEFAULT ''",
+			"created_at INTEGER NOT NULL DEFAULT 0",
+		} {
+			if _, err := s.db.ExecContext(ctx, "ALTER TABLE bans ADD COLUMN "+column); err != nil {
+				return fmt.Errorf("failed to migrate sqlite bans table: %w", err)
+			}
+		}
+	}
+
+	if ok, err = hasColumn("journal", "instance"); err != nil {
+		return err
+	}
+	if !ok {
+		if _, err := s.db.ExecContext(ctx, "ALTER TABLE journal ADD COLUMN instance TEXT NOT NULL DEFAULT ''"); err != nil {
+			return fmt.Errorf("failed to migrate sqlite journal table: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) purgeExpired(ctx context.Context) error {
+	now := time.Now().Unix()
+	for _, table := range []string{"bans", "ip_bans", "blocklist", "delegatees", "restrictions", "strikes"} {
+		if _, err := s.db.ExecContext(ctx, "DELETE FROM "+table+" WHERE expires_at <= ?", now); err != nil {
+			return fmt.Errorf("failed to purge expired %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// exists reports whether query, with now appended to args, returns a row.
+func (s *SQLiteStore) exists(ctx context.Context, query string, args ...any) (bool, error) {
+	var one int
+	err := s.db.QueryRowContext(ctx, query, append(args, time.Now().Unix())...).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *SQLiteStore) IsAuthorBanned(ctx context.Context, pubkey string) (bool, error) {
+	return s.exists(ctx, "SELECT 1 FROM bans WHERE pubkey = ? AND expires_at > ?", pubkey)
+}
+
+func (s *SQLiteStore) BanAuthor(ctx context.Context, pubkey string, duration time.Duration, info BanInfo) error {
+	slog.InfoContext(ctx, "Banning author", "pubkey", pubkey, "duration", duration.String(), "reason", info.Reason, "source", info.Source)
+	info = newBanInfo(info, duration)
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO bans (pubkey, expires_at, reason, source, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (pubkey) DO UPDATE SET expires_at = excluded.expires_at, reason = excluded.reason,
+			source = excluded.source, created_at = excluded.created_at`,
+		pubkey, info.ExpiresAt.Unix(), info.Reason, info.Source, info.CreatedAt.Unix())
+	return err
+}
+
+func (s *SQLiteStore) GetBanInfo(ctx context.Context, pubkey string) (*BanInfo, error) {
+	var info BanInfo
+	var expires, created int64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT expires_at, reason, source, created_at FROM bans WHERE pubkey = ? AND expires_at > ?",
+		pubkey, time.Now().Unix()).Scan(&expires, &info.Reason, &info.Source, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.ExpiresAt = time.Unix(expires, 0)
+	if created > 0 {
+		info.CreatedAt = time.Unix(created, 0)
+	}
+	return &info, nil
+}
+
+func (s *SQLiteStore) UnbanAuthor(ctx context.Context, pubkey string) error {
+	slog.InfoContext(ctx, "Unbanning author", "pubkey", pubkey)
+	_, err := s.db.ExecContext(ctx, "DELETE FROM bans WHERE pubkey = ?", pubkey)
+	return err
+}
+
+func (s *SQLiteStore) BanIP(ctx context.Context, ip string, duration time.Duration, info BanInfo) error {
+	slog.InfoContext(ctx, "Banning IP", "ip", ip, "duration", duration.String(), "reason", info.Reason, "source", info.Source)
+	info = newBanInfo(info, duration)
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO ip_bans (ip, expires_at, reason, source, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (ip) DO UPDATE SET expires_at = excluded.expires_at, reason = excluded.reason,
+			source = excluded.source, created_at = excluded.created_at`,
+		ip, info.ExpiresAt.Unix(), info.Reason, info.Source, info.CreatedAt.Unix())
+	return err
+}
+
+func (s *SQLiteStore) IsIPBanned(ctx context.Context, ip string) (bool, error) {
+	return s.exists(ctx, "SELECT 1 FROM ip_bans WHERE ip = ? AND expires_at > ?", ip)
+}
+
+func (s *SQLiteStore) UnbanIP(ctx context.Context, ip string) error {
+	slog.InfoContext(ctx, "Unbanning IP", "ip", ip)
+	_, err := s.db.ExecContext(ctx, "DELETE FROM ip_bans WHERE ip = ?", ip)
+	return err
+}
+
+func (s *SQLiteStore) IPBans(ctx context.Context) ([]IPBan, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT ip, expires_at, reason, source, created_at FROM ip_bans WHERE expires_at > ? ORDER BY ip", time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var bans []IPBan
+	for rows.Next() {
+		var ban IPBan
+		var expiresAt, createdAt int64
+		if err := rows.Scan(&ban.IP, &expiresAt, &ban.Reason, &ban.Source, &createdAt); err != nil {
+			return nil, err
+		}
+		ban.ExpiresAt = time.Unix(expiresAt, 0)
+		if createdAt > 0 {
+			ban.CreatedAt = time.Unix(createdAt, 0)
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+
+func (s *SQLiteStore) Block(ctx context.Context, key string, duration time.Duration, info BanInfo) error {
+	slog.InfoContext(ctx, "Blocking", "key", key, "duration", duration.String(), "reason", info.Reason, "source", info.Source)
+	info = newBanInfo(info, duration)
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO blocklist (key, expires_at, reason, source, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET expires_at = excluded.expires_at, reason = excluded.reason,
+			source = excluded.source, created_at = excluded.created_at`,
+		key, info.ExpiresAt.Unix(), info.Reason, info.Source, info.CreatedAt.Unix())
+	return err
+}
+
+func (s *SQLiteStore) IsBlocked(ctx context.Context, key string) (bool, error) {
+	return s.exists(ctx, "SELECT 1 FROM blocklist WHERE key = ? AND expires_at > ?", key)
+}
+
+func (s *SQLiteStore) Unblock(ctx context.Context, key string) error {
+	slog.InfoContext(ctx, "Unblocking", "key", key)
+	_, err := s.db.ExecContext(ctx, "DELETE FROM blocklist WHERE key = ?", key)
+	return err
+}
+
+func (s *SQLiteStore) Blocklist(ctx context.Context) ([]BlockedEntry, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT key, expires_at, reason, source, created_at FROM blocklist WHERE expires_at > ? ORDER BY key", time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []BlockedEntry
+	for rows.Next() {
+		var entry BlockedEntry
+		var expiresAt, createdAt int64
+		if err := rows.Scan(&entry.Key, &expiresAt, &entry.Reason, &entry.Source, &createdAt); err != nil {
+			return nil, err
+		}
+		entry.ExpiresAt = time.Unix(expiresAt, 0)
+		if createdAt > 0 {
+			entry.CreatedAt = time.Unix(createdAt, 0)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLiteStore) AddDelegatee(ctx context.Context, delegator, delegatee string, ttl time.Duration, limit int) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM delegatees WHERE delegator = ? AND expires_at <= ?", delegator, now.Unix()); err != nil {
+		return false, err
+	}
+	if limit > 0 {
+		var known, active int
+		err := tx.QueryRowContext(ctx,
+			"SELECT COALESCE(SUM(delegatee = ?), 0), COUNT(*) FROM delegatees WHERE delegator = ?",
+			delegatee, delegator).Scan(&known, &active)
+		if err != nil {
+			return false, err
+		}
+		if known == 0 && active >= limit {
+			return false, tx.Commit()
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO delegatees (delegator, delegatee, expires_at) VALUES (?, ?, ?) ON CONFLICT (delegator, delegatee) DO UPDATE SET expires_at = excluded.expires_at",
+		delegator, delegatee, now.Add(ttl).Unix())
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *SQLiteStore) AddStrike(ctx context.Context, pubkey string, window time.Duration) (int, error) {
+	now := time.Now()
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO strikes (pubkey, count, expires_at) VALUES (?, 1, ?)
+		ON CONFLICT (pubkey) DO UPDATE SET
+			count = CASE WHEN strikes.expires_at > ? THEN strikes.count + 1 ELSE 1 END,
+			expires_at = excluded.expires_at
+		RETURNING count`,
+		pubkey, now.Add(window).Unix(), now.Unix()).Scan(&count)
+	return count, err
+}
+
+func (s *SQLiteStore) ClearStrikes(ctx context.Context, pubkey string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM strikes WHERE pubkey = ?", pubkey)
+	return err
+}
+
+func (s *SQLiteStore) RestrictKinds(ctx context.Context, pubkey string, kinds []int, duration time.Duration) error {
+	slog.InfoContext(ctx, "Restricting author", "pubkey", pubkey, "kinds", kinds, "duration", duration.String())
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	until := time.Now().Add(duration).Unix()
+	for _, kind := range kinds {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO restrictions (pubkey, kind, expires_at) VALUES (?, ?, ?) ON CONFLICT (pubkey, kind) DO UPDATE SET expires_at = excluded.expires_at",
+			pubkey, kind, until)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) LiftRestrictions(ctx context.Context, pubkey string, kinds []int) error {
+	if len(kinds) == 0 {
+		slog.InfoContext(ctx, "Lifting author restrictions", "pubkey", pubkey, "kinds", "all")
+		_, err := s.db.ExecContext(ctx, "DELETE FROM restrictions WHERE pubkey = ?", pubkey)
+		return err
+	}
+	slog.InfoContext(ctx, "Lifting author restrictions", "pubkey", pubkey, "kinds", kinds)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, kind := range kinds {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM restrictions WHERE pubkey = ? AND kind = ?", pubkey, kind); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) IsKindRestricted(ctx context.Context, pubkey string, kind int) (bool, error) {
+	return s.exists(ctx, "SELECT 1 FROM restrictions WHERE pubkey = ? AND kind = ? AND expires_at > ?", pubkey, kind)
+}
+
+func (s *SQLiteStore) Restrictions(ctx context.Context, pubkey string) ([]Restriction, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT kind, expires_at FROM restrictions WHERE pubkey = ? AND expires_at > ? ORDER BY kind",
+		pubkey, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var restrictions []Restriction
+	for rows.Next() {
+		var kind int
+		var until int64
+		if err := rows.Scan(&kind, &until); err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, Restriction{Kind: kind, Until: time.Unix(until, 0)})
+	}
+	return restrictions, rows.Err()
+}
+
+func (s *SQLiteStore) Authors(ctx context.Context) ([]AuthorRecord, error) {
+	records := make(map[string]*AuthorRecord)
+	now := time.Now().Unix()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT pubkey, expires_at FROM bans WHERE expires_at > ?", now)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var pubkey string
+		var until int64
+		if err := rows.Scan(&pubkey, &until); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		recordFor(records, pubkey).BannedUntil = time.Unix(until, 0)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, "SELECT pubkey, kind, expires_at FROM restrictions WHERE expires_at > ? ORDER BY kind", now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pubkey string
+		var kind int
+		var until int64
+		if err := rows.Scan(&pubkey, &kind, &until); err != nil {
+			return nil, err
+		}
+		r := recordFor(records, pubkey)
+		r.Restrictions = append(r.Restrictions, Restriction{Kind: kind, Until: time.Unix(until, 0)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sortRecords(records), nil
+}
+
+func (s *SQLiteStore) JournalAction(ctx context.Context, a Action) (Action, error) {
+	a = newJournalEntry(a)
+	value, err := json.Marshal(a)
+	if err != nil {
+		return a, err
+	}
+	_, err = s.db.ExecContext(ctx, "INSERT INTO journal (id, action, instance) VALUES (?, ?, ?)", a.ID, string(value), s.instance)
+	return a, err
+}
+
+func (s *SQLiteStore) CompleteAction(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM journal WHERE id = ?", id)
+	return err
+}
+
+// PendingActions returns the pending actions of this instance, and those
+// journaled before actions had an instance, which any instance replays.
+func (s *SQLiteStore) PendingActions(ctx context.Context) ([]Action, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, action FROM journal WHERE instance IN (?, '') ORDER BY id", s.instance)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var actions []Action
+	for rows.Next() {
+		var id, value string
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		var a Action
+		if err := json.Unmarshal([]byte(value), &a); err != nil {
+			continue
+		}
+		a.ID = id
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
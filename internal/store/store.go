@@ -2,29 +2,172 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/nbd-wtf/go-nostr"
 
 	"github.com/lessucettes/adresu-plugin/internal/config"
 )
 
-const banPrefix = "ban:"
+const (
+	banPrefix       = "ban:"
+	banInfoPrefix   = "baninfo:"   // Redis only; Badger keeps ban info in the ban value.
+	ipBanPrefix     = "ipban:"     // ipban:<address or CIDR network>
+	delegateePrefix = "delegatee:" // delegatee:<delegator>:<delegatee>
+	restrictPrefix  = "restrict:"  // restrict:<pubkey>:<kind>
+	journalPrefix   = "journal:"   // journal:<created unix nanos>-<seq>
+	strikePrefix    = "strike:"    // strike:<pubkey>
+	blockPrefix     = "block:"     // block:<blocklist key>
+)
+
+// Blocklist keys name what a blocklist entry blocks: an event by its ID, or
+// every event with the same content by the hex SHA-256 of the content.
+const (
+	BlockedEventPrefix   = "event:"
+	BlockedContentPrefix = "content:"
+)
+
+// knownPrefixes lists every key prefix the plugin writes; anything else in
+// the database is reported by Check.
+var knownPrefixes = []string{banPrefix, ipBanPrefix, delegateePrefix, restrictPrefix, journalPrefix, strikePrefix, blockPrefix}
 
-// Store is the generic interface for all storage types.
+// ErrDatabaseLocked is returned when another process holds the database lock.
+var ErrDatabaseLocked = errors.New("database is locked by another process")
+
+// ErrStoreUnavailable is wrapped by the errors of stores that could not be
+// read or written, so callers can tell them apart from bad input and retry.
+var ErrStoreUnavailable = errors.New("store unavailable")
+
+// Store is the generic interface for all storage types. Open selects the
+// implementation configured by database.driver.
 type Store interface {
 	IsAuthorBanned(ctx context.Context, pubkey string) (bool, error)
-	BanAuthor(ctx context.Context, pubkey string, duration time.Duration) error
+	// BanAuthor bans pubkey for duration, recording info's reason and
+	// source; the store sets its timestamps.
+	BanAuthor(ctx context.Context, pubkey string, duration time.Duration, info BanInfo) error
+	// GetBanInfo returns the ban of pubkey, or nil if it is not banned.
+	GetBanInfo(ctx context.Context, pubkey string) (*BanInfo, error)
 	UnbanAuthor(ctx context.Context, pubkey string) error
+	// BanIP bans a normalized address or CIDR network for duration. Callers
+	// look up the same normalized form with IsIPBanned.
+	BanIP(ctx context.Context, ip string, duration time.Duration, info BanInfo) error
+	IsIPBanned(ctx context.Context, ip string) (bool, error)
+	UnbanIP(ctx context.Context, ip string) error
+	// IPBans returns the active IP bans, ordered by address.
+	IPBans(ctx context.Context) ([]IPBan, error)
+	// Block adds a blocklist key for duration. Callers look up the same key
+	// with IsBlocked.
+	Block(ctx context.Context, key string, duration time.Duration, info BanInfo) error
+	IsBlocked(ctx context.Context, key string) (bool, error)
+	Unblock(ctx context.Context, key string) error
+	// Blocklist returns the active blocklist entries, ordered by key.
+	Blocklist(ctx context.Context) ([]BlockedEntry, error)
+	// AddDelegatee records that delegatee may post on behalf of delegator
+	// for ttl. A new delegatee is refused (false) once delegator already has
+	// limit active ones; limit <= 0 means no limit.
+	AddDelegatee(ctx context.Context, delegator, delegatee string, ttl time.Duration, limit int) (bool, error)
+	// AddStrike counts a strike against pubkey and returns its strikes. The
+	// count is forgotten window after the last strike.
+	AddStrike(ctx context.Context, pubkey string, window time.Duration) (int, error)
+	ClearStrikes(ctx context.Context, pubkey string) error
+	// RestrictKinds forbids pubkey to post the given kinds for duration,
+	// without banning it.
+	RestrictKinds(ctx context.Context, pubkey string, kinds []int, duration time.Duration) error
+	// LiftRestrictions removes restrictions of pubkey; no kinds means all.
+	LiftRestrictions(ctx context.Context, pubkey string, kinds []int) error
+	IsKindRestricted(ctx context.Context, pubkey string, kind int) (bool, error)
+	Restrictions(ctx context.Context, pubkey string) ([]Restriction, error)
+	// Authors returns the moderation state of every banned or restricted
+	// pubkey, ordered by pubkey.
+	Authors(ctx context.Context) ([]AuthorRecord, error)
+	// JournalAction, CompleteAction and PendingActions form a write-ahead
+	// journal of side effects executed asynchronously.
+	JournalAction(ctx context.Context, a Action) (Action, error)
+	CompleteAction(ctx context.Context, id string) error
+	PendingActions(ctx context.Context) ([]Action, error)
 	Close() error
 }
 
+// GarbageCollector is implemented by stores that need their disk space
+// reclaimed periodically, as BadgerStore does.
+type GarbageCollector interface {
+	CollectGarbage(ctx context.Context) error
+}
+
+// BanInfo explains a ban. Bans recorded before it was introduced only have
+// ExpiresAt.
+type BanInfo struct {
+	Reason string `json:"reason,omitempty"`
+	// Source is what issued the ban: a filter name, or the pubkey of the
+	// moderator or reputation issuer.
+	Source    string    `json:"source,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IPBan is a banned address or network.
+type IPBan struct {
+	IP string `json:"ip"`
+	BanInfo
+}
+
+// sortIPBans orders bans by address.
+func sortIPBans(bans []IPBan) []IPBan {
+	slices.SortFunc(bans, func(a, b IPBan) int { return strings.Compare(a.IP, b.IP) })
+	return bans
+}
+
+// BlockedEntry is a blocklist key and why it was blocked.
+type BlockedEntry struct {
+	Key string `json:"key"`
+	BanInfo
+}
+
+// ValidBlockKey reports whether key is a blocklist key.
+func ValidBlockKey(key string) bool {
+	for _, prefix := range []string{BlockedEventPrefix, BlockedContentPrefix} {
+		if hash, ok := strings.CutPrefix(key, prefix); ok {
+			return nostr.IsValid32ByteHex(hash)
+		}
+	}
+	return false
+}
+
+// sortBlocklist orders entries by key.
+func sortBlocklist(entries []BlockedEntry) []BlockedEntry {
+	slices.SortFunc(entries, func(a, b BlockedEntry) int { return strings.Compare(a.Key, b.Key) })
+	return entries
+}
+
+// newBanInfo stamps info for a ban of duration starting now.
+func newBanInfo(info BanInfo, duration time.Duration) BanInfo {
+	info.CreatedAt = time.Now().Truncate(time.Second)
+	info.ExpiresAt = info.CreatedAt.Add(duration)
+	return info
+}
+
+// Restriction is one kind a pubkey may not post, until a point in time.
+type Restriction struct {
+	Kind  int       `json:"kind"`
+	Until time.Time `json:"until"`
+}
+
 // BadgerStore is the production-ready implementation of the Store interface using BadgerDB.
 type BadgerStore struct {
 	db *badger.DB
+	// snapshotDir is the copy a read-only store was opened from, removed on
+	// Close.
+	snapshotDir string
 }
 
 // badgerLogger adapts slog.Logger to be used as a logger for BadgerDB.
@@ -39,21 +182,161 @@ func (l *badgerLogger) Debugf(f string, v ...any)   {}
 
 // NewBadgerStore initializes and returns a new, optimized BadgerStore.
 func NewBadgerStore(cfg *config.DBConfig) (*BadgerStore, error) {
-	opts := badger.DefaultOptions(cfg.Path)
+	db, err := badger.Open(badgerOptions(cfg.Path))
+	if err != nil {
+		if badgerLocked(err) {
+			return nil, fmt.Errorf(
+				"%w: %s is in use (is another adresu-plugin instance running?); stop it or set a different database.path",
+				ErrDatabaseLocked, cfg.Path,
+			)
+		}
+		return nil, fmt.Errorf("failed to open badger db: %w", err)
+	}
+
+	s := &BadgerStore{db: db}
+	if cfg.CheckOnStartup {
+		report, err := s.Check(context.Background(), false)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("database integrity check failed: %w", err)
+		}
+		slog.Info("Database integrity check passed", "keys_by_prefix", report.KeysByPrefix, "unknown_keys", report.UnknownKeys)
+	}
+	return s, nil
+}
+
+// NewBadgerMemoryStore returns an empty BadgerStore that is kept in memory
+// and lost on Close, for tests.
+func NewBadgerMemoryStore() (*BadgerStore, error) {
+	db, err := badger.Open(badgerOptions("").WithInMemory(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open in-memory badger db: %w", err)
+	}
+	return &BadgerStore{db: db}, nil
+}
+
+func badgerOptions(path string) badger.Options {
+	opts := badger.DefaultOptions(path)
 	opts.ValueThreshold = 1024
 	opts.Logger = &badgerLogger{slog.Default()}
+	return opts
+}
+
+// badgerLocked reports whether err is badger failing to lock its directory.
+func badgerLocked(err error) bool {
+	return strings.Contains(err.Error(), "Cannot acquire directory lock")
+}
+
+// CheckReport summarizes the contents of the database.
+type CheckReport struct {
+	KeysByPrefix map[string]int
+	UnknownKeys  int
+	InvalidKeys  []string
+}
+
+// Check walks all keys, counts them by prefix and validates their shape.
+// With verifyChecksums it also verifies the checksums of every table, which
+// reads the whole database from disk.
+func (s *BadgerStore) Check(ctx context.Context, verifyChecksums bool) (*CheckReport, error) {
+	if verifyChecksums {
+		if err := s.db.VerifyChecksum(); err != nil {
+			return nil, fmt.Errorf("checksum verification failed: %w", err)
+		}
+	}
+
+	report := &CheckReport{KeysByPrefix: make(map[string]int, len(knownPrefixes))}
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
 
-	db, err := badger.Open(opts)
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			key := string(it.Item().Key())
+			prefix := ""
+			for _, p := range knownPrefixes {
+				if strings.HasPrefix(key, p) {
+					prefix = p
+					break
+				}
+			}
+			if prefix == "" {
+				report.UnknownKeys++
+				continue
+			}
+			report.KeysByPrefix[prefix]++
+			if !validKey(prefix, strings.TrimPrefix(key, prefix)) {
+				report.InvalidKeys = append(report.InvalidKeys, key)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to open badger db: %w", err)
+		return nil, err
 	}
+	return report, nil
+}
 
-	return &BadgerStore{db: db}, nil
+// validKey reports whether the part of a key after its prefix is well formed.
+func validKey(prefix, rest string) bool {
+	switch prefix {
+	case banPrefix:
+		return nostr.IsValidPublicKey(rest)
+	case ipBanPrefix:
+		_, _, err := net.ParseCIDR(rest)
+		return net.ParseIP(rest) != nil || err == nil
+	case blockPrefix:
+		return ValidBlockKey(rest)
+	case delegateePrefix:
+		delegator, delegatee, ok := strings.Cut(rest, ":")
+		return ok && nostr.IsValidPublicKey(delegator) && nostr.IsValidPublicKey(delegatee)
+	case restrictPrefix:
+		pubkey, kind, ok := strings.Cut(rest, ":")
+		_, err := strconv.Atoi(kind)
+		return ok && nostr.IsValidPublicKey(pubkey) && err == nil
+	case journalPrefix:
+		nanos, seq, ok := strings.Cut(rest, "-")
+		_, err1 := strconv.ParseInt(nanos, 10, 64)
+		_, err2 := strconv.ParseUint(seq, 16, 32)
+		return ok && err1 == nil && err2 == nil
+	}
+	return true
 }
 
 // Close gracefully closes the database connection.
 func (s *BadgerStore) Close() error {
-	return s.db.Close()
+	err := s.db.Close()
+	if s.snapshotDir != "" {
+		os.RemoveAll(s.snapshotDir)
+	}
+	return err
+}
+
+// badgerGCDiscardRatio is the share of garbage a value log file must hold to
+// be rewritten.
+const badgerGCDiscardRatio = 0.5
+
+// CollectGarbage rewrites the value log files that are mostly garbage, which
+// Badger never does on its own, one at a time until none is left.
+func (s *BadgerStore) CollectGarbage(ctx context.Context) error {
+	rewritten := 0
+	for ctx.Err() == nil {
+		err := s.db.RunValueLogGC(badgerGCDiscardRatio)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("value log garbage collection failed: %w", err)
+		}
+		rewritten++
+	}
+	if rewritten > 0 {
+		slog.Info("Badger value log garbage collected", "files_rewritten", rewritten)
+	}
+	return ctx.Err()
 }
 
 // IsAuthorBanned checks if a given pubkey is in the ban list.
@@ -72,21 +355,411 @@ func (s *BadgerStore) IsAuthorBanned(ctx context.Context, pubkey string) (bool,
 	return true, nil
 }
 
-// BanAuthor adds a pubkey to the ban list with a specified TTL.
-func (s *BadgerStore) BanAuthor(ctx context.Context, pubkey string, duration time.Duration) error {
-	slog.Info("Banning author", "pubkey", pubkey, "duration", duration.String())
+// BanAuthor adds a pubkey to the ban list with a specified TTL. The value is
+// the JSON encoded BanInfo.
+func (s *BadgerStore) BanAuthor(ctx context.Context, pubkey string, duration time.Duration, info BanInfo) error {
+	slog.InfoContext(ctx, "Banning author", "pubkey", pubkey, "duration", duration.String(), "reason", info.Reason, "source", info.Source)
+	value, err := json.Marshal(newBanInfo(info, duration))
+	if err != nil {
+		return err
+	}
 	key := []byte(banPrefix + pubkey)
 	return s.db.Update(func(txn *badger.Txn) error {
-		entry := badger.NewEntry(key, nil).WithTTL(duration)
+		entry := badger.NewEntry(key, value).WithTTL(duration)
 		return txn.SetEntry(entry)
 	})
 }
 
+// GetBanInfo reads the ban of pubkey. Bans stored without a value only
+// report their expiry.
+func (s *BadgerStore) GetBanInfo(ctx context.Context, pubkey string) (*BanInfo, error) {
+	var info *BanInfo
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(banPrefix + pubkey))
+		if err != nil {
+			return err
+		}
+		info = &BanInfo{}
+		if err := item.Value(func(v []byte) error {
+			if len(v) == 0 || json.Unmarshal(v, info) != nil {
+				*info = BanInfo{}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		info.ExpiresAt = time.Unix(int64(item.ExpiresAt()), 0)
+		return nil
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
 // UnbanAuthor removes a pubkey from the ban list in the database.
 func (s *BadgerStore) UnbanAuthor(ctx context.Context, pubkey string) error {
-	slog.Info("Unbanning author", "pubkey", pubkey)
+	slog.InfoContext(ctx, "Unbanning author", "pubkey", pubkey)
 	key := []byte(banPrefix + pubkey)
 	return s.db.Update(func(txn *badger.Txn) error {
 		return txn.Delete(key)
 	})
 }
+
+// BanIP adds an address or network to the IP ban list with a specified TTL.
+// The value is the JSON encoded BanInfo.
+func (s *BadgerStore) BanIP(ctx context.Context, ip string, duration time.Duration, info BanInfo) error {
+	slog.InfoContext(ctx, "Banning IP", "ip", ip, "duration", duration.String(), "reason", info.Reason, "source", info.Source)
+	value, err := json.Marshal(newBanInfo(info, duration))
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(ipBanPrefix+ip), value).WithTTL(duration))
+	})
+}
+
+// IsIPBanned checks if an address or network is in the IP ban list.
+func (s *BadgerStore) IsIPBanned(ctx context.Context, ip string) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(ipBanPrefix + ip))
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnbanIP removes an address or network from the IP ban list.
+func (s *BadgerStore) UnbanIP(ctx context.Context, ip string) error {
+	slog.InfoContext(ctx, "Unbanning IP", "ip", ip)
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(ipBanPrefix + ip))
+	})
+}
+
+// IPBans lists the IP ban list.
+func (s *BadgerStore) IPBans(ctx context.Context) ([]IPBan, error) {
+	var bans []IPBan
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(ipBanPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item := it.Item()
+			ban := IPBan{IP: strings.TrimPrefix(string(item.Key()), ipBanPrefix)}
+			if err := item.Value(func(val []byte) error { return json.Unmarshal(val, &ban.BanInfo) }); err != nil {
+				ban.BanInfo = BanInfo{}
+			}
+			ban.ExpiresAt = time.Unix(int64(item.ExpiresAt()), 0)
+			bans = append(bans, ban)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortIPBans(bans), nil
+}
+
+// Block adds key to the blocklist with a specified TTL. The value is the
+// JSON encoded BanInfo.
+func (s *BadgerStore) Block(ctx context.Context, key string, duration time.Duration, info BanInfo) error {
+	slog.InfoContext(ctx, "Blocking", "key", key, "duration", duration.String(), "reason", info.Reason, "source", info.Source)
+	value, err := json.Marshal(newBanInfo(info, duration))
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(blockPrefix+key), value).WithTTL(duration))
+	})
+}
+
+// IsBlocked checks if key is in the blocklist.
+func (s *BadgerStore) IsBlocked(ctx context.Context, key string) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(blockPrefix + key))
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Unblock removes key from the blocklist.
+func (s *BadgerStore) Unblock(ctx context.Context, key string) error {
+	slog.InfoContext(ctx, "Unblocking", "key", key)
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(blockPrefix + key))
+	})
+}
+
+// Blocklist lists the blocklist.
+func (s *BadgerStore) Blocklist(ctx context.Context) ([]BlockedEntry, error) {
+	var entries []BlockedEntry
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(blockPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item := it.Item()
+			entry := BlockedEntry{Key: strings.TrimPrefix(string(item.Key()), blockPrefix)}
+			if err := item.Value(func(val []byte) error { return json.Unmarshal(val, &entry.BanInfo) }); err != nil {
+				entry.BanInfo = BanInfo{}
+			}
+			entry.ExpiresAt = time.Unix(int64(item.ExpiresAt()), 0)
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortBlocklist(entries), nil
+}
+
+// AddDelegatee records a delegatee of delegator, enforcing limit.
+func (s *BadgerStore) AddDelegatee(ctx context.Context, delegator, delegatee string, ttl time.Duration, limit int) (bool, error) {
+	prefix := []byte(delegateePrefix + delegator + ":")
+	key := append(prefix, delegatee...)
+	allowed := true
+	err := s.db.Update(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+		if err != nil && limit > 0 {
+			// A new delegatee: count the active ones first.
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			opts.Prefix = prefix
+			it := txn.NewIterator(opts)
+			active := 0
+			for it.Rewind(); it.Valid() && active < limit; it.Next() {
+				active++
+			}
+			it.Close()
+			if active >= limit {
+				allowed = false
+				return nil
+			}
+		}
+		return txn.SetEntry(badger.NewEntry(key, nil).WithTTL(ttl))
+	})
+	if err != nil {
+		return false, err
+	}
+	return allowed, nil
+}
+
+// AddStrike increments the strike count of pubkey, renewing its TTL.
+func (s *BadgerStore) AddStrike(ctx context.Context, pubkey string, window time.Duration) (int, error) {
+	key := []byte(strikePrefix + pubkey)
+	var count int
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		switch {
+		case errors.Is(err, badger.ErrKeyNotFound):
+		case err != nil:
+			return err
+		default:
+			err = item.Value(func(v []byte) error {
+				count, err = strconv.Atoi(string(v))
+				return err
+			})
+			if err != nil {
+				count = 0 // An unreadable count starts over.
+			}
+		}
+		count++
+		return txn.SetEntry(badger.NewEntry(key, []byte(strconv.Itoa(count))).WithTTL(window))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ClearStrikes deletes the strike count of pubkey.
+func (s *BadgerStore) ClearStrikes(ctx context.Context, pubkey string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(strikePrefix + pubkey))
+	})
+}
+
+func restrictKey(pubkey string, kind int) []byte {
+	return []byte(restrictPrefix + pubkey + ":" + strconv.Itoa(kind))
+}
+
+// RestrictKinds adds a restriction for every kind, replacing existing ones.
+func (s *BadgerStore) RestrictKinds(ctx context.Context, pubkey string, kinds []int, duration time.Duration) error {
+	slog.InfoContext(ctx, "Restricting author", "pubkey", pubkey, "kinds", kinds, "duration", duration.String())
+	return s.db.Update(func(txn *badger.Txn) error {
+		for _, kind := range kinds {
+			if err := txn.SetEntry(badger.NewEntry(restrictKey(pubkey, kind), nil).WithTTL(duration)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LiftRestrictions deletes restrictions of pubkey.
+func (s *BadgerStore) LiftRestrictions(ctx context.Context, pubkey string, kinds []int) error {
+	if len(kinds) == 0 {
+		current, err := s.Restrictions(ctx, pubkey)
+		if err != nil {
+			return err
+		}
+		for _, r := range current {
+			kinds = append(kinds, r.Kind)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil
+	}
+	slog.InfoContext(ctx, "Lifting author restrictions", "pubkey", pubkey, "kinds", kinds)
+	return s.db.Update(func(txn *badger.Txn) error {
+		for _, kind := range kinds {
+			if err := txn.Delete(restrictKey(pubkey, kind)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// IsKindRestricted checks if pubkey may not post kind.
+func (s *BadgerStore) IsKindRestricted(ctx context.Context, pubkey string, kind int) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(restrictKey(pubkey, kind))
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Restrictions lists the active restrictions of pubkey.
+func (s *BadgerStore) Restrictions(ctx context.Context, pubkey string) ([]Restriction, error) {
+	prefix := []byte(restrictPrefix + pubkey + ":")
+	var restrictions []Restriction
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			kind, err := strconv.Atoi(string(item.Key()[len(prefix):]))
+			if err != nil {
+				continue
+			}
+			restrictions = append(restrictions, Restriction{Kind: kind, Until: time.Unix(int64(item.ExpiresAt()), 0)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restrictions, nil
+}
+
+// AuthorRecord is the moderation state of one pubkey.
+type AuthorRecord struct {
+	PubKey       string
+	BannedUntil  time.Time // Zero if not banned.
+	Restrictions []Restriction
+}
+
+// Authors collects bans and restrictions from their key prefixes.
+func (s *BadgerStore) Authors(ctx context.Context) ([]AuthorRecord, error) {
+	records := make(map[string]*AuthorRecord)
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for _, prefix := range []string{banPrefix, restrictPrefix} {
+			for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				item := it.Item()
+				rest := strings.TrimPrefix(string(item.Key()), prefix)
+				if !validKey(prefix, rest) {
+					continue
+				}
+				until := time.Unix(int64(item.ExpiresAt()), 0)
+				if prefix == banPrefix {
+					recordFor(records, rest).BannedUntil = until
+					continue
+				}
+				pubkey, kind, _ := strings.Cut(rest, ":")
+				k, _ := strconv.Atoi(kind)
+				r := recordFor(records, pubkey)
+				r.Restrictions = append(r.Restrictions, Restriction{Kind: k, Until: until})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sortRecords(records), nil
+}
+
+// BanListener is notified after a pubkey has been banned successfully.
+type BanListener func(pubkey string)
+
+// listeningStore wraps a Store and notifies listeners about new bans.
+type listeningStore struct {
+	Store
+	listeners []BanListener
+}
+
+// WithBanListeners returns a Store that calls each listener after every
+// successful BanAuthor. All other calls go straight to the wrapped store.
+func WithBanListeners(s Store, listeners ...BanListener) Store {
+	if len(listeners) == 0 {
+		return s
+	}
+	return &listeningStore{Store: s, listeners: listeners}
+}
+
+func (s *listeningStore) BanAuthor(ctx context.Context, pubkey string, duration time.Duration, info BanInfo) error {
+	if err := s.Store.BanAuthor(ctx, pubkey, duration, info); err != nil {
+		return err
+	}
+	for _, l := range s.listeners {
+		l(pubkey)
+	}
+	return nil
+}
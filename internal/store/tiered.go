@@ -0,0 +1,276 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// mirror is an in-memory copy of the bans and restrictions in a Store.
+type mirror struct {
+	bans         map[string]time.Time
+	restrictions map[string]map[int]time.Time
+}
+
+func newMirror(records []AuthorRecord) *mirror {
+	m := &mirror{
+		bans:         make(map[string]time.Time),
+		restrictions: make(map[string]map[int]time.Time),
+	}
+	for _, r := range records {
+		if !r.BannedUntil.IsZero() {
+			m.bans[r.PubKey] = r.BannedUntil
+		}
+		for _, restriction := range r.Restrictions {
+			m.restrict(r.PubKey, []int{restriction.Kind}, restriction.Until)
+		}
+	}
+	return m
+}
+
+func (m *mirror) restrict(pubkey string, kinds []int, until time.Time) {
+	kindsUntil := m.restrictions[pubkey]
+	if kindsUntil == nil {
+		kindsUntil = make(map[int]time.Time, len(kinds))
+		m.restrictions[pubkey] = kindsUntil
+	}
+	for _, kind := range kinds {
+		kindsUntil[kind] = until
+	}
+}
+
+// lift removes restrictions of pubkey (all of them without kinds) and
+// returns them.
+func (m *mirror) lift(pubkey string, kinds []int, now time.Time) []archiveRecord {
+	if len(kinds) == 0 {
+		for kind := range m.restrictions[pubkey] {
+			kinds = append(kinds, kind)
+		}
+	}
+	var lifted []archiveRecord
+	for _, kind := range kinds {
+		if until, ok := m.restrictions[pubkey][kind]; ok {
+			lifted = append(lifted, archiveRecord{PubKey: pubkey, Kind: &kind, Until: until, Ended: now, Reason: "lifted"})
+			delete(m.restrictions[pubkey], kind)
+		}
+	}
+	if len(m.restrictions[pubkey]) == 0 {
+		delete(m.restrictions, pubkey)
+	}
+	return lifted
+}
+
+// unban removes the ban of pubkey and returns it.
+func (m *mirror) unban(pubkey string, now time.Time) []archiveRecord {
+	until, ok := m.bans[pubkey]
+	if !ok {
+		return nil
+	}
+	delete(m.bans, pubkey)
+	return []archiveRecord{{PubKey: pubkey, Until: until, Ended: now, Reason: "lifted"}}
+}
+
+// archiveRecord is one ban or restriction that left the hot tier.
+type archiveRecord struct {
+	PubKey string    `json:"pubkey"`
+	Kind   *int      `json:"kind,omitempty"` // Set for restrictions.
+	Until  time.Time `json:"until"`
+	Ended  time.Time `json:"ended"`
+	Reason string    `json:"reason"` // "expired" or "lifted".
+}
+
+// dropped lists the entries of m missing from next, as of now.
+func (m *mirror) dropped(next *mirror, now time.Time) []archiveRecord {
+	reason := func(until time.Time) string {
+		if until.After(now) {
+			return "lifted"
+		}
+		return "expired"
+	}
+	var records []archiveRecord
+	for pubkey, until := range m.bans {
+		if _, ok := next.bans[pubkey]; !ok {
+			records = append(records, archiveRecord{PubKey: pubkey, Until: until, Ended: now, Reason: reason(until)})
+		}
+	}
+	for pubkey, kinds := range m.restrictions {
+		for kind, until := range kinds {
+			if _, ok := next.restrictions[pubkey][kind]; !ok {
+				records = append(records, archiveRecord{PubKey: pubkey, Kind: &kind, Until: until, Ended: now, Reason: reason(until)})
+			}
+		}
+	}
+	return records
+}
+
+// TieredStore serves ban and restriction lookups from an in-memory mirror of
+// the wrapped store (the hot tier), writing through to it (the warm tier).
+// The mirror is rebuilt at startup and every resync interval, picking up
+// changes by other processes sharing the database; if a rebuild fails, the
+// previous mirror keeps being served. Entries leaving the mirror can be
+// appended to an archive file (the cold tier). Other calls go straight to the
+// wrapped store.
+type TieredStore struct {
+	Store
+	cfg *config.TieringConfig
+
+	mu      sync.RWMutex
+	hot     *mirror // nil until the first rebuild succeeds.
+	syncing bool
+	// pending are writes made during a rebuild, replayed onto its result.
+	pending []func(*mirror) []archiveRecord
+}
+
+func NewTieredStore(s Store, cfg *config.TieringConfig) *TieredStore {
+	return &TieredStore{Store: s, cfg: cfg}
+}
+
+// Start builds the mirror. Lookups fall through to the wrapped store until a
+// build succeeds.
+func (t *TieredStore) Start(ctx context.Context) {
+	if err := t.rebuild(ctx); err != nil {
+		slog.Error("Failed to build the in-memory store mirror, serving from the database", "error", err)
+	}
+}
+
+// Resync rebuilds the mirror from the database, picking up changes made by
+// other processes sharing it; it is scheduled every resync interval. A failed
+// resync keeps the previous mirror.
+func (t *TieredStore) Resync(ctx context.Context) error {
+	if err := t.rebuild(ctx); err != nil {
+		return fmt.Errorf("failed to resync the in-memory store mirror, keeping the previous one: %w", err)
+	}
+	return nil
+}
+
+func (t *TieredStore) rebuild(ctx context.Context) error {
+	t.mu.Lock()
+	t.syncing = true
+	t.mu.Unlock()
+
+	records, err := t.Store.Authors(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pending := t.pending
+	t.syncing, t.pending = false, nil
+	if err != nil {
+		return err
+	}
+
+	next := newMirror(records)
+	for _, apply := range pending {
+		apply(next)
+	}
+	if t.hot != nil {
+		t.archive(t.hot.dropped(next, time.Now()))
+	}
+	t.hot = next
+	return nil
+}
+
+// update applies a successful write to the mirror, archiving the entries it
+// removes.
+func (t *TieredStore) update(apply func(*mirror) []archiveRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hot != nil {
+		t.archive(apply(t.hot))
+	}
+	if t.syncing {
+		t.pending = append(t.pending, apply)
+	}
+}
+
+// archive appends records to the archive file. The caller must hold t.mu.
+func (t *TieredStore) archive(records []archiveRecord) {
+	if t.cfg.ArchivePath == "" || len(records) == 0 {
+		return
+	}
+	if err := appendJSONLines(t.cfg.ArchivePath, records); err != nil {
+		slog.Error("Failed to archive moderation records", "path", t.cfg.ArchivePath, "error", err)
+	}
+}
+
+func appendJSONLines(path string, records []archiveRecord) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write archive record: %w", err)
+		}
+	}
+	return f.Close()
+}
+
+func (t *TieredStore) IsAuthorBanned(ctx context.Context, pubkey string) (bool, error) {
+	t.mu.RLock()
+	if t.hot == nil {
+		t.mu.RUnlock()
+		return t.Store.IsAuthorBanned(ctx, pubkey)
+	}
+	until, ok := t.hot.bans[pubkey]
+	t.mu.RUnlock()
+	return ok && until.After(time.Now()), nil
+}
+
+func (t *TieredStore) IsKindRestricted(ctx context.Context, pubkey string, kind int) (bool, error) {
+	t.mu.RLock()
+	if t.hot == nil {
+		t.mu.RUnlock()
+		return t.Store.IsKindRestricted(ctx, pubkey, kind)
+	}
+	until, ok := t.hot.restrictions[pubkey][kind]
+	t.mu.RUnlock()
+	return ok && until.After(time.Now()), nil
+}
+
+func (t *TieredStore) BanAuthor(ctx context.Context, pubkey string, duration time.Duration, info BanInfo) error {
+	if err := t.Store.BanAuthor(ctx, pubkey, duration, info); err != nil {
+		return err
+	}
+	until := time.Now().Add(duration)
+	t.update(func(m *mirror) []archiveRecord {
+		m.bans[pubkey] = until
+		return nil
+	})
+	return nil
+}
+
+func (t *TieredStore) UnbanAuthor(ctx context.Context, pubkey string) error {
+	if err := t.Store.UnbanAuthor(ctx, pubkey); err != nil {
+		return err
+	}
+	t.update(func(m *mirror) []archiveRecord { return m.unban(pubkey, time.Now()) })
+	return nil
+}
+
+func (t *TieredStore) RestrictKinds(ctx context.Context, pubkey string, kinds []int, duration time.Duration) error {
+	if err := t.Store.RestrictKinds(ctx, pubkey, kinds, duration); err != nil {
+		return err
+	}
+	until := time.Now().Add(duration)
+	t.update(func(m *mirror) []archiveRecord {
+		m.restrict(pubkey, kinds, until)
+		return nil
+	})
+	return nil
+}
+
+func (t *TieredStore) LiftRestrictions(ctx context.Context, pubkey string, kinds []int) error {
+	if err := t.Store.LiftRestrictions(ctx, pubkey, kinds); err != nil {
+		return err
+	}
+	t.update(func(m *mirror) []archiveRecord { return m.lift(pubkey, kinds, time.Now()) })
+	return nil
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// unavailable wraps err with ErrStoreUnavailable.
+func unavailable(err error) error {
+	if err == nil || errors.Is(err, ErrStoreUnavailable) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrStoreUnavailable, err)
+}
+
+// classifyingStore wraps every error of a backend with ErrStoreUnavailable:
+// the backends fail only when the database cannot be reached or used.
+type classifyingStore struct {
+	Store
+}
+
+func (s classifyingStore) IsAuthorBanned(ctx context.Context, pubkey string) (bool, error) {
+	banned, err := s.Store.IsAuthorBanned(ctx, pubkey)
+	return banned, unavailable(err)
+}
+
+func (s classifyingStore) BanAuthor(ctx context.Context, pubkey string, duration time.Duration, info BanInfo) error {
+	return unavailable(s.Store.BanAuthor(ctx, pubkey, duration, info))
+}
+
+func (s classifyingStore) GetBanInfo(ctx context.Context, pubkey string) (*BanInfo, error) {
+	info, err := s.Store.GetBanInfo(ctx, pubkey)
+	return info, unavailable(err)
+}
+
+func (s classifyingStore) UnbanAuthor(ctx context.Context, pubkey string) error {
+	return unavailable(s.Store.UnbanAuthor(ctx, pubkey))
+}
+
+func (s classifyingStore) BanIP(ctx context.Context, ip string, duration time.Duration, info BanInfo) error {
+	return unavailable(s.Store.BanIP(ctx, ip, duration, info))
+}
+
+func (s classifyingStore) IsIPBanned(ctx context.Context, ip string) (bool, error) {
+	banned, err := s.Store.IsIPBanned(ctx, ip)
+	return banned, unavailable(err)
+}
+
+func (s classifyingStore) UnbanIP(ctx context.Context, ip string) error {
+	return unavailable(s.Store.UnbanIP(ctx, ip))
+}
+
+func (s classifyingStore) IPBans(ctx context.Context) ([]IPBan, error) {
+	bans, err := s.Store.IPBans(ctx)
+	return bans, unavailable(err)
+}
+
+func (s classifyingStore) Block(ctx context.Context, key string, duration time.Duration, info BanInfo) error {
+	return unavailable(s.Store.Block(ctx, key, duration, info))
+}
+
+func (s classifyingStore) IsBlocked(ctx context.Context, key string) (bool, error) {
+	blocked, err := s.Store.IsBlocked(ctx, key)
+	return blocked, unavailable(err)
+}
+
+func (s classifyingStore) Unblock(ctx context.Context, key string) error {
+	return unavailable(s.Store.Unblock(ctx, key))
+}
+
+func (s classifyingStore) Blocklist(ctx context.Context) ([]BlockedEntry, error) {
+	entries, err := s.Store.Blocklist(ctx)
+	return entries, unavailable(err)
+}
+
+func (s classifyingStore) AddDelegatee(ctx context.Context, delegator, delegatee string, ttl time.Duration, limit int) (bool, error) {
+	added, err := s.Store.AddDelegatee(ctx, delegator, delegatee, ttl, limit)
+	return added, unavailable(err)
+}
+
+func (s classifyingStore) AddStrike(ctx context.Context, pubkey string, window time.Duration) (int, error) {
+	count, err := s.Store.AddStrike(ctx, pubkey, window)
+	return count, unavailable(err)
+}
+
+func (s classifyingStore) ClearStrikes(ctx context.Context, pubkey string) error {
+	return unavailable(s.Store.ClearStrikes(ctx, pubkey))
+}
+
+func (s classifyingStore) RestrictKinds(ctx context.Context, pubkey string, kinds []int, duration time.Duration) error {
+	return unavailable(s.Store.RestrictKinds(ctx, pubkey, kinds, duration))
+}
+
+func (s classifyingStore) LiftRestrictions(ctx context.Context, pubkey string, kinds []int) error {
+	return unavailable(s.Store.LiftRestrictions(ctx, pubkey, kinds))
+}
+
+func (s classifyingStore) IsKindRestricted(ctx context.Context, pubkey string, kind int) (bool, error) {
+	restricted, err := s.Store.IsKindRestricted(ctx, pubkey, kind)
+	return restricted, unavailable(err)
+}
+
+func (s classifyingStore) Restrictions(ctx context.Context, pubkey string) ([]Restriction, error) {
+	restrictions, err := s.Store.Restrictions(ctx, pubkey)
+	return restrictions, unavailable(err)
+}
+
+func (s classifyingStore) Authors(ctx context.Context) ([]AuthorRecord, error) {
+	records, err := s.Store.Authors(ctx)
+	return records, unavailable(err)
+}
+
+func (s classifyingStore) JournalAction(ctx context.Context, a Action) (Action, error) {
+	a, err := s.Store.JournalAction(ctx, a)
+	return a, unavailable(err)
+}
+
+func (s classifyingStore) CompleteAction(ctx context.Context, id string) error {
+	return unavailable(s.Store.CompleteAction(ctx, id))
+}
+
+func (s classifyingStore) PendingActions(ctx context.Context) ([]Action, error) {
+	actions, err := s.Store.PendingActions(ctx)
+	return actions, unavailable(err)
+}
+
+// collectingClassifyingStore is a classifyingStore over a backend that
+// collects garbage.
+type collectingClassifyingStore struct {
+	classifyingStore
+	gc GarbageCollector
+}
+
+func (s collectingClassifyingStore) CollectGarbage(ctx context.Context) error {
+	return unavailable(s.gc.CollectGarbage(ctx))
+}
@@ -1,16 +1,23 @@
 package strfry
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os/exec"
 	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/store"
 )
 
 type ClientInterface interface {
 	DeleteEventsByAuthor(author string) error
+	DeleteEvent(id string) error
 }
 
 type Client struct {
@@ -29,26 +36,72 @@ func NewClient(executablePath, configPath string) *Client {
 
 // DeleteEventsByAuthor calls `strfry delete` for a given author.
 func (c *Client) DeleteEventsByAuthor(author string) error {
+	if err := c.DeleteByFilter(nostr.Filter{Authors: []string{author}}); err != nil {
+		return err
+	}
+	slog.Info("Successfully deleted events for author", "author", author)
+	return nil
+}
+
+// DeleteEvent calls `strfry delete` for a single event.
+func (c *Client) DeleteEvent(id string) error {
+	if err := c.DeleteByFilter(nostr.Filter{IDs: []string{id}}); err != nil {
+		return err
+	}
+	slog.Info("Successfully deleted event", "event_id", id)
+	return nil
+}
+
+// DeleteByFilter calls `strfry delete` for the stored events matching filter.
+func (c *Client) DeleteByFilter(filter nostr.Filter) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	filter := fmt.Sprintf(`{"authors":["%s"]}`, author)
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return err
+	}
 	args := []string{
 		"--config=" + c.configPath,
 		"delete",
-		"--filter=" + filter,
+		"--filter=" + string(filterJSON),
 	}
 
 	cmd := exec.CommandContext(ctx, c.executablePath, args...)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	slog.Info("Executing strfry delete", "author", author, "command", cmd.String())
+	slog.Info("Executing strfry delete", "filter", string(filterJSON), "command", cmd.String())
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("strfry delete command failed: %w, stderr: %s", err, stderr.String())
+		return fmt.Errorf("%w: strfry delete command failed: %w, stderr: %s", store.ErrStoreUnavailable, err, stderr.String())
 	}
-
-	slog.Info("Successfully deleted events for author", "author", author)
 	return nil
 }
+
+// ScanEvents calls `strfry scan` and returns the stored events matching filter.
+func (c *Client) ScanEvents(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, c.executablePath, "--config="+c.configPath, "scan", string(filterJSON))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: strfry scan command failed: %w, stderr: %s", store.ErrStoreUnavailable, err, stderr.String())
+	}
+
+	var events []*nostr.Event
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event nostr.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, &event)
+	}
+	return events, scanner.Err()
+}
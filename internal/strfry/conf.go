@@ -0,0 +1,77 @@
+package strfry
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// ParseConfigFile reads a strfry.conf file and returns its settings flattened
+// into dotted keys, e.g. "events.maxEventSize". Quoted values are unquoted;
+// everything else is returned verbatim.
+func ParseConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	var sections []string
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := stripComment(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case line == "}":
+			if len(sections) == 0 {
+				return nil, fmt.Errorf("%w: %s:%d: unbalanced '}'", config.ErrConfigInvalid, path, lineNo)
+			}
+			sections = sections[:len(sections)-1]
+
+		case strings.HasSuffix(line, "{") && !strings.Contains(line, "="):
+			sections = append(sections, strings.TrimSpace(strings.TrimSuffix(line, "{")))
+
+		case strings.Contains(line, "="):
+			key, value, _ := strings.Cut(line, "=")
+			key = strings.TrimSpace(key)
+			value = strings.TrimSpace(value)
+			if strings.HasSuffix(value, "{") {
+				// "name = {" opens a section as well.
+				sections = append(sections, key)
+				continue
+			}
+			value = strings.Trim(value, `"`)
+			values[strings.Join(append(sections, key), ".")] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// stripComment removes a trailing '#' comment that is not inside quotes.
+func stripComment(line string) string {
+	inQuotes := false
+	for i, r := range line {
+		switch r {
+		case '"':
+			inQuotes = !inQuotes
+		case '#':
+			if !inQuotes {
+				return strings.TrimSpace(line[:i])
+			}
+		}
+	}
+	return strings.TrimSpace(line)
+}
@@ -0,0 +1,169 @@
+package strfry
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+)
+
+// Limits are the strfry settings that overlap with plugin filters.
+// Zero means "not set in strfry.conf".
+type Limits struct {
+	MaxEventSize                   int
+	MaxNumTags                     int
+	RejectEventsNewerThan          time.Duration
+	RejectEventsOlderThan          time.Duration
+	RejectEphemeralEventsOlderThan time.Duration
+}
+
+// ReadLimits extracts Limits from a strfry.conf file.
+func ReadLimits(path string) (*Limits, error) {
+	values, err := ParseConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var l Limits
+	intValue := func(key string) (int, error) {
+		v, ok := values[key]
+		if !ok {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s: invalid integer %q", config.ErrConfigInvalid, key, v)
+		}
+		return n, nil
+	}
+	seconds := func(key string) (time.Duration, error) {
+		n, err := intValue(key)
+		return time.Duration(n) * time.Second, err
+	}
+
+	if l.MaxEventSize, err = intValue("events.maxEventSize"); err != nil {
+		return nil, err
+	}
+	if l.MaxNumTags, err = intValue("events.maxNumTags"); err != nil {
+		return nil, err
+	}
+	if l.RejectEventsNewerThan, err = seconds("events.rejectEventsNewerThanSeconds"); err != nil {
+		return nil, err
+	}
+	if l.RejectEventsOlderThan, err = seconds("events.rejectEventsOlderThanSeconds"); err != nil {
+		return nil, err
+	}
+	if l.RejectEphemeralEventsOlderThan, err = seconds("events.rejectEphemeralEventsOlderThanSeconds"); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// AlignWithStrfry compares plugin filter settings with strfry's own limits.
+// Plugin limits looser than strfry's can never trigger and only confuse
+// operators, so they are reported, and clamped in "align" mode.
+func AlignWithStrfry(cfg *config.Config) {
+	mode := cfg.Strfry.CheckConfig
+	if mode == config.StrfryCheckOff {
+		return
+	}
+
+	limits, err := ReadLimits(cfg.Strfry.ConfigPath)
+	if err != nil {
+		slog.Warn("Could not read strfry config, skipping limit checks", "path", cfg.Strfry.ConfigPath, "error", err)
+		return
+	}
+
+	align := mode == config.StrfryCheckAlign
+	report := func(setting string, pluginValue, strfryValue any, strfryKey string) {
+		slog.Warn("Plugin setting is looser than strfry's own limit and will never trigger",
+			"setting", setting,
+			"plugin_value", pluginValue,
+			"strfry_setting", strfryKey,
+			"strfry_value", strfryValue,
+			"auto_aligned", align,
+		)
+	}
+
+	f := &cfg.Filters
+	if max := limits.MaxEventSize; max > 0 {
+		if f.Size.DefaultMaxSize > max {
+			report("filters.size.default_max_size_bytes", f.Size.DefaultMaxSize, max, "events.maxEventSize")
+			if align {
+				f.Size.DefaultMaxSize = max
+			}
+		}
+		for i := range f.Size.Rules {
+			rule := &f.Size.Rules[i]
+			if rule.MaxSize > max {
+				report(fmt.Sprintf("filters.size.rule[%d]", i), rule.MaxSize, max, "events.maxEventSize")
+				if align {
+					rule.MaxSize = max
+				}
+			}
+		}
+	}
+
+	if max := limits.MaxNumTags; max > 0 {
+		for i := range f.Tags.Rules {
+			rule := &f.Tags.Rules[i]
+			if rule.MaxTags != nil && *rule.MaxTags > max {
+				report(fmt.Sprintf("filters.tags.rule[%d].max_tags", i), *rule.MaxTags, max, "events.maxNumTags")
+				if align {
+					aligned := max
+					rule.MaxTags = &aligned
+				}
+			}
+		}
+	}
+
+	if max := limits.RejectEventsOlderThan; max > 0 {
+		if f.Freshness.DefaultMaxPast > max {
+			report("filters.freshness.default_max_past", f.Freshness.DefaultMaxPast, max, "events.rejectEventsOlderThanSeconds")
+			if align {
+				f.Freshness.DefaultMaxPast = max
+			}
+		}
+	}
+	if max := limits.RejectEventsNewerThan; max > 0 {
+		if f.Freshness.DefaultMaxFuture > max {
+			report("filters.freshness.default_max_future", f.Freshness.DefaultMaxFuture, max, "events.rejectEventsNewerThanSeconds")
+			if align {
+				f.Freshness.DefaultMaxFuture = max
+			}
+		}
+	}
+	for i := range f.Freshness.Rules {
+		rule := &f.Freshness.Rules[i]
+		maxPast := limits.RejectEventsOlderThan
+		if allEphemeral(rule.Kinds) && limits.RejectEphemeralEventsOlderThan > 0 {
+			maxPast = limits.RejectEphemeralEventsOlderThan
+		}
+		if maxPast > 0 && rule.MaxPast > maxPast {
+			report(fmt.Sprintf("filters.freshness.rule[%d].max_past", i), rule.MaxPast, maxPast, "events.rejectEventsOlderThanSeconds")
+			if align {
+				rule.MaxPast = maxPast
+			}
+		}
+		if max := limits.RejectEventsNewerThan; max > 0 && rule.MaxFuture > max {
+			report(fmt.Sprintf("filters.freshness.rule[%d].max_future", i), rule.MaxFuture, max, "events.rejectEventsNewerThanSeconds")
+			if align {
+				rule.MaxFuture = max
+			}
+		}
+	}
+}
+
+func allEphemeral(kinds []int) bool {
+	if len(kinds) == 0 {
+		return false
+	}
+	for _, k := range kinds {
+		if k < 20000 || k >= 30000 {
+			return false
+		}
+	}
+	return true
+}
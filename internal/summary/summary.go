@@ -0,0 +1,435 @@
+// Package summary compiles a daily report of the relay's activity for its
+// operator: top offenders, bans issued and expired, busiest hours and filter
+// hits not seen on earlier days. Reports are written to a rotating set of
+// files and may be sent to the moderator as direct messages.
+package summary
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/nbd-wtf/go-nostr/nip19"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/notify"
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+)
+
+const (
+	// KeyEnv names the environment variable holding the key that signs
+	// summary direct messages.
+	KeyEnv = "ADRESU_SUMMARY_KEY"
+
+	// maxOffenders bounds the pubkeys tracked within a day; later offenders
+	// are not counted once it is reached.
+	maxOffenders = 100000
+	// maxKnownHits bounds the filter hits remembered from earlier days.
+	maxKnownHits = 10000
+	busiestHours = 3
+	filePrefix   = "summary-"
+	fileSuffix   = ".txt"
+)
+
+// Offender is a pubkey whose events were rejected.
+type Offender struct {
+	PubKey     string `json:"pubkey"`
+	Rejections int    `json:"rejections"`
+	// Filter rejected most of its events.
+	Filter string `json:"filter"`
+}
+
+// Hit is a filter's rejections for one reason code.
+type Hit struct {
+	Filter string `json:"filter"`
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// HourCount is the events judged within one UTC hour of the day.
+type HourCount struct {
+	Hour   int `json:"hour"`
+	Events int `json:"events"`
+}
+
+// Report is one daily summary.
+type Report struct {
+	From      time.Time  `json:"from"`
+	Generated time.Time  `json:"generated"`
+	Accepted  int        `json:"accepted"`
+	Rejected  int        `json:"rejected"`
+	Offenders []Offender `json:"top_offenders"`
+	// BansIssued counts every ban, including repeated ones; the pubkeys
+	// listed are the latest, up to the configured top.
+	BansIssued  int         `json:"bans_issued"`
+	Banned      []string    `json:"banned"`
+	BansExpired []string    `json:"bans_expired"`
+	BansLifted  []string    `json:"bans_lifted"`
+	Busiest     []HourCount `json:"busiest_hours"`
+	// NewHits are the filter and reason code pairs that had no rejection on
+	// earlier days since startup.
+	NewHits []Hit `json:"new_filter_hits"`
+}
+
+// BanLister lists every pubkey with a ban or restriction.
+type BanLister interface {
+	Authors(ctx context.Context) ([]store.AuthorRecord, error)
+}
+
+type hitKey struct {
+	filter, reason string
+}
+
+type offender struct {
+	rejections int
+	filters    map[string]int
+}
+
+// day holds the counts since the last summary.
+type day struct {
+	from      time.Time
+	accepted  int
+	rejected  int
+	hours     [24]int
+	offenders map[string]*offender
+	hits      map[hitKey]int
+	bans      int
+	banned    []string
+	// bannedUntil is the ban of each pubkey banned when the day began, to
+	// tell expired bans from lifted ones.
+	bannedUntil map[string]time.Time
+}
+
+// Summary counts pipeline decisions and bans, and publishes a report once a
+// day.
+type Summary struct {
+	cfg  *config.SummaryConfig
+	bans BanLister
+	dm   *notify.DM // Nil unless direct messages are configured.
+
+	mu    sync.Mutex
+	day   day
+	known *lru.LRU[hitKey, struct{}]
+}
+
+// New creates a summary. Direct messages need moderator and the key in
+// $ADRESU_SUMMARY_KEY.
+func New(cfg *config.SummaryConfig, bans BanLister, moderator string) (*Summary, error) {
+	s := &Summary{
+		cfg:   cfg,
+		bans:  bans,
+		known: lru.NewLRU[hitKey, struct{}](maxKnownHits, nil, 0),
+	}
+	if len(cfg.DMRelays) > 0 {
+		dm, err := notify.NewDM(KeyEnv, moderator, cfg.DMRelays)
+		if err != nil {
+			return nil, err
+		}
+		s.dm = dm
+	}
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	s.day = newDay(time.Now(), nil)
+	return s, nil
+}
+
+func newDay(from time.Time, bannedUntil map[string]time.Time) day {
+	return day{
+		from:        from,
+		offenders:   make(map[string]*offender),
+		hits:        make(map[hitKey]int),
+		bannedUntil: bannedUntil,
+	}
+}
+
+// ObserveDecision implements policy.DecisionObserver.
+func (s *Summary) ObserveDecision(d policy.Decision) {
+	if d.Lookback {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.day.hours[d.Time.UTC().Hour()]++
+	if d.Action == "accept" {
+		s.day.accepted++
+		return
+	}
+	s.day.rejected++
+	code, _, _ := strings.Cut(d.Reason, ":")
+	s.day.hits[hitKey{filter: d.Filter, reason: code}]++
+
+	o, ok := s.day.offenders[d.PubKey]
+	if !ok {
+		if len(s.day.offenders) >= maxOffenders {
+			return
+		}
+		o = &offender{filters: make(map[string]int)}
+		s.day.offenders[d.PubKey] = o
+	}
+	o.rejections++
+	o.filters[d.Filter]++
+}
+
+// OnBan is a store.BanListener counting issued bans.
+func (s *Summary) OnBan(pubkey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.day.bans++
+	s.day.banned = append(s.day.banned, pubkey)
+	if len(s.day.banned) > s.cfg.Top {
+		s.day.banned = slices.Clone(s.day.banned[len(s.day.banned)-s.cfg.Top:])
+	}
+}
+
+// Start records the bans in force, so that the first summary can tell which
+// expired.
+func (s *Summary) Start(ctx context.Context) {
+	if bannedUntil, err := s.bannedUntil(ctx); err != nil {
+		slog.Warn("Failed to list bans for the daily summary", "error", err)
+	} else {
+		s.mu.Lock()
+		s.day.bannedUntil = bannedUntil
+		s.mu.Unlock()
+	}
+}
+
+// Run compiles and publishes the summary of the day and starts the next
+// one; it is scheduled daily at the configured time.
+func (s *Summary) Run(ctx context.Context) error {
+	report, err := s.rotate(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to compile daily summary: %w", err)
+	}
+	s.publish(ctx, report)
+	return nil
+}
+
+// Report compiles the summary of the day so far.
+func (s *Summary) Report(ctx context.Context) (Report, error) {
+	bannedUntil, err := s.bannedUntil(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compile(bannedUntil, time.Now()), nil
+}
+
+// rotate compiles the summary of the day and starts the next one.
+func (s *Summary) rotate(ctx context.Context) (Report, error) {
+	bannedUntil, err := s.bannedUntil(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := s.compile(bannedUntil, now)
+	for k := range s.day.hits {
+		s.known.Add(k, struct{}{})
+	}
+	s.day = newDay(now, bannedUntil)
+	return report, nil
+}
+
+// bannedUntil returns the end of every ban in force.
+func (s *Summary) bannedUntil(ctx context.Context) (map[string]time.Time, error) {
+	records, err := s.bans.Authors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	bans := make(map[string]time.Time)
+	for _, rec := range records {
+		if rec.BannedUntil.After(now) {
+			bans[rec.PubKey] = rec.BannedUntil
+		}
+	}
+	return bans, nil
+}
+
+// compile builds the report of the day given the bans now in force. The
+// caller must hold mu.
+func (s *Summary) compile(bannedUntil map[string]time.Time, now time.Time) Report {
+	d := &s.day
+	report := Report{
+		From:        d.from,
+		Generated:   now,
+		Accepted:    d.accepted,
+		Rejected:    d.rejected,
+		Offenders:   []Offender{},
+		BansIssued:  d.bans,
+		Banned:      slices.Clone(d.banned),
+		BansExpired: []string{},
+		BansLifted:  []string{},
+		Busiest:     []HourCount{},
+		NewHits:     []Hit{},
+	}
+	if report.Banned == nil {
+		report.Banned = []string{}
+	}
+
+	for pubkey, o := range d.offenders {
+		top := ""
+		for filter, n := range o.filters {
+			if top == "" || n > o.filters[top] || (n == o.filters[top] && filter < top) {
+				top = filter
+			}
+		}
+		report.Offenders = append(report.Offenders, Offender{PubKey: pubkey, Rejections: o.rejections, Filter: top})
+	}
+	slices.SortFunc(report.Offenders, func(a, b Offender) int {
+		return cmp.Or(cmp.Compare(b.Rejections, a.Rejections), strings.Compare(a.PubKey, b.PubKey))
+	})
+	report.Offenders = report.Offenders[:min(len(report.Offenders), s.cfg.Top)]
+
+	for _, pubkey := range slices.Sorted(maps.Keys(d.bannedUntil)) {
+		if _, ok := bannedUntil[pubkey]; ok {
+			continue
+		}
+		if d.bannedUntil[pubkey].After(now) {
+			report.BansLifted = append(report.BansLifted, pubkey)
+		} else {
+			report.BansExpired = append(report.BansExpired, pubkey)
+		}
+	}
+
+	for hour, n := range d.hours {
+		if n > 0 {
+			report.Busiest = append(report.Busiest, HourCount{Hour: hour, Events: n})
+		}
+	}
+	slices.SortFunc(report.Busiest, func(a, b HourCount) int {
+		return cmp.Or(cmp.Compare(b.Events, a.Events), cmp.Compare(a.Hour, b.Hour))
+	})
+	report.Busiest = report.Busiest[:min(len(report.Busiest), busiestHours)]
+
+	for k, n := range d.hits {
+		if !s.known.Contains(k) {
+			report.NewHits = append(report.NewHits, Hit{Filter: k.filter, Reason: k.reason, Count: n})
+		}
+	}
+	slices.SortFunc(report.NewHits, func(a, b Hit) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Filter, b.Filter), strings.Compare(a.Reason, b.Reason))
+	})
+	return report
+}
+
+// publish logs the report and delivers it to the configured directory and
+// moderator.
+func (s *Summary) publish(ctx context.Context, report Report) {
+	slog.Info("Daily summary", "accepted", report.Accepted, "rejected", report.Rejected,
+		"bans_issued", report.BansIssued, "bans_expired", len(report.BansExpired), "new_filter_hits", len(report.NewHits))
+	text := report.Text()
+	if s.cfg.Dir != "" {
+		path := filepath.Join(s.cfg.Dir, filePrefix+report.Generated.UTC().Format(time.DateOnly)+fileSuffix)
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			slog.Error("Failed to write daily summary", "path", path, "error", err)
+		} else {
+			s.prune()
+		}
+	}
+	if s.dm != nil {
+		if err := s.dm.Send(ctx, text); err != nil {
+			slog.Error("Failed to send daily summary to the moderator", "error", err)
+		}
+	}
+}
+
+// prune removes all but the latest cfg.Keep summary files. Their names sort
+// by date.
+func (s *Summary) prune() {
+	files, err := filepath.Glob(filepath.Join(s.cfg.Dir, filePrefix+"*"+fileSuffix))
+	if err != nil || len(files) <= s.cfg.Keep {
+		return
+	}
+	slices.Sort(files)
+	for _, path := range files[:len(files)-s.cfg.Keep] {
+		if err := os.Remove(path); err != nil {
+			slog.Warn("Failed to remove old daily summary", "path", path, "error", err)
+		}
+	}
+}
+
+// Text renders the report for humans.
+func (r Report) Text() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Daily summary, %s to %s\n", r.From.UTC().Format(time.RFC3339), r.Generated.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&sb, "\nEvents: %d accepted, %d rejected\n", r.Accepted, r.Rejected)
+
+	fmt.Fprintf(&sb, "\nTop offenders (%d):\n", len(r.Offenders))
+	if len(r.Offenders) == 0 {
+		sb.WriteString("  none\n")
+	}
+	for _, o := range r.Offenders {
+		fmt.Fprintf(&sb, "  %s  %d rejected, mostly by %s\n", npub(o.PubKey), o.Rejections, o.Filter)
+	}
+
+	fmt.Fprintf(&sb, "\nBans: %d issued, %d expired, %d lifted\n", r.BansIssued, len(r.BansExpired), len(r.BansLifted))
+	writePubKeys(&sb, "issued", r.Banned)
+	writePubKeys(&sb, "expired", r.BansExpired)
+	writePubKeys(&sb, "lifted", r.BansLifted)
+
+	sb.WriteString("\nBusiest hours (UTC):\n")
+	if len(r.Busiest) == 0 {
+		sb.WriteString("  none\n")
+	}
+	for _, h := range r.Busiest {
+		fmt.Fprintf(&sb, "  %02d:00  %d events\n", h.Hour, h.Events)
+	}
+
+	fmt.Fprintf(&sb, "\nNew filter hits (%d):\n", len(r.NewHits))
+	if len(r.NewHits) == 0 {
+		sb.WriteString("  none\n")
+	}
+	for _, h := range r.NewHits {
+		fmt.Fprintf(&sb, "  %s %s  %d\n", h.Filter, h.Reason, h.Count)
+	}
+	return sb.String()
+}
+
+func writePubKeys(sb *strings.Builder, label string, pubkeys []string) {
+	for _, pk := range pubkeys {
+		fmt.Fprintf(sb, "  %s  %s\n", label, npub(pk))
+	}
+}
+
+func npub(pubkey string) string {
+	if s, err := nip19.EncodePublicKey(pubkey); err == nil {
+		return s
+	}
+	return pubkey
+}
+
+// ServeHTTP returns the summary of the day so far, as text or, with
+// ?format=json, as JSON.
+func (s *Summary) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	report, err := s.Report(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if req.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, report.Text())
+}
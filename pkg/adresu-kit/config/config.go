@@ -42,21 +42,60 @@ func (m *RateLimiterBy) UnmarshalText(text []byte) error {
 	}
 }
 
+// FilterAction is what content-matching filters do with a matching event.
+type FilterAction string
+
+const (
+	ActionReject FilterAction = "reject"
+	ActionStrike FilterAction = "strike" // Accept, but count a strike against the author.
+	ActionAllow  FilterAction = "allow"
+	// ActionShadow accepts the event, so its author is not told, but has the
+	// host delete it shortly after.
+	ActionShadow FilterAction = "shadow"
+)
+
+func (a *FilterAction) UnmarshalText(text []byte) error {
+	v := string(text)
+	switch FilterAction(v) {
+	case ActionReject, ActionStrike, ActionAllow, ActionShadow, "":
+		*a = FilterAction(v)
+		return nil
+	default:
+		return fmt.Errorf("invalid action: %q (must be reject, strike, allow, shadow)", v)
+	}
+}
+
 type RateLimitRule struct {
 	Description string  `toml:"description"`
 	Kinds       []int   `toml:"kinds"`
 	Rate        float64 `toml:"rate"`
 	Burst       int     `toml:"burst"`
+	// SizeWeighted charges one token per started KiB of the serialized event
+	// instead of one per event, so rate and burst are in KiB.
+	SizeWeighted bool `toml:"size_weighted"`
+}
+
+// ThreadReplyConfig relaxes rate limits for replies inside an author's own thread.
+type ThreadReplyConfig struct {
+	Enabled         bool          `toml:"enabled"`
+	RateMultiplier  float64       `toml:"rate_multiplier"`
+	BurstMultiplier float64       `toml:"burst_multiplier"`
+	CacheSize       int           `toml:"cache_size"`
+	ActiveWindow    time.Duration `toml:"active_window"`
 }
 
 type RateLimiterConfig struct {
-	Enabled      bool            `toml:"enabled"`
-	By           RateLimiterBy   `toml:"by"`
-	CacheSize    int             `toml:"cache_size"`
-	TTL          time.Duration   `toml:"ttl"`
-	DefaultRate  float64         `toml:"default_rate"`
-	DefaultBurst int             `toml:"default_burst"`
-	Rules        []RateLimitRule `toml:"rule"`
+	Enabled       bool              `toml:"enabled"`
+	By            RateLimiterBy     `toml:"by"`
+	CacheSize     int               `toml:"cache_size"`
+	TTL           time.Duration     `toml:"ttl"`
+	DefaultRate   float64           `toml:"default_rate"`
+	DefaultBurst  int               `toml:"default_burst"`
+	Rules         []RateLimitRule   `toml:"rule"`
+	ThreadReplies ThreadReplyConfig `toml:"thread_replies"`
+	// WarnThreshold attaches an advisory to accepted events once the
+	// remaining burst falls to this fraction or below. 0 disables it.
+	WarnThreshold float64 `toml:"warn_threshold"`
 }
 
 type KindFilterConfig struct {
@@ -78,14 +117,33 @@ type FreshnessFilterConfig struct {
 }
 
 type SizeRule struct {
-	Description string `toml:"description"`
-	Kinds       []int  `toml:"kinds"`
-	MaxSize     int    `toml:"max_size_bytes"`
+	Description      string `toml:"description"`
+	Kinds            []int  `toml:"kinds"`
+	MaxSize          int    `toml:"max_size_bytes"`
+	MinContentLength *int   `toml:"min_content_length"`
 }
 
 type SizeFilterConfig struct {
-	DefaultMaxSize int        `toml:"default_max_size_bytes"`
-	Rules          []SizeRule `toml:"rule"`
+	DefaultMaxSize          int        `toml:"default_max_size_bytes"`
+	DefaultMinContentLength int        `toml:"default_min_content_length"`
+	EmptyContentKinds       []int      `toml:"empty_content_kinds"`
+	Rules                   []SizeRule `toml:"rule"`
+}
+
+// ValidationFilterConfig enables cheap structural checks, each with its own
+// toggle, that catch malformed events before behavioral filters see them.
+type ValidationFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// EmptyTagNames rejects empty tags and tags with an empty name.
+	EmptyTagNames bool `toml:"empty_tag_names"`
+	// HexReferences rejects "e", "p", "E" and "P" tags whose value is not
+	// 64 lowercase hex characters.
+	HexReferences bool `toml:"hex_references"`
+	// Timestamps rejects created_at values outside of years 1970 to 9999 and
+	// "expiration" or "published_at" tags that are not Unix timestamps.
+	Timestamps bool `toml:"timestamps"`
+	// MaxTags caps the number of tags of any kind; 0 = unlimited.
+	MaxTags int `toml:"max_tags"`
 }
 
 type TagRule struct {
@@ -100,6 +158,27 @@ type TagsFilterConfig struct {
 	Rules []TagRule `toml:"rule"`
 }
 
+// TagStuffingRule limits the hashtags and mentions of events of Kinds; 0
+// disables a limit.
+type TagStuffingRule struct {
+	Description string `toml:"description"`
+	Kinds       []int  `toml:"kinds"`
+	// MaxHashtags caps the distinct "t" tags, regardless of case.
+	MaxHashtags int `toml:"max_hashtags"`
+	// MaxMentions caps the distinct pubkeys of "p" tags.
+	MaxMentions int `toml:"max_mentions"`
+	// MaxHashtagRatio caps the share of the content's non-space characters
+	// taken by #hashtags, for content of at least MinContentLength of them.
+	MaxHashtagRatio  float64 `toml:"max_hashtag_ratio"`
+	MinContentLength int     `toml:"min_content_length"`
+}
+
+type TagStuffingFilterConfig struct {
+	Enabled bool              `toml:"enabled"`
+	Rules   []TagStuffingRule `toml:"rule"`
+	Action  FilterAction      `toml:"action"`
+}
+
 type KeywordRule struct {
 	Description string   `toml:"description"`
 	Kinds       []int    `toml:"kinds"`
@@ -135,6 +214,48 @@ type LanguageFilterConfig struct {
 	ApprovedCacheTTL       time.Duration                 `toml:"approved_cache_ttl"`
 	ApprovedCacheSize      int                           `toml:"approved_cache_size"`
 	PrimaryAcceptThreshold map[string]map[string]float64 `toml:"primary_accept_threshold"`
+	// RegionLanguages override AllowedLanguages by origin of the event: keys
+	// are ISO 3166 country codes or region names, as shared by the host
+	// through meta. A country's entry takes precedence over its regions'.
+	RegionLanguages map[string][]string `toml:"region_languages"`
+	// WarmupPolicy decides what happens to events arriving while the language
+	// models are still loading: "accept" them unchecked or "queue" them for up
+	// to WarmupTimeout.
+	WarmupPolicy  LanguageWarmupPolicy `toml:"warmup_policy"`
+	WarmupTimeout time.Duration        `toml:"warmup_timeout"`
+	Trust         LanguageTrustConfig  `toml:"trust"`
+}
+
+// LanguageTrustConfig adapts the language check to each author's history.
+// Authors rejected MuteAfter times within RejectionWindow are muted: their
+// checked kinds are rejected without detection for MuteDuration. Authors who
+// passed BilingualAfter times skip detection for BilingualTTL.
+type LanguageTrustConfig struct {
+	Enabled         bool          `toml:"enabled"`
+	CacheSize       int           `toml:"cache_size"`
+	MuteAfter       int           `toml:"mute_after"`
+	RejectionWindow time.Duration `toml:"rejection_window"`
+	MuteDuration    time.Duration `toml:"mute_duration"`
+	BilingualAfter  int           `toml:"bilingual_after"`
+	BilingualTTL    time.Duration `toml:"bilingual_ttl"`
+}
+
+type LanguageWarmupPolicy string
+
+const (
+	WarmupAccept LanguageWarmupPolicy = "accept"
+	WarmupQueue  LanguageWarmupPolicy = "queue"
+)
+
+func (p *LanguageWarmupPolicy) UnmarshalText(text []byte) error {
+	v := string(text)
+	switch LanguageWarmupPolicy(v) {
+	case WarmupAccept, WarmupQueue, "":
+		*p = LanguageWarmupPolicy(v)
+		return nil
+	default:
+		return fmt.Errorf("invalid language.warmup_policy: %q (must be accept, queue)", v)
+	}
 }
 
 type RepostAbuseFilterConfig struct {
@@ -147,3 +268,233 @@ type RepostAbuseFilterConfig struct {
 	CountRejectAsActivity bool          `toml:"count_reject_as_activity"`
 	RequireNIP21InQuote   bool          `toml:"require_nip21_in_quote"`
 }
+
+// ReplyFloodFilterConfig limits how many distinct threads and authors a
+// pubkey replies to within Window; 0 disables a limit. Replies to its own
+// threads are not counted.
+type ReplyFloodFilterConfig struct {
+	Enabled    bool          `toml:"enabled"`
+	Kinds      []int         `toml:"kinds"`
+	Window     time.Duration `toml:"window"`
+	MaxThreads int           `toml:"max_threads"`
+	MaxAuthors int           `toml:"max_authors"`
+	// CacheSize is the number of pubkeys tracked.
+	CacheSize int          `toml:"cache_size"`
+	Action    FilterAction `toml:"action"`
+}
+
+// KindDiversityFilterConfig flags the classic bot signature: an author who,
+// within Window of their first event, posts more than MinEvents events, all
+// of one kind, without sending or receiving any reaction or reply.
+type KindDiversityFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Kinds to check. Empty checks all kinds.
+	Kinds     []int         `toml:"kinds"`
+	MinEvents int           `toml:"min_events"`
+	Window    time.Duration `toml:"window"`
+	CacheSize int           `toml:"cache_size"`
+	// PoWDifficulty, if set, lets flagged authors through with NIP-13 proof
+	// of work of at least this many bits.
+	PoWDifficulty int          `toml:"pow_difficulty"`
+	Action        FilterAction `toml:"action"`
+}
+
+// DuplicateContentFilterConfig catches copy-paste spam: the same content,
+// or nearly the same, posted more than MaxDuplicates times by one author or
+// more than GlobalMaxDuplicates times by anyone within Window.
+type DuplicateContentFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Kinds to check. Empty checks all kinds.
+	Kinds []int `toml:"kinds"`
+	// MinLength skips content shorter than this many characters, so short
+	// replies such as "gm" or "+1" can repeat freely.
+	MinLength     int `toml:"min_length"`
+	MaxDuplicates int `toml:"max_duplicates"`
+	// GlobalMaxDuplicates caps copies across all authors; 0 = unlimited.
+	GlobalMaxDuplicates int           `toml:"global_max_duplicates"`
+	Window              time.Duration `toml:"window"`
+	// MaxDistance is how many SimHash bits near-duplicates may differ in;
+	// 0 counts only exact copies.
+	MaxDistance int          `toml:"max_distance"`
+	CacheSize   int          `toml:"cache_size"`
+	Action      FilterAction `toml:"action"`
+}
+
+type ReferenceFilterConfig struct {
+	Enabled       bool     `toml:"enabled"`
+	Kinds         []int    `toml:"kinds"`
+	DeniedPubKeys []string `toml:"denied_pubkeys"`
+	DeniedEvents  []string `toml:"denied_events"`
+	DeniedRelays  []string `toml:"denied_relays"`
+}
+
+type FairnessFilterConfig struct {
+	Enabled        bool          `toml:"enabled"`
+	SaturationRate float64       `toml:"saturation_rate"`
+	MaxShare       float64       `toml:"max_share"`
+	Window         time.Duration `toml:"window"`
+	IPv4Prefix     int           `toml:"ipv4_prefix"`
+	IPv6Prefix     int           `toml:"ipv6_prefix"`
+}
+
+type LiveActivityFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// RequireKnownStream rejects live chat (kind 1311) for streams whose
+	// kind 30311 event this filter has not seen.
+	RequireKnownStream bool `toml:"require_known_stream"`
+	RejectEndedStreams bool `toml:"reject_ended_streams"`
+	// ExemptRoles are the p-tag roles on the stream event exempt from limits.
+	// The stream's own author is always exempt.
+	ExemptRoles []string      `toml:"exempt_roles"`
+	ChatRate    float64       `toml:"chat_rate"`
+	ChatBurst   int           `toml:"chat_burst"`
+	StreamRate  float64       `toml:"stream_rate"`
+	StreamBurst int           `toml:"stream_burst"`
+	CacheSize   int           `toml:"cache_size"`
+	StreamTTL   time.Duration `toml:"stream_ttl"`
+}
+
+type FileSharingRule struct {
+	Kinds  []int        `toml:"kinds"`
+	Action FilterAction `toml:"action"`
+}
+
+type FileSharingFilterConfig struct {
+	Enabled          bool     `toml:"enabled"`
+	BlockMagnetLinks bool     `toml:"block_magnet_links"`
+	Domains          []string `toml:"domains"`
+	// Action applies to kinds without a matching rule. Defaults to reject.
+	Action FilterAction      `toml:"action"`
+	Rules  []FileSharingRule `toml:"rule"`
+}
+
+type PhishingFilterConfig struct {
+	Enabled bool  `toml:"enabled"`
+	Kinds   []int `toml:"kinds"`
+	// ProtectedDomains are the services whose lookalikes are flagged. An
+	// empty list uses a built-in set of popular nostr and bitcoin services.
+	ProtectedDomains []string `toml:"protected_domains"`
+	AllowedDomains   []string `toml:"allowed_domains"`
+	MaxEditDistance  int      `toml:"max_edit_distance"`
+	// FlagMixedScript flags any internationalized domain mixing scripts,
+	// even if it does not resemble a protected domain.
+	FlagMixedScript bool         `toml:"flag_mixed_script"`
+	Action          FilterAction `toml:"action"`
+}
+
+// BotClass tells known benign bots, such as crawlers, indexers and feed
+// bridges, from malicious ones.
+type BotClass string
+
+const (
+	BotBenign    BotClass = "benign"
+	BotMalicious BotClass = "malicious"
+)
+
+func (c *BotClass) UnmarshalText(text []byte) error {
+	v := string(text)
+	switch BotClass(v) {
+	case BotBenign, BotMalicious:
+		*c = BotClass(v)
+		return nil
+	default:
+		return fmt.Errorf("invalid bot class: %q (must be benign, malicious)", v)
+	}
+}
+
+// BotSignature identifies a bot by the events it writes. Every criterion set
+// must match, and any entry of a criterion does.
+type BotSignature struct {
+	Name  string   `toml:"name"`
+	Class BotClass `toml:"class"`
+	Kinds []int    `toml:"kinds"`
+	// PubKeys are the bot's keys, in hex; the plugin's configuration also
+	// accepts npub.
+	PubKeys []string `toml:"pubkeys"`
+	// Clients are case-insensitive path.Match patterns, such as "rss*",
+	// matched against the name and the handler address of the NIP-89
+	// "client" tag.
+	Clients []string `toml:"clients"`
+	// Content are regular expressions matched against the content, e.g.
+	// the template the bot fills in.
+	Content []string `toml:"content"`
+	// Action, if set, overrides the action of the class.
+	Action FilterAction `toml:"action"`
+}
+
+type BotSignatureFilterConfig struct {
+	Enabled         bool           `toml:"enabled"`
+	BenignAction    FilterAction   `toml:"benign_action"`
+	MaliciousAction FilterAction   `toml:"malicious_action"`
+	Signatures      []BotSignature `toml:"signature"`
+}
+
+// ClientRule adjusts the rate limits of the events of some NIP-89 clients.
+type ClientRule struct {
+	Description string `toml:"description"`
+	// Clients are case-insensitive path.Match patterns, matched like those
+	// of bot signatures.
+	Clients []string `toml:"clients"`
+	// RateMultiplier and BurstMultiplier scale the RateLimiterFilter limits
+	// of the clients' events; 0 leaves them as they are.
+	RateMultiplier  float64 `toml:"rate_multiplier"`
+	BurstMultiplier float64 `toml:"burst_multiplier"`
+}
+
+// ClientFilterConfig is the policy on the NIP-89 "client" tag, which names
+// the software an event was written with.
+type ClientFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Denied are patterns of clients whose events get Action.
+	Denied []string `toml:"denied"`
+	// RequiredKinds are the kinds whose events without a client tag get
+	// Action.
+	RequiredKinds []int        `toml:"required_kinds"`
+	Action        FilterAction `toml:"action"`
+	// Rules apply in order; the first matching one applies.
+	Rules []ClientRule `toml:"rule"`
+}
+
+type PoWRule struct {
+	Description   string `toml:"description"`
+	Kinds         []int  `toml:"kinds"`
+	MinDifficulty int    `toml:"min_difficulty"`
+}
+
+// PoWFilterConfig requires NIP-13 proof of work. Kinds without a rule need
+// DefaultMinDifficulty leading zero bits; 0 requires none.
+type PoWFilterConfig struct {
+	Enabled              bool      `toml:"enabled"`
+	DefaultMinDifficulty int       `toml:"default_min_difficulty"`
+	Rules                []PoWRule `toml:"rule"`
+}
+
+// MetadataFilterConfig checks kind 0 profiles: their content must be a JSON
+// object whose fields fit the limits below, 0 meaning no limit.
+type MetadataFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// MaxNameLength caps name and display_name, in characters.
+	MaxNameLength  int `toml:"max_name_length"`
+	MaxAboutLength int `toml:"max_about_length"`
+	// MaxURLLength caps picture and banner URLs, except data: URIs.
+	MaxURLLength int `toml:"max_url_length"`
+	// MaxDataURIBytes caps the decoded size of a data: URI picture or
+	// banner; 0 rejects all of them.
+	MaxDataURIBytes int `toml:"max_data_uri_bytes"`
+	// KeywordKinds applies the [filters.keywords] rules of these kinds
+	// (e.g. [1] for notes) to name, display_name and about.
+	KeywordKinds []int        `toml:"keyword_kinds"`
+	Action       FilterAction `toml:"action"`
+}
+
+type InlineDataFilterConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Kinds to check. Empty checks all kinds except those whose content is
+	// encrypted (and therefore legitimately base64).
+	Kinds []int `toml:"kinds"`
+	// MaxDataURIBytes caps the decoded size of a data: URI; 0 flags all of them.
+	MaxDataURIBytes   int          `toml:"max_data_uri_bytes"`
+	AllowedMediaTypes []string     `toml:"allowed_media_types"`
+	MaxBase64Bytes    int          `toml:"max_base64_bytes"`
+	Action            FilterAction `toml:"action"`
+}
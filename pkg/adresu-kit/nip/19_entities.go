@@ -0,0 +1,109 @@
+// nip/19_entities.go
+package nip
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+var nostrURIRe = regexp.MustCompile(`nostr:((?:npub1|nprofile1|note1|nevent1|naddr1)[02-9ac-hj-np-z]+)`)
+
+// Entities holds everything referenced by NIP-21 "nostr:" URIs in content.
+type Entities struct {
+	PubKeys   []string // Profiles mentioned directly or as event/address authors.
+	Events    []string // Referenced event IDs.
+	Addresses []string // Referenced addressable events as "kind:pubkey:d".
+	Relays    []string // Relay hints, normalized.
+}
+
+// IsEmpty reports whether no entity was found.
+func (e *Entities) IsEmpty() bool {
+	return len(e.PubKeys) == 0 && len(e.Events) == 0 && len(e.Addresses) == 0 && len(e.Relays) == 0
+}
+
+// ExtractEntities parses all "nostr:" NIP-19 entities in content. Malformed
+// entities are skipped.
+func ExtractEntities(content string) *Entities {
+	ents := &Entities{}
+	if !strings.Contains(content, "nostr:") {
+		return ents
+	}
+
+	for _, m := range nostrURIRe.FindAllStringSubmatch(content, -1) {
+		prefix, value, err := nip19.Decode(m[1])
+		if err != nil {
+			continue
+		}
+		switch prefix {
+		case "npub":
+			ents.addPubKey(value.(string))
+		case "note":
+			ents.addEvent(value.(string))
+		case "nprofile":
+			p := value.(nostr.ProfilePointer)
+			ents.addPubKey(p.PublicKey)
+			ents.addRelays(p.Relays)
+		case "nevent":
+			p := value.(nostr.EventPointer)
+			ents.addEvent(p.ID)
+			ents.addPubKey(p.Author)
+			ents.addRelays(p.Relays)
+		case "naddr":
+			p := value.(nostr.EntityPointer)
+			ents.Addresses = appendUnique(ents.Addresses, fmt.Sprintf("%d:%s:%s", p.Kind, p.PublicKey, p.Identifier))
+			ents.addPubKey(p.PublicKey)
+			ents.addRelays(p.Relays)
+		}
+	}
+	return ents
+}
+
+func (e *Entities) addPubKey(pk string) {
+	if pk != "" {
+		e.PubKeys = appendUnique(e.PubKeys, strings.ToLower(pk))
+	}
+}
+
+func (e *Entities) addEvent(id string) {
+	if id != "" {
+		e.Events = appendUnique(e.Events, strings.ToLower(id))
+	}
+}
+
+func (e *Entities) addRelays(relays []string) {
+	for _, r := range relays {
+		if host := RelayHost(r); host != "" {
+			e.Relays = appendUnique(e.Relays, host)
+		}
+	}
+}
+
+// RelayHost reduces a relay URL (or bare host) to its lowercase host name,
+// which is what relay deny lists are matched against.
+func RelayHost(relay string) string {
+	relay = strings.TrimSpace(relay)
+	if relay == "" {
+		return ""
+	}
+	if !strings.Contains(relay, "://") {
+		relay = "wss://" + relay
+	}
+	u, err := url.Parse(relay)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func appendUnique(list []string, v string) []string {
+	if slices.Contains(list, v) {
+		return list
+	}
+	return append(list, v)
+}
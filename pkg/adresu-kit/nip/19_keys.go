@@ -0,0 +1,72 @@
+// nip/19_keys.go
+package nip
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// NormalizePubKey accepts a pubkey as hex, npub or nprofile (optionally with a
+// "nostr:" prefix) and returns it as lowercase hex.
+func NormalizePubKey(s string) (string, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "nostr:")
+	if s == "" {
+		return "", fmt.Errorf("empty pubkey")
+	}
+
+	if strings.HasPrefix(s, "npub1") || strings.HasPrefix(s, "nprofile1") {
+		// The prefix decoded on failure is empty; name the one given.
+		hrp, _, _ := strings.Cut(s, "1")
+		prefix, value, err := nip19.Decode(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %w", hrp, err)
+		}
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case nostr.ProfilePointer:
+			return v.PublicKey, nil
+		}
+		return "", fmt.Errorf("unexpected %s payload", prefix)
+	}
+
+	hexKey := strings.ToLower(s)
+	if !nostr.IsValidPublicKey(hexKey) {
+		return "", fmt.Errorf("not a valid hex pubkey or npub: %q", s)
+	}
+	return hexKey, nil
+}
+
+// NormalizeEventID accepts an event ID as hex, note or nevent (optionally with
+// a "nostr:" prefix) and returns it as lowercase hex.
+func NormalizeEventID(s string) (string, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "nostr:")
+	if s == "" {
+		return "", fmt.Errorf("empty event id")
+	}
+
+	if strings.HasPrefix(s, "note1") || strings.HasPrefix(s, "nevent1") {
+		// The prefix decoded on failure is empty; name the one given.
+		hrp, _, _ := strings.Cut(s, "1")
+		prefix, value, err := nip19.Decode(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %w", hrp, err)
+		}
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case nostr.EventPointer:
+			return v.ID, nil
+		}
+		return "", fmt.Errorf("unexpected %s payload", prefix)
+	}
+
+	id := strings.ToLower(s)
+	if !nostr.IsValid32ByteHex(id) {
+		return "", fmt.Errorf("not a valid hex event id or note: %q", s)
+	}
+	return id, nil
+}
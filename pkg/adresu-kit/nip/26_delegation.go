@@ -4,7 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -12,74 +12,105 @@ import (
 	"github.com/nbd-wtf/go-nostr"
 )
 
+// Delegation is a verified NIP-26 delegation.
+type Delegation struct {
+	Delegator  string
+	Conditions DelegationConditions
+}
+
+// DelegationConditions are the parsed conditions of a delegation token.
+// Since and Until are 0 when the token sets no such bound.
+type DelegationConditions struct {
+	Kinds []int
+	Since int64 // created_at>
+	Until int64 // created_at<
+}
+
+// Bounded reports whether the delegation is limited in time on both ends.
+func (c DelegationConditions) Bounded() bool {
+	return c.Since > 0 && c.Until > 0
+}
+
+// ParseDelegationConditions parses a conditions string such as
+// "kind=1&created_at>1700000000&created_at<1710000000". Unknown conditions
+// are ignored.
+func ParseDelegationConditions(conditionsStr string) (DelegationConditions, error) {
+	var c DelegationConditions
+	for cond := range strings.SplitSeq(conditionsStr, "&") {
+		switch {
+		case cond == "":
+		case strings.HasPrefix(cond, "kind="):
+			kind, err := strconv.Atoi(cond[len("kind="):])
+			if err != nil {
+				return c, fmt.Errorf("invalid 'kind' condition value: %q", cond)
+			}
+			c.Kinds = append(c.Kinds, kind)
+		case strings.HasPrefix(cond, "created_at>"):
+			ts, err := strconv.ParseInt(cond[len("created_at>"):], 10, 64)
+			if err != nil {
+				return c, fmt.Errorf("invalid 'created_at>' value: %q", cond)
+			}
+			c.Since = ts
+		case strings.HasPrefix(cond, "created_at<"):
+			ts, err := strconv.ParseInt(cond[len("created_at<"):], 10, 64)
+			if err != nil {
+				return c, fmt.Errorf("invalid 'created_at<' value: %q", cond)
+			}
+			c.Until = ts
+		}
+	}
+	return c, nil
+}
+
+// ValidateDelegation verifies the event's delegation tag and returns the
+// delegator's pubkey.
 func ValidateDelegation(event *nostr.Event) (string, error) {
+	d, err := ParseDelegation(event)
+	if err != nil {
+		return "", err
+	}
+	return d.Delegator, nil
+}
+
+// ParseDelegation verifies the event's delegation tag: the event must satisfy
+// the conditions and the token must be signed by the delegator.
+func ParseDelegation(event *nostr.Event) (*Delegation, error) {
 	delegationTag := event.Tags.Find("delegation")
 	if delegationTag == nil {
-		return "", fmt.Errorf("event has no delegation tag")
+		return nil, fmt.Errorf("event has no delegation tag")
 	}
 
 	if len(delegationTag) != 4 {
-		return "", fmt.Errorf("tag is not a valid delegation tag")
+		return nil, fmt.Errorf("tag is not a valid delegation tag")
 	}
 	delegatorPubKeyHex := delegationTag[1]
 	conditionsStr := delegationTag[2]
 	sigHex := delegationTag[3]
 
-	if err := validateDelegationConditions(event, conditionsStr); err != nil {
-		return "", fmt.Errorf("event does not satisfy conditions: %w", err)
+	conditions, err := ParseDelegationConditions(conditionsStr)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDelegationConditions(event, conditions); err != nil {
+		return nil, fmt.Errorf("event does not satisfy conditions: %w", err)
 	}
 
 	if err := verifyDelegationSignature(event.PubKey, delegatorPubKeyHex, conditionsStr, sigHex); err != nil {
-		return "", fmt.Errorf("signature verification failed: %w", err)
+		return nil, fmt.Errorf("signature verification failed: %w", err)
 	}
 
-	return delegatorPubKeyHex, nil
+	return &Delegation{Delegator: delegatorPubKeyHex, Conditions: conditions}, nil
 }
 
-func validateDelegationConditions(event *nostr.Event, conditionsStr string) error {
-	safeConditionsStr := strings.ReplaceAll(conditionsStr, "+", "%2B")
-	conditions, err := url.ParseQuery(safeConditionsStr)
-	if err != nil {
-		return fmt.Errorf("failed to parse conditions query string: %w", err)
+func checkDelegationConditions(event *nostr.Event, c DelegationConditions) error {
+	if len(c.Kinds) > 0 && !slices.Contains(c.Kinds, event.Kind) {
+		return fmt.Errorf("event kind %d is not in the allowed list", event.Kind)
 	}
-
-	for key, values := range conditions {
-		if len(values) == 0 {
-			continue
-		}
-		switch key {
-		case "kind":
-			kindMatch := false
-			for _, v := range values {
-				kind, err := strconv.Atoi(v)
-				if err != nil {
-					return fmt.Errorf("invalid 'kind' condition value: %q", v)
-				}
-				if event.Kind == kind {
-					kindMatch = true
-					break
-				}
-			}
-			if !kindMatch {
-				return fmt.Errorf("event kind %d is not in the allowed list", event.Kind)
-			}
-		case "created_at>":
-			ts, err := strconv.ParseInt(values[0], 10, 64)
-			if err != nil {
-				return fmt.Errorf("invalid 'created_at>' value: %q", values[0])
-			}
-			if int64(event.CreatedAt) <= ts {
-				return fmt.Errorf("event created_at %d is not after %d", event.CreatedAt, ts)
-			}
-		case "created_at<":
-			ts, err := strconv.ParseInt(values[0], 10, 64)
-			if err != nil {
-				return fmt.Errorf("invalid 'created_at<' value: %q", values[0])
-			}
-			if int64(event.CreatedAt) >= ts {
-				return fmt.Errorf("event created_at %d is not before %d", event.CreatedAt, ts)
-			}
-		}
+	if c.Since > 0 && int64(event.CreatedAt) <= c.Since {
+		return fmt.Errorf("event created_at %d is not after %d", event.CreatedAt, c.Since)
+	}
+	if c.Until > 0 && int64(event.CreatedAt) >= c.Until {
+		return fmt.Errorf("event created_at %d is not before %d", event.CreatedAt, c.Until)
 	}
 	return nil
 }
@@ -0,0 +1,144 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const botSignatureFilterName = "BotSignatureFilter"
+
+// MetaKeyBot is the meta key under which BotSignatureFilter shares the bot an
+// event was identified as (*BotIdentity), for the filters after it.
+const MetaKeyBot = "bot"
+
+// BotIdentity is the known bot an event was identified as.
+type BotIdentity struct {
+	Name  string          `json:"name"`
+	Class config.BotClass `json:"class"`
+}
+
+// IdentifiedBot returns the bot BotSignatureFilter identified the event of
+// meta as, or nil.
+func IdentifiedBot(meta map[string]any) *BotIdentity {
+	bot, _ := meta[MetaKeyBot].(*BotIdentity)
+	return bot
+}
+
+type botSignature struct {
+	identity BotIdentity
+	action   config.FilterAction
+	kinds    map[int]struct{}
+	pubkeys  map[string]struct{}
+	clients  []string
+	content  []*regexp.Regexp
+}
+
+// BotSignatureFilter recognizes the events of known bots by their keys,
+// NIP-89 client tags and content templates, and applies the action of their
+// class: typically letting crawlers and indexers through while rejecting
+// spam bots. The first matching signature applies.
+type BotSignatureFilter struct {
+	cfg        *config.BotSignatureFilterConfig
+	signatures []botSignature
+}
+
+func NewBotSignatureFilter(cfg *config.BotSignatureFilterConfig) (*BotSignatureFilter, error) {
+	f := &BotSignatureFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	for _, s := range cfg.Signatures {
+		sig := botSignature{identity: BotIdentity{Name: s.Name, Class: s.Class}, action: s.Action}
+		if sig.action == "" {
+			sig.action = cfg.BenignAction
+			if s.Class == config.BotMalicious {
+				sig.action = cfg.MaliciousAction
+			}
+		}
+		if len(s.Kinds) > 0 {
+			sig.kinds = make(map[int]struct{}, len(s.Kinds))
+			for _, k := range s.Kinds {
+				sig.kinds[k] = struct{}{}
+			}
+		}
+		if len(s.PubKeys) > 0 {
+			sig.pubkeys = make(map[string]struct{}, len(s.PubKeys))
+			for _, pk := range s.PubKeys {
+				sig.pubkeys[strings.ToLower(pk)] = struct{}{}
+			}
+		}
+		if len(s.Clients) > 0 {
+			var err error
+			if sig.clients, err = clientPatterns(s.Clients); err != nil {
+				return nil, fmt.Errorf("signature %q: %w", s.Name, err)
+			}
+		}
+		for _, expr := range s.Content {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("signature %q: invalid content regexp %q: %w", s.Name, expr, err)
+			}
+			sig.content = append(sig.content, re)
+		}
+		f.signatures = append(f.signatures, sig)
+	}
+	return f, nil
+}
+
+func (f *BotSignatureFilter) Match(_ context.Context, event *nostr.Event, meta map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(botSignatureFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+
+	client := event.Tags.Find("client")
+	for i := range f.signatures {
+		sig := &f.signatures[i]
+		if !sig.matches(event, client) {
+			continue
+		}
+		if meta != nil {
+			meta[MetaKeyBot] = &sig.identity
+		}
+		res, err := ActionResult(newResult, sig.action, fmt.Sprintf("%s_bot:'%s'", sig.identity.Class, sig.identity.Name))
+		res.Values = map[string]any{"bot": sig.identity.Name, "class": string(sig.identity.Class)}
+		return res, err
+	}
+	return newResult(true, "no_known_bot", nil)
+}
+
+func (s *botSignature) matches(event *nostr.Event, client nostr.Tag) bool {
+	if s.kinds != nil {
+		if _, ok := s.kinds[event.Kind]; !ok {
+			return false
+		}
+	}
+	if s.pubkeys != nil {
+		if _, ok := s.pubkeys[event.PubKey]; !ok {
+			return false
+		}
+	}
+	if s.clients != nil && !matchClient(s.clients, client) {
+		return false
+	}
+	if s.content != nil && !s.matchesContent(event.Content) {
+		return false
+	}
+	return true
+}
+
+func (s *botSignature) matchesContent(content string) bool {
+	for _, re := range s.content {
+		if re.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const clientFilterName = "ClientFilter"
+
+// MetaKeyClientRate is the meta key under which ClientFilter shares the rate
+// limit adjustment of an event's client (*ClientRate) with RateLimiterFilter.
+const MetaKeyClientRate = "client_rate"
+
+// ClientRate scales the rate limits of the events of some clients.
+type ClientRate struct {
+	// ID tells the rule apart, so its events get rate limiters of their own.
+	ID              string
+	Description     string
+	RateMultiplier  float64
+	BurstMultiplier float64
+}
+
+type clientRule struct {
+	patterns []string
+	rate     ClientRate
+}
+
+// ClientFilter applies the relay's policy on the clients events are written
+// with, as named by their NIP-89 "client" tag: abusive client forks can be
+// denied or slowed down, and some kinds can be required to name their
+// client. The tag is self-declared, so this is a lever against bulk traffic
+// from one implementation, not an authentication.
+type ClientFilter struct {
+	cfg           *config.ClientFilterConfig
+	denied        []string
+	requiredKinds map[int]struct{}
+	rules         []clientRule
+}
+
+func NewClientFilter(cfg *config.ClientFilterConfig) (*ClientFilter, error) {
+	f := &ClientFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	var err error
+	if f.denied, err = clientPatterns(cfg.Denied); err != nil {
+		return nil, fmt.Errorf("denied: %w", err)
+	}
+	if len(cfg.RequiredKinds) > 0 {
+		f.requiredKinds = make(map[int]struct{}, len(cfg.RequiredKinds))
+		for _, k := range cfg.RequiredKinds {
+			f.requiredKinds[k] = struct{}{}
+		}
+	}
+	for i, rule := range cfg.Rules {
+		patterns, err := clientPatterns(rule.Clients)
+		if err != nil {
+			return nil, fmt.Errorf("rule #%d: %w", i, err)
+		}
+		rate := ClientRate{
+			ID:              "client-" + strconv.Itoa(i),
+			Description:     rule.Description,
+			RateMultiplier:  rule.RateMultiplier,
+			BurstMultiplier: rule.BurstMultiplier,
+		}
+		if rate.Description == "" {
+			rate.Description = strings.Join(rule.Clients, ",")
+		}
+		if rate.RateMultiplier == 0 {
+			rate.RateMultiplier = 1
+		}
+		if rate.BurstMultiplier == 0 {
+			rate.BurstMultiplier = 1
+		}
+		f.rules = append(f.rules, clientRule{patterns: patterns, rate: rate})
+	}
+	return f, nil
+}
+
+func (f *ClientFilter) Match(_ context.Context, event *nostr.Event, meta map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(clientFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+
+	client := event.Tags.Find("client")
+	if client == nil {
+		if _, ok := f.requiredKinds[event.Kind]; ok {
+			return ActionResult(newResult, f.cfg.Action, fmt.Sprintf("client_required:kind_%d", event.Kind))
+		}
+		return newResult(true, "no_client_tag", nil)
+	}
+
+	if matchClient(f.denied, client) {
+		res, err := ActionResult(newResult, f.cfg.Action, fmt.Sprintf("client_denied:'%s'", client[1]))
+		res.Values = map[string]any{"client": client[1]}
+		return res, err
+	}
+	for i := range f.rules {
+		if matchClient(f.rules[i].patterns, client) {
+			if meta != nil {
+				meta[MetaKeyClientRate] = &f.rules[i].rate
+			}
+			break
+		}
+	}
+	return newResult(true, "client_allowed", nil)
+}
+
+// clientPatterns validates client patterns and lowercases them for
+// matchClient.
+func clientPatterns(patterns []string) ([]string, error) {
+	lowered := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid client pattern %q: %w", pattern, err)
+		}
+		lowered = append(lowered, pattern)
+	}
+	return lowered, nil
+}
+
+// matchClient reports whether the name or handler address of a NIP-89
+// client tag, ["client", <name>, <31990 address>, <relay hint>], matches one
+// of patterns.
+func matchClient(patterns []string, client nostr.Tag) bool {
+	for _, value := range client[min(1, len(client)):min(3, len(client))] {
+		value = strings.ToLower(value)
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
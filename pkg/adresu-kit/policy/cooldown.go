@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// MetaKeyCooldowns is the meta key under which a pipeline shares its
+// *Cooldowns registry with filters.
+const MetaKeyCooldowns = "cooldowns"
+
+// Cooldown is an active posting cooldown.
+type Cooldown struct {
+	Until  time.Time
+	Reason string
+}
+
+// Cooldowns is a shared registry of posting cooldowns per pubkey and per IP.
+// Any filter can impose one, and a single cheap check at the top of the
+// pipeline enforces them all, so filters need no cooldown caches of their own.
+type Cooldowns struct {
+	mu      sync.Mutex
+	entries *lru.LRU[string, Cooldown]
+}
+
+// NewCooldowns creates a registry tracking up to size pubkeys and IPs.
+func NewCooldowns(size int) *Cooldowns {
+	// Cooldowns expire individually; the LRU only bounds memory.
+	return &Cooldowns{entries: lru.NewLRU[string, Cooldown](size, nil, 0)}
+}
+
+// CooldownsFrom returns the registry shared through meta, or nil.
+func CooldownsFrom(meta map[string]any) *Cooldowns {
+	c, _ := meta[MetaKeyCooldowns].(*Cooldowns)
+	return c
+}
+
+// Impose puts pubkey and ip (either may be empty) on cooldown for d. An
+// existing cooldown that lasts longer is kept.
+func (c *Cooldowns) Impose(pubkey, ip string, d time.Duration, reason string) {
+	if c == nil || d <= 0 {
+		return
+	}
+	cd := Cooldown{Until: time.Now().Add(d), Reason: reason}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range cooldownKeys(pubkey, ip) {
+		if old, ok := c.entries.Peek(key); ok && old.Until.After(cd.Until) {
+			continue
+		}
+		c.entries.Add(key, cd)
+	}
+}
+
+// Active returns the cooldown in effect for pubkey or ip, if any.
+func (c *Cooldowns) Active(pubkey, ip string) (Cooldown, bool) {
+	if c == nil {
+		return Cooldown{}, false
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range cooldownKeys(pubkey, ip) {
+		cd, ok := c.entries.Get(key)
+		if !ok {
+			continue
+		}
+		if now.Before(cd.Until) {
+			return cd, true
+		}
+		c.entries.Remove(key)
+	}
+	return Cooldown{}, false
+}
+
+// Lift removes the cooldowns of pubkey and ip.
+func (c *Cooldowns) Lift(pubkey, ip string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range cooldownKeys(pubkey, ip) {
+		c.entries.Remove(key)
+	}
+}
+
+func cooldownKeys(pubkey, ip string) []string {
+	keys := make([]string, 0, 2)
+	if pubkey != "" {
+		keys = append(keys, "pk:"+pubkey)
+	}
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	return keys
+}
@@ -0,0 +1,218 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	duplicateContentFilterName = "DuplicateContentFilter"
+	// maxAuthorContents bounds the recent contents remembered per author.
+	maxAuthorContents = 32
+	// maxBandEntries bounds the contents remembered per SimHash band value.
+	maxBandEntries = 8
+)
+
+// contentCopies counts the copies of one content within a window.
+type contentCopies struct {
+	exact, sim uint64
+	count      int
+	first      time.Time
+}
+
+// bandKey is one band of a SimHash: contents within the configured distance
+// share at least one band with each other.
+type bandKey struct {
+	band  int
+	value uint64
+}
+
+// DuplicateContentFilter rejects authors reposting the same content, and
+// content copied across many authors. Copies are found by an exact hash of
+// the whitespace-normalized content and, with max_distance set, by SimHash,
+// so that changing a link or a word does not make a template new.
+type DuplicateContentFilter struct {
+	cfg   *config.DuplicateContentFilterConfig
+	kinds map[int]struct{}
+	bands int
+
+	mu      sync.Mutex
+	authors *lru.LRU[string, []*contentCopies]
+	// exact and near index the copies across all authors.
+	exact *lru.LRU[uint64, *contentCopies]
+	near  *lru.LRU[bandKey, []*contentCopies]
+}
+
+func NewDuplicateContentFilter(cfg *config.DuplicateContentFilterConfig) (*DuplicateContentFilter, error) {
+	f := &DuplicateContentFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	if len(cfg.Kinds) > 0 {
+		f.kinds = make(map[int]struct{}, len(cfg.Kinds))
+		for _, k := range cfg.Kinds {
+			f.kinds[k] = struct{}{}
+		}
+	}
+	f.authors = lru.NewLRU[string, []*contentCopies](cfg.CacheSize, nil, cfg.Window)
+	if cfg.GlobalMaxDuplicates > 0 {
+		f.exact = lru.NewLRU[uint64, *contentCopies](cfg.CacheSize, nil, cfg.Window)
+		if cfg.MaxDistance > 0 {
+			// As for the digest clusters: two hashes differing in at most
+			// MaxDistance bits share one of MaxDistance+1 bands.
+			f.bands = cfg.MaxDistance + 1
+			f.near = lru.NewLRU[bandKey, []*contentCopies](cfg.CacheSize, nil, cfg.Window)
+		}
+	}
+	return f, nil
+}
+
+func (f *DuplicateContentFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(duplicateContentFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if f.kinds != nil {
+		if _, ok := f.kinds[event.Kind]; !ok {
+			return newResult(true, "kind_not_checked", nil)
+		}
+	}
+	normalized := strings.Join(strings.Fields(event.Content), " ")
+	if utf8.RuneCountInString(normalized) < max(f.cfg.MinLength, 1) {
+		return newResult(true, "content_too_short_to_check", nil)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(normalized))
+	exact := h.Sum64()
+	var sim uint64
+	if f.cfg.MaxDistance > 0 {
+		sim = SimHash(normalized)
+	}
+	now := time.Now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	recent, _ := f.authors.Get(event.PubKey)
+	own := f.find(recent, exact, sim, now)
+	if own != nil && own.count >= f.cfg.MaxDuplicates {
+		return f.violation(newResult, "duplicate_content", own.count+1, f.cfg.MaxDuplicates)
+	}
+	var global *contentCopies
+	if f.exact != nil {
+		global = f.findGlobal(exact, sim, now)
+		if global != nil && global.count >= f.cfg.GlobalMaxDuplicates {
+			return f.violation(newResult, "duplicate_content_global", global.count+1, f.cfg.GlobalMaxDuplicates)
+		}
+	}
+
+	if own != nil {
+		own.count++
+	} else {
+		recent = f.prune(recent, now)
+		if len(recent) >= maxAuthorContents {
+			recent = recent[1:]
+		}
+		recent = append(recent, &contentCopies{exact: exact, sim: sim, count: 1, first: now})
+	}
+	f.authors.Add(event.PubKey, recent)
+	if f.exact != nil {
+		if global != nil {
+			global.count++
+		} else {
+			f.addGlobal(&contentCopies{exact: exact, sim: sim, count: 1, first: now})
+		}
+	}
+	return newResult(true, "content_not_duplicated", nil)
+}
+
+// violation reports content posted copies times, over limit.
+func (f *DuplicateContentFilter) violation(newResult func(bool, string, error) (FilterResult, error), code string, copies, limit int) (FilterResult, error) {
+	res, err := ActionResult(newResult, f.cfg.Action, fmt.Sprintf("%s:copies_%d,max_%d", code, copies, limit))
+	res.Values = map[string]any{"copies": copies, "max": limit}
+	return res, err
+}
+
+// matches reports whether c counts as a copy of the content hashed to exact
+// and sim within the window.
+func (f *DuplicateContentFilter) matches(c *contentCopies, exact, sim uint64, now time.Time) bool {
+	if now.Sub(c.first) > f.cfg.Window {
+		return false
+	}
+	return c.exact == exact || (f.cfg.MaxDistance > 0 && bits.OnesCount64(c.sim^sim) <= f.cfg.MaxDistance)
+}
+
+func (f *DuplicateContentFilter) find(entries []*contentCopies, exact, sim uint64, now time.Time) *contentCopies {
+	for _, c := range entries {
+		if f.matches(c, exact, sim, now) {
+			return c
+		}
+	}
+	return nil
+}
+
+// prune drops the entries whose window has passed.
+func (f *DuplicateContentFilter) prune(entries []*contentCopies, now time.Time) []*contentCopies {
+	kept := entries[:0:0]
+	for _, c := range entries {
+		if now.Sub(c.first) <= f.cfg.Window {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// bandKeys returns the band keys of sim.
+func (f *DuplicateContentFilter) bandKeys(sim uint64) []bandKey {
+	width := 64 / f.bands
+	mask := uint64(1)<<width - 1
+	keys := make([]bandKey, f.bands)
+	for b := range f.bands {
+		keys[b] = bandKey{band: b, value: (sim >> (b * width)) & mask}
+	}
+	return keys
+}
+
+func (f *DuplicateContentFilter) findGlobal(exact, sim uint64, now time.Time) *contentCopies {
+	if c, ok := f.exact.Get(exact); ok && f.matches(c, exact, sim, now) {
+		return c
+	}
+	if f.near == nil {
+		return nil
+	}
+	for _, key := range f.bandKeys(sim) {
+		entries, _ := f.near.Get(key)
+		if c := f.find(entries, exact, sim, now); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+func (f *DuplicateContentFilter) addGlobal(c *contentCopies) {
+	f.exact.Add(c.exact, c)
+	if f.near == nil {
+		return
+	}
+	for _, key := range f.bandKeys(c.sim) {
+		entries, _ := f.near.Get(key)
+		entries = f.prune(entries, c.first)
+		if len(entries) >= maxBandEntries {
+			entries = entries[1:]
+		}
+		f.near.Add(key, append(entries, c))
+	}
+}
@@ -50,6 +50,17 @@ func NewEmergencyFilter(cfg *config.EmergencyFilterConfig) (*EmergencyFilter, er
 	return filter, nil
 }
 
+// Prime marks the authors in history as recently seen, so they do not count
+// against the new pubkey rate after a restart.
+func (f *EmergencyFilter) Prime(history []AuthorHistory) {
+	if f.recentSeen == nil {
+		return
+	}
+	for _, h := range history {
+		f.recentSeen.Add(h.PubKey, struct{}{})
+	}
+}
+
 func (f *EmergencyFilter) Match(_ context.Context, ev *nostr.Event, meta map[string]any) (FilterResult, error) {
 	newResult := NewResultFunc(emergencyFilterName)
 
@@ -67,7 +78,7 @@ func (f *EmergencyFilter) Match(_ context.Context, ev *nostr.Event, meta map[str
 
 	if f.perIPEnabled {
 		if remoteIP, ok := meta["remote_ip"].(string); ok && remoteIP != "" {
-			key := normalizeIPWithOptionalPrefixes(remoteIP, f.ipv4Prefix, f.ipv6Prefix)
+			key := NormalizeIP(remoteIP, f.ipv4Prefix, f.ipv6Prefix)
 
 			lim, ok := f.perIPLimiters.Get(key)
 			if !ok {
@@ -89,7 +100,10 @@ func (f *EmergencyFilter) Match(_ context.Context, ev *nostr.Event, meta map[str
 	return newResult(true, "new_pubkey_accepted", nil)
 }
 
-func normalizeIPWithOptionalPrefixes(ipStr string, v4Prefix, v6Prefix int) string {
+// NormalizeIP returns the canonical form of ipStr or, with a positive prefix
+// length for its family, the network containing it in CIDR notation.
+// Unparsable input is returned unchanged.
+func NormalizeIP(ipStr string, v4Prefix, v6Prefix int) string {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		return ipStr
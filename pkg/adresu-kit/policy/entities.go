@@ -0,0 +1,26 @@
+package policy
+
+import (
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+)
+
+// MetaKeyEntities is the meta key under which parsed NIP-19 entities are cached.
+const MetaKeyEntities = "nip19_entities"
+
+// ContentEntities returns the NIP-19 entities referenced in the event content.
+// The result is parsed once per event and shared through meta, so any number of
+// filters can inspect it without re-scanning the content.
+func ContentEntities(ev *nostr.Event, meta map[string]any) *nip.Entities {
+	if meta != nil {
+		if ents, ok := meta[MetaKeyEntities].(*nip.Entities); ok {
+			return ents
+		}
+	}
+	ents := nip.ExtractEntities(ev.Content)
+	if meta != nil {
+		meta[MetaKeyEntities] = ents
+	}
+	return ents
+}
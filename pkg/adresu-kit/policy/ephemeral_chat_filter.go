@@ -3,6 +3,7 @@ package policy
 import (
 	"context"
 	"fmt"
+	"math"
 	"regexp"
 	"slices"
 	"time"
@@ -26,9 +27,16 @@ type EphemeralChatFilter struct {
 	wordRegex  *regexp.Regexp
 	lastSeen   *lru.LRU[string, time.Time]
 	limiters   *lru.LRU[string, *rate.Limiter]
+	slowMode   *SlowMode
 }
 
 func NewEphemeralChatFilter(cfg *config.EphemeralChatFilterConfig) (*EphemeralChatFilter, error) {
+	return NewEphemeralChatFilterWithSlowMode(cfg, nil)
+}
+
+// NewEphemeralChatFilterWithSlowMode creates the filter enforcing the rooms
+// in slowMode, if not nil, in addition to min_delay_between_messages.
+func NewEphemeralChatFilterWithSlowMode(cfg *config.EphemeralChatFilterConfig, slowMode *SlowMode) (*EphemeralChatFilter, error) {
 	if !cfg.Enabled {
 		return &EphemeralChatFilter{cfg: cfg}, nil
 	}
@@ -59,6 +67,7 @@ func NewEphemeralChatFilter(cfg *config.EphemeralChatFilterConfig) (*EphemeralCh
 		wordRegex:  wordRegex,
 		lastSeen:   lastSeen,
 		limiters:   limiters,
+		slowMode:   slowMode,
 	}
 
 	return filter, nil
@@ -71,12 +80,28 @@ func (f *EphemeralChatFilter) Match(_ context.Context, event *nostr.Event, meta
 		return newResult(true, "filter_disabled_or_kind_not_matched", nil)
 	}
 
+	if f.slowMode != nil {
+		room := ChatRoom(event)
+		f.slowMode.Remember(event, room)
+		// Messages are recorded outside of slow mode too, so that it applies
+		// as soon as it is enabled.
+		limit, _ := f.slowMode.Delay(room)
+		if delay, tooSoon := f.slowMode.Wait(room, event.PubKey, limit, time.Now()); tooSoon {
+			reason := fmt.Sprintf("slow_mode:delay_%.1fs,limit_%.1fs", delay.Seconds(), limit.Seconds())
+			res, err := newResult(false, reason, nil)
+			res.Values = map[string]any{"delay": delay.Seconds(), "limit": limit.Seconds(), "retry_after": int(math.Ceil((limit - delay).Seconds()))}
+			return res, err
+		}
+	}
+
 	if f.lastSeen != nil && f.cfg.MinDelay > 0 {
 		now := time.Now()
 		if last, ok := f.lastSeen.Get(event.PubKey); ok {
 			if delay := now.Sub(last); delay < f.cfg.MinDelay {
 				reason := fmt.Sprintf("posting_too_frequently:delay_%.1fs,limit_%.1fs", delay.Seconds(), f.cfg.MinDelay.Seconds())
-				return newResult(false, reason, nil)
+				res, err := newResult(false, reason, nil)
+				res.Values = map[string]any{"delay": delay.Seconds(), "limit": f.cfg.MinDelay.Seconds(), "retry_after": int(math.Ceil((f.cfg.MinDelay - delay).Seconds()))}
+				return res, err
 			}
 		}
 		f.lastSeen.Add(event.PubKey, now)
@@ -101,7 +126,9 @@ func (f *EphemeralChatFilter) Match(_ context.Context, event *nostr.Event, meta
 		if letters > minLetters {
 			if ratio := float64(caps) / float64(letters); ratio > f.cfg.MaxCapsRatio {
 				reason := fmt.Sprintf("excessive_caps:ratio_%.2f,limit_%.2f", ratio, f.cfg.MaxCapsRatio)
-				return newResult(false, reason, nil)
+				res, err := newResult(false, reason, nil)
+				res.Values = map[string]any{"ratio": ratio, "limit": f.cfg.MaxCapsRatio}
+				return res, err
 			}
 		}
 	}
@@ -118,14 +145,18 @@ func (f *EphemeralChatFilter) Match(_ context.Context, event *nostr.Event, meta
 				}
 				if count >= f.cfg.MaxRepeatChars {
 					reason := fmt.Sprintf("excessive_char_repetition:count_%d,limit_%d", count, f.cfg.MaxRepeatChars)
-					return newResult(false, reason, nil)
+					res, err := newResult(false, reason, nil)
+					res.Values = map[string]any{"count": count, "limit": f.cfg.MaxRepeatChars}
+					return res, err
 				}
 			}
 		}
 	}
 
 	if f.wordRegex != nil && f.wordRegex.MatchString(content) {
-		return newResult(false, fmt.Sprintf("word_too_long:limit_%d", f.cfg.MaxWordLength), nil)
+		res, err := newResult(false, fmt.Sprintf("word_too_long:limit_%d", f.cfg.MaxWordLength), nil)
+		res.Values = map[string]any{"limit": f.cfg.MaxWordLength}
+		return res, err
 	}
 
 	if f.zalgoRegex != nil && f.zalgoRegex.MatchString(content) {
@@ -142,7 +173,9 @@ func (f *EphemeralChatFilter) Match(_ context.Context, event *nostr.Event, meta
 	}
 
 	reason := fmt.Sprintf("rate_limit_exceeded:required_pow_%d", f.cfg.RequiredPoWOnLimit)
-	return newResult(false, reason, nil)
+	res, err := newResult(false, reason, nil)
+	res.Values = map[string]any{"pow_difficulty": f.cfg.RequiredPoWOnLimit}
+	return res, err
 }
 
 func (f *EphemeralChatFilter) getLimiter(key string) *rate.Limiter {
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	fairnessFilterName = "FairnessFilter"
+)
+
+// FairnessFilter spreads capacity across networks during floods. While the
+// global event rate is below the saturation threshold it allows everything;
+// once saturated, no single IP prefix may take more than max_share of the
+// events passing this filter.
+type FairnessFilter struct {
+	mu  sync.Mutex
+	cfg *config.FairnessFilterConfig
+
+	windowStart   time.Time
+	globalCurrent int
+	globalPrev    int
+	current       map[string]int
+	previous      map[string]int
+}
+
+func NewFairnessFilter(cfg *config.FairnessFilterConfig) (*FairnessFilter, error) {
+	return &FairnessFilter{
+		cfg:         cfg,
+		windowStart: time.Now(),
+		current:     make(map[string]int),
+		previous:    make(map[string]int),
+	}, nil
+}
+
+func (f *FairnessFilter) Match(_ context.Context, event *nostr.Event, meta map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(fairnessFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	remoteIP, _ := meta["remote_ip"].(string)
+	if remoteIP == "" {
+		return newResult(true, "no_remote_ip", nil)
+	}
+	prefix := NormalizeIP(remoteIP, f.cfg.IPv4Prefix, f.cfg.IPv6Prefix)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	weight := f.rotate(now)
+
+	// Sliding-window estimates: the previous window is weighted by how much
+	// of it still overlaps the current one.
+	global := float64(f.globalPrev)*weight + float64(f.globalCurrent)
+	mine := float64(f.previous[prefix])*weight + float64(f.current[prefix])
+	globalRate := global / f.cfg.Window.Seconds()
+
+	if globalRate >= f.cfg.SaturationRate && global > 0 {
+		if share := mine / global; share >= f.cfg.MaxShare {
+			reason := fmt.Sprintf("fair_share_exceeded:share_%.2f,limit_%.2f", share, f.cfg.MaxShare)
+			return newResult(false, reason, nil)
+		}
+	}
+
+	f.globalCurrent++
+	f.current[prefix]++
+	return newResult(true, "fair_share_ok", nil)
+}
+
+// rotate advances the fixed windows and returns the weight of the previous one.
+func (f *FairnessFilter) rotate(now time.Time) float64 {
+	elapsed := now.Sub(f.windowStart)
+	switch {
+	case elapsed >= 2*f.cfg.Window:
+		f.previous, f.globalPrev = make(map[string]int), 0
+		f.current, f.globalCurrent = make(map[string]int), 0
+		f.windowStart = now
+		elapsed = 0
+	case elapsed >= f.cfg.Window:
+		f.previous, f.globalPrev = f.current, f.globalCurrent
+		f.current, f.globalCurrent = make(map[string]int), 0
+		f.windowStart = f.windowStart.Add(f.cfg.Window)
+		elapsed = now.Sub(f.windowStart)
+	}
+	return 1 - float64(elapsed)/float64(f.cfg.Window)
+}
+
+// Saturated reports whether the global event rate is at or above the
+// saturation threshold, i.e. whether per-prefix shares are being enforced.
+func (f *FairnessFilter) Saturated() bool {
+	if !f.cfg.Enabled {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	weight := f.rotate(time.Now())
+	global := float64(f.globalPrev)*weight + float64(f.globalCurrent)
+	return global > 0 && global/f.cfg.Window.Seconds() >= f.cfg.SaturationRate
+}
@@ -0,0 +1,116 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	fileSharingFilterName = "FileSharingFilter"
+)
+
+var magnetRe = regexp.MustCompile(`(?i)magnet:\?[^\s<>"']+`)
+
+// FileSharingFilter detects magnet links and links to configured file-locker
+// domains in content and tags. Magnet URIs are parsed rather than matched
+// with patterns, so parameter order and encoding do not matter.
+type FileSharingFilter struct {
+	cfg         *config.FileSharingFilterConfig
+	domains     map[string]struct{}
+	kindActions map[int]config.FilterAction
+}
+
+func NewFileSharingFilter(cfg *config.FileSharingFilterConfig) (*FileSharingFilter, error) {
+	f := &FileSharingFilter{
+		cfg:         cfg,
+		domains:     make(map[string]struct{}, len(cfg.Domains)),
+		kindActions: make(map[int]config.FilterAction),
+	}
+	if !cfg.Enabled {
+		return f, nil
+	}
+
+	for _, d := range cfg.Domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "*.")
+		if d == "" || strings.ContainsAny(d, "/: ") {
+			return nil, fmt.Errorf("invalid file sharing domain %q", d)
+		}
+		f.domains[d] = struct{}{}
+	}
+	for i, rule := range cfg.Rules {
+		if len(rule.Kinds) == 0 {
+			return nil, fmt.Errorf("file sharing rule #%d has no kinds", i)
+		}
+		for _, k := range rule.Kinds {
+			f.kindActions[k] = rule.Action
+		}
+	}
+	return f, nil
+}
+
+func (f *FileSharingFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(fileSharingFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+
+	action, ok := f.kindActions[event.Kind]
+	if !ok {
+		action = f.cfg.Action
+	}
+	if action == config.ActionAllow {
+		return newResult(true, "kind_allowed", nil)
+	}
+
+	texts := make([]string, 0, 1+len(event.Tags))
+	texts = append(texts, event.Content)
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 {
+			texts = append(texts, strings.Join(tag[1:], " "))
+		}
+	}
+
+	for _, text := range texts {
+		if f.cfg.BlockMagnetLinks {
+			if hash, found := findMagnet(text); found {
+				return ActionResult(newResult, action, fmt.Sprintf("magnet_link_found:'%s'", hash))
+			}
+		}
+		if len(f.domains) > 0 {
+			for _, host := range urlHosts(text) {
+				if domain, found := matchDomain(host, f.domains); found {
+					return ActionResult(newResult, action, fmt.Sprintf("file_sharing_domain_found:'%s'", domain))
+				}
+			}
+		}
+	}
+
+	return newResult(true, "no_file_sharing_links", nil)
+}
+
+// Independent reports that FileSharingFilter only inspects the event itself.
+func (f *FileSharingFilter) Independent() bool { return true }
+
+// findMagnet returns the exact topic (usually "urn:btih:<infohash>") of the
+// first magnet URI in text that has one.
+func findMagnet(text string) (string, bool) {
+	if !strings.Contains(strings.ToLower(text), "magnet:") {
+		return "", false
+	}
+	for _, m := range magnetRe.FindAllString(text, -1) {
+		// ParseQuery keeps the well-formed parameters even if others fail.
+		params, _ := url.ParseQuery(m[len("magnet:?"):])
+		if xt := params.Get("xt"); xt != "" {
+			return xt, true
+		}
+	}
+	return "", false
+}
@@ -63,14 +63,21 @@ func (f *FreshnessFilter) Match(_ context.Context, event *nostr.Event, meta map[
 	age := now.Sub(createdAt)
 	if maxPast > 0 && age > maxPast {
 		reason := fmt.Sprintf("event_too_old:age_%s,max_%s", age.Round(time.Second), maxPast)
-		return newResult(false, reason, nil)
+		res, err := newResult(false, reason, nil)
+		res.Values = map[string]any{"age": age.Round(time.Second), "max": maxPast}
+		return res, err
 	}
 
 	futureOffset := createdAt.Sub(now)
 	if maxFuture > 0 && futureOffset > maxFuture {
 		reason := fmt.Sprintf("event_in_future:offset_%s,max_%s", futureOffset.Round(time.Second), maxFuture)
-		return newResult(false, reason, nil)
+		res, err := newResult(false, reason, nil)
+		res.Values = map[string]any{"offset": futureOffset.Round(time.Second), "max": maxFuture}
+		return res, err
 	}
 
 	return newResult(true, "timestamp_ok", nil)
 }
+
+// Independent reports that FreshnessFilter only inspects the event itself.
+func (f *FreshnessFilter) Independent() bool { return true }
@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// AuthorHistory summarizes an author's past events on a relay, e.g. scanned
+// from its existing database, so stateful filters need not treat every
+// regular as an unknown newcomer after a fresh start.
+type AuthorHistory struct {
+	PubKey        string      `json:"pubkey"`
+	FirstSeen     time.Time   `json:"first_seen"`
+	LastSeen      time.Time   `json:"last_seen"`
+	Events        int         `json:"events"`
+	OriginalPosts int         `json:"original_posts"`
+	Reposts       int         `json:"reposts"`
+	Kinds         map[int]int `json:"kinds"`
+	// Interactions counts reactions and replies sent or received.
+	Interactions int `json:"interactions"`
+}
+
+// Primer is an optional interface for filters keeping per-author state that
+// can be seeded from history before the first event arrives.
+type Primer interface {
+	Prime(history []AuthorHistory)
+}
+
+// HistoryBuilder accumulates events into per-author histories.
+type HistoryBuilder struct {
+	authors map[string]*AuthorHistory
+}
+
+func NewHistoryBuilder() *HistoryBuilder {
+	return &HistoryBuilder{authors: make(map[string]*AuthorHistory)}
+}
+
+// Add accounts for one event.
+func (b *HistoryBuilder) Add(event *nostr.Event) {
+	h := b.author(event.PubKey)
+	at := event.CreatedAt.Time()
+	if h.FirstSeen.IsZero() || at.Before(h.FirstSeen) {
+		h.FirstSeen = at
+	}
+	if at.After(h.LastSeen) {
+		h.LastSeen = at
+	}
+	h.Events++
+	h.Kinds[event.Kind]++
+
+	switch {
+	case event.Kind == nostr.KindRepost || event.Kind == nostr.KindGenericRepost:
+		h.Reposts++
+	case event.Kind == nostr.KindTextNote && hasTag(event, "q") && contentHasNIP21Ref(event.Content):
+		h.Reposts++
+	case event.Kind == nostr.KindTextNote:
+		h.OriginalPosts++
+	}
+
+	if isInteraction(event) {
+		h.Interactions++
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "p" && tag[1] != event.PubKey {
+				b.author(tag[1]).Interactions++
+			}
+		}
+	}
+}
+
+// History returns the accumulated histories of authors with at least one
+// event, least recently active first, so priming a bounded cache keeps the
+// most recent authors.
+func (b *HistoryBuilder) History() []AuthorHistory {
+	history := make([]AuthorHistory, 0, len(b.authors))
+	for _, h := range b.authors {
+		if h.Events > 0 {
+			history = append(history, *h)
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if !history[i].LastSeen.Equal(history[j].LastSeen) {
+			return history[i].LastSeen.Before(history[j].LastSeen)
+		}
+		return history[i].PubKey < history[j].PubKey
+	})
+	return history
+}
+
+func (b *HistoryBuilder) author(pubkey string) *AuthorHistory {
+	h, ok := b.authors[pubkey]
+	if !ok {
+		h = &AuthorHistory{PubKey: pubkey, Kinds: make(map[int]int)}
+		b.authors[pubkey] = h
+	}
+	return h
+}
@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	inlineDataFilterName = "InlineDataFilter"
+)
+
+// defaultEncryptedKinds carry NIP-04/NIP-44 ciphertext, which is base64 by
+// design: DMs, seals, gift wraps and Nostr Connect messages.
+var defaultEncryptedKinds = []int{4, 13, 1059, 1060, 24133}
+
+var dataURIRe = regexp.MustCompile(`(?i)data:([a-z0-9.+-]+/[a-z0-9.+-]+)?((?:;[a-z0-9-]+(?:=[^;,\s]*)?)*),([^\s"'<>()]*)`)
+
+// InlineDataFilter catches binaries smuggled into relay storage as data: URIs
+// or long base64 runs in content and tag values, bypassing media policies.
+type InlineDataFilter struct {
+	cfg          *config.InlineDataFilterConfig
+	kinds        map[int]struct{}
+	allowedTypes map[string]struct{}
+}
+
+func NewInlineDataFilter(cfg *config.InlineDataFilterConfig) (*InlineDataFilter, error) {
+	f := &InlineDataFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	if len(cfg.Kinds) > 0 {
+		f.kinds = make(map[int]struct{}, len(cfg.Kinds))
+		for _, k := range cfg.Kinds {
+			f.kinds[k] = struct{}{}
+		}
+	}
+	if len(cfg.AllowedMediaTypes) > 0 {
+		f.allowedTypes = make(map[string]struct{}, len(cfg.AllowedMediaTypes))
+		for _, t := range cfg.AllowedMediaTypes {
+			f.allowedTypes[strings.ToLower(strings.TrimSpace(t))] = struct{}{}
+		}
+	}
+	return f, nil
+}
+
+func (f *InlineDataFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(inlineDataFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if f.kinds != nil {
+		if _, ok := f.kinds[event.Kind]; !ok {
+			return newResult(true, "kind_not_checked", nil)
+		}
+	} else if slices.Contains(defaultEncryptedKinds, event.Kind) {
+		return newResult(true, "encrypted_kind_skipped", nil)
+	}
+
+	texts := make([]string, 0, 1+len(event.Tags))
+	texts = append(texts, event.Content)
+	for _, tag := range event.Tags {
+		texts = append(texts, tag[min(1, len(tag)):]...)
+	}
+
+	for _, text := range texts {
+		if reason := f.inspect(text); reason != "" {
+			return ActionResult(newResult, f.cfg.Action, reason)
+		}
+	}
+	return newResult(true, "no_inline_data", nil)
+}
+
+// Independent reports that InlineDataFilter only inspects the event itself.
+func (f *InlineDataFilter) Independent() bool { return true }
+
+func (f *InlineDataFilter) inspect(text string) string {
+	if strings.Contains(strings.ToLower(text), "data:") {
+		for _, m := range dataURIRe.FindAllStringSubmatch(text, -1) {
+			mediaType := strings.ToLower(m[1])
+			if mediaType == "" {
+				mediaType = "text/plain"
+			}
+			size := len(m[3])
+			if strings.Contains(strings.ToLower(m[2]), ";base64") {
+				size = size * 3 / 4
+			}
+			if f.allowedTypes != nil {
+				if _, ok := f.allowedTypes[mediaType]; !ok {
+					return fmt.Sprintf("data_uri_media_type_denied:'%s'", mediaType)
+				}
+			}
+			if size > f.cfg.MaxDataURIBytes {
+				return fmt.Sprintf("data_uri_too_large:type_%s,size_%d,limit_%d", mediaType, size, f.cfg.MaxDataURIBytes)
+			}
+		}
+	}
+
+	if f.cfg.MaxBase64Bytes > 0 {
+		if size := longestBase64Run(text) * 3 / 4; size > f.cfg.MaxBase64Bytes {
+			return fmt.Sprintf("base64_blob_too_large:size_%d,limit_%d", size, f.cfg.MaxBase64Bytes)
+		}
+	}
+	return ""
+}
+
+// longestBase64Run returns the length of the longest run of base64 (standard
+// or URL-safe) characters that mixes upper case, lower case and digits, so
+// long words, hex IDs and bech32 strings are not mistaken for blobs.
+func longestBase64Run(text string) int {
+	longest := 0
+	start := -1
+	var upper, lower, digit bool
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) && isBase64Char(text[i]) {
+			if start < 0 {
+				start, upper, lower, digit = i, false, false, false
+			}
+			switch c := text[i]; {
+			case c >= 'A' && c <= 'Z':
+				upper = true
+			case c >= 'a' && c <= 'z':
+				lower = true
+			case c >= '0' && c <= '9':
+				digit = true
+			}
+			continue
+		}
+		if start >= 0 {
+			if upper && lower && digit {
+				longest = max(longest, i-start)
+			}
+			start = -1
+		}
+	}
+	return longest
+}
+
+func isBase64Char(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+		c == '+' || c == '/' || c == '=' || c == '-' || c == '_'
+}
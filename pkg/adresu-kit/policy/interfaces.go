@@ -2,9 +2,12 @@ package policy
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
 )
 
 // FilterResult is the structured return type for all filters.
@@ -13,6 +16,19 @@ type FilterResult struct {
 	Filter   string
 	Reason   string
 	Duration time.Duration
+	// Strike marks an allowed event as a violation anyway, so stateful
+	// consumers (e.g. autoban) can count it without rejecting the event.
+	Strike bool
+	// ShadowBan marks an allowed event for silent removal: the host accepts
+	// it, so its author is not tipped off, then deletes it. Hosts that cannot
+	// delete events simply accept it.
+	ShadowBan bool
+	// Warning is an optional non-fatal advisory for the author of an
+	// allowed event, e.g. that they are close to a limit.
+	Warning string
+	// Values are the computed details behind the decision (limits, current
+	// rates, retry-after seconds), exposed to customizable message templates.
+	Values map[string]any
 }
 
 // Filter is the interface that all kit filters must implement.
@@ -20,6 +36,39 @@ type Filter interface {
 	Match(ctx context.Context, ev *nostr.Event, meta map[string]any) (FilterResult, error)
 }
 
+// MetaKeyCountry and MetaKeyRegions are the meta keys under which a host may
+// share the origin of an event's source address: its country as an ISO 3166
+// code (string) and the operator-defined regions of that country
+// ([]string, lowercase).
+const (
+	MetaKeyCountry = "country"
+	MetaKeyRegions = "regions"
+)
+
+// MetaKeyOrigin, MetaKeyUserAgent, MetaKeyAuthPubKey and MetaKeyNIP05 are the
+// meta keys under which a host may share what its relay knows of the client
+// that submitted an event: the HTTP Origin and User-Agent headers of its
+// connection, the hex pubkey it authenticated as with NIP-42, and the
+// author's NIP-05 address as verified by the relay (all strings). strfry
+// provides none of them.
+const (
+	MetaKeyOrigin     = "origin"
+	MetaKeyUserAgent  = "user_agent"
+	MetaKeyAuthPubKey = "auth_pubkey"
+	MetaKeyNIP05      = "nip05"
+)
+
+// ErrFilterTimeout is wrapped by the errors of filters that gave up waiting
+// on a deadline, as opposed to failing outright.
+var ErrFilterTimeout = errors.New("filter timed out")
+
+// Independent is an optional interface for filters whose Match neither reads
+// nor writes state shared with other filters (including meta), so a pipeline
+// may evaluate them concurrently with their independent neighbours.
+type Independent interface {
+	Independent() bool
+}
+
 // NewResultFunc returns a helper function for creating FilterResult objects.
 func NewResultFunc(filterName string) func(allowed bool, reason string, err error) (FilterResult, error) {
 	start := time.Now()
@@ -32,3 +81,21 @@ func NewResultFunc(filterName string) func(allowed bool, reason string, err erro
 		}, err
 	}
 }
+
+// ActionResult turns a match into a result according to the configured action.
+func ActionResult(newResult func(bool, string, error) (FilterResult, error), action config.FilterAction, reason string) (FilterResult, error) {
+	switch action {
+	case config.ActionAllow:
+		return newResult(true, reason, nil)
+	case config.ActionStrike:
+		res, err := newResult(true, reason, nil)
+		res.Strike = true
+		return res, err
+	case config.ActionShadow:
+		res, err := newResult(true, reason, nil)
+		res.ShadowBan = true
+		return res, err
+	default:
+		return newResult(false, reason, nil)
+	}
+}
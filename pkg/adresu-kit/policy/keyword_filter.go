@@ -30,9 +30,24 @@ func NewKeywordFilter(cfg *config.KeywordFilterConfig) (*KeywordFilter, error) {
 		return &KeywordFilter{enabled: false}, nil
 	}
 
+	kindMap, err := compileKeywordRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &KeywordFilter{
+		enabled:     cfg.Enabled,
+		kindToRules: kindMap,
+	}
+
+	return filter, nil
+}
+
+// compileKeywordRules compiles rules, indexed by the kinds they apply to.
+func compileKeywordRules(rules []config.KeywordRule) (map[int][]compiledKeywordRule, error) {
 	kindMap := make(map[int][]compiledKeywordRule)
 
-	for _, rule := range cfg.Rules {
+	for _, rule := range rules {
 		// Compile simple words into case-insensitive whole-word regexes.
 		for _, word := range rule.Words {
 			compiled, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(word) + `\b`)
@@ -66,12 +81,7 @@ func NewKeywordFilter(cfg *config.KeywordFilterConfig) (*KeywordFilter, error) {
 		}
 	}
 
-	filter := &KeywordFilter{
-		enabled:     cfg.Enabled,
-		kindToRules: kindMap,
-	}
-
-	return filter, nil
+	return kindMap, nil
 }
 
 func (f *KeywordFilter) Match(_ context.Context, event *nostr.Event, meta map[string]any) (FilterResult, error) {
@@ -95,3 +105,6 @@ func (f *KeywordFilter) Match(_ context.Context, event *nostr.Event, meta map[st
 
 	return newResult(true, "no_forbidden_patterns_found", nil)
 }
+
+// Independent reports that KeywordFilter only inspects the event itself.
+func (f *KeywordFilter) Independent() bool { return true }
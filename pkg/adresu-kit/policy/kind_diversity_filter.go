@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+)
+
+const (
+	kindDiversityFilterName = "KindDiversityFilter"
+)
+
+// authorActivity counts an author's events since their first one in the
+// current window.
+type authorActivity struct {
+	Kind         int
+	Events       int
+	MixedKinds   bool
+	Interactions int // Reactions and replies sent or received.
+}
+
+// KindDiversityFilter flags authors posting a single kind at volume with no
+// reactions or replies sent or received, a common bot signature.
+type KindDiversityFilter struct {
+	mu       sync.Mutex
+	activity *lru.LRU[string, *authorActivity]
+	kinds    map[int]struct{}
+	cfg      *config.KindDiversityFilterConfig
+}
+
+func NewKindDiversityFilter(cfg *config.KindDiversityFilterConfig) (*KindDiversityFilter, error) {
+	f := &KindDiversityFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	// Entries are added once, so each window runs from an author's first event.
+	f.activity = lru.NewLRU[string, *authorActivity](cfg.CacheSize, nil, cfg.Window)
+	if len(cfg.Kinds) > 0 {
+		f.kinds = make(map[int]struct{}, len(cfg.Kinds))
+		for _, k := range cfg.Kinds {
+			f.kinds[k] = struct{}{}
+		}
+	}
+	return f, nil
+}
+
+// Prime seeds the activity of the authors in history. Their windows start
+// now, as the history does not say when each event fell.
+func (f *KindDiversityFilter) Prime(history []AuthorHistory) {
+	if f.activity == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, h := range history {
+		a := &authorActivity{Interactions: h.Interactions}
+		top, checkedKinds := 0, 0
+		for kind, n := range h.Kinds {
+			if f.kinds != nil {
+				if _, ok := f.kinds[kind]; !ok {
+					continue
+				}
+			}
+			checkedKinds++
+			a.Events += n
+			if n > top || (n == top && kind < a.Kind) {
+				top, a.Kind = n, kind
+			}
+		}
+		if a.Events == 0 && a.Interactions == 0 {
+			continue
+		}
+		a.MixedKinds = checkedKinds > 1
+		f.activity.Add(h.PubKey, a)
+	}
+}
+
+func (f *KindDiversityFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(kindDiversityFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+
+	interaction := isInteraction(event)
+	checked := true
+	if f.kinds != nil {
+		_, checked = f.kinds[event.Kind]
+	}
+	if !checked && !interaction {
+		return newResult(true, "kind_not_checked", nil)
+	}
+
+	f.mu.Lock()
+	if interaction {
+		// Credit the authors being reacted or replied to that are tracked.
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "p" && tag[1] != event.PubKey {
+				if a, ok := f.activity.Peek(tag[1]); ok {
+					a.Interactions++
+				}
+			}
+		}
+	}
+	a, ok := f.activity.Get(event.PubKey)
+	if !ok {
+		a = &authorActivity{Kind: event.Kind}
+		f.activity.Add(event.PubKey, a)
+	}
+	if interaction {
+		a.Interactions++
+	}
+	if checked {
+		a.Events++
+		if event.Kind != a.Kind {
+			a.MixedKinds = true
+		}
+	}
+	stats := *a
+	f.mu.Unlock()
+
+	if !checked {
+		return newResult(true, "kind_not_checked", nil)
+	}
+	if stats.MixedKinds || stats.Interactions > 0 || stats.Events <= f.cfg.MinEvents {
+		return newResult(true, "kind_diversity_ok", nil)
+	}
+
+	if f.cfg.PoWDifficulty > 0 && nip.IsPoWValid(event, f.cfg.PoWDifficulty) {
+		return newResult(true, "single_kind_volume_pow_ok", nil)
+	}
+	reason := fmt.Sprintf("single_kind_volume:kind_%d,events_%d", stats.Kind, stats.Events)
+	if f.cfg.PoWDifficulty > 0 {
+		reason += fmt.Sprintf(",pow_required_%d", f.cfg.PoWDifficulty)
+	}
+	res, err := ActionResult(newResult, f.cfg.Action, reason)
+	res.Values = map[string]any{"kind": stats.Kind, "events": stats.Events}
+	if f.cfg.PoWDifficulty > 0 {
+		res.Values["pow_difficulty"] = f.cfg.PoWDifficulty
+	}
+	return res, err
+}
+
+// isInteraction reports whether event is a reaction to or a reply to
+// another event.
+func isInteraction(event *nostr.Event) bool {
+	switch event.Kind {
+	case nostr.KindReaction, nostr.KindComment:
+		return true
+	case nostr.KindTextNote:
+		return event.Tags.Find("e") != nil
+	}
+	return false
+}
@@ -54,3 +54,6 @@ func (f *KindFilter) Match(_ context.Context, event *nostr.Event, meta map[strin
 
 	return newResult(true, "kind_allowed", nil)
 }
+
+// Independent reports that KindFilter only inspects the event itself.
+func (f *KindFilter) Independent() bool { return true }
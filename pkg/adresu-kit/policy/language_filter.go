@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/nbd-wtf/go-nostr"
@@ -19,6 +20,8 @@ import (
 var (
 	globalDetectorOnce  sync.Once
 	globalDetector      lingua.LanguageDetector
+	globalWarmupOnce    sync.Once
+	globalWarmup        *WarmingDetector
 	buildLookupOnce     sync.Once
 	languageLookupMap   map[string]lingua.Language
 	contentCleanerRegex *regexp.Regexp
@@ -26,6 +29,8 @@ var (
 
 const (
 	languageFilterName = "LanguageFilter"
+
+	defaultWarmupTimeout = 5 * time.Second
 )
 
 func init() {
@@ -34,32 +39,47 @@ func init() {
 }
 
 type LanguageFilter struct {
-	cfg               *config.LanguageFilterConfig
-	detector          lingua.LanguageDetector
-	allowedLangs      map[lingua.Language]struct{}
+	cfg          *config.LanguageFilterConfig
+	detector     lingua.LanguageDetector
+	warming      *WarmingDetector
+	allowedLangs map[lingua.Language]struct{}
+	// regionLangs replace allowedLangs for events from a country or region,
+	// keyed in lowercase.
+	regionLangs       map[string]map[lingua.Language]struct{}
 	allowedKinds      map[int]struct{}
 	approvedCache     *lru.LRU[string, struct{}]
+	trust             *languageTrust // Nil unless cfg.Trust is enabled.
 	thresholds        map[lingua.Language]map[lingua.Language]float64
 	defaultThresholds map[lingua.Language]float64
 }
 
 func NewLanguageFilter(cfg *config.LanguageFilterConfig, detector lingua.LanguageDetector) (*LanguageFilter, error) {
-	if !cfg.Enabled {
-		return &LanguageFilter{cfg: cfg}, nil
+	if cfg.Enabled && detector == nil {
+		return nil, errors.New("language filter enabled but detector is nil")
 	}
-	if detector == nil {
+	return newLanguageFilter(cfg, detector, nil)
+}
+
+// NewLanguageFilterWithWarmup creates a LanguageFilter whose detector may still
+// be loading. Until it is ready, events are handled per cfg.WarmupPolicy.
+func NewLanguageFilterWithWarmup(cfg *config.LanguageFilterConfig, warming *WarmingDetector) (*LanguageFilter, error) {
+	if cfg.Enabled && warming == nil {
 		return nil, errors.New("language filter enabled but detector is nil")
 	}
+	return newLanguageFilter(cfg, nil, warming)
+}
+
+func newLanguageFilter(cfg *config.LanguageFilterConfig, detector lingua.LanguageDetector, warming *WarmingDetector) (*LanguageFilter, error) {
+	if !cfg.Enabled {
+		return &LanguageFilter{cfg: cfg}, nil
+	}
 
 	buildLookupOnce.Do(buildLanguageLookupMap)
 
-	allowedMap := make(map[lingua.Language]struct{}, len(cfg.AllowedLanguages))
-	for _, langStr := range cfg.AllowedLanguages {
-		if lang, ok := languageLookupMap[strings.ToLower(langStr)]; ok {
-			allowedMap[lang] = struct{}{}
-		} else {
-			slog.Warn("LanguageFilter config warning: unsupported language name or ISO code in config; ignored", "value", langStr)
-		}
+	allowedMap := languageSet(cfg.AllowedLanguages)
+	regionLangs := make(map[string]map[lingua.Language]struct{}, len(cfg.RegionLanguages))
+	for origin, langs := range cfg.RegionLanguages {
+		regionLangs[strings.ToLower(origin)] = languageSet(langs)
 	}
 
 	allowedKinds := make(map[int]struct{}, len(cfg.KindsToCheck))
@@ -93,12 +113,20 @@ func NewLanguageFilter(cfg *config.LanguageFilterConfig, detector lingua.Languag
 		cache = lru.NewLRU[string, struct{}](cfg.ApprovedCacheSize, nil, cfg.ApprovedCacheTTL)
 	}
 
+	var trust *languageTrust
+	if cfg.Trust.Enabled {
+		trust = newLanguageTrust(cfg.Trust)
+	}
+
 	filter := &LanguageFilter{
 		cfg:               cfg,
 		detector:          detector,
+		warming:           warming,
 		allowedLangs:      allowedMap,
+		regionLangs:       regionLangs,
 		allowedKinds:      allowedKinds,
 		approvedCache:     cache,
+		trust:             trust,
 		thresholds:        thresholds,
 		defaultThresholds: defaultThresholds,
 	}
@@ -106,7 +134,7 @@ func NewLanguageFilter(cfg *config.LanguageFilterConfig, detector lingua.Languag
 	return filter, nil
 }
 
-func (f *LanguageFilter) Match(_ context.Context, event *nostr.Event, meta map[string]any) (FilterResult, error) {
+func (f *LanguageFilter) Match(ctx context.Context, event *nostr.Event, meta map[string]any) (FilterResult, error) {
 	newResult := NewResultFunc(languageFilterName)
 
 	if !f.cfg.Enabled || len(f.allowedLangs) == 0 {
@@ -115,6 +143,19 @@ func (f *LanguageFilter) Match(_ context.Context, event *nostr.Event, meta map[s
 	if _, ok := f.allowedKinds[event.Kind]; !ok {
 		return newResult(true, "kind_not_checked", nil)
 	}
+	now := time.Now()
+	if f.trust != nil {
+		mutedUntil, bilingual := f.trust.state(event.PubKey, now)
+		if !mutedUntil.IsZero() {
+			until := mutedUntil.UTC().Format(time.RFC3339)
+			res, err := newResult(false, "author_muted_for_language:until_"+until, nil)
+			res.Values = map[string]any{"muted_until": until}
+			return res, err
+		}
+		if bilingual {
+			return newResult(true, "pubkey_trusted_bilingual", nil)
+		}
+	}
 	if f.cfg.MinLengthForCheck > 0 && len(event.Content) < f.cfg.MinLengthForCheck {
 		return newResult(true, "content_too_short", nil)
 	}
@@ -129,16 +170,30 @@ func (f *LanguageFilter) Match(_ context.Context, event *nostr.Event, meta map[s
 		return newResult(true, "cleaned_content_too_short", nil)
 	}
 
-	detectedLang, detected := f.detector.DetectLanguageOf(cleanedContent)
+	detector := f.detector
+	if detector == nil {
+		var reason string
+		if detector, reason = f.waitForDetector(ctx); detector == nil {
+			return newResult(true, reason, nil)
+		}
+	}
+
+	detectedLang, detected := detector.DetectLanguageOf(cleanedContent)
 	if !detected {
 		return newResult(false, "language_undetectable", nil)
 	}
 
 	langCode := detectedLang.IsoCode639_1().String()
-	if _, isAllowed := f.allowedLangs[detectedLang]; isAllowed {
-		if f.approvedCache != nil {
-			f.approvedCache.Add(event.PubKey, struct{}{})
+	if origin, langs := f.originLanguages(meta); langs != nil {
+		// Approvals are not cached, as they only hold for this origin.
+		if _, isAllowed := langs[detectedLang]; isAllowed {
+			if meta != nil {
+				meta["language"] = langCode
+			}
+			return newResult(true, fmt.Sprintf("language_allowed_for_origin:'%s',origin_%s", langCode, origin), nil)
 		}
+	} else if _, isAllowed := f.allowedLangs[detectedLang]; isAllowed {
+		f.approve(event.PubKey, now)
 		if meta != nil {
 			meta["language"] = langCode
 		}
@@ -151,10 +206,8 @@ func (f *LanguageFilter) Match(_ context.Context, event *nostr.Event, meta map[s
 			threshold, hasRule = f.defaultThresholds[primaryLang]
 		}
 		if hasRule {
-			if confidence := f.detector.ComputeLanguageConfidence(cleanedContent, primaryLang); confidence > threshold {
-				if f.approvedCache != nil {
-					f.approvedCache.Add(event.PubKey, struct{}{})
-				}
+			if confidence := detector.ComputeLanguageConfidence(cleanedContent, primaryLang); confidence > threshold {
+				f.approve(event.PubKey, now)
 				if meta != nil {
 					meta["language"] = langCode
 				}
@@ -164,7 +217,118 @@ func (f *LanguageFilter) Match(_ context.Context, event *nostr.Event, meta map[s
 		}
 	}
 
-	return newResult(false, fmt.Sprintf("language_not_allowed:'%s'", langCode), nil)
+	if f.trust != nil {
+		if mutedUntil := f.trust.rejected(event.PubKey, now); !mutedUntil.IsZero() {
+			until := mutedUntil.UTC().Format(time.RFC3339)
+			res, err := newResult(false, fmt.Sprintf("language_not_allowed:'%s',author_muted_until_%s", langCode, until), nil)
+			res.Values = map[string]any{"language": langCode, "muted_until": until}
+			return res, err
+		}
+	}
+	res, err := newResult(false, fmt.Sprintf("language_not_allowed:'%s'", langCode), nil)
+	res.Values = map[string]any{"language": langCode}
+	return res, err
+}
+
+// originLanguages returns the languages allowed for the country or, failing
+// that, the first region in meta with an override, or nil if none has one.
+func (f *LanguageFilter) originLanguages(meta map[string]any) (string, map[lingua.Language]struct{}) {
+	if len(f.regionLangs) == 0 {
+		return "", nil
+	}
+	if country, _ := meta[MetaKeyCountry].(string); country != "" {
+		if langs, ok := f.regionLangs[strings.ToLower(country)]; ok {
+			return strings.ToLower(country), langs
+		}
+	}
+	regions, _ := meta[MetaKeyRegions].([]string)
+	for _, region := range regions {
+		if langs, ok := f.regionLangs[region]; ok {
+			return region, langs
+		}
+	}
+	return "", nil
+}
+
+// languageSet resolves language names or ISO codes, warning about unknown ones.
+func languageSet(names []string) map[lingua.Language]struct{} {
+	set := make(map[lingua.Language]struct{}, len(names))
+	for _, langStr := range names {
+		if lang, ok := languageLookupMap[strings.ToLower(langStr)]; ok {
+			set[lang] = struct{}{}
+		} else {
+			slog.Warn("LanguageFilter config warning: unsupported language name or ISO code in config; ignored", "value", langStr)
+		}
+	}
+	return set
+}
+
+// approve records that pubkey posted in an allowed language.
+func (f *LanguageFilter) approve(pubkey string, now time.Time) {
+	if f.approvedCache != nil {
+		f.approvedCache.Add(pubkey, struct{}{})
+	}
+	if f.trust != nil {
+		f.trust.passed(pubkey, now)
+	}
+}
+
+// waitForDetector returns the warming detector once it is ready. Depending on
+// the warm-up policy it gives up at once or after the warm-up timeout, and
+// returns the reason for accepting the event unchecked.
+func (f *LanguageFilter) waitForDetector(ctx context.Context) (lingua.LanguageDetector, string) {
+	if d := f.warming.Detector(); d != nil {
+		return d, ""
+	}
+	if f.cfg.WarmupPolicy != config.WarmupQueue {
+		return nil, "detector_warming_up"
+	}
+
+	timeout := f.cfg.WarmupTimeout
+	if timeout <= 0 {
+		timeout = defaultWarmupTimeout
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	select {
+	case <-f.warming.ready:
+		return f.warming.Detector(), ""
+	case <-waitCtx.Done():
+		return nil, "detector_warmup_timeout"
+	}
+}
+
+// WarmingDetector loads the global detector in the background, so language
+// models can build while events are already flowing.
+type WarmingDetector struct {
+	ready    chan struct{}
+	detector lingua.LanguageDetector
+}
+
+// WarmGlobalDetector starts loading the global detector in the background and
+// returns immediately. Repeated calls share the same warm-up.
+func WarmGlobalDetector() *WarmingDetector {
+	globalWarmupOnce.Do(func() {
+		w := &WarmingDetector{ready: make(chan struct{})}
+		go func() {
+			start := time.Now()
+			w.detector = GetGlobalDetector()
+			close(w.ready)
+			slog.Info("Language detector ready", "took", time.Since(start))
+		}()
+		globalWarmup = w
+	})
+	return globalWarmup
+}
+
+// Detector returns the detector, or nil if it is still loading.
+func (w *WarmingDetector) Detector() lingua.LanguageDetector {
+	select {
+	case <-w.ready:
+		return w.detector
+	default:
+		return nil
+	}
 }
 
 func GetGlobalDetector() lingua.LanguageDetector {
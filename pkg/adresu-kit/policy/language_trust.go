@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	defaultTrustCacheSize       = 65536
+	defaultTrustRejectionWindow = time.Hour
+	defaultTrustMuteDuration    = time.Hour
+	defaultTrustBilingualTTL    = 7 * 24 * time.Hour
+)
+
+// authorTrust is the language history of one author.
+type authorTrust struct {
+	rejections     int
+	windowStart    time.Time
+	mutedUntil     time.Time
+	passes         int
+	bilingualUntil time.Time
+}
+
+// languageTrust remembers authors who repeatedly post in disallowed languages
+// (negative cache, escalating to a mute) and authors who reliably post in
+// allowed ones (bilingual flag, skipping detection).
+type languageTrust struct {
+	cfg     config.LanguageTrustConfig
+	mu      sync.Mutex
+	authors *lru.LRU[string, *authorTrust]
+}
+
+func newLanguageTrust(cfg config.LanguageTrustConfig) *languageTrust {
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = defaultTrustCacheSize
+	}
+	if cfg.RejectionWindow <= 0 {
+		cfg.RejectionWindow = defaultTrustRejectionWindow
+	}
+	if cfg.MuteDuration <= 0 {
+		cfg.MuteDuration = defaultTrustMuteDuration
+	}
+	if cfg.BilingualTTL <= 0 {
+		cfg.BilingualTTL = defaultTrustBilingualTTL
+	}
+	// Entries outlive the longest state they hold; each update refreshes them.
+	ttl := max(cfg.RejectionWindow, cfg.MuteDuration, cfg.BilingualTTL)
+	return &languageTrust{cfg: cfg, authors: lru.NewLRU[string, *authorTrust](cfg.CacheSize, nil, ttl)}
+}
+
+// state reports whether pubkey is muted (and until when) or flagged bilingual.
+func (t *languageTrust) state(pubkey string, now time.Time) (mutedUntil time.Time, bilingual bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.authors.Peek(pubkey)
+	if !ok {
+		return time.Time{}, false
+	}
+	if now.Before(a.mutedUntil) {
+		return a.mutedUntil, false
+	}
+	return time.Time{}, now.Before(a.bilingualUntil)
+}
+
+// passed records a post in an allowed language.
+func (t *languageTrust) passed(pubkey string, now time.Time) {
+	if t.cfg.BilingualAfter <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a := t.get(pubkey)
+	a.passes++
+	if a.passes >= t.cfg.BilingualAfter {
+		a.passes = 0
+		a.bilingualUntil = now.Add(t.cfg.BilingualTTL)
+	}
+	t.authors.Add(pubkey, a)
+}
+
+// rejected records a post in a disallowed language and returns the end of
+// the mute it triggered, if any.
+func (t *languageTrust) rejected(pubkey string, now time.Time) time.Time {
+	if t.cfg.MuteAfter <= 0 {
+		return time.Time{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a := t.get(pubkey)
+	if now.Sub(a.windowStart) > t.cfg.RejectionWindow {
+		a.rejections, a.windowStart = 0, now
+	}
+	a.rejections++
+	var until time.Time
+	if a.rejections >= t.cfg.MuteAfter {
+		a.rejections = 0
+		a.mutedUntil = now.Add(t.cfg.MuteDuration)
+		until = a.mutedUntil
+	}
+	t.authors.Add(pubkey, a)
+	return until
+}
+
+func (t *languageTrust) get(pubkey string) *authorTrust {
+	if a, ok := t.authors.Peek(pubkey); ok {
+		return a
+	}
+	return &authorTrust{}
+}
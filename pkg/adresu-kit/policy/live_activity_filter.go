@@ -0,0 +1,177 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/nbd-wtf/go-nostr"
+	"golang.org/x/time/rate"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	liveActivityFilterName = "LiveActivityFilter"
+
+	kindLiveEvent = 30311
+	kindLiveChat  = 1311
+)
+
+var defaultExemptRoles = []string{"host", "moderator"}
+
+// LiveActivityFilter applies NIP-53 specific limits. It remembers live events
+// (kind 30311) passing through the relay and rate limits live chat (kind 1311)
+// per stream and per chatter, exempting the stream's hosts and moderators.
+type LiveActivityFilter struct {
+	cfg         *config.LiveActivityFilterConfig
+	exemptRoles []string
+
+	mu       sync.Mutex
+	streams  *lru.LRU[string, *liveStream]
+	limiters *lru.LRU[string, *rate.Limiter]
+}
+
+type liveStream struct {
+	createdAt nostr.Timestamp
+	ended     bool
+	exempt    map[string]struct{}
+}
+
+func NewLiveActivityFilter(cfg *config.LiveActivityFilterConfig) (*LiveActivityFilter, error) {
+	if !cfg.Enabled {
+		return &LiveActivityFilter{cfg: cfg}, nil
+	}
+
+	size := cfg.CacheSize
+	if size <= 0 {
+		size = 10000
+	}
+	ttl := cfg.StreamTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	roles := defaultExemptRoles
+	if len(cfg.ExemptRoles) > 0 {
+		roles = make([]string, len(cfg.ExemptRoles))
+		for i, r := range cfg.ExemptRoles {
+			roles[i] = strings.ToLower(r)
+		}
+	}
+
+	return &LiveActivityFilter{
+		cfg:         cfg,
+		exemptRoles: roles,
+		streams:     lru.NewLRU[string, *liveStream](size, nil, ttl),
+		limiters:    lru.NewLRU[string, *rate.Limiter](size, nil, 15*time.Minute),
+	}, nil
+}
+
+func (f *LiveActivityFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(liveActivityFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+
+	switch event.Kind {
+	case kindLiveEvent:
+		return f.matchLiveEvent(event, newResult)
+	case kindLiveChat:
+		return f.matchLiveChat(event, newResult)
+	}
+	return newResult(true, "kind_not_matched", nil)
+}
+
+func (f *LiveActivityFilter) matchLiveEvent(event *nostr.Event, newResult func(bool, string, error) (FilterResult, error)) (FilterResult, error) {
+	d := event.Tags.GetD()
+	if d == "" {
+		return newResult(false, "live_event_missing_d_tag", nil)
+	}
+	addr := fmt.Sprintf("%d:%s:%s", kindLiveEvent, event.PubKey, d)
+
+	stream := &liveStream{
+		createdAt: event.CreatedAt,
+		exempt:    map[string]struct{}{event.PubKey: {}},
+	}
+	for _, tag := range event.Tags {
+		switch {
+		case len(tag) >= 2 && tag[0] == "status":
+			stream.ended = tag[1] == "ended"
+		case len(tag) >= 4 && tag[0] == "p" && slices.Contains(f.exemptRoles, strings.ToLower(tag[3])):
+			stream.exempt[strings.ToLower(tag[1])] = struct{}{}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Live events are replaceable; an older version must not undo a newer one.
+	if prev, ok := f.streams.Peek(addr); ok && prev.createdAt > event.CreatedAt {
+		return newResult(true, "live_event_outdated", nil)
+	}
+	f.streams.Add(addr, stream)
+	return newResult(true, "live_event_recorded", nil)
+}
+
+func (f *LiveActivityFilter) matchLiveChat(event *nostr.Event, newResult func(bool, string, error) (FilterResult, error)) (FilterResult, error) {
+	addr := ""
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "a" && strings.HasPrefix(tag[1], fmt.Sprintf("%d:", kindLiveEvent)) {
+			addr = tag[1]
+			break
+		}
+	}
+	if addr == "" {
+		return newResult(false, "live_chat_missing_stream_reference", nil)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stream, known := f.streams.Get(addr)
+	if !known {
+		if f.cfg.RequireKnownStream {
+			return newResult(false, "live_chat_unknown_stream", nil)
+		}
+	} else {
+		if _, ok := stream.exempt[event.PubKey]; ok {
+			return newResult(true, "live_chat_exempt_participant", nil)
+		}
+		if stream.ended && f.cfg.RejectEndedStreams {
+			return newResult(false, "live_chat_stream_ended", nil)
+		}
+	}
+
+	// The chatter's own limit is checked first, so a flooding chatter does
+	// not use up the stream's shared budget.
+	if f.cfg.ChatRate > 0 {
+		if !f.limiter("chat:"+addr+":"+event.PubKey, f.cfg.ChatRate, f.cfg.ChatBurst).Allow() {
+			reason := fmt.Sprintf("live_chat_rate_exceeded:rate_%.2f/s", f.cfg.ChatRate)
+			res, err := newResult(false, reason, nil)
+			res.Values = map[string]any{"rate": f.cfg.ChatRate, "burst": f.cfg.ChatBurst}
+			return res, err
+		}
+	}
+	if f.cfg.StreamRate > 0 {
+		if !f.limiter("stream:"+addr, f.cfg.StreamRate, f.cfg.StreamBurst).Allow() {
+			reason := fmt.Sprintf("live_stream_cap_exceeded:rate_%.2f/s", f.cfg.StreamRate)
+			res, err := newResult(false, reason, nil)
+			res.Values = map[string]any{"rate": f.cfg.StreamRate, "burst": f.cfg.StreamBurst}
+			return res, err
+		}
+	}
+	return newResult(true, "live_chat_ok", nil)
+}
+
+func (f *LiveActivityFilter) limiter(key string, r float64, burst int) *rate.Limiter {
+	if limiter, ok := f.limiters.Get(key); ok {
+		return limiter
+	}
+	limiter := rate.NewLimiter(rate.Limit(r), max(burst, 1))
+	f.limiters.Add(key, limiter)
+	return limiter
+}
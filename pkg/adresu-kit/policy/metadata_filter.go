@@ -0,0 +1,143 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	metadataFilterName = "MetadataFilter"
+)
+
+// MetadataFilter checks kind 0 profiles, whose spam the keyword rules aimed at
+// notes would otherwise miss: the content must be a JSON object, its text
+// fields must fit their limits, data: URI avatars must be small and, if set
+// up, its name and about must not match keyword rules.
+type MetadataFilter struct {
+	cfg   *config.MetadataFilterConfig
+	rules []compiledKeywordRule
+}
+
+// NewMetadataFilter returns a MetadataFilter taking the rules of
+// cfg.KeywordKinds from keywords, whether KeywordFilter is enabled or not.
+func NewMetadataFilter(cfg *config.MetadataFilterConfig, keywords *config.KeywordFilterConfig) (*MetadataFilter, error) {
+	f := &MetadataFilter{cfg: cfg}
+	if !cfg.Enabled || len(cfg.KeywordKinds) == 0 {
+		return f, nil
+	}
+	kindMap, err := compileKeywordRules(keywords.Rules)
+	if err != nil {
+		return nil, err
+	}
+	// Rules listing several of the kinds share their regex.
+	seen := make(map[*regexp.Regexp]struct{})
+	for _, kind := range cfg.KeywordKinds {
+		for _, rule := range kindMap[kind] {
+			if _, ok := seen[rule.regex]; !ok {
+				seen[rule.regex] = struct{}{}
+				f.rules = append(f.rules, rule)
+			}
+		}
+	}
+	return f, nil
+}
+
+func (f *MetadataFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(metadataFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if event.Kind != nostr.KindProfileMetadata {
+		return newResult(true, "not_metadata", nil)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(event.Content), &fields); err != nil || fields == nil {
+		return ActionResult(newResult, f.cfg.Action, "invalid_metadata_json")
+	}
+
+	limits := []struct {
+		field string
+		max   int
+	}{
+		{"name", f.cfg.MaxNameLength},
+		{"display_name", f.cfg.MaxNameLength},
+		{"about", f.cfg.MaxAboutLength},
+		{"picture", f.cfg.MaxURLLength},
+		{"banner", f.cfg.MaxURLLength},
+	}
+	text := make(map[string]string, len(limits))
+	for _, l := range limits {
+		v, ok := fields[l.field]
+		if !ok || v == nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return ActionResult(newResult, f.cfg.Action, fmt.Sprintf("metadata_field_not_string:'%s'", l.field))
+		}
+		text[l.field] = s
+
+		if (l.field == "picture" || l.field == "banner") && hasDataURIPrefix(s) {
+			size, ok := dataURISize(s)
+			if !ok {
+				return ActionResult(newResult, f.cfg.Action, fmt.Sprintf("invalid_data_uri:'%s'", l.field))
+			}
+			if size > f.cfg.MaxDataURIBytes {
+				res, err := ActionResult(newResult, f.cfg.Action,
+					fmt.Sprintf("data_uri_%s_too_large:size_%d,limit_%d", l.field, size, f.cfg.MaxDataURIBytes))
+				res.Values = map[string]any{"field": l.field, "size": size, "max": f.cfg.MaxDataURIBytes}
+				return res, err
+			}
+			continue
+		}
+		if length := utf8.RuneCountInString(s); l.max > 0 && length > l.max {
+			res, err := ActionResult(newResult, f.cfg.Action,
+				fmt.Sprintf("metadata_field_too_long:field_%s,length_%d,limit_%d", l.field, length, l.max))
+			res.Values = map[string]any{"field": l.field, "length": length, "max": l.max}
+			return res, err
+		}
+	}
+
+	for _, rule := range f.rules {
+		for _, field := range []string{"name", "display_name", "about"} {
+			if rule.regex.MatchString(text[field]) {
+				res, err := ActionResult(newResult, f.cfg.Action,
+					fmt.Sprintf("forbidden_pattern_found:field_%s,'%s'", field, rule.source))
+				res.Values = map[string]any{"field": field}
+				return res, err
+			}
+		}
+	}
+
+	return newResult(true, "metadata_ok", nil)
+}
+
+// Independent reports that MetadataFilter only inspects the event itself.
+func (f *MetadataFilter) Independent() bool { return true }
+
+func hasDataURIPrefix(s string) bool {
+	return len(s) >= 5 && strings.EqualFold(s[:5], "data:")
+}
+
+// dataURISize returns the decoded size of the data: URI s, or false if it has
+// no data part.
+func dataURISize(s string) (int, bool) {
+	params, data, ok := strings.Cut(s[5:], ",")
+	if !ok {
+		return 0, false
+	}
+	if strings.Contains(strings.ToLower(params), ";base64") {
+		return len(data) * 3 / 4, true
+	}
+	return len(data), true
+}
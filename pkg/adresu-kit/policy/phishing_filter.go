@@ -0,0 +1,219 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/nbd-wtf/go-nostr"
+	"golang.org/x/net/idna"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	phishingFilterName = "PhishingFilter"
+
+	defaultMaxEditDistance = 1
+)
+
+var defaultProtectedDomains = []string{
+	"primal.net", "damus.io", "snort.social", "iris.to", "coracle.social",
+	"nostrudel.ninja", "nostr.band", "njump.me", "getalby.com", "zeusln.com",
+	"walletofsatoshi.com", "strike.me", "mempool.space", "blockstream.info",
+	"bitcoin.org", "coinbase.com", "kraken.com", "binance.com",
+}
+
+// confusables maps characters commonly used in homograph attacks to the
+// ASCII letter they imitate.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd',
+	'һ': 'h', 'ӏ': 'l', 'ԛ': 'q', 'ԝ': 'w',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x',
+	// Latin look-alikes and digits
+	'ı': 'i', 'ɑ': 'a', 'ɡ': 'g', 'ℓ': 'l', '0': 'o', '1': 'l',
+}
+
+// PhishingFilter flags links to internationalized (punycode) domains that
+// imitate a protected service through homoglyphs, and ASCII domains within a
+// small edit distance of one. It complements plain domain deny lists, which
+// cannot anticipate every lookalike.
+type PhishingFilter struct {
+	cfg         *config.PhishingFilterConfig
+	kinds       map[int]struct{}
+	protected   map[string]struct{}
+	allowed     map[string]struct{}
+	maxDistance int
+}
+
+func NewPhishingFilter(cfg *config.PhishingFilterConfig) (*PhishingFilter, error) {
+	f := &PhishingFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+
+	protected := cfg.ProtectedDomains
+	if len(protected) == 0 {
+		protected = defaultProtectedDomains
+	}
+	var err error
+	if f.protected, err = domainSet(protected); err != nil {
+		return nil, fmt.Errorf("protected_domains: %w", err)
+	}
+	if f.allowed, err = domainSet(cfg.AllowedDomains); err != nil {
+		return nil, fmt.Errorf("allowed_domains: %w", err)
+	}
+	if len(cfg.Kinds) > 0 {
+		f.kinds = make(map[int]struct{}, len(cfg.Kinds))
+		for _, k := range cfg.Kinds {
+			f.kinds[k] = struct{}{}
+		}
+	}
+	f.maxDistance = cfg.MaxEditDistance
+	if f.maxDistance <= 0 {
+		f.maxDistance = defaultMaxEditDistance
+	}
+	return f, nil
+}
+
+func (f *PhishingFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(phishingFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if f.kinds != nil {
+		if _, ok := f.kinds[event.Kind]; !ok {
+			return newResult(true, "kind_not_checked", nil)
+		}
+	}
+
+	for _, host := range urlHosts(event.Content) {
+		if reason := f.inspect(host); reason != "" {
+			return ActionResult(newResult, f.cfg.Action, reason)
+		}
+	}
+	return newResult(true, "no_suspicious_domains", nil)
+}
+
+// Independent reports that PhishingFilter only inspects the event itself.
+func (f *PhishingFilter) Independent() bool { return true }
+
+// inspect returns a rejection reason for a suspicious host, or "".
+func (f *PhishingFilter) inspect(host string) string {
+	if _, ok := matchDomain(host, f.allowed); ok {
+		return ""
+	}
+	if _, ok := matchDomain(host, f.protected); ok {
+		return ""
+	}
+
+	unicodeHost, err := idna.ToUnicode(host)
+	if err != nil {
+		unicodeHost = host
+	}
+	isIDN := strings.ContainsFunc(unicodeHost, func(r rune) bool { return r > unicode.MaxASCII })
+	skeleton := domainSkeleton(unicodeHost)
+
+	if isIDN {
+		if target, ok := matchDomain(skeleton, f.protected); ok {
+			return fmt.Sprintf("homograph_domain:'%s',imitates_'%s'", host, target)
+		}
+		if f.cfg.FlagMixedScript && isMixedScript(unicodeHost) {
+			return fmt.Sprintf("mixed_script_domain:'%s'", host)
+		}
+	}
+
+	base := registrableDomain(skeleton)
+	for target := range f.protected {
+		// The host itself is not protected, so even distance 0 means the
+		// skeleton matched only after undoing character substitutions.
+		if levenshtein(base, domainSkeleton(target)) <= f.maxDistance {
+			return fmt.Sprintf("lookalike_domain:'%s',imitates_'%s'", host, target)
+		}
+		// "primal.net.account-verify.example" borrows the protected name.
+		if strings.HasPrefix(skeleton, target+".") || strings.Contains(skeleton, "."+target+".") {
+			return fmt.Sprintf("embedded_protected_domain:'%s',imitates_'%s'", host, target)
+		}
+	}
+	return ""
+}
+
+func domainSet(domains []string) (map[string]struct{}, error) {
+	set := make(map[string]struct{}, len(domains))
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "*.")
+		if d == "" || strings.ContainsAny(d, "/: ") {
+			return nil, fmt.Errorf("invalid domain %q", d)
+		}
+		set[d] = struct{}{}
+	}
+	return set, nil
+}
+
+// domainSkeleton replaces confusable characters with the ASCII letters they
+// imitate, so "ԁаmus.io" and "damus.io" compare equal.
+func domainSkeleton(host string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(host) {
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+	return strings.NewReplacer("rn", "m", "vv", "w").Replace(b.String())
+}
+
+// registrableDomain approximates the registrable part of host as its last two
+// labels, which is sufficient for comparing against protected domains.
+func registrableDomain(host string) string {
+	labels := strings.Split(host, ".")
+	if len(labels) <= 2 {
+		return host
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// isMixedScript reports whether any label combines letters from more than one
+// script, the hallmark of homograph domains.
+func isMixedScript(host string) bool {
+	scripts := []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Greek, unicode.Armenian}
+	for _, label := range strings.Split(host, ".") {
+		seen := 0
+		for _, table := range scripts {
+			if strings.ContainsFunc(label, func(r rune) bool { return unicode.Is(table, r) }) {
+				seen++
+			}
+		}
+		if seen > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
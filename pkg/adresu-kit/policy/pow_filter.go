@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+)
+
+const (
+	powFilterName = "PoWFilter"
+)
+
+// PoWFilter requires a minimum NIP-13 proof of work per kind.
+type PoWFilter struct {
+	cfg         *config.PoWFilterConfig
+	rulesByKind map[int]int
+}
+
+func NewPoWFilter(cfg *config.PoWFilterConfig) (*PoWFilter, error) {
+	rulesByKind := make(map[int]int)
+	for _, rule := range cfg.Rules {
+		for _, kind := range rule.Kinds {
+			rulesByKind[kind] = rule.MinDifficulty
+		}
+	}
+	return &PoWFilter{cfg: cfg, rulesByKind: rulesByKind}, nil
+}
+
+func (f *PoWFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(powFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+
+	required := f.cfg.DefaultMinDifficulty
+	if minDifficulty, ok := f.rulesByKind[event.Kind]; ok {
+		required = minDifficulty
+	}
+	if required <= 0 {
+		return newResult(true, "pow_not_required", nil)
+	}
+
+	if !nip.IsPoWValid(event, required) {
+		difficulty := committedDifficulty(event)
+		reason := fmt.Sprintf("pow_insufficient:difficulty_%d,required_%d", difficulty, required)
+		res, err := newResult(false, reason, nil)
+		res.Values = map[string]any{"difficulty": difficulty, "required": required}
+		return res, err
+	}
+	return newResult(true, "pow_ok", nil)
+}
+
+func (f *PoWFilter) Independent() bool { return true }
+
+// committedDifficulty is the proof of work an event counts for under NIP-13:
+// its leading zero bits, but no more than the target its nonce tag commits to.
+func committedDifficulty(event *nostr.Event) int {
+	nonceTag := event.Tags.FindLast("nonce")
+	if len(nonceTag) < 3 {
+		return 0
+	}
+	target, err := strconv.Atoi(strings.TrimSpace(nonceTag[2]))
+	if err != nil {
+		return 0
+	}
+	return max(0, min(target, nip.CountLeadingZeroBits(event.ID)))
+}
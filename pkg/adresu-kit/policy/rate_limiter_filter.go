@@ -2,7 +2,9 @@ package policy
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"time"
 
@@ -26,6 +28,10 @@ type RateLimiterFilter struct {
 	cfg        *config.RateLimiterConfig
 	limiters   *lru.LRU[string, *rate.Limiter]
 	kindToRule map[int]processedRateRule
+
+	// threadRoots maps recent text note IDs to their authors, so replies
+	// inside an author's own thread can be recognized cheaply.
+	threadRoots *lru.LRU[string, string]
 }
 
 func NewRateLimiterFilter(cfg *config.RateLimiterConfig) (*RateLimiterFilter, error) {
@@ -59,6 +65,18 @@ func NewRateLimiterFilter(cfg *config.RateLimiterConfig) (*RateLimiterFilter, er
 		kindToRule: kindMap,
 	}
 
+	if cfg.ThreadReplies.Enabled {
+		rootsSize := cfg.ThreadReplies.CacheSize
+		if rootsSize <= 0 {
+			rootsSize = 65536
+		}
+		window := cfg.ThreadReplies.ActiveWindow
+		if window <= 0 {
+			window = time.Hour
+		}
+		filter.threadRoots = lru.NewLRU[string, string](rootsSize, nil, window)
+	}
+
 	return filter, nil
 }
 
@@ -73,12 +91,14 @@ func (f *RateLimiterFilter) Match(_ context.Context, event *nostr.Event, meta ma
 	var currentBurst int
 	var ruleID string
 	var ruleDescription string
+	var sizeWeighted bool
 
 	if processed, exists := f.kindToRule[event.Kind]; exists {
 		currentRate = processed.rule.Rate
 		currentBurst = processed.rule.Burst
 		ruleID = processed.id
 		ruleDescription = processed.rule.Description
+		sizeWeighted = processed.rule.SizeWeighted
 	} else {
 		currentRate = f.cfg.DefaultRate
 		currentBurst = f.cfg.DefaultBurst
@@ -90,6 +110,31 @@ func (f *RateLimiterFilter) Match(_ context.Context, event *nostr.Event, meta ma
 		return newResult(true, "rate_unlimited_for_kind", nil)
 	}
 
+	if f.isOwnThreadReply(event) {
+		currentRate *= f.cfg.ThreadReplies.RateMultiplier
+		currentBurst = int(float64(currentBurst) * f.cfg.ThreadReplies.BurstMultiplier)
+		ruleID += ":thread"
+		ruleDescription += " (thread reply)"
+	}
+
+	if scale, ok := meta[MetaKeyClientRate].(*ClientRate); ok {
+		currentRate *= scale.RateMultiplier
+		currentBurst = max(1, int(float64(currentBurst)*scale.BurstMultiplier))
+		ruleID += ":" + scale.ID
+		ruleDescription += " (client " + scale.Description + ")"
+	}
+
+	cost := 1
+	if sizeWeighted {
+		raw, err := json.Marshal(event)
+		if err != nil {
+			return newResult(false, "internal_marshal_failed", err)
+		}
+		// One token per started KiB. Events larger than the burst cost the
+		// whole burst rather than being unable to pass at all.
+		cost = min(max(1, (len(raw)+1023)/1024), currentBurst)
+	}
+
 	userKeys := make([]string, 0, 2)
 	remoteIP, _ := meta["remote_ip"].(string)
 
@@ -111,15 +156,66 @@ func (f *RateLimiterFilter) Match(_ context.Context, event *nostr.Event, meta ma
 		}
 	}
 
+	minTokens := float64(currentBurst)
 	for _, userKey := range userKeys {
 		cacheKey := fmt.Sprintf("%s:%s", ruleID, userKey)
 		limiter := f.getLimiter(cacheKey, currentRate, currentBurst)
-		if !limiter.Allow() {
+		if !limiter.AllowN(time.Now(), cost) {
 			reason := fmt.Sprintf("rate_limit_exceeded:rule:'%s'", ruleDescription)
-			return newResult(false, reason, nil)
+			res, err := newResult(false, reason, nil)
+			res.Values = map[string]any{
+				"rule":        ruleDescription,
+				"rate":        currentRate,
+				"burst":       currentBurst,
+				"retry_after": int(math.Ceil((float64(cost) - limiter.Tokens()) / currentRate)),
+				"cost":        cost,
+			}
+			return res, err
+		}
+		minTokens = min(minTokens, limiter.Tokens())
+	}
+
+	if f.threadRoots != nil && event.Kind == nostr.KindTextNote {
+		f.threadRoots.Add(event.ID, event.PubKey)
+	}
+
+	res, err := newResult(true, "rate_limit_ok", nil)
+	if f.cfg.WarnThreshold > 0 && minTokens <= f.cfg.WarnThreshold*float64(currentBurst) {
+		res.Warning = fmt.Sprintf("close to rate limit: slow down to about %.2f events/s", currentRate)
+	}
+	return res, err
+}
+
+// isOwnThreadReply reports whether the event is a reply whose thread root is
+// a recent note by the same author.
+func (f *RateLimiterFilter) isOwnThreadReply(event *nostr.Event) bool {
+	if f.threadRoots == nil || event.Kind != nostr.KindTextNote {
+		return false
+	}
+	rootID := threadRootID(event.Tags)
+	if rootID == "" {
+		return false
+	}
+	author, ok := f.threadRoots.Get(rootID)
+	return ok && author == event.PubKey
+}
+
+// threadRootID returns the NIP-10 root of a reply, preferring the marked
+// "root" tag and falling back to the first positional "e" tag.
+func threadRootID(tags nostr.Tags) string {
+	var firstE string
+	for _, tag := range tags {
+		if len(tag) < 2 || tag[0] != "e" {
+			continue
+		}
+		if len(tag) >= 4 && tag[3] == "root" {
+			return tag[1]
+		}
+		if firstE == "" {
+			firstE = tag[1]
 		}
 	}
-	return newResult(true, "rate_limit_ok", nil)
+	return firstE
 }
 
 func (f *RateLimiterFilter) getLimiter(key string, r float64, b int) *rate.Limiter {
@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/nip"
+)
+
+const (
+	referenceFilterName = "ReferenceFilter"
+)
+
+// ReferenceFilter rejects events whose content references denied pubkeys,
+// events or relays through NIP-19 "nostr:" URIs.
+type ReferenceFilter struct {
+	enabled       bool
+	kinds         map[int]struct{}
+	deniedPubKeys map[string]struct{}
+	deniedEvents  map[string]struct{}
+	deniedRelays  map[string]struct{}
+}
+
+func NewReferenceFilter(cfg *config.ReferenceFilterConfig) (*ReferenceFilter, error) {
+	if cfg == nil || !cfg.Enabled {
+		return &ReferenceFilter{}, nil
+	}
+
+	filter := &ReferenceFilter{
+		enabled:       true,
+		deniedPubKeys: make(map[string]struct{}, len(cfg.DeniedPubKeys)),
+		deniedEvents:  make(map[string]struct{}, len(cfg.DeniedEvents)),
+		deniedRelays:  make(map[string]struct{}, len(cfg.DeniedRelays)),
+	}
+
+	if len(cfg.Kinds) > 0 {
+		filter.kinds = make(map[int]struct{}, len(cfg.Kinds))
+		for _, k := range cfg.Kinds {
+			filter.kinds[k] = struct{}{}
+		}
+	}
+	for _, v := range cfg.DeniedPubKeys {
+		pk, err := nip.NormalizePubKey(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied pubkey %q: %w", v, err)
+		}
+		filter.deniedPubKeys[pk] = struct{}{}
+	}
+	for _, v := range cfg.DeniedEvents {
+		id, err := nip.NormalizeEventID(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied event %q: %w", v, err)
+		}
+		filter.deniedEvents[id] = struct{}{}
+	}
+	for _, v := range cfg.DeniedRelays {
+		host := nip.RelayHost(v)
+		if host == "" {
+			return nil, fmt.Errorf("invalid denied relay %q", v)
+		}
+		filter.deniedRelays[host] = struct{}{}
+	}
+
+	return filter, nil
+}
+
+func (f *ReferenceFilter) Match(_ context.Context, event *nostr.Event, meta map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(referenceFilterName)
+
+	if !f.enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if f.kinds != nil {
+		if _, ok := f.kinds[event.Kind]; !ok {
+			return newResult(true, "kind_not_checked", nil)
+		}
+	}
+
+	ents := ContentEntities(event, meta)
+	if ents.IsEmpty() {
+		return newResult(true, "no_references", nil)
+	}
+
+	for _, pk := range ents.PubKeys {
+		if _, denied := f.deniedPubKeys[pk]; denied {
+			return newResult(false, fmt.Sprintf("denied_pubkey_referenced:'%s'", pk), nil)
+		}
+	}
+	for _, id := range ents.Events {
+		if _, denied := f.deniedEvents[id]; denied {
+			return newResult(false, fmt.Sprintf("denied_event_referenced:'%s'", id), nil)
+		}
+	}
+	for _, host := range ents.Relays {
+		if f.isRelayDenied(host) {
+			return newResult(false, fmt.Sprintf("denied_relay_referenced:'%s'", host), nil)
+		}
+	}
+
+	return newResult(true, "references_ok", nil)
+}
+
+// isRelayDenied matches the relay host and all of its parent domains, so
+// denying "scam.example" also covers "relay.scam.example".
+func (f *ReferenceFilter) isRelayDenied(host string) bool {
+	_, denied := matchDomain(host, f.deniedRelays)
+	return denied
+}
@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	replyFloodFilterName = "ReplyFloodFilter"
+)
+
+// replyActivity holds when a pubkey last replied to each thread and author
+// within the window.
+type replyActivity struct {
+	threads map[string]time.Time
+	authors map[string]time.Time
+}
+
+// ReplyFloodFilter catches mass-reply campaigns, which drop the same pitch
+// under as many threads as possible: it rejects the replies of a pubkey to
+// more distinct threads or authors within a sliding window than allowed.
+type ReplyFloodFilter struct {
+	cfg   *config.ReplyFloodFilterConfig
+	kinds map[int]struct{}
+
+	mu       sync.Mutex
+	activity *lru.LRU[string, *replyActivity]
+}
+
+func NewReplyFloodFilter(cfg *config.ReplyFloodFilterConfig) (*ReplyFloodFilter, error) {
+	f := &ReplyFloodFilter{cfg: cfg}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	f.kinds = make(map[int]struct{}, len(cfg.Kinds))
+	for _, k := range cfg.Kinds {
+		f.kinds[k] = struct{}{}
+	}
+	f.activity = lru.NewLRU[string, *replyActivity](cfg.CacheSize, nil, cfg.Window)
+	return f, nil
+}
+
+func (f *ReplyFloodFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(replyFloodFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if _, ok := f.kinds[event.Kind]; !ok {
+		return newResult(true, "kind_not_checked", nil)
+	}
+	thread, author := replyTarget(event)
+	if thread == "" {
+		return newResult(true, "not_a_reply", nil)
+	}
+	if author == event.PubKey {
+		return newResult(true, "reply_to_self", nil)
+	}
+
+	now := time.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	act, ok := f.activity.Get(event.PubKey)
+	if !ok {
+		act = &replyActivity{threads: make(map[string]time.Time), authors: make(map[string]time.Time)}
+	}
+	expired := func(_ string, t time.Time) bool { return now.Sub(t) > f.cfg.Window }
+	maps.DeleteFunc(act.threads, expired)
+	maps.DeleteFunc(act.authors, expired)
+
+	if count, limit := countWith(act.threads, thread), f.cfg.MaxThreads; limit > 0 && count > limit {
+		return f.floodResult(newResult, "threads", count, limit, act.threads, now)
+	}
+	if author != "" {
+		if count, limit := countWith(act.authors, author), f.cfg.MaxAuthors; limit > 0 && count > limit {
+			return f.floodResult(newResult, "authors", count, limit, act.authors, now)
+		}
+		act.authors[author] = now
+	}
+	act.threads[thread] = now
+	f.activity.Add(event.PubKey, act)
+
+	return newResult(true, "reply_rate_ok", nil)
+}
+
+func (f *ReplyFloodFilter) floodResult(newResult func(bool, string, error) (FilterResult, error), target string, count, limit int, seen map[string]time.Time, now time.Time) (FilterResult, error) {
+	// A slot frees up once the oldest reply leaves the window.
+	oldest := slices.MinFunc(slices.Collect(maps.Values(seen)), func(a, b time.Time) int { return a.Compare(b) })
+	retryAfter := max(1, int(f.cfg.Window.Seconds()-now.Sub(oldest).Seconds()))
+
+	reason := fmt.Sprintf("reply_flood:%s_%d,max_%d,window_%s", target, count, limit, f.cfg.Window)
+	res, err := ActionResult(newResult, f.cfg.Action, reason)
+	res.Values = map[string]any{"target": target, "count": count, "max": limit, "retry_after": retryAfter}
+	return res, err
+}
+
+// countWith returns the number of keys of seen, counting key if new.
+func countWith(seen map[string]time.Time, key string) int {
+	if _, ok := seen[key]; ok {
+		return len(seen)
+	}
+	return len(seen) + 1
+}
+
+// replyTarget returns the root of the thread event replies to and the author
+// it replies to, or an empty thread if event is not a reply. The root is the
+// NIP-22 "E" tag, else the NIP-10 "root" marked "e" tag, else the first "e"
+// tag; the author is the pubkey hint of the replied-to "e" tag, else the
+// first "p" tag.
+func replyTarget(event *nostr.Event) (thread, author string) {
+	var first, root, reply nostr.Tag
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "E":
+			if root == nil || root[0] != "E" {
+				root = tag
+			}
+		case "e":
+			if first == nil {
+				first = tag
+			}
+			if len(tag) >= 4 && tag[3] == "root" && root == nil {
+				root = tag
+			}
+			if len(tag) >= 4 && tag[3] == "reply" {
+				reply = tag
+			}
+		case "p":
+			if author == "" {
+				author = strings.ToLower(tag[1])
+			}
+		}
+	}
+	if root == nil {
+		root = first
+	}
+	if root == nil {
+		return "", ""
+	}
+	if reply == nil {
+		reply = root
+	}
+	if len(reply) >= 5 && nostr.IsValidPublicKey(reply[4]) {
+		author = strings.ToLower(reply[4])
+	}
+	return strings.ToLower(root[1]), author
+}
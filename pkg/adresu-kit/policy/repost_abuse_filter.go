@@ -50,6 +50,25 @@ func NewRepostAbuseFilter(cfg *config.RepostAbuseFilterConfig) (*RepostAbuseFilt
 	return filter, nil
 }
 
+// Prime seeds the original post and repost counts of the authors in history.
+func (f *RepostAbuseFilter) Prime(history []AuthorHistory) {
+	if !f.cfg.Enabled {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, h := range history {
+		if h.OriginalPosts+h.Reposts == 0 {
+			continue
+		}
+		f.stats.Add(h.PubKey, &UserActivityStats{
+			OriginalPosts: h.OriginalPosts,
+			Reposts:       h.Reposts,
+			LastEventTime: h.LastSeen,
+		})
+	}
+}
+
 func (f *RepostAbuseFilter) Match(_ context.Context, event *nostr.Event, meta map[string]any) (FilterResult, error) {
 	newResult := NewResultFunc(repostAbuseFilterName)
 
@@ -0,0 +1,50 @@
+package policy
+
+import (
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// shingleSize is the number of consecutive words hashed together. Single
+// words keep a template recognizable when one token (a link, a name) varies;
+// longer shingles change a hash too much for every substituted word.
+const shingleSize = 1
+
+// SimHash returns a 64-bit SimHash of the text's words. Texts that
+// share most words get hashes that differ in only a few bits, so small
+// edits (a changed link, an appended tag) keep a template recognizable.
+func SimHash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	n := max(len(words)-shingleSize+1, 1)
+	for i := range n {
+		h := fnv.New64a()
+		for _, w := range words[i:min(i+shingleSize, len(words))] {
+			h.Write([]byte(w))
+			h.Write([]byte{' '})
+		}
+		sum := h.Sum64()
+		for b := range 64 {
+			if sum&(1<<b) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+
+	var hash uint64
+	for b, w := range weights {
+		if w > 0 {
+			hash |= 1 << b
+		}
+	}
+	return hash
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/nbd-wtf/go-nostr"
 
@@ -14,14 +16,36 @@ const (
 	sizeFilterName = "SizeFilter"
 )
 
+// defaultEmptyContentKinds legitimately carry little or no content, so the
+// default minimum content length never applies to them: metadata-only events,
+// deletions, reposts, reactions, zap receipts and, through
+// defaultEmptyContent, every replaceable, ephemeral and addressable kind,
+// such as NIP-51 lists and relay lists.
+var defaultEmptyContentKinds = []int{
+	nostr.KindProfileMetadata,
+	nostr.KindFollowList,
+	nostr.KindDeletion,
+	nostr.KindRepost,
+	nostr.KindReaction,
+	nostr.KindGenericRepost,
+	nostr.KindZap,
+	nostr.KindMuteList,
+}
+
 type SizeFilter struct {
-	cfg        *config.SizeFilterConfig
-	kindToRule map[int]*config.SizeRule
+	cfg               *config.SizeFilterConfig
+	kindToRule        map[int]*config.SizeRule
+	emptyContentKinds map[int]struct{}
+	// defaultExempt also exempts the kind ranges of defaultEmptyContent,
+	// unless empty_content_kinds replaces the defaults.
+	defaultExempt bool
 }
 
 func NewSizeFilter(cfg *config.SizeFilterConfig) (*SizeFilter, error) {
 	kindMap := make(map[int]*config.SizeRule)
 
+	emptyKinds := defaultEmptyContentKinds
+	defaultExempt := true
 	if cfg != nil {
 		for i := range cfg.Rules {
 			rule := &cfg.Rules[i]
@@ -29,22 +53,49 @@ func NewSizeFilter(cfg *config.SizeFilterConfig) (*SizeFilter, error) {
 				kindMap[kind] = rule
 			}
 		}
+		if len(cfg.EmptyContentKinds) > 0 {
+			emptyKinds = cfg.EmptyContentKinds
+			defaultExempt = false
+		}
+	}
+
+	emptyMap := make(map[int]struct{}, len(emptyKinds))
+	for _, kind := range emptyKinds {
+		emptyMap[kind] = struct{}{}
 	}
 
-	filter := &SizeFilter{cfg: cfg, kindToRule: kindMap}
+	filter := &SizeFilter{cfg: cfg, kindToRule: kindMap, emptyContentKinds: emptyMap, defaultExempt: defaultExempt}
 	return filter, nil
 }
 
 func (f *SizeFilter) Match(_ context.Context, event *nostr.Event, meta map[string]any) (FilterResult, error) {
 	newResult := NewResultFunc(sizeFilterName)
 
-	maxSize := 0
+	maxSize, minContent := 0, 0
 	if f.cfg != nil {
 		maxSize = f.cfg.DefaultMaxSize
+		if !f.emptyContentExempt(event.Kind) {
+			minContent = f.cfg.DefaultMinContentLength
+		}
 	}
 
 	if rule, ok := f.kindToRule[event.Kind]; ok {
 		maxSize = rule.MaxSize
+		// An explicit per-kind minimum overrides the empty-content exemption.
+		if rule.MinContentLength != nil {
+			minContent = *rule.MinContentLength
+		}
+	}
+
+	if minContent > 0 {
+		// Count characters rather than bytes, and ignore surrounding
+		// whitespace, so "   ." floods are caught as well.
+		if length := utf8.RuneCountInString(strings.TrimSpace(event.Content)); length < minContent {
+			reason := fmt.Sprintf("content_too_short:length_%d,min_%d", length, minContent)
+			res, err := newResult(false, reason, nil)
+			res.Values = map[string]any{"length": length, "min": minContent}
+			return res, err
+		}
 	}
 
 	if maxSize <= 0 {
@@ -60,8 +111,28 @@ func (f *SizeFilter) Match(_ context.Context, event *nostr.Event, meta map[strin
 
 	if size > maxSize {
 		reason := fmt.Sprintf("event_too_large:size_%d,max_%d", size, maxSize)
-		return newResult(false, reason, nil)
+		res, err := newResult(false, reason, nil)
+		res.Values = map[string]any{"size": size, "max": maxSize}
+		return res, err
 	}
 
 	return newResult(true, "size_ok", nil)
 }
+
+// Independent reports that SizeFilter only inspects the event itself.
+func (f *SizeFilter) Independent() bool { return true }
+
+// emptyContentExempt reports whether the default minimum content length
+// skips kind.
+func (f *SizeFilter) emptyContentExempt(kind int) bool {
+	if _, ok := f.emptyContentKinds[kind]; ok {
+		return true
+	}
+	return f.defaultExempt && defaultEmptyContent(kind)
+}
+
+// defaultEmptyContent reports whether kind is replaceable, ephemeral or
+// addressable; such events are mostly state carried in tags.
+func defaultEmptyContent(kind int) bool {
+	return nostr.IsReplaceableKind(kind) || nostr.IsEphemeralKind(kind) || nostr.IsAddressableKind(kind)
+}
@@ -0,0 +1,139 @@
+package policy
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// slowModeRoomTTL is how long the room of a chat message is remembered, i.e.
+// how old a message a moderator can react to in order to slow its room down.
+const slowModeRoomTTL = time.Hour
+
+// slowModeState is the slow mode of one room.
+type slowModeState struct {
+	delay time.Duration
+	until time.Time
+}
+
+// SlowMode is a shared registry of chat rooms in slow mode, in which everyone
+// must wait a longer delay between messages, like the slow mode of chat
+// platforms. It outlives pipeline reloads. EphemeralChatFilter enforces it and
+// remembers the room of recent messages, so that a moderator reacting to one
+// can put its room in slow mode.
+type SlowMode struct {
+	mu    sync.Mutex
+	rooms map[string]slowModeState
+	// messages maps recent message IDs to their rooms.
+	messages *lru.LRU[string, string]
+	// posted holds the last message time per room and pubkey.
+	posted *lru.LRU[string, time.Time]
+}
+
+// NewSlowMode creates a registry tracking up to size messages and posters
+// (10000 if size is not positive).
+func NewSlowMode(size int) *SlowMode {
+	if size <= 0 {
+		size = 10000
+	}
+	return &SlowMode{
+		rooms:    make(map[string]slowModeState),
+		messages: lru.NewLRU[string, string](size, nil, slowModeRoomTTL),
+		// Entries are compared with the room's delay; the LRU only bounds memory.
+		posted: lru.NewLRU[string, time.Time](size, nil, 0),
+	}
+}
+
+// ChatRoom identifies the room of a chat message: its kind and the NIP-29
+// group ("h" tag), NIP-28 channel (root "e" tag) or geohash channel ("g"
+// tag) it belongs to. Messages without any of these share a room per kind.
+func ChatRoom(event *nostr.Event) string {
+	return chatRoom(event.Kind, event)
+}
+
+func chatRoom(kind int, event *nostr.Event) string {
+	room := strconv.Itoa(kind)
+	if tag := event.Tags.Find("h"); len(tag) >= 2 {
+		return room + ":h:" + tag[1]
+	}
+	for _, tag := range event.Tags {
+		if len(tag) >= 4 && tag[0] == "e" && tag[3] == "root" {
+			return room + ":e:" + tag[1]
+		}
+	}
+	if tag := event.Tags.Find("g"); len(tag) >= 2 {
+		return room + ":g:" + tag[1]
+	}
+	return room
+}
+
+// Remember records the room of a chat message.
+func (s *SlowMode) Remember(event *nostr.Event, room string) {
+	s.messages.Add(event.ID, room)
+}
+
+// RoomOf returns the room of the message a NIP-25 reaction reacts to, if it
+// passed through recently or the reaction names its NIP-29 group.
+func (s *SlowMode) RoomOf(reaction *nostr.Event) (string, bool) {
+	if tag := reaction.Tags.FindLast("e"); len(tag) >= 2 {
+		if room, ok := s.messages.Get(tag[1]); ok {
+			return room, true
+		}
+	}
+	kindTag := reaction.Tags.Find("k")
+	if len(kindTag) < 2 || reaction.Tags.Find("h") == nil {
+		return "", false
+	}
+	kind, err := strconv.Atoi(kindTag[1])
+	if err != nil {
+		return "", false
+	}
+	return chatRoom(kind, reaction), true
+}
+
+// Toggle puts room in slow mode with delay for d, or lifts it if the room is
+// in slow mode already, and reports whether slow mode is now on.
+func (s *SlowMode) Toggle(room string, delay, d time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.rooms[room]; ok && time.Now().Before(state.until) {
+		delete(s.rooms, room)
+		return false
+	}
+	s.rooms[room] = slowModeState{delay: delay, until: time.Now().Add(d)}
+	return true
+}
+
+// Delay returns the delay in effect in room, if it is in slow mode.
+func (s *SlowMode) Delay(room string) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.rooms[room]
+	if !ok {
+		return 0, false
+	}
+	if !time.Now().Before(state.until) {
+		delete(s.rooms, room)
+		return 0, false
+	}
+	return state.delay, true
+}
+
+// Wait records a message by pubkey in room at now, unless it comes sooner
+// than delay after the previous one, in which case it returns the time
+// elapsed since that one.
+func (s *SlowMode) Wait(room, pubkey string, delay time.Duration, now time.Time) (time.Duration, bool) {
+	key := room + "|" + pubkey
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.posted.Get(key); ok {
+		if elapsed := now.Sub(last); elapsed < delay {
+			return elapsed, true
+		}
+	}
+	s.posted.Add(key, now)
+	return 0, false
+}
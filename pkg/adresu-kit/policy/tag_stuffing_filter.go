@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	tagStuffingFilterName = "TagStuffingFilter"
+)
+
+var hashtagRe = regexp.MustCompile(`(?:^|\s)(#[\p{L}\p{N}_]+)`)
+
+// TagStuffingFilter catches events stuffed with hashtags or mentions to reach
+// more feeds and notifications, which a flat tag limit cannot tell from long
+// threads: it counts distinct hashtags and mentioned pubkeys, and how much of
+// the content is hashtags.
+type TagStuffingFilter struct {
+	cfg        *config.TagStuffingFilterConfig
+	kindToRule map[int]*config.TagStuffingRule
+}
+
+func NewTagStuffingFilter(cfg *config.TagStuffingFilterConfig) (*TagStuffingFilter, error) {
+	f := &TagStuffingFilter{cfg: cfg, kindToRule: make(map[int]*config.TagStuffingRule)}
+	if !cfg.Enabled {
+		return f, nil
+	}
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		for _, kind := range rule.Kinds {
+			f.kindToRule[kind] = rule
+		}
+	}
+	return f, nil
+}
+
+func (f *TagStuffingFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(tagStuffingFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	rule, exists := f.kindToRule[event.Kind]
+	if !exists {
+		return newResult(true, "no_rules_for_kind", nil)
+	}
+
+	hashtags := make(map[string]struct{})
+	mentions := make(map[string]struct{})
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "t":
+			hashtags[strings.ToLower(tag[1])] = struct{}{}
+		case "p":
+			mentions[strings.ToLower(tag[1])] = struct{}{}
+		}
+	}
+
+	if rule.MaxHashtags > 0 && len(hashtags) > rule.MaxHashtags {
+		return f.limitResult(newResult, "t", len(hashtags), rule.MaxHashtags)
+	}
+	if rule.MaxMentions > 0 && len(mentions) > rule.MaxMentions {
+		return f.limitResult(newResult, "p", len(mentions), rule.MaxMentions)
+	}
+
+	if rule.MaxHashtagRatio > 0 {
+		length := 0
+		for _, r := range event.Content {
+			if !unicode.IsSpace(r) {
+				length++
+			}
+		}
+		if length > 0 && length >= rule.MinContentLength {
+			tagged := 0
+			for _, m := range hashtagRe.FindAllStringSubmatch(event.Content, -1) {
+				tagged += utf8.RuneCountInString(m[1])
+			}
+			if ratio := float64(tagged) / float64(length); ratio > rule.MaxHashtagRatio {
+				reason := fmt.Sprintf("hashtag_stuffing:ratio_%.2f,limit_%.2f", ratio, rule.MaxHashtagRatio)
+				res, err := ActionResult(newResult, f.cfg.Action, reason)
+				res.Values = map[string]any{"ratio": ratio, "limit": rule.MaxHashtagRatio}
+				return res, err
+			}
+		}
+	}
+
+	return newResult(true, "tags_ok", nil)
+}
+
+// Independent reports that TagStuffingFilter only inspects the event itself.
+func (f *TagStuffingFilter) Independent() bool { return true }
+
+func (f *TagStuffingFilter) limitResult(newResult func(bool, string, error) (FilterResult, error), tag string, count, limit int) (FilterResult, error) {
+	reason := fmt.Sprintf("too_many_distinct_tags:'%s',got_%d,max_%d", tag, count, limit)
+	res, err := ActionResult(newResult, f.cfg.Action, reason)
+	res.Values = map[string]any{"tag": tag, "count": count, "max": limit}
+	return res, err
+}
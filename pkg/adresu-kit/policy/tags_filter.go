@@ -61,7 +61,9 @@ func (f *TagsFilter) Match(_ context.Context, event *nostr.Event, meta map[strin
 
 	if rule.MaxTags != nil && len(event.Tags) > *rule.MaxTags {
 		reason := fmt.Sprintf("too_many_tags:got_%d,max_%d", len(event.Tags), *rule.MaxTags)
-		return newResult(false, reason, nil)
+		res, err := newResult(false, reason, nil)
+		res.Values = map[string]any{"count": len(event.Tags), "max": *rule.MaxTags}
+		return res, err
 	}
 
 	if len(processedRule.requiredTags) > 0 || len(processedRule.maxTagCounts) > 0 {
@@ -85,7 +87,9 @@ func (f *TagsFilter) Match(_ context.Context, event *nostr.Event, meta map[strin
 		for reqTag := range processedRule.requiredTags {
 			if !requiredFound[reqTag] {
 				reason := fmt.Sprintf("missing_required_tag:'%s'", reqTag)
-				return newResult(false, reason, nil)
+				res, err := newResult(false, reason, nil)
+				res.Values = map[string]any{"tag": reqTag}
+				return res, err
 			}
 		}
 
@@ -93,10 +97,15 @@ func (f *TagsFilter) Match(_ context.Context, event *nostr.Event, meta map[strin
 			count := specificTagCounts[tagName]
 			if count > limit {
 				reason := fmt.Sprintf("too_many_tags:'%s',got_%d,max_%d", tagName, count, limit)
-				return newResult(false, reason, nil)
+				res, err := newResult(false, reason, nil)
+				res.Values = map[string]any{"tag": tagName, "count": count, "max": limit}
+				return res, err
 			}
 		}
 	}
 
 	return newResult(true, "tags_ok", nil)
 }
+
+// Independent reports that TagsFilter only inspects the event itself.
+func (f *TagsFilter) Independent() bool { return true }
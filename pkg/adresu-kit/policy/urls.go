@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var urlRe = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'()\[\]]+`)
+
+// urlHosts returns the lowercase host names of all web links in text.
+func urlHosts(text string) []string {
+	var hosts []string
+	for _, raw := range urlRe.FindAllString(text, -1) {
+		if !strings.Contains(raw, "://") {
+			raw = "https://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		hosts = append(hosts, strings.TrimSuffix(strings.ToLower(u.Hostname()), "."))
+	}
+	return hosts
+}
+
+// matchDomain reports the entry of set matching host or one of its parent
+// domains, so listing "example.com" also covers "cdn.example.com".
+func matchDomain(host string, set map[string]struct{}) (string, bool) {
+	for {
+		if _, ok := set[host]; ok {
+			return host, true
+		}
+		dot := strings.IndexByte(host, '.')
+		if dot < 0 {
+			return "", false
+		}
+		host = host[dot+1:]
+	}
+}
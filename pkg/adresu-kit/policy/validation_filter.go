@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+)
+
+const (
+	validationFilterName = "ValidationFilter"
+	// maxCreatedAt is the last second of year 9999.
+	maxCreatedAt = 253402300799
+)
+
+// ValidationFilter rejects structurally malformed events early, before they
+// reach behavioral filters and pollute their caches. Its checks only look at
+// the event itself.
+type ValidationFilter struct {
+	cfg *config.ValidationFilterConfig
+}
+
+func NewValidationFilter(cfg *config.ValidationFilterConfig) (*ValidationFilter, error) {
+	return &ValidationFilter{cfg: cfg}, nil
+}
+
+func (f *ValidationFilter) Match(_ context.Context, event *nostr.Event, _ map[string]any) (FilterResult, error) {
+	newResult := NewResultFunc(validationFilterName)
+
+	if !f.cfg.Enabled {
+		return newResult(true, "filter_disabled", nil)
+	}
+	if f.cfg.Timestamps && (event.CreatedAt <= 0 || event.CreatedAt > maxCreatedAt) {
+		return newResult(false, fmt.Sprintf("invalid_created_at:%d", event.CreatedAt), nil)
+	}
+	if f.cfg.MaxTags > 0 && len(event.Tags) > f.cfg.MaxTags {
+		return newResult(false, fmt.Sprintf("too_many_tags:got_%d,max_%d", len(event.Tags), f.cfg.MaxTags), nil)
+	}
+
+	for i, tag := range event.Tags {
+		if len(tag) == 0 || tag[0] == "" {
+			if f.cfg.EmptyTagNames {
+				return newResult(false, fmt.Sprintf("empty_tag_name:index_%d", i), nil)
+			}
+			continue
+		}
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "e", "p", "E", "P":
+			if f.cfg.HexReferences && !nostr.IsValid32ByteHex(tag[1]) {
+				return newResult(false, fmt.Sprintf("invalid_hex_in_%s_tag:index_%d", tag[0], i), nil)
+			}
+		case "expiration", "published_at":
+			if f.cfg.Timestamps && !isUnixTimestamp(tag[1]) {
+				return newResult(false, fmt.Sprintf("invalid_%s_tag:index_%d", tag[0], i), nil)
+			}
+		}
+	}
+	return newResult(true, "event_well_formed", nil)
+}
+
+// isUnixTimestamp reports whether s is a decimal Unix timestamp within the
+// range accepted for created_at.
+func isUnixTimestamp(s string) bool {
+	ts, err := strconv.ParseInt(s, 10, 64)
+	return err == nil && ts >= 0 && ts <= maxCreatedAt && s[0] != '+'
+}
@@ -0,0 +1,65 @@
+package testkit_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+	kitconfig "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/config"
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+	"github.com/lessucettes/adresu-plugin/pkg/adresu-kit/testkit"
+)
+
+func ExampleChain() {
+	kinds, _ := kitpolicy.NewKindFilter(&kitconfig.KindFilterConfig{DeniedKinds: []int{nostr.KindEncryptedDirectMessage}})
+	chain := testkit.NewChain(kinds)
+	defer chain.Close()
+
+	ctx := context.Background()
+	alice := testkit.NewKey(1)
+	for _, event := range []*nostr.Event{
+		testkit.NewEvent(nostr.KindTextNote).By(alice).Content("gm").Build(),
+		testkit.NewEvent(nostr.KindEncryptedDirectMessage).By(alice).Content("psst").Build(),
+	} {
+		res, err := chain.Run(ctx, event, "203.0.113.7")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if r, rejected := res.Rejection(); rejected {
+			fmt.Printf("kind %d rejected by %s: %s\n", event.Kind, r.Filter, r.Reason)
+		} else {
+			fmt.Printf("kind %d allowed\n", event.Kind)
+		}
+	}
+	// Output:
+	// kind 1 allowed
+	// kind 4 rejected by KindFilter: kind_4_denied
+}
+
+func ExampleNewStore() {
+	ctx := context.Background()
+	spam := testkit.NewEvent(nostr.KindTextNote).By(testkit.NewKey(1)).Content("buy now").Build()
+	db := testkit.NewStore()
+	defer db.Close()
+	relay := testkit.NewStrfry(spam)
+
+	blocklist, _ := policy.NewBlocklistFilter(&config.BlocklistFilterConfig{Enabled: true}, db, relay)
+	if _, err := blocklist.BlockEvent(ctx, spam.ID, time.Hour, store.BanInfo{Reason: "spam"}); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// The same content from another author is blocked too.
+	repost := testkit.NewEvent(nostr.KindTextNote).By(testkit.NewKey(2)).Content("buy now").Build()
+	res, _ := testkit.NewChain(blocklist).Run(ctx, repost, "")
+	r, _ := res.Rejection()
+	fmt.Println(r.Reason)
+	// Output:
+	// content_blocked
+}
@@ -0,0 +1,102 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/store"
+	"github.com/lessucettes/adresu-plugin/internal/strfry"
+)
+
+// NewStore returns an empty store kept in memory, for filters of the plugin
+// that need its database. It behaves as the badger store the plugin uses by
+// default; close it when done.
+func NewStore() store.Store {
+	s, err := store.NewBadgerMemoryStore()
+	if err != nil {
+		panic(fmt.Sprintf("testkit: failed to open in-memory store: %v", err))
+	}
+	return s
+}
+
+// Strfry stands in for the relay's strfry: it holds the events added to it,
+// answers scans from them and records deletions instead of running strfry.
+// It is safe for concurrent use, as moderation deletes in the background.
+type Strfry struct {
+	mu      sync.Mutex
+	events  []*nostr.Event
+	authors []string
+	ids     []string
+	// Err, if set, is returned by every deletion, which then deletes nothing.
+	Err error
+}
+
+var _ strfry.ClientInterface = (*Strfry)(nil)
+
+// NewStrfry returns a strfry storing events.
+func NewStrfry(events ...*nostr.Event) *Strfry {
+	return &Strfry{events: events}
+}
+
+// Add stores events.
+func (s *Strfry) Add(events ...*nostr.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+}
+
+func (s *Strfry) DeleteEventsByAuthor(author string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	s.authors = append(s.authors, author)
+	s.events = slices.DeleteFunc(s.events, func(e *nostr.Event) bool { return e.PubKey == author })
+	return nil
+}
+
+func (s *Strfry) DeleteEvent(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	s.ids = append(s.ids, id)
+	s.events = slices.DeleteFunc(s.events, func(e *nostr.Event) bool { return e.ID == id })
+	return nil
+}
+
+// ScanEvents returns the stored events matching filter, up to its limit.
+func (s *Strfry) ScanEvents(_ context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []*nostr.Event
+	for _, e := range s.events {
+		if filter.Matches(e) {
+			events = append(events, e)
+			if filter.Limit > 0 && len(events) == filter.Limit {
+				break
+			}
+		}
+	}
+	return events, nil
+}
+
+// DeletedAuthors returns the pubkeys whose events were deleted, in order.
+func (s *Strfry) DeletedAuthors() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.authors)
+}
+
+// DeletedEvents returns the IDs of the events deleted one by one, in order.
+func (s *Strfry) DeletedEvents() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.ids)
+}
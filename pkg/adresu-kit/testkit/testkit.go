@@ -0,0 +1,164 @@
+// Package testkit helps the authors of custom filters test them against the
+// kit's Filter interface without a relay: it builds signed events from
+// deterministic keys and runs filters in a chain the way the plugin's
+// pipeline does, sharing meta between them and stopping at the first
+// rejection.
+//
+//	alice := testkit.NewKey(1)
+//	note := testkit.NewEvent(nostr.KindTextNote).By(alice).Content("gm").Build()
+//	chain := testkit.NewChain(myFilter)
+//	res, err := chain.Run(ctx, note, "203.0.113.7")
+//	if r, rejected := res.Rejection(); err != nil || rejected {
+//		t.Fatalf("note rejected: %+v, %v", r, err)
+//	}
+//
+// Kit filters keep their state in memory, so the chain needs no database or
+// strfry. Filters of the plugin itself, which do, get them from NewStore, an
+// empty in-memory database, and Strfry, which records deletions and answers
+// scans from the events added to it.
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	kitpolicy "github.com/lessucettes/adresu-plugin/pkg/adresu-kit/policy"
+)
+
+// Key is a key pair derived from a number, so fixtures are reproducible.
+type Key struct {
+	Secret string
+	Public string
+}
+
+// NewKey returns the key pair whose secret key is n, which must not be 0.
+func NewKey(n uint64) Key {
+	sk := fmt.Sprintf("%064x", n)
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		panic(fmt.Sprintf("testkit: invalid key %d: %v", n, err))
+	}
+	return Key{Secret: sk, Public: pk}
+}
+
+// EventBuilder builds signed events. Unless set, events are signed with
+// NewKey(1) and created now.
+type EventBuilder struct {
+	event nostr.Event
+	key   Key
+}
+
+func NewEvent(kind int) *EventBuilder {
+	return &EventBuilder{event: nostr.Event{Kind: kind, CreatedAt: nostr.Now(), Tags: nostr.Tags{}}, key: NewKey(1)}
+}
+
+// Reaction starts a NIP-25 reaction to target.
+func Reaction(target *nostr.Event, content string) *EventBuilder {
+	return NewEvent(nostr.KindReaction).Content(content).
+		Tag("e", target.ID).Tag("p", target.PubKey).Tag("k", fmt.Sprint(target.Kind))
+}
+
+// Reply starts a NIP-10 reply to the note parent.
+func Reply(parent *nostr.Event, content string) *EventBuilder {
+	return NewEvent(nostr.KindTextNote).Content(content).
+		Tag("e", parent.ID, "", "reply").Tag("p", parent.PubKey)
+}
+
+// By signs the event with key.
+func (b *EventBuilder) By(key Key) *EventBuilder {
+	b.key = key
+	return b
+}
+
+func (b *EventBuilder) Content(content string) *EventBuilder {
+	b.event.Content = content
+	return b
+}
+
+// Tag appends a tag, such as Tag("t", "nostr").
+func (b *EventBuilder) Tag(tag ...string) *EventBuilder {
+	b.event.Tags = append(b.event.Tags, nostr.Tag(tag))
+	return b
+}
+
+// At sets the creation time.
+func (b *EventBuilder) At(t time.Time) *EventBuilder {
+	b.event.CreatedAt = nostr.Timestamp(t.Unix())
+	return b
+}
+
+// Build returns a signed copy of the event.
+func (b *EventBuilder) Build() *nostr.Event {
+	event := b.event
+	event.Tags = append(nostr.Tags(nil), b.event.Tags...)
+	if err := event.Sign(b.key.Secret); err != nil {
+		panic(fmt.Sprintf("testkit: failed to sign event: %v", err))
+	}
+	return &event
+}
+
+// Chain runs filters in order on one event, as a pipeline stage each.
+type Chain struct {
+	filters []kitpolicy.Filter
+}
+
+func NewChain(filters ...kitpolicy.Filter) *Chain {
+	return &Chain{filters: filters}
+}
+
+// Result is the outcome of running a chain on an event.
+type Result struct {
+	// Results holds the result of every filter run, the last one being the
+	// rejection if any.
+	Results []kitpolicy.FilterResult
+	// Meta is what the filters shared, including "remote_ip".
+	Meta map[string]any
+}
+
+// Allowed reports whether every filter allowed the event.
+func (r Result) Allowed() bool {
+	_, rejected := r.Rejection()
+	return !rejected
+}
+
+// Rejection returns the result of the filter that rejected the event, if
+// any.
+func (r Result) Rejection() (kitpolicy.FilterResult, bool) {
+	if n := len(r.Results); n > 0 && !r.Results[n-1].Allowed {
+		return r.Results[n-1], true
+	}
+	return kitpolicy.FilterResult{}, false
+}
+
+// Run runs the filters on event, submitted from remoteIP (empty if unknown),
+// until one rejects it or fails.
+func (c *Chain) Run(ctx context.Context, event *nostr.Event, remoteIP string) (Result, error) {
+	res := Result{Meta: map[string]any{"remote_ip": remoteIP}}
+	for _, f := range c.filters {
+		r, err := f.Match(ctx, event, res.Meta)
+		res.Results = append(res.Results, r)
+		if err != nil {
+			return res, fmt.Errorf("filter %s: %w", r.Filter, err)
+		}
+		if !r.Allowed {
+			break
+		}
+	}
+	return res, nil
+}
+
+// Close closes the filters that hold resources, as the pipeline does.
+func (c *Chain) Close() error {
+	var errs []error
+	for _, f := range c.filters {
+		if closer, ok := f.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
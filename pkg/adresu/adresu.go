@@ -0,0 +1,115 @@
+// Package adresu embeds the adresu policy pipeline in Go relays, so they can
+// judge events in-process instead of running adresu-plugin as a strfry-style
+// write policy subprocess.
+//
+// The pipeline is built from the same configuration file as the plugin.
+// Features that act on a strfry database (deleting the events of banned
+// authors, shadow bans, reading follow lists from strfry) shell out to the
+// strfry executable of [strfry]; hosts without strfry should leave them
+// disabled.
+//
+// With khatru:
+//
+//	p, err := adresu.NewPipelineFromConfig("/etc/adresu/config.toml")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer p.Close()
+//	relay.RejectEvent = append(relay.RejectEvent, p.RejectEvent(khatru.GetIP))
+package adresu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/lessucettes/adresu-plugin/internal/config"
+	"github.com/lessucettes/adresu-plugin/internal/pipeline"
+	"github.com/lessucettes/adresu-plugin/internal/policy"
+	"github.com/lessucettes/adresu-plugin/internal/schedule"
+	"github.com/lessucettes/adresu-plugin/internal/store"
+	"github.com/lessucettes/adresu-plugin/internal/trace"
+)
+
+// Decision is the pipeline's verdict on an event.
+type Decision struct {
+	Accept bool
+	// Message is the message for the client of a rejected event, as
+	// rendered by [messages] templates.
+	Message string
+}
+
+// Pipeline judges events with the filters of a configuration. It is safe for
+// concurrent use.
+type Pipeline struct {
+	p      *policy.Pipeline
+	db     store.Store
+	cancel context.CancelFunc
+}
+
+// NewPipelineFromConfig builds the pipeline of the configuration file at
+// path, opening the database it names and starting its periodic jobs.
+func NewPipelineFromConfig(path string) (*Pipeline, error) {
+	cfg, _, err := config.Load(path, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	db, err := store.Open(&cfg.DB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	sched, err := schedule.New(cfg.Schedule.Jitter, cfg.Schedule.Jobs)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize scheduler: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sched.Start(ctx)
+
+	p, err := pipeline.Build(cfg, pipeline.Deps{DB: db, Scheduler: sched})
+	if err != nil {
+		cancel()
+		db.Close()
+		return nil, err
+	}
+	return &Pipeline{p: p, db: db, cancel: cancel}, nil
+}
+
+// ProcessEvent judges event, submitted from remoteIP (empty if unknown). A
+// filter failure is returned along with a rejection.
+func (p *Pipeline) ProcessEvent(ctx context.Context, event *nostr.Event, remoteIP string) (Decision, error) {
+	ctx = trace.With(ctx, trace.NewID())
+	if src, ok := policy.ClientSource(remoteIP); ok {
+		ctx = policy.WithSource(ctx, src)
+	}
+	res, err := p.p.ProcessEvent(ctx, event, remoteIP, false)
+	return Decision{Accept: res.Action == "accept", Message: res.Msg}, err
+}
+
+// RejectEvent returns a hook with the signature of khatru's
+// Relay.RejectEvent, taking the submitter's address from remoteIP (such as
+// khatru.GetIP), which may be nil.
+func (p *Pipeline) RejectEvent(remoteIP func(ctx context.Context) string) func(ctx context.Context, event *nostr.Event) (reject bool, msg string) {
+	return func(ctx context.Context, event *nostr.Event) (bool, string) {
+		var ip string
+		if remoteIP != nil {
+			ip = remoteIP(ctx)
+		}
+		decision, err := p.ProcessEvent(ctx, event, ip)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error processing event", "event_id", event.ID, "error", err)
+		}
+		return !decision.Accept, decision.Message
+	}
+}
+
+// Close waits for the events being judged, stops the periodic jobs and
+// closes the database.
+func (p *Pipeline) Close() error {
+	err := p.p.Close()
+	p.cancel()
+	return errors.Join(err, p.db.Close())
+}